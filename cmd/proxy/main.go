@@ -4,31 +4,48 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/admin"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/handlers"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/metrics"
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/middleware"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/redisstore"
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/tracing"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/usage"
 )
 
 var (
 	configFile    = flag.String("config", "config.yaml", "Path to configuration file")
 	multiTenant   = flag.Bool("multi-tenant", false, "Enable multi-tenant mode")
-	dbConnStr     = flag.String("db", "", "Database connection string (required for multi-tenant)")
+	dbConnStr     = flag.String("db", "", "Database connection string (multi-tenant): PostgreSQL, or sqlite:///path")
+	tenantDir     = flag.String("tenant-dir", "", "Directory of tenant YAML files (multi-tenant, instead of -db)")
 	port          = flag.Int("port", 0, "Server port (overrides config)")
 	version       = "1.0.0"
 	buildTime     = "unknown"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit" {
+		os.Exit(runVerifyAudit(os.Args[2:]))
+	}
+
 	flag.Parse()
 
 	// Setup logging
@@ -52,27 +69,157 @@ func main() {
 		cfg.Server.Port = *port
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, version)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	if cfg.Tracing.Exporter != "" {
+		log.WithField("exporter", cfg.Tracing.Exporter).Info("Tracing enabled")
+	}
+
+	// Stops background watchers on shutdown
+	watchCtx, stopWatchers := context.WithCancel(context.Background())
+	defer stopWatchers()
+
 	// Initialize tenant store
 	var tenantStore store.TenantStore
-	if *multiTenant {
+	if *multiTenant && *tenantDir != "" {
+		if *dbConnStr != "" {
+			log.Fatal("Use either -db or -tenant-dir, not both")
+		}
+		log.WithField("dir", *tenantDir).Info("Initializing multi-tenant mode with tenant files")
+		fileStore, err := store.NewFileTenantStore(*tenantDir, store.DefaultFilePollInterval)
+		if err != nil {
+			log.Fatalf("Failed to initialize file tenant store: %v", err)
+		}
+		go fileStore.RefreshSecretRefs(watchCtx, time.Duration(cfg.Secrets.RefreshInterval)*time.Second)
+		tenantStore = fileStore
+	} else if *multiTenant {
 		if *dbConnStr == "" {
-			log.Fatal("Database connection string required for multi-tenant mode")
+			log.Fatal("Database connection string or tenant directory required for multi-tenant mode")
 		}
 		log.Info("Initializing multi-tenant mode with database")
-		tenantStore, err = store.NewDatabaseTenantStore(*dbConnStr)
+		dbStore, err := store.NewDatabaseTenantStore(*dbConnStr, store.CacheOptions{
+			TTL:             time.Duration(cfg.Database.CacheTTL) * time.Second,
+			RefreshInterval: time.Duration(cfg.Database.CacheRefreshInterval) * time.Second,
+		})
 		if err != nil {
 			log.Fatalf("Failed to initialize database tenant store: %v", err)
 		}
+		keyring, err := store.LoadKeyring(cfg.Database.Encryption)
+		if err != nil {
+			log.Fatalf("Failed to load tenant secret master key: %v", err)
+		}
+		if keyring != nil {
+			dbStore.EnableEncryption(keyring)
+		} else {
+			log.Warn("No master key configured, tenant secrets are stored in cleartext")
+		}
+		dbStore.ResolveSecretRefs(cfg.Secrets.TenantSchemes)
+		go dbStore.RefreshSecretRefs(watchCtx, time.Duration(cfg.Secrets.RefreshInterval)*time.Second)
+		metrics.RegisterTenantCache("local", dbStore)
+		tenantStore = dbStore
 	} else {
 		log.Info("Initializing single-tenant mode")
-		tenantStore, err = store.NewSingleTenantStore(cfg)
+		singleStore, err := store.NewSingleTenantStore(cfg)
 		if err != nil {
 			log.Fatalf("Failed to initialize single tenant store: %v", err)
 		}
+		// Pick up rotated LRS passwords, JWT secrets and client credentials
+		go config.WatchSecrets(watchCtx, cfg, time.Duration(cfg.Secrets.RefreshInterval)*time.Second, func(refreshed *config.Config) {
+			if err := singleStore.Reload(refreshed); err != nil {
+				log.WithError(err).Error("Failed to apply refreshed secrets")
+			}
+		})
+		tenantStore = singleStore
 	}
 
+	// Token revocation, cmi5 fetch tokens, LTI launch nonces and rate limit
+	// counters are shared through Redis when configured, so every replica
+	// sees them
+	var revocations store.TokenRevocationList = store.NewMemoryRevocationList()
+	var fetchTokens store.FetchTokenStore = store.NewMemoryFetchTokenStore()
+	var ltiNonces store.NonceStore = store.NewMemoryNonceStore()
+	var rateLimiter store.RateLimiter = store.NewMemoryRateLimiter()
+	// routingStore resolves tenants for incoming requests
+	routingStore := tenantStore
+	if cfg.Redis.Host != "" {
+		log.WithField("host", cfg.Redis.Host).Info("Initializing Redis")
+		redisClient, err := redisstore.NewClient(cfg.Redis)
+		if err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		defer redisClient.Close()
+
+		revocations = redisstore.NewRevocationList(redisClient)
+		ltiNonces = redisstore.NewNonceStore(redisClient)
+		rateLimiter = redisstore.NewRateLimiter(redisClient)
+		fetchTokens, err = redisstore.NewFetchTokenStore(redisClient, cfg.Redis.EncryptionKey)
+		if err != nil {
+			log.Fatalf("Failed to initialize Redis fetch tokens: %v", err)
+		}
+
+		if dbStore, ok := tenantStore.(*store.DatabaseTenantStore); ok {
+			redisTenants, err := redisstore.NewTenantStore(dbStore, redisClient,
+				time.Duration(cfg.Redis.CacheTTL)*time.Second, cfg.Redis.EncryptionKey)
+			if err != nil {
+				log.Fatalf("Failed to initialize Redis tenant cache: %v", err)
+			}
+			dbStore.OnInvalidate(redisTenants.Invalidate)
+			metrics.RegisterTenantCache("redis", redisTenants)
+			routingStore = redisTenants
+		}
+	}
+
+	// Audit events go to the tenant database, or to a file without one
+	var auditSink audit.Sink
+	if dbStore, ok := tenantStore.(*store.DatabaseTenantStore); ok {
+		auditSink = dbStore
+	} else if cfg.Audit.File != "" {
+		fileSink, err := audit.OpenFileSink(cfg.Audit.File)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer fileSink.Close()
+		auditSink = fileSink
+	}
+	var auditor audit.Recorder = audit.Discard
+	var auditWriter *audit.Writer
+	if auditSink != nil {
+		auditWriter = audit.NewWriter(auditSink, audit.Options{
+			BufferSize:    cfg.Audit.BufferSize,
+			BatchSize:     cfg.Audit.BatchSize,
+			FlushInterval: time.Duration(cfg.Audit.FlushInterval) * time.Second,
+		})
+		auditor = auditWriter
+	} else {
+		log.Warn("No audit log configured, audit events are discarded")
+	}
+	var checkpointer *audit.Checkpointer
+	if dbStore, ok := auditSink.(*store.DatabaseTenantStore); ok && cfg.Audit.SigningKey != "" {
+		key, err := audit.ParseSigningKey(cfg.Audit.SigningKey)
+		if err != nil {
+			log.Fatalf("Invalid audit.signing_key: %v", err)
+		}
+		checkpointer = audit.NewCheckpointer(dbStore, key)
+		log.WithField("public_key", audit.PublicKeyString(key)).Info("Audit checkpoints enabled")
+		go checkpointer.Run(watchCtx, time.Duration(cfg.Audit.CheckpointInterval)*time.Second)
+	}
+
+	// Usage is metered into hourly totals in the tenant database, which
+	// quotas are checked against
+	var usageStore usage.Store
+	if dbStore, ok := tenantStore.(*store.DatabaseTenantStore); ok {
+		usageStore = dbStore
+	} else {
+		log.Warn("No tenant database configured, usage is metered in memory only")
+	}
+	meter := usage.NewMeter(usageStore)
+	meter.Flush(context.Background()) // Loads month-to-date totals
+	go meter.Run(watchCtx, time.Duration(cfg.Usage.FlushInterval)*time.Second)
+
 	// Initialize handlers
-	h := handlers.New(tenantStore)
+	h := handlers.New(tenantStore, revocations, fetchTokens, ltiNonces, auditor, meter)
 
 	// Setup router
 	r := mux.NewRouter()
@@ -83,16 +230,47 @@ func main() {
 		fmt.Fprintf(w, `{"status":"ok","version":"%s"}`, version)
 	}).Methods("GET")
 
+	// Requests are mapped to tenants by host unless configured otherwise
+	var tenantResolver middleware.TenantResolver = middleware.HostResolver(routingStore)
+	if *multiTenant {
+		tenantResolver, err = middleware.NewTenantResolver(routingStore, cfg.TenantResolution)
+		if err != nil {
+			log.Fatalf("Invalid tenant_resolution configuration: %v", err)
+		}
+		log.WithField("order", cfg.TenantResolution.Order).Info("Tenant resolution configured")
+	}
+
 	// Auth API (LMS-facing) - requires LMS API key
 	authRouter := r.PathPrefix("/auth").Subrouter()
-	authRouter.Use(middleware.TenantMiddleware(tenantStore))
-	authRouter.Use(middleware.LMSAuthMiddleware)
+	authRouter.Use(middleware.TenantMiddleware(tenantResolver))
+	authRouter.Use(middleware.LMSAuthMiddleware(tenantStore, auditor))
+	authRouter.Use(middleware.RateLimitMiddleware(rateLimiter))
 	authRouter.HandleFunc("/token", h.IssueToken).Methods("POST")
 
+	// OAuth 2.0 token endpoint (LMS-facing) - client authenticates in the request
+	oauthRouter := r.PathPrefix("/oauth").Subrouter()
+	oauthRouter.Use(middleware.TenantMiddleware(tenantResolver))
+	oauthRouter.Use(middleware.RateLimitMiddleware(rateLimiter))
+	oauthRouter.HandleFunc("/token", h.OAuthToken).Methods("POST")
+
+	// cmi5 fetch URL (content-facing) - the single-use ID authenticates
+	fetchRouter := r.PathPrefix("/fetch").Subrouter()
+	fetchRouter.Use(middleware.TenantMiddleware(tenantResolver))
+	fetchRouter.Use(middleware.RateLimitMiddleware(rateLimiter))
+	fetchRouter.HandleFunc("/{id}", h.FetchToken).Methods("POST")
+
+	// LTI 1.3 tool (platform-facing) - platform id_token authenticates the launch
+	ltiRouter := r.PathPrefix("/lti").Subrouter()
+	ltiRouter.Use(middleware.TenantMiddleware(tenantResolver))
+	ltiRouter.Use(middleware.RateLimitMiddleware(rateLimiter))
+	ltiRouter.HandleFunc("/login", h.LTILogin).Methods("GET", "POST")
+	ltiRouter.HandleFunc("/launch", h.LTILaunch).Methods("POST")
+
 	// xAPI Proxy (content-facing) - requires JWT
 	xapiRouter := r.PathPrefix("/xapi").Subrouter()
-	xapiRouter.Use(middleware.TenantMiddleware(tenantStore))
-	xapiRouter.Use(middleware.JWTAuthMiddleware)
+	xapiRouter.Use(middleware.TenantMiddleware(tenantResolver))
+	xapiRouter.Use(middleware.JWTAuthMiddleware(revocations, auditor))
+	xapiRouter.Use(middleware.RateLimitMiddleware(rateLimiter))
 	xapiRouter.HandleFunc("/statements", h.ProxyStatements).Methods("POST", "PUT", "GET")
 	xapiRouter.HandleFunc("/activities/state", h.ProxyState).Methods("POST", "PUT", "GET", "DELETE")
 	xapiRouter.HandleFunc("/activities/profile", h.ProxyActivityProfile).Methods("POST", "PUT", "GET", "DELETE")
@@ -101,24 +279,36 @@ func main() {
 
 	// Admin API (if multi-tenant)
 	if *multiTenant {
-		adminRouter := r.PathPrefix("/admin").Subrouter()
-		adminRouter.Use(middleware.AdminAuthMiddleware)
-		adminRouter.HandleFunc("/tenants", h.CreateTenant).Methods("POST")
-		adminRouter.HandleFunc("/tenants", h.ListTenants).Methods("GET")
-		adminRouter.HandleFunc("/tenants/{id}", h.GetTenant).Methods("GET")
-		adminRouter.HandleFunc("/tenants/{id}", h.UpdateTenant).Methods("PUT")
-		adminRouter.HandleFunc("/tenants/{id}", h.DeleteTenant).Methods("DELETE")
+		adminAuth, err := admin.NewAuthenticator(cfg.Admin)
+		if err != nil {
+			log.Fatalf("Failed to initialize admin authentication: %v", err)
+		}
+		// Tenant files are managed outside the proxy, so the admin API is
+		// optional there; without credentials it rejects every request
+		if !adminAuth.Enabled() && *tenantDir == "" {
+			log.Fatal("Multi-tenant mode requires admin.principals or admin.oidc in configuration")
+		}
+
+		h.AdminRoutes(r.PathPrefix("/admin").Subrouter(), adminAuth)
 	}
 
 	// Apply logging middleware to all routes
 	r.Use(middleware.LoggingMiddleware)
+	r.Use(middleware.MetricsMiddleware)
+	r.Use(middleware.TracingMiddleware)
 	r.Use(middleware.CORSMiddleware)
 
+	// Tenant path prefixes are stripped before routing
+	var handler http.Handler = r
+	if *multiTenant && slices.Contains(cfg.TenantResolution.Order, "path") {
+		handler = middleware.TenantPathPrefix(cfg.TenantResolution.PathPrefix)(r)
+	}
+
 	// Create server
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
 	srv := &http.Server{
 		Addr:         addr,
-		Handler:      r,
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -132,6 +322,28 @@ func main() {
 		}
 	}()
 
+	// Metrics are served on their own listener, so they need not be exposed
+	// publicly
+	var metricsSrv *http.Server
+	if cfg.Metrics.Port > 0 {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle(cfg.Metrics.Path, metrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:        net.JoinHostPort(cfg.Metrics.Host, strconv.Itoa(cfg.Metrics.Port)),
+			Handler:     metricsMux,
+			ReadTimeout: 15 * time.Second,
+		}
+		go func() {
+			log.WithFields(log.Fields{
+				"addr": metricsSrv.Addr,
+				"path": cfg.Metrics.Path,
+			}).Info("Starting metrics server")
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Metrics server failed: %v", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -146,6 +358,27 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(ctx)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.WithError(err).Warn("Failed to flush traces")
+	}
+
+	// Write queued audit events before the store closes
+	if auditWriter != nil {
+		auditWriter.Close()
+	}
+	if checkpointer != nil {
+		checkpointer.Checkpoint(context.Background())
+	}
+	meter.Flush(context.Background())
+
+	if closer, ok := tenantStore.(interface{ Close() error }); ok {
+		if err := closer.Close(); err != nil {
+			log.WithError(err).Warn("Failed to close tenant store")
+		}
+	}
 
 	log.Info("Server stopped")
 }
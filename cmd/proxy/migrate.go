@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+const migrateUsage = `Usage: xapi-proxy migrate -db CONNSTR up|down [N]|status
+
+  up       apply every pending migration
+  down N   roll back the latest N migrations (default 1)
+  status   list migrations and when they were applied
+`
+
+// runMigrate implements the migrate subcommand and returns the exit code
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	connStr := fs.String("db", "", "Database connection string: PostgreSQL, or sqlite:///path")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Give up after this long")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *connStr == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	m, err := store.OpenMigrator(*connStr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		return 1
+	}
+	defer m.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch cmd := fs.Arg(0); cmd {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Printf("applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Printf("schema is up to date at version %d\n", m.LatestVersion())
+		}
+	case "down":
+		steps := 1
+		if fs.NArg() > 1 {
+			steps, err = strconv.Atoi(fs.Arg(1))
+			if err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "migrate: invalid step count %q\n", fs.Arg(1))
+				return 2
+			}
+		}
+		rolledBack, err := m.Down(ctx, steps)
+		for _, mig := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			return 1
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("no migrations to roll back")
+		}
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		w.Flush()
+	default:
+		fmt.Fprintf(os.Stderr, "migrate: unknown command %q\n", cmd)
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
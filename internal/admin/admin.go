@@ -0,0 +1,198 @@
+package admin
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/jwks"
+)
+
+// Role is an admin API role
+type Role string
+
+const (
+	// RoleSuperAdmin may perform every admin action on every tenant
+	RoleSuperAdmin Role = "super-admin"
+	// RoleTenantAdmin may read and manage a single tenant
+	RoleTenantAdmin Role = "tenant-admin"
+	// RoleAuditor may read every tenant but change nothing
+	RoleAuditor Role = "auditor"
+)
+
+// Access is the level of access an admin route requires
+type Access int
+
+const (
+	// AccessRead reads tenant data
+	AccessRead Access = iota
+	// AccessWrite changes data within a tenant
+	AccessWrite
+	// AccessManage creates, lists or deletes tenants
+	AccessManage
+)
+
+// ErrUnauthenticated is returned when admin credentials are not recognized
+var ErrUnauthenticated = errors.New("invalid admin credentials")
+
+// Principal is an authenticated admin
+type Principal struct {
+	Name     string `json:"name"`
+	Role     Role   `json:"role"`
+	TenantID string `json:"tenant_id,omitempty"` // Set for tenant-admin
+}
+
+// Can reports whether the principal has the given access. tenantID is the
+// tenant the route addresses, or "" for routes that span tenants.
+func (p *Principal) Can(access Access, tenantID string) bool {
+	switch p.Role {
+	case RoleSuperAdmin:
+		return true
+	case RoleAuditor:
+		return access == AccessRead
+	case RoleTenantAdmin:
+		return access != AccessManage && tenantID != "" && tenantID == p.TenantID
+	}
+	return false
+}
+
+// validateRole checks a role and its tenant scope
+func validateRole(role Role, tenantID string) error {
+	switch role {
+	case RoleSuperAdmin, RoleAuditor:
+		return nil
+	case RoleTenantAdmin:
+		if tenantID == "" {
+			return fmt.Errorf("tenant-admin requires a tenant ID")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown admin role: %q", role)
+}
+
+// tokenPrincipal is a principal identified by a static bearer token
+type tokenPrincipal struct {
+	hash      []byte
+	principal *Principal
+}
+
+// oidcVerifier verifies admin JWTs from an OIDC provider
+type oidcVerifier struct {
+	issuer      string
+	audience    string
+	keys        *jwks.KeySet
+	roleClaim   string
+	tenantClaim string
+}
+
+// Authenticator authenticates admin bearer credentials
+type Authenticator struct {
+	tokens []tokenPrincipal
+	oidc   *oidcVerifier
+}
+
+// NewAuthenticator builds an authenticator from configuration
+func NewAuthenticator(cfg config.AdminConfig) (*Authenticator, error) {
+	a := &Authenticator{}
+
+	for i, p := range cfg.Principals {
+		if p.Name == "" {
+			return nil, fmt.Errorf("admin.principals[%d]: name is required", i)
+		}
+		hash, err := hex.DecodeString(p.TokenHash)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("admin.principals[%d]: token_hash must be a hex SHA-256 digest", i)
+		}
+		role := Role(p.Role)
+		if err := validateRole(role, p.TenantID); err != nil {
+			return nil, fmt.Errorf("admin.principals[%d]: %w", i, err)
+		}
+		a.tokens = append(a.tokens, tokenPrincipal{
+			hash:      hash,
+			principal: &Principal{Name: p.Name, Role: role, TenantID: p.TenantID},
+		})
+	}
+
+	if cfg.OIDC != nil {
+		if cfg.OIDC.Issuer == "" || cfg.OIDC.Audience == "" || cfg.OIDC.JWKSFile == "" {
+			return nil, fmt.Errorf("admin.oidc: issuer, audience and jwks_file are required")
+		}
+		keys, err := jwks.LoadFile(cfg.OIDC.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("admin.oidc: %w", err)
+		}
+		v := &oidcVerifier{
+			issuer:      cfg.OIDC.Issuer,
+			audience:    cfg.OIDC.Audience,
+			keys:        keys,
+			roleClaim:   cfg.OIDC.RoleClaim,
+			tenantClaim: cfg.OIDC.TenantClaim,
+		}
+		if v.roleClaim == "" {
+			v.roleClaim = "role"
+		}
+		if v.tenantClaim == "" {
+			v.tenantClaim = "tenant_id"
+		}
+		a.oidc = v
+	}
+
+	return a, nil
+}
+
+// Enabled reports whether any admin credentials are configured
+func (a *Authenticator) Enabled() bool {
+	return len(a.tokens) > 0 || a.oidc != nil
+}
+
+// Authenticate resolves a bearer credential to a principal. Static tokens
+// are compared by hash in constant time; anything else must be a valid
+// JWT from the configured OIDC issuer.
+func (a *Authenticator) Authenticate(credential string) (*Principal, error) {
+	sum := sha256.Sum256([]byte(credential))
+	var match *Principal
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(sum[:], t.hash) == 1 {
+			match = t.principal
+		}
+	}
+	if match != nil {
+		return match, nil
+	}
+
+	if a.oidc != nil {
+		return a.oidc.verify(credential)
+	}
+	return nil, ErrUnauthenticated
+}
+
+// verify validates an OIDC JWT and maps its claims to a principal
+func (v *oidcVerifier) verify(tokenString string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, v.keys.Keyfunc,
+		jwt.WithValidMethods(jwks.SigningMethods),
+		jwt.WithIssuer(v.issuer),
+		jwt.WithAudience(v.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	subject, _ := claims["sub"].(string)
+	role, _ := claims[v.roleClaim].(string)
+	tenantID, _ := claims[v.tenantClaim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: sub claim is required", ErrUnauthenticated)
+	}
+	if err := validateRole(Role(role), tenantID); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	return &Principal{Name: subject, Role: Role(role), TenantID: tenantID}, nil
+}
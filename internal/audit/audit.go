@@ -0,0 +1,262 @@
+// Package audit records security-relevant events: token issuance, access
+// decisions on learner records and admin API requests. Events are queued
+// without blocking the request and written to a Sink in batches.
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Operations recorded in the audit log
+const (
+	OpTokenIssue      = "token_issue"
+	OpAuthenticate    = "authenticate"
+	OpStatementsWrite = "statements_write"
+	OpStatementsRead  = "statements_read"
+	OpStateAccess     = "state_access"
+	OpActivityProfile = "activity_profile"
+	OpAgentProfile    = "agent_profile"
+	OpAdminAction     = "admin_action"
+)
+
+// Event is one audit record
+type Event struct {
+	TenantID        string    `json:"tenant_id,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+	Operation       string    `json:"operation"`
+	ActorMbox       string    `json:"actor_mbox,omitempty"` // See models.Actor.Identifier
+	Registration    string    `json:"registration,omitempty"`
+	ActivityID      string    `json:"activity_id,omitempty"`
+	PermissionWrite string    `json:"permission_write,omitempty"`
+	PermissionRead  string    `json:"permission_read,omitempty"`
+	Success         bool      `json:"success"`
+	Reason          string    `json:"reason,omitempty"` // Why the request was denied or failed
+	IPAddress       string    `json:"ip_address,omitempty"`
+	UserAgent       string    `json:"user_agent,omitempty"`
+	AdminPrincipal  string    `json:"admin_principal,omitempty"`
+	AdminRole       string    `json:"admin_role,omitempty"`
+	RequestMethod   string    `json:"request_method,omitempty"`
+	RequestPath     string    `json:"request_path,omitempty"`
+}
+
+// NewEvent starts a successful event for a request
+func NewEvent(r *http.Request, tenantID, operation string) *Event {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	return &Event{
+		TenantID:      tenantID,
+		Timestamp:     time.Now().UTC(),
+		Operation:     operation,
+		Success:       true,
+		IPAddress:     ip,
+		UserAgent:     r.UserAgent(),
+		RequestMethod: r.Method,
+		RequestPath:   r.URL.Path,
+	}
+}
+
+// Deny marks the event as refused for reason
+func (e *Event) Deny(reason string) *Event {
+	e.Success = false
+	e.Reason = reason
+	return e
+}
+
+// Recorder accepts audit events
+type Recorder interface {
+	Record(e *Event)
+}
+
+// Discard is a Recorder that drops every event
+var Discard Recorder = discard{}
+
+type discard struct{}
+
+func (discard) Record(*Event) {}
+
+// Sink stores batches of events
+type Sink interface {
+	WriteAuditEvents(ctx context.Context, events []*Event) error
+}
+
+// Options tunes a Writer
+type Options struct {
+	BufferSize    int           // Events queued before new ones are dropped; default 10000
+	BatchSize     int           // Events per sink write; default 100
+	FlushInterval time.Duration // Longest an event waits for a full batch; default 1s
+}
+
+// setDefaults fills unset options
+func (o *Options) setDefaults() {
+	if o.BufferSize <= 0 {
+		o.BufferSize = 10000
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Second
+	}
+}
+
+// Stats reports a Writer's throughput and backpressure
+type Stats struct {
+	Buffered int    `json:"buffered"` // Events waiting to be written
+	Capacity int    `json:"capacity"`
+	Recorded uint64 `json:"recorded"` // Events accepted into the buffer
+	Written  uint64 `json:"written"`
+	Dropped  uint64 `json:"dropped"` // Events refused because the buffer was full
+	Failed   uint64 `json:"failed"`  // Events lost to sink errors
+	Batches  uint64 `json:"batches"`
+}
+
+// Writer is a Recorder that buffers events and writes them to a sink in
+// batches from a background goroutine. Record never blocks: when the sink
+// falls behind and the buffer fills, events are dropped and counted.
+type Writer struct {
+	sink   Sink
+	opts   Options
+	events chan *Event
+	closed atomic.Bool
+	stop   chan struct{}
+	done   chan struct{}
+
+	recorded, written, dropped, failed, batches atomic.Uint64
+
+	warnMu     sync.Mutex
+	lastWarned time.Time
+}
+
+// NewWriter starts a Writer for sink
+func NewWriter(sink Sink, opts Options) *Writer {
+	opts.setDefaults()
+	w := &Writer{
+		sink:   sink,
+		opts:   opts,
+		events: make(chan *Event, opts.BufferSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Record queues an event
+func (w *Writer) Record(e *Event) {
+	if w.closed.Load() {
+		w.drop()
+		return
+	}
+	select {
+	case w.events <- e:
+		w.recorded.Add(1)
+	default:
+		w.drop()
+	}
+}
+
+// drop counts a lost event and warns at most once a minute
+func (w *Writer) drop() {
+	dropped := w.dropped.Add(1)
+
+	w.warnMu.Lock()
+	defer w.warnMu.Unlock()
+	if time.Since(w.lastWarned) < time.Minute {
+		return
+	}
+	w.lastWarned = time.Now()
+	log.WithFields(log.Fields{
+		"dropped":  dropped,
+		"capacity": w.opts.BufferSize,
+	}).Warn("Audit buffer full, dropping audit events")
+}
+
+// Stats returns counters since startup
+func (w *Writer) Stats() Stats {
+	return Stats{
+		Buffered: len(w.events),
+		Capacity: w.opts.BufferSize,
+		Recorded: w.recorded.Load(),
+		Written:  w.written.Load(),
+		Dropped:  w.dropped.Load(),
+		Failed:   w.failed.Load(),
+		Batches:  w.batches.Load(),
+	}
+}
+
+// Close stops accepting events and writes those already queued
+func (w *Writer) Close() error {
+	if w.closed.Swap(true) {
+		return nil
+	}
+	close(w.stop)
+	<-w.done
+	return nil
+}
+
+// run collects batches until Close, then drains the buffer
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Event, 0, w.opts.BatchSize)
+	for {
+		select {
+		case e := <-w.events:
+			batch = append(batch, e)
+			if len(batch) >= w.opts.BatchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case <-w.stop:
+			for {
+				select {
+				case e := <-w.events:
+					batch = append(batch, e)
+					if len(batch) >= w.opts.BatchSize {
+						batch = w.flush(batch)
+					}
+				default:
+					w.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes a batch and returns the emptied slice
+func (w *Writer) flush(batch []*Event) []*Event {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w.batches.Add(1)
+	if err := w.sink.WriteAuditEvents(ctx, batch); err != nil {
+		w.failed.Add(uint64(len(batch)))
+		log.WithFields(log.Fields{
+			"events": len(batch),
+			"error":  err.Error(),
+		}).Error("Failed to write audit events")
+	} else {
+		w.written.Add(uint64(len(batch)))
+	}
+
+	clear(batch)
+	return batch[:0]
+}
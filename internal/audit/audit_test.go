@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSink records the batches written to it. While gate is set, writes
+// signal entered and wait for gate to be closed.
+type testSink struct {
+	mu      sync.Mutex
+	batches [][]*Event
+	err     error
+	entered chan struct{}
+	gate    chan struct{}
+	written chan struct{}
+}
+
+func newTestSink() *testSink {
+	return &testSink{written: make(chan struct{}, 100)}
+}
+
+func (s *testSink) WriteAuditEvents(ctx context.Context, events []*Event) error {
+	if s.gate != nil {
+		s.entered <- struct{}{}
+		<-s.gate
+	}
+	s.mu.Lock()
+	// The writer reuses the slice, so keep a copy
+	s.batches = append(s.batches, append([]*Event(nil), events...))
+	s.mu.Unlock()
+	s.written <- struct{}{}
+	return s.err
+}
+
+// sizes returns the size of each batch written so far
+func (s *testSink) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sizes []int
+	for _, b := range s.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+// wait blocks until a batch has been written
+func (s *testSink) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-s.written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch written")
+	}
+}
+
+func TestWriterFlushesFullBatches(t *testing.T) {
+	sink := newTestSink()
+	w := NewWriter(sink, Options{BatchSize: 3, FlushInterval: time.Hour})
+	for i := 0; i < 5; i++ {
+		w.Record(&Event{Operation: OpTokenIssue})
+	}
+	sink.wait(t)
+	if sizes := sink.sizes(); len(sizes) != 1 || sizes[0] != 3 {
+		t.Errorf("batches before Close = %v, want one of 3", sizes)
+	}
+
+	// Close writes the partial batch
+	w.Close()
+	if sizes := sink.sizes(); len(sizes) != 2 || sizes[1] != 2 {
+		t.Errorf("batches after Close = %v, want 3 then 2", sizes)
+	}
+	if stats := w.Stats(); stats.Recorded != 5 || stats.Written != 5 || stats.Batches != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestWriterFlushesOnInterval(t *testing.T) {
+	sink := newTestSink()
+	w := NewWriter(sink, Options{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	defer w.Close()
+
+	w.Record(&Event{Operation: OpTokenIssue})
+	sink.wait(t)
+	if sizes := sink.sizes(); len(sizes) != 1 || sizes[0] != 1 {
+		t.Errorf("batches = %v, want the event flushed alone", sizes)
+	}
+}
+
+func TestWriterDropsWhenFull(t *testing.T) {
+	sink := newTestSink()
+	sink.entered = make(chan struct{}, 10)
+	sink.gate = make(chan struct{})
+	w := NewWriter(sink, Options{BufferSize: 2, BatchSize: 1, FlushInterval: time.Hour})
+
+	// The first event is taken from the buffer and its write blocks, then
+	// two more fill the buffer and the rest are dropped
+	w.Record(&Event{Operation: OpTokenIssue})
+	<-sink.entered
+	for i := 0; i < 4; i++ {
+		w.Record(&Event{Operation: OpTokenIssue})
+	}
+	if stats := w.Stats(); stats.Recorded != 3 || stats.Dropped != 2 || stats.Buffered != 2 || stats.Capacity != 2 {
+		t.Errorf("stats with the sink blocked = %+v, want 3 recorded, 2 dropped and 2 buffered", stats)
+	}
+
+	close(sink.gate)
+	w.Close()
+	if stats := w.Stats(); stats.Written != 3 || stats.Dropped != 2 || stats.Buffered != 0 {
+		t.Errorf("stats after Close = %+v, want 3 written and 2 dropped", stats)
+	}
+}
+
+func TestWriterCloseDrainsOnce(t *testing.T) {
+	sink := newTestSink()
+	w := NewWriter(sink, Options{BatchSize: 100, FlushInterval: time.Hour})
+	queued := make(map[*Event]bool)
+	for i := 0; i < 5; i++ {
+		e := &Event{Operation: OpTokenIssue}
+		queued[e] = true
+		w.Record(e)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+	w.Record(&Event{Operation: OpTokenIssue})
+
+	seen := make(map[*Event]int)
+	for _, batch := range sink.batches {
+		for _, e := range batch {
+			seen[e]++
+		}
+	}
+	for e := range queued {
+		if seen[e] != 1 {
+			t.Errorf("queued event written %d times, want once", seen[e])
+		}
+	}
+	if len(seen) != len(queued) {
+		t.Errorf("%d events written, want the %d queued", len(seen), len(queued))
+	}
+	if stats := w.Stats(); stats.Written != 5 || stats.Dropped != 1 || stats.Batches != 1 {
+		t.Errorf("stats = %+v, want 5 written in one batch and the late event dropped", stats)
+	}
+}
+
+func TestWriterCountsFailedWrites(t *testing.T) {
+	sink := newTestSink()
+	sink.err = errors.New("database unavailable")
+	w := NewWriter(sink, Options{BatchSize: 2, FlushInterval: time.Hour})
+	for i := 0; i < 3; i++ {
+		w.Record(&Event{Operation: OpTokenIssue})
+	}
+	w.Close()
+	if stats := w.Stats(); stats.Failed != 3 || stats.Written != 0 || stats.Batches != 2 {
+		t.Errorf("stats = %+v, want 3 failed in 2 batches", stats)
+	}
+}
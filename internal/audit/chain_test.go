@@ -0,0 +1,222 @@
+package audit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testChain builds a valid chain of n records with IDs from 1
+func testChain(chainID string, n int) []*Record {
+	var records []*Record
+	prev := ""
+	for i := 1; i <= n; i++ {
+		rec := &Record{
+			ID: int64(i),
+			Event: Event{
+				TenantID:  chainID,
+				Timestamp: time.Date(2026, 10, 1, 12, 0, i, 0, time.UTC),
+				Operation: OpStatementsRead,
+				ActorMbox: "mailto:learner@example.com",
+				Success:   true,
+				IPAddress: "192.0.2.1",
+			},
+			ChainID:  chainID,
+			PrevHash: prev,
+		}
+		rec.Hash = ChainHash(chainID, prev, &rec.Event)
+		prev = rec.Hash
+		records = append(records, rec)
+	}
+	return records
+}
+
+// verifyChain feeds records to a verifier, returning the first break
+func verifyChain(t *testing.T, requireGenesis bool, records ...*Record) *ChainBreak {
+	t.Helper()
+	v := NewChainVerifier(requireGenesis)
+	for _, rec := range records {
+		if err := v.Add(rec); err != nil {
+			var chainBreak *ChainBreak
+			if !errors.As(err, &chainBreak) {
+				t.Fatalf("Add: %v", err)
+			}
+			return chainBreak
+		}
+	}
+	return nil
+}
+
+func TestChainHash(t *testing.T) {
+	e := &Event{Timestamp: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), Operation: OpTokenIssue}
+	hash := ChainHash("acme", "", e)
+	if len(hash) != 64 {
+		t.Errorf("hash = %q, want hex SHA-256", hash)
+	}
+	// The same instant in another zone hashes the same
+	local := *e
+	local.Timestamp = e.Timestamp.In(time.FixedZone("UTC+2", 2*60*60))
+	if ChainHash("acme", "", &local) != hash {
+		t.Error("hash depends on the timestamp's zone")
+	}
+	if ChainHash("globex", "", e) == hash || ChainHash("acme", hash, e) == hash {
+		t.Error("hash ignores the chain or the previous hash")
+	}
+	// Fields are delimited, so moving text between them changes the hash
+	a := &Event{Timestamp: e.Timestamp, ActorMbox: "ab", Registration: "c"}
+	b := &Event{Timestamp: e.Timestamp, ActorMbox: "a", Registration: "bc"}
+	if ChainHash("acme", "", a) == ChainHash("acme", "", b) {
+		t.Error("hash doesn't separate fields")
+	}
+}
+
+func TestChainVerifier(t *testing.T) {
+	tests := []struct {
+		name           string
+		records        func() []*Record
+		requireGenesis bool
+		wantBreak      int64  // ID of the first broken record; 0 for none
+		wantReason     string // Substring of the break reason
+	}{
+		{
+			name:           "intact chain",
+			records:        func() []*Record { return testChain("acme", 4) },
+			requireGenesis: true,
+		},
+		{
+			name: "tampered field",
+			records: func() []*Record {
+				records := testChain("acme", 4)
+				records[1].Success = false
+				return records
+			},
+			requireGenesis: true,
+			wantBreak:      2,
+			wantReason:     "altered record",
+		},
+		{
+			name: "tampered field with its hash recomputed",
+			records: func() []*Record {
+				records := testChain("acme", 4)
+				records[1].ActorMbox = "mailto:someone-else@example.com"
+				records[1].Hash = ChainHash("acme", records[1].PrevHash, &records[1].Event)
+				return records
+			},
+			requireGenesis: true,
+			wantBreak:      3,
+			wantReason:     "deleted or reordered",
+		},
+		{
+			name: "deleted record",
+			records: func() []*Record {
+				records := testChain("acme", 4)
+				return append(records[:1], records[2:]...)
+			},
+			requireGenesis: true,
+			wantBreak:      3,
+			wantReason:     "deleted or reordered",
+		},
+		{
+			name:           "deleted first record",
+			records:        func() []*Record { return testChain("acme", 4)[1:] },
+			requireGenesis: true,
+			wantBreak:      2,
+			wantReason:     "does not start at its first record",
+		},
+		{
+			name:    "range of a chain",
+			records: func() []*Record { return testChain("acme", 4)[1:] },
+		},
+		{
+			name: "reordered records",
+			records: func() []*Record {
+				records := testChain("acme", 4)
+				// Swap the content of records 2 and 3, keeping IDs ascending
+				records[1].ID, records[2].ID = 3, 2
+				records[1], records[2] = records[2], records[1]
+				return records
+			},
+			requireGenesis: true,
+			wantBreak:      2,
+			wantReason:     "deleted or reordered",
+		},
+		{
+			name: "records fed out of ID order",
+			records: func() []*Record {
+				records := testChain("acme", 4)
+				return []*Record{records[0], records[2], records[1]}
+			},
+			requireGenesis: true,
+			wantBreak:      3,
+			wantReason:     "deleted or reordered",
+		},
+		{
+			name: "repeated ID",
+			records: func() []*Record {
+				records := testChain("acme", 2)
+				return []*Record{records[0], records[1], records[1]}
+			},
+			requireGenesis: true,
+			wantBreak:      2,
+			wantReason:     "out of order",
+		},
+		{
+			name: "unchained record inside the chain",
+			records: func() []*Record {
+				records := testChain("acme", 3)
+				records[1].Hash, records[1].PrevHash = "", ""
+				return records
+			},
+			requireGenesis: true,
+			wantBreak:      2,
+			wantReason:     "no hash",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chainBreak := verifyChain(t, tt.requireGenesis, tt.records()...)
+			if tt.wantBreak == 0 {
+				if chainBreak != nil {
+					t.Errorf("unexpected break: %v", chainBreak)
+				}
+				return
+			}
+			if chainBreak == nil || chainBreak.ID != tt.wantBreak || !strings.Contains(chainBreak.Reason, tt.wantReason) {
+				t.Errorf("break = %v, want record %d: %s", chainBreak, tt.wantBreak, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestChainVerifierChains(t *testing.T) {
+	// Records written before chaining precede the chain; chains are
+	// verified independently however their records interleave
+	legacy := &Record{ID: 1, Event: Event{Operation: OpTokenIssue}, ChainID: "acme"}
+	acme, globex := testChain("acme", 3), testChain("globex", 2)
+	for i, rec := range acme {
+		rec.ID = int64(2 + 2*i)
+	}
+	for i, rec := range globex {
+		rec.ID = int64(3 + 2*i)
+	}
+
+	v := NewChainVerifier(true)
+	v.Watch(acme[2].ID)
+	v.Watch(100)
+	for _, rec := range []*Record{legacy, acme[0], globex[0], acme[1], globex[1], acme[2]} {
+		if err := v.Add(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v.Verified != 5 || v.Unchained != 1 {
+		t.Errorf("verified %d and unchained %d, want 5 and 1", v.Verified, v.Unchained)
+	}
+	if hash, ok := v.Hash(acme[2].ID); !ok || hash != acme[2].Hash {
+		t.Errorf("watched hash = %q, %v; want the record's hash", hash, ok)
+	}
+	if _, ok := v.Hash(100); ok {
+		t.Error("hash of a record never seen was reported")
+	}
+}
@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCheckpointSignature(t *testing.T) {
+	seed := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{9}, ed25519.SeedSize))
+	key, err := ParseSigningKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := key.Public().(ed25519.PublicKey)
+
+	signed := func() *Checkpoint {
+		cp := &Checkpoint{
+			ChainID:   "acme",
+			AuditID:   42,
+			Hash:      ChainHash("acme", "", &Event{Operation: OpTokenIssue}),
+			CreatedAt: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		}
+		cp.Sign(key)
+		return cp
+	}
+	if !signed().Verify(public) {
+		t.Fatal("signed checkpoint does not verify")
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	tests := map[string]func(cp *Checkpoint){
+		"other chain":  func(cp *Checkpoint) { cp.ChainID = "globex" },
+		"other record": func(cp *Checkpoint) { cp.AuditID = 41 },
+		"other hash":   func(cp *Checkpoint) { cp.Hash = ChainHash("acme", "", &Event{}) },
+		"other time":   func(cp *Checkpoint) { cp.CreatedAt = cp.CreatedAt.Add(time.Second) },
+		"other signer": func(cp *Checkpoint) { cp.Sign(otherKey) },
+		"garbled":      func(cp *Checkpoint) { cp.Signature = "not base64!" },
+		"no signature": func(cp *Checkpoint) { cp.Signature = "" },
+		"truncated":    func(cp *Checkpoint) { cp.Signature = cp.Signature[:20] },
+	}
+	for name, tamper := range tests {
+		cp := signed()
+		tamper(cp)
+		if cp.Verify(public) {
+			t.Errorf("%s: tampered checkpoint verified", name)
+		}
+	}
+
+	for _, bad := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParseSigningKey(bad); err == nil {
+			t.Errorf("ParseSigningKey(%q) succeeded", bad)
+		}
+	}
+}
@@ -1,20 +1,100 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Mode     string         `yaml:"mode"` // "single-tenant" or "multi-tenant"
-	Server   ServerConfig   `yaml:"server"`
-	LRS      LRSConfig      `yaml:"lrs,omitempty"`      // Single-tenant only
-	Auth     AuthConfig     `yaml:"auth,omitempty"`     // Single-tenant only
-	Database DatabaseConfig `yaml:"database,omitempty"` // Multi-tenant only
-	Redis    RedisConfig    `yaml:"redis,omitempty"`    // Optional caching
+	Mode       string           `yaml:"mode"` // "single-tenant" or "multi-tenant"
+	Server     ServerConfig     `yaml:"server"`
+	LRS        LRSConfig        `yaml:"lrs,omitempty"`         // Single-tenant only
+	Auth       AuthConfig       `yaml:"auth,omitempty"`        // Single-tenant only
+	Database   DatabaseConfig   `yaml:"database,omitempty"`    // Multi-tenant only
+	Redis      RedisConfig      `yaml:"redis,omitempty"`       // Optional caching
+	LTI        LTIConfig        `yaml:"lti,omitempty"`         // Single-tenant only
+	RateLimits RateLimitsConfig `yaml:"rate_limits,omitempty"` // Single-tenant only
+	Quotas     QuotasConfig     `yaml:"quotas,omitempty"`      // Single-tenant only
+	Admin      AdminConfig      `yaml:"admin,omitempty"`       // Multi-tenant admin API
+	Secrets    SecretsConfig    `yaml:"secrets,omitempty"`
+	Audit      AuditConfig      `yaml:"audit,omitempty"`
+	Usage      UsageConfig      `yaml:"usage,omitempty"`
+	Metrics    MetricsConfig    `yaml:"metrics,omitempty"`
+	Tracing    TracingConfig    `yaml:"tracing,omitempty"`
+
+	TenantResolution TenantResolutionConfig `yaml:"tenant_resolution,omitempty"` // Multi-tenant only
+
+	// Secret references by field path, kept to refresh them
+	secretRefs map[string]string
+}
+
+// SecretsConfig configures secret references such as file:///run/secrets/lrs,
+// env:NAME and exec:command, accepted in every secret field
+type SecretsConfig struct {
+	RefreshInterval int `yaml:"refresh_interval"` // seconds; default 300
+	// Schemes that may be used in tenant rows (LRS password, JWT secret).
+	// Empty treats every tenant value as a literal, since tenant admins
+	// must not be able to read proxy files or environment.
+	TenantSchemes []string `yaml:"tenant_schemes"`
+}
+
+// AuditConfig tunes the audit log. Deployments with a tenant database write
+// it to the audit_log table; others to File, if set.
+type AuditConfig struct {
+	File          string `yaml:"file"`           // NDJSON file, used without a tenant database
+	BufferSize    int    `yaml:"buffer_size"`    // Events queued before new ones are dropped; default 10000
+	BatchSize     int    `yaml:"batch_size"`     // Events per write; default 100
+	FlushInterval int    `yaml:"flush_interval"` // seconds; default 1
+
+	// Base64 32-byte Ed25519 seed signing checkpoints of the audit_log hash
+	// chains; empty disables checkpoints
+	SigningKey         string `yaml:"signing_key"`
+	CheckpointInterval int    `yaml:"checkpoint_interval"` // seconds; default 3600
+}
+
+// UsageConfig tunes usage metering. Deployments with a tenant database add
+// hourly totals to the tenant_usage table; others keep them in memory.
+type UsageConfig struct {
+	FlushInterval int `yaml:"flush_interval"` // seconds; default 60
+}
+
+// TenantResolutionConfig selects how requests are mapped to tenants. The
+// resolvers in Order are tried in turn until one finds a tenant.
+type TenantResolutionConfig struct {
+	Order          []string `yaml:"order"`           // "host", "path", "header", "token"; default ["host"]
+	PathPrefix     string   `yaml:"path_prefix"`     // Default "/t/", as in /t/{tenant}/xapi/statements
+	Header         string   `yaml:"header"`          // Default "X-Tenant-ID"
+	TrustedProxies []string `yaml:"trusted_proxies"` // CIDRs of gateways allowed to set Header
+}
+
+// AdminConfig configures who may call the admin API
+type AdminConfig struct {
+	Principals []AdminPrincipalConfig `yaml:"principals"`
+	OIDC       *AdminOIDCConfig       `yaml:"oidc,omitempty"`
+}
+
+// AdminPrincipalConfig is an admin identified by a static bearer token.
+// Only the hex SHA-256 of the token is configured.
+type AdminPrincipalConfig struct {
+	Name      string `yaml:"name"`
+	TokenHash string `yaml:"token_hash"`
+	Role      string `yaml:"role"`      // "super-admin", "tenant-admin" or "auditor"
+	TenantID  string `yaml:"tenant_id"` // Required for tenant-admin
+}
+
+// AdminOIDCConfig trusts JWTs from an OIDC provider for admin access. Role
+// and tenant are read from the configured claims.
+type AdminOIDCConfig struct {
+	Issuer      string `yaml:"issuer"`
+	Audience    string `yaml:"audience"`
+	JWKSFile    string `yaml:"jwks_file"`
+	RoleClaim   string `yaml:"role_claim"`   // Default "role"
+	TenantClaim string `yaml:"tenant_claim"` // Default "tenant_id"
 }
 
 // ServerConfig contains server settings
@@ -23,21 +103,146 @@ type ServerConfig struct {
 	Host string `yaml:"host"`
 }
 
+// MetricsConfig sets the listener serving Prometheus metrics, kept apart
+// from the public port
+type MetricsConfig struct {
+	Port int    `yaml:"port"` // 0 disables metrics
+	Host string `yaml:"host"`
+	Path string `yaml:"path"` // Default "/metrics"
+}
+
+// TracingConfig selects where OpenTelemetry spans are exported
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`     // "otlp", "stdout" or "file"; empty disables tracing
+	Endpoint    string  `yaml:"endpoint"`     // otlp: collector host:port; default OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318
+	Insecure    bool    `yaml:"insecure"`     // otlp: plain HTTP instead of HTTPS
+	File        string  `yaml:"file"`         // file: spans appended as JSON lines
+	SampleRatio float64 `yaml:"sample_ratio"` // Share of new traces sampled; default 1
+	ServiceName string  `yaml:"service_name"` // Default "xapi-lrs-auth-proxy"
+}
+
 // LRSConfig contains LRS connection settings
 type LRSConfig struct {
-	Endpoint        string `yaml:"endpoint"`
-	Username        string `yaml:"username"`
-	Password        string `yaml:"password"`
-	ConnectionTimeout int  `yaml:"connection_timeout"` // seconds
-	MaxRetries      int    `yaml:"max_retries"`
+	Endpoint          string `yaml:"endpoint"`
+	Username          string `yaml:"username"`
+	Password          string `yaml:"password"`
+	ConnectionTimeout int    `yaml:"connection_timeout"` // seconds
+	MaxRetries        int    `yaml:"max_retries"`
 }
 
 // AuthConfig contains authentication settings
 type AuthConfig struct {
-	JWTSecret      string   `yaml:"jwt_secret"`
-	JWTTTLSeconds  int      `yaml:"jwt_ttl_seconds"`
-	LMSAPIKeys     []string `yaml:"lms_api_keys"`
-	PermissionPolicy string `yaml:"permission_policy"` // "strict" or "permissive"
+	JWTSecret            string              `yaml:"jwt_secret"`
+	JWTTTLSeconds        int                 `yaml:"jwt_ttl_seconds"`
+	LMSAPIKeys           []LMSAPIKeyConfig   `yaml:"lms_api_keys"`
+	PermissionPolicy     string              `yaml:"permission_policy"` // "strict" or "permissive"
+	OAuthTokenTTLSeconds int                 `yaml:"oauth_token_ttl_seconds"`
+	OAuthClients         []OAuthClientConfig `yaml:"oauth_clients"`
+	TokenExchange        TokenExchangeConfig `yaml:"token_exchange,omitempty"`
+	PermissionApprovals  []ApprovalConfig    `yaml:"permission_approvals"`
+}
+
+// RateLimitsConfig sets token-bucket request limits. Unset limits are
+// unlimited.
+type RateLimitsConfig struct {
+	Tenant *RateLimitConfig `yaml:"tenant"`  // All of the tenant's requests
+	APIKey *RateLimitConfig `yaml:"api_key"` // Per LMS API key or OAuth client, on /auth/token
+	Actor  *RateLimitConfig `yaml:"actor"`   // Per actor and registration, on /xapi
+}
+
+// RateLimitConfig is a token bucket holding Burst requests, refilled at
+// RequestsPerMinute
+type RateLimitConfig struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"` // Default requests_per_minute
+}
+
+// QuotasConfig sets monthly usage quotas. Unset quotas are unlimited.
+type QuotasConfig struct {
+	StatementsWritten *QuotaConfig `yaml:"statements_written"`
+	StatementsRead    *QuotaConfig `yaml:"statements_read"`
+	TokensIssued      *QuotaConfig `yaml:"tokens_issued"`
+	BytesProxied      *QuotaConfig `yaml:"bytes_proxied"` // Request and response bodies exchanged with the LRS
+}
+
+// QuotaConfig is a monthly limit. Past Soft, responses carry a warning; past
+// Hard, requests are refused with ExceededStatus.
+type QuotaConfig struct {
+	Soft           int64 `yaml:"soft"`
+	Hard           int64 `yaml:"hard"`
+	ExceededStatus int   `yaml:"exceeded_status"` // 402 (default) or 429
+}
+
+// ApprovalConfig approves an elevated permission for one AU (single-tenant)
+type ApprovalConfig struct {
+	CourseID        string `yaml:"course_id"`
+	AUID            string `yaml:"au_id"`
+	PermissionType  string `yaml:"permission_type"` // "statements_read" or "statements_write"
+	PermissionScope string `yaml:"permission_scope"`
+	ApprovedBy      string `yaml:"approved_by"`
+}
+
+// LMSAPIKeyConfig is an LMS API key and the limits on the tokens it may
+// request. A plain string entry configures a key with default limits.
+type LMSAPIKeyConfig struct {
+	Key                     string     `yaml:"key"`
+	MaxReadPermission       string     `yaml:"max_read_permission"`
+	MaxWritePermission      string     `yaml:"max_write_permission"`
+	AllowedCourseIDs        []string   `yaml:"allowed_course_ids"`
+	AllowedActivityPrefixes []string   `yaml:"allowed_activity_prefixes"`
+	ExpiresAt               *time.Time `yaml:"expires_at"` // RFC 3339; optional
+}
+
+// UnmarshalYAML accepts either a bare key string or a mapping
+func (k *LMSAPIKeyConfig) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		k.Key = value.Value
+		return nil
+	}
+	type plain LMSAPIKeyConfig
+	return value.Decode((*plain)(k))
+}
+
+// OAuthClientConfig registers an LMS for the OAuth 2.0 client_credentials grant
+type OAuthClientConfig struct {
+	ClientID      string   `yaml:"client_id"`
+	ClientSecret  string   `yaml:"client_secret"`   // client_secret_basic / client_secret_post
+	PublicKeyFile string   `yaml:"public_key_file"` // PEM public key for private_key_jwt
+	Scopes        []string `yaml:"scopes"`          // e.g. "write:actor-activity-registration-scoped"
+}
+
+// TokenExchangeConfig configures RFC 8693 token exchange from upstream
+// identity provider tokens
+type TokenExchangeConfig struct {
+	Issuers []TokenExchangeIssuerConfig `yaml:"issuers"`
+}
+
+// TokenExchangeIssuerConfig trusts subject tokens from one identity provider
+type TokenExchangeIssuerConfig struct {
+	Issuer             string            `yaml:"issuer"`
+	Audience           string            `yaml:"audience"`  // Required aud of subject tokens
+	JWKSFile           string            `yaml:"jwks_file"` // Issuer's public signing keys
+	ClaimMappings      map[string]string `yaml:"claim_mappings"`
+	AccountHomePage    string            `yaml:"account_home_page"`    // Defaults to the issuer
+	MaxReadPermission  string            `yaml:"max_read_permission"`  // Ceiling for exchanged tokens
+	MaxWritePermission string            `yaml:"max_write_permission"` // Ceiling for exchanged tokens
+}
+
+// LTIConfig contains LTI 1.3 tool settings
+type LTIConfig struct {
+	Platforms []LTIPlatformConfig `yaml:"platforms"`
+}
+
+// LTIPlatformConfig registers an LTI 1.3 platform (LMS)
+type LTIPlatformConfig struct {
+	Issuer             string   `yaml:"issuer"`
+	ClientID           string   `yaml:"client_id"`
+	DeploymentIDs      []string `yaml:"deployment_ids"` // Empty accepts any deployment
+	AuthLoginURL       string   `yaml:"auth_login_url"` // Platform OIDC authorization endpoint
+	JWKSFile           string   `yaml:"jwks_file"`      // Platform public signing keys
+	ContentURLPrefixes []string `yaml:"content_url_prefixes"`
+	WritePermission    string   `yaml:"write_permission"`
+	ReadPermission     string   `yaml:"read_permission"`
 }
 
 // DatabaseConfig contains database settings
@@ -48,15 +253,36 @@ type DatabaseConfig struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	SSLMode  string `yaml:"ssl_mode"`
+	// Tenant cache tuning (seconds); invalidation is pushed by LISTEN/NOTIFY
+	CacheTTL             int              `yaml:"cache_ttl"`              // Default 300
+	CacheRefreshInterval int              `yaml:"cache_refresh_interval"` // Default 900
+	Encryption           EncryptionConfig `yaml:"encryption,omitempty"`
+}
+
+// EncryptionConfig configures envelope encryption of tenant secrets. Each
+// tenant's LRS password and JWT secret are encrypted with a per-tenant data
+// key, which is wrapped by the master key.
+type EncryptionConfig struct {
+	MasterKey MasterKeySource `yaml:"master_key"`
+	// Keys being rotated out: still accepted for unwrapping until
+	// POST /admin/secrets/reencrypt has rewrapped every data key
+	PreviousMasterKeys []MasterKeySource `yaml:"previous_master_keys"`
+}
+
+// MasterKeySource locates a base64 encoded 32-byte master key
+type MasterKeySource struct {
+	File string `yaml:"file"`
+	Env  string `yaml:"env"` // Name of the environment variable holding the key
 }
 
 // RedisConfig contains Redis cache settings
 type RedisConfig struct {
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	Password string `yaml:"password"`
-	DB       int    `yaml:"db"`
-	CacheTTL int    `yaml:"cache_ttl"` // seconds
+	Host          string `yaml:"host"` // Empty disables Redis
+	Port          int    `yaml:"port"`
+	Password      string `yaml:"password"`
+	DB            int    `yaml:"db"`
+	CacheTTL      int    `yaml:"cache_ttl"`      // seconds
+	EncryptionKey string `yaml:"encryption_key"` // Base64 32-byte AES key for cached secrets
 }
 
 // Load reads configuration from a YAML file
@@ -87,6 +313,9 @@ func Load(filename string) (*Config, error) {
 	if cfg.Auth.PermissionPolicy == "" {
 		cfg.Auth.PermissionPolicy = "strict"
 	}
+	if cfg.Auth.OAuthTokenTTLSeconds == 0 {
+		cfg.Auth.OAuthTokenTTLSeconds = 300 // 5 minutes
+	}
 	if cfg.Database.Port == 0 {
 		cfg.Database.Port = 5432
 	}
@@ -99,12 +328,47 @@ func Load(filename string) (*Config, error) {
 	if cfg.Redis.CacheTTL == 0 {
 		cfg.Redis.CacheTTL = 300 // 5 minutes
 	}
+	if cfg.Secrets.RefreshInterval == 0 {
+		cfg.Secrets.RefreshInterval = 300 // 5 minutes
+	}
+	if cfg.Audit.BufferSize == 0 {
+		cfg.Audit.BufferSize = 10000
+	}
+	if cfg.Audit.BatchSize == 0 {
+		cfg.Audit.BatchSize = 100
+	}
+	if cfg.Audit.FlushInterval == 0 {
+		cfg.Audit.FlushInterval = 1
+	}
+	if cfg.Audit.CheckpointInterval == 0 {
+		cfg.Audit.CheckpointInterval = 3600 // 1 hour
+	}
+	if cfg.Tracing.SampleRatio == 0 {
+		cfg.Tracing.SampleRatio = 1
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "xapi-lrs-auth-proxy"
+	}
+	if cfg.Metrics.Path == "" {
+		cfg.Metrics.Path = "/metrics"
+	}
+	if cfg.Usage.FlushInterval == 0 {
+		cfg.Usage.FlushInterval = 60 // 1 minute
+	}
+	if len(cfg.TenantResolution.Order) == 0 {
+		cfg.TenantResolution.Order = []string{"host"}
+	}
+	if cfg.TenantResolution.PathPrefix == "" {
+		cfg.TenantResolution.PathPrefix = "/t/"
+	}
+	if cfg.TenantResolution.Header == "" {
+		cfg.TenantResolution.Header = "X-Tenant-ID"
+	}
 
-	// Expand environment variables
-	cfg.LRS.Password = expandEnv(cfg.LRS.Password)
-	cfg.Auth.JWTSecret = expandEnv(cfg.Auth.JWTSecret)
-	cfg.Database.Password = expandEnv(cfg.Database.Password)
-	cfg.Redis.Password = expandEnv(cfg.Redis.Password)
+	// Expand environment variables and resolve secret references
+	if err := cfg.resolveSecrets(context.Background()); err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
@@ -123,8 +387,8 @@ func (c *Config) Validate() error {
 		if c.Auth.JWTSecret == "" {
 			return fmt.Errorf("JWT secret is required")
 		}
-		if len(c.Auth.LMSAPIKeys) == 0 {
-			return fmt.Errorf("at least one LMS API key is required")
+		if len(c.Auth.LMSAPIKeys) == 0 && len(c.Auth.OAuthClients) == 0 {
+			return fmt.Errorf("at least one LMS API key or OAuth client is required")
 		}
 	}
 	return nil
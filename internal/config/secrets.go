@@ -0,0 +1,242 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// execSecretTimeout bounds how long an exec: secret command may run
+const execSecretTimeout = 10 * time.Second
+
+// envRefPattern matches a value that is exactly one ${VAR} reference
+var envRefPattern = regexp.MustCompile(`^\$\{[A-Za-z_][A-Za-z0-9_]*\}$`)
+
+// SecretProvider resolves secret references of one scheme. A value such as
+// "vault:kv/lrs#password" is passed to the provider registered for "vault"
+// as "kv/lrs#password".
+type SecretProvider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// SecretProviderFunc adapts a function to SecretProvider
+type SecretProviderFunc func(ctx context.Context, ref string) (string, error)
+
+// Resolve implements SecretProvider
+func (f SecretProviderFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+var (
+	providersMu     sync.RWMutex
+	secretProviders = map[string]SecretProvider{
+		"file": SecretProviderFunc(resolveFileSecret),
+		"env":  SecretProviderFunc(resolveEnvSecret),
+		"exec": SecretProviderFunc(resolveExecSecret),
+	}
+)
+
+// RegisterSecretProvider adds or replaces the provider for a scheme. It must
+// be called before the configuration is loaded.
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	secretProviders[scheme] = provider
+}
+
+// SecretScheme returns the scheme of a secret reference, or "" when the
+// value is a literal
+func SecretScheme(value string) string {
+	scheme, _, ok := strings.Cut(value, ":")
+	if !ok {
+		return ""
+	}
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	if _, ok := secretProviders[scheme]; !ok {
+		return ""
+	}
+	return scheme
+}
+
+// ExpandSecretEnv expands environment variables in a secret field that is
+// a single ${VAR} or a provider reference. Other values are literal secrets,
+// which may contain "$", and are returned unchanged.
+func ExpandSecretEnv(value string) string {
+	if envRefPattern.MatchString(value) || SecretScheme(value) != "" {
+		return expandEnv(value)
+	}
+	return value
+}
+
+// ResolveSecret resolves a secret reference. Literal values are returned
+// unchanged.
+func ResolveSecret(ctx context.Context, value string) (string, error) {
+	scheme := SecretScheme(value)
+	if scheme == "" {
+		return value, nil
+	}
+	providersMu.RLock()
+	provider := secretProviders[scheme]
+	providersMu.RUnlock()
+
+	secret, err := provider.Resolve(ctx, strings.TrimPrefix(value, scheme+":"))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s secret: %w", scheme, err)
+	}
+	return secret, nil
+}
+
+// resolveFileSecret reads file:///path, dropping a trailing newline
+func resolveFileSecret(ctx context.Context, ref string) (string, error) {
+	path := strings.TrimPrefix(ref, "//")
+	if !strings.HasPrefix(path, "/") {
+		return "", fmt.Errorf("file secret must be an absolute path: file:///path")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveEnvSecret reads env:NAME
+func resolveEnvSecret(ctx context.Context, ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return value, nil
+}
+
+// resolveExecSecret runs exec:command args... without a shell and returns
+// its standard output, dropping a trailing newline
+func resolveExecSecret(ctx context.Context, ref string) (string, error) {
+	args := strings.Fields(ref)
+	if len(args) == 0 {
+		return "", fmt.Errorf("exec secret requires a command")
+	}
+	ctx, cancel := context.WithTimeout(ctx, execSecretTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
+
+// secretFields returns the secret fields of the configuration by path
+func (c *Config) secretFields() map[string]*string {
+	fields := map[string]*string{
+		"lrs.password":         &c.LRS.Password,
+		"auth.jwt_secret":      &c.Auth.JWTSecret,
+		"database.password":    &c.Database.Password,
+		"redis.password":       &c.Redis.Password,
+		"redis.encryption_key": &c.Redis.EncryptionKey,
+		"audit.signing_key":    &c.Audit.SigningKey,
+	}
+	for i := range c.Auth.LMSAPIKeys {
+		fields[fmt.Sprintf("auth.lms_api_keys[%d].key", i)] = &c.Auth.LMSAPIKeys[i].Key
+	}
+	for i := range c.Auth.OAuthClients {
+		fields[fmt.Sprintf("auth.oauth_clients[%d].client_secret", i)] = &c.Auth.OAuthClients[i].ClientSecret
+	}
+	for i := range c.Admin.Principals {
+		fields[fmt.Sprintf("admin.principals[%d].token_hash", i)] = &c.Admin.Principals[i].TokenHash
+	}
+	return fields
+}
+
+// resolveSecrets expands environment variable references in secret fields
+// and resolves secret references, remembering the references for refreshes
+func (c *Config) resolveSecrets(ctx context.Context) error {
+	c.secretRefs = make(map[string]string)
+	for path, field := range c.secretFields() {
+		value := ExpandSecretEnv(*field)
+		if SecretScheme(value) != "" {
+			c.secretRefs[path] = value
+		}
+		secret, err := ResolveSecret(ctx, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		*field = secret
+	}
+	return nil
+}
+
+// clone copies the configuration deeply enough that its secret fields can
+// be changed without affecting c
+func (c *Config) clone() *Config {
+	clone := *c
+	clone.Auth.LMSAPIKeys = append([]LMSAPIKeyConfig(nil), c.Auth.LMSAPIKeys...)
+	clone.Auth.OAuthClients = append([]OAuthClientConfig(nil), c.Auth.OAuthClients...)
+	clone.Admin.Principals = append([]AdminPrincipalConfig(nil), c.Admin.Principals...)
+	return &clone
+}
+
+// RefreshSecrets resolves the secret references again. It returns a copy of
+// the configuration with the new values, or nil when nothing changed.
+func (c *Config) RefreshSecrets(ctx context.Context) (*Config, error) {
+	if len(c.secretRefs) == 0 {
+		return nil, nil
+	}
+	refreshed := c.clone()
+	fields := refreshed.secretFields()
+	var changed []string
+	for path, ref := range c.secretRefs {
+		secret, err := ResolveSecret(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if *fields[path] != secret {
+			*fields[path] = secret
+			changed = append(changed, path)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	log.WithField("fields", changed).Info("Secrets changed")
+	return refreshed, nil
+}
+
+// WatchSecrets refreshes secret references every interval until ctx is
+// done, passing each changed configuration to onChange. Resolution errors
+// are logged and the previous values kept.
+func WatchSecrets(ctx context.Context, cfg *Config, interval time.Duration, onChange func(*Config)) {
+	if interval <= 0 || len(cfg.secretRefs) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refreshed, err := cfg.RefreshSecrets(ctx)
+			if err != nil {
+				log.WithError(err).Warn("Failed to refresh secrets")
+				continue
+			}
+			if refreshed != nil {
+				cfg = refreshed
+				onChange(refreshed)
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+import "testing"
+
+func TestExpandSecretEnv(t *testing.T) {
+	t.Setenv("XLP_TEST_SECRET", "from-env")
+	t.Setenv("XLP_TEST_DIR", "/run/secrets")
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"${XLP_TEST_SECRET}", "from-env"},
+		{"file://${XLP_TEST_DIR}/lrs", "file:///run/secrets/lrs"},
+		{"exec:vault-read ${XLP_TEST_DIR}", "exec:vault-read /run/secrets"},
+		// Literal secrets are used as written
+		{"pa$$word", "pa$$word"},
+		{"key-$XLP_TEST_SECRET", "key-$XLP_TEST_SECRET"},
+		{"prefix-${XLP_TEST_SECRET}", "prefix-${XLP_TEST_SECRET}"},
+		{"$XLP_TEST_SECRET", "$XLP_TEST_SECRET"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ExpandSecretEnv(tt.value); got != tt.want {
+			t.Errorf("ExpandSecretEnv(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
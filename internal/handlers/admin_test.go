@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/admin"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// newTestAdminRouter serves the admin API for tenants acme and globex to
+// the bearer tokens "super", "acme-admin" and "auditor"
+func newTestAdminRouter(t *testing.T) (*mux.Router, *store.DatabaseTenantStore) {
+	t.Helper()
+	h, dbStore := newTestDatabaseHandler(t, "acme", "globex")
+
+	tokenHash := func(token string) string {
+		sum := sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+	authn, err := admin.NewAuthenticator(config.AdminConfig{Principals: []config.AdminPrincipalConfig{
+		{Name: "root", TokenHash: tokenHash("super"), Role: string(admin.RoleSuperAdmin)},
+		{Name: "alice", TokenHash: tokenHash("acme-admin"), Role: string(admin.RoleTenantAdmin), TenantID: "acme"},
+		{Name: "carol", TokenHash: tokenHash("auditor"), Role: string(admin.RoleAuditor)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	h.AdminRoutes(r.PathPrefix("/admin").Subrouter(), authn)
+	return r, dbStore
+}
+
+// serveAdminRequest sends a request to the admin router with token as the
+// bearer credential
+func serveAdminRequest(r http.Handler, token, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminAccess(t *testing.T) {
+	router, _ := newTestAdminRouter(t)
+	approval := `{"course_id": "course-1", "au_id": "au-1", "permission_type": "statements_read", "permission_scope": "actor-course-registration-scoped"}`
+
+	tests := []struct {
+		name       string
+		token      string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"no credentials", "", "GET", "/admin/tenants/acme", "", http.StatusUnauthorized},
+		{"unknown token", "other", "GET", "/admin/tenants/acme", "", http.StatusUnauthorized},
+
+		// AccessRead on a tenant
+		{"super-admin reads a tenant", "super", "GET", "/admin/tenants/acme", "", http.StatusOK},
+		{"tenant-admin reads its tenant", "acme-admin", "GET", "/admin/tenants/acme", "", http.StatusOK},
+		{"auditor reads a tenant", "auditor", "GET", "/admin/tenants/acme", "", http.StatusOK},
+		{"tenant-admin reads another tenant", "acme-admin", "GET", "/admin/tenants/globex", "", http.StatusForbidden},
+		{"tenant-admin lists another tenant's keys", "acme-admin", "GET", "/admin/tenants/globex/api-keys", "", http.StatusForbidden},
+
+		// AccessRead across tenants
+		{"super-admin lists tenants", "super", "GET", "/admin/tenants", "", http.StatusOK},
+		{"auditor lists tenants", "auditor", "GET", "/admin/tenants", "", http.StatusOK},
+		{"tenant-admin lists tenants", "acme-admin", "GET", "/admin/tenants", "", http.StatusForbidden},
+		{"tenant-admin reads cache stats", "acme-admin", "GET", "/admin/cache/stats", "", http.StatusForbidden},
+
+		// AccessWrite
+		{"super-admin writes a tenant", "super", "POST", "/admin/tenants/globex/approvals", approval, http.StatusCreated},
+		{"tenant-admin writes its tenant", "acme-admin", "POST", "/admin/tenants/acme/approvals", approval, http.StatusCreated},
+		{"auditor writes a tenant", "auditor", "POST", "/admin/tenants/acme/approvals", approval, http.StatusForbidden},
+		{"tenant-admin writes another tenant", "acme-admin", "POST", "/admin/tenants/globex/approvals", approval, http.StatusForbidden},
+		{"tenant-admin updates another tenant", "acme-admin", "PATCH", "/admin/tenants/globex", `{}`, http.StatusForbidden},
+
+		// AccessManage
+		{"super-admin manages a tenant", "super", "POST", "/admin/tenants/globex/suspend", "", http.StatusOK},
+		{"tenant-admin manages its tenant", "acme-admin", "POST", "/admin/tenants/acme/suspend", "", http.StatusForbidden},
+		{"tenant-admin deletes its tenant", "acme-admin", "DELETE", "/admin/tenants/acme", "", http.StatusForbidden},
+		{"auditor manages a tenant", "auditor", "POST", "/admin/tenants/acme/suspend", "", http.StatusForbidden},
+		{"tenant-admin creates a tenant", "acme-admin", "POST", "/admin/tenants", `{}`, http.StatusForbidden},
+		{"auditor re-encrypts secrets", "auditor", "POST", "/admin/secrets/reencrypt", "", http.StatusForbidden},
+
+		// Audit and usage queries scope by the tenant_id filter
+		{"tenant-admin queries its audit log", "acme-admin", "GET", "/admin/audit", "", http.StatusOK},
+		{"tenant-admin queries another audit log", "acme-admin", "GET", "/admin/audit?tenant_id=globex", "", http.StatusForbidden},
+		{"tenant-admin exports another audit log", "acme-admin", "GET", "/admin/audit/export?tenant_id=globex", "", http.StatusForbidden},
+		{"tenant-admin reads another tenant's usage", "acme-admin", "GET", "/admin/usage?tenant_id=globex", "", http.StatusForbidden},
+		{"auditor queries every audit log", "auditor", "GET", "/admin/audit", "", http.StatusOK},
+		{"auditor reads every tenant's usage", "auditor", "GET", "/admin/usage", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAdminRequest(router, tt.token, tt.method, tt.path, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Errorf("%s %s = %d, want %d: %s", tt.method, tt.path, w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+func TestAdminAuditScope(t *testing.T) {
+	router, dbStore := newTestAdminRouter(t)
+	now := time.Now()
+	if err := dbStore.WriteAuditEvents(context.Background(), []*audit.Event{
+		{TenantID: "acme", Timestamp: now, Operation: audit.OpTokenIssue, Success: true},
+		{TenantID: "globex", Timestamp: now, Operation: audit.OpTokenIssue, Success: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tenants := func(token, path string) []string {
+		t.Helper()
+		w := serveAdminRequest(router, token, "GET", path, "")
+		var resp struct {
+			Events []*audit.Record `json:"events"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d, %v", path, w.Code, err)
+		}
+		var ids []string
+		for _, e := range resp.Events {
+			ids = append(ids, e.TenantID)
+		}
+		return ids
+	}
+
+	if got := tenants("acme-admin", "/admin/audit"); len(got) != 1 || got[0] != "acme" {
+		t.Errorf("tenant-admin audit events = %v, want acme's only", got)
+	}
+	if got := tenants("acme-admin", "/admin/audit?tenant_id=acme"); len(got) != 1 || got[0] != "acme" {
+		t.Errorf("tenant-admin audit events for acme = %v", got)
+	}
+	if got := tenants("auditor", "/admin/audit"); len(got) != 2 {
+		t.Errorf("auditor audit events = %v, want both tenants", got)
+	}
+	if got := tenants("super", "/admin/audit?tenant_id=globex"); len(got) != 1 || got[0] != "globex" {
+		t.Errorf("super-admin audit events for globex = %v", got)
+	}
+}
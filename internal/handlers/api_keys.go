@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// RotateAPIKeyRequest controls how long a rotated key keeps working
+type RotateAPIKeyRequest struct {
+	GracePeriodSeconds int `json:"grace_period_seconds,omitempty"`
+}
+
+// CreateAPIKey handles POST /admin/tenants/{id}/api-keys
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	var req store.LMSAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := store.NewLMSAPIKey(req.MaxReadPermission, req.MaxWritePermission, nil, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	created, err := dbStore.CreateAPIKey(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		log.WithError(err).Error("Failed to create API key")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// ListAPIKeys handles GET /admin/tenants/{id}/api-keys
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := dbStore.ListAPIKeys(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		log.WithError(err).Error("Failed to list API keys")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"api_keys": keys,
+	})
+}
+
+// RevokeAPIKey handles DELETE /admin/tenants/{id}/api-keys/{prefix}
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	err := dbStore.RevokeAPIKey(r.Context(), vars["id"], vars["prefix"])
+	if errors.Is(err, store.ErrAPIKeyNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to revoke API key")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RotateAPIKey handles POST /admin/tenants/{id}/api-keys/{prefix}/rotate
+func (h *Handler) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	var req RotateAPIKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.GracePeriodSeconds < 0 {
+		http.Error(w, "grace_period_seconds must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	created, err := dbStore.RotateAPIKey(r.Context(), vars["id"], vars["prefix"],
+		time.Duration(req.GracePeriodSeconds)*time.Second)
+	if errors.Is(err, store.ErrAPIKeyNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to rotate API key")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
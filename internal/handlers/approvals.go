@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/admin"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/middleware"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// checkApprovals refuses elevated permissions that have no approved,
+// unrevoked permission_approvals row for the token's course and AU. It
+// returns a denial reason, or an error if approvals could not be checked.
+func (h *Handler) checkApprovals(ctx context.Context, tenant *store.TenantConfig, req *models.TokenRequest) (string, error) {
+	checks := []struct {
+		permissionType string
+		scope          string
+	}{
+		{store.PermissionTypeStatementsWrite, req.Permissions.Write},
+		{store.PermissionTypeStatementsRead, req.Permissions.Read},
+	}
+
+	for _, c := range checks {
+		if !models.IsElevatedPermission(c.scope) {
+			continue
+		}
+
+		approvals, ok := h.tenantStore.(store.ApprovalStore)
+		if !ok {
+			return fmt.Sprintf("%s permission %s requires approval", c.permissionType, c.scope), nil
+		}
+		if req.CourseID == "" {
+			return fmt.Sprintf("%s permission %s requires approval; course_id is required", c.permissionType, c.scope), nil
+		}
+
+		approved, err := approvals.IsApproved(ctx, tenant.TenantID, req.CourseID, req.ActivityID, c.permissionType, c.scope)
+		if err != nil {
+			return "", err
+		}
+		if !approved {
+			return fmt.Sprintf("%s permission %s not approved for course %s activity %s",
+				c.permissionType, c.scope, req.CourseID, req.ActivityID), nil
+		}
+	}
+
+	return "", nil
+}
+
+// RequestApproval handles POST /admin/tenants/{id}/approvals
+func (h *Handler) RequestApproval(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	var req store.ApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	approval, err := dbStore.RequestApproval(r.Context(), mux.Vars(r)["id"], &req)
+	if err != nil {
+		log.WithError(err).Error("Failed to request approval")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(approval)
+}
+
+// ListApprovals handles GET /admin/tenants/{id}/approvals
+func (h *Handler) ListApprovals(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	approvals, err := dbStore.ListApprovals(r.Context(), mux.Vars(r)["id"], r.URL.Query().Get("course_id"))
+	if err != nil {
+		log.WithError(err).Error("Failed to list approvals")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"approvals": approvals,
+	})
+}
+
+// ApproveApproval handles POST /admin/tenants/{id}/approvals/{approval_id}/approve
+func (h *Handler) ApproveApproval(w http.ResponseWriter, r *http.Request) {
+	h.decideApproval(w, r, true)
+}
+
+// RevokeApproval handles POST /admin/tenants/{id}/approvals/{approval_id}/revoke
+func (h *Handler) RevokeApproval(w http.ResponseWriter, r *http.Request) {
+	h.decideApproval(w, r, false)
+}
+
+// decideApproval approves or revokes an approval
+func (h *Handler) decideApproval(w http.ResponseWriter, r *http.Request, approve bool) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	tenantID := vars["id"]
+	approvalID, err := strconv.Atoi(vars["approval_id"])
+	if err != nil {
+		http.Error(w, "Invalid approval ID", http.StatusBadRequest)
+		return
+	}
+
+	// The decision is attributed to the authenticated admin
+	principal := r.Context().Value(middleware.AdminPrincipalKey).(*admin.Principal)
+
+	var approval *store.PermissionApproval
+	if approve {
+		approval, err = dbStore.ApproveApproval(r.Context(), tenantID, approvalID, principal.Name)
+	} else {
+		approval, err = dbStore.RevokeApproval(r.Context(), tenantID, approvalID, principal.Name)
+	}
+	if errors.Is(err, store.ErrApprovalNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to update approval")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(approval)
+}
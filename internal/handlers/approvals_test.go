@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/admin"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/middleware"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// tenantOnlyStore hides every optional interface of the store it wraps
+type tenantOnlyStore struct {
+	store.TenantStore
+}
+
+func TestCheckApprovals(t *testing.T) {
+	h, tenant := newTestHandler(t, config.Config{Auth: config.AuthConfig{
+		LMSAPIKeys: []config.LMSAPIKeyConfig{{Key: "lms-key"}},
+		PermissionApprovals: []config.ApprovalConfig{{
+			CourseID:        "course-1",
+			AUID:            "au-1",
+			PermissionType:  store.PermissionTypeStatementsRead,
+			PermissionScope: "actor-course-registration-scoped",
+			ApprovedBy:      "alice@example.com",
+		}},
+	}})
+
+	request := func(write, read, courseID, auID string) *models.TokenRequest {
+		return &models.TokenRequest{
+			Permissions: models.Permissions{Write: write, Read: read},
+			CourseID:    courseID,
+			ActivityID:  auID,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		req        *models.TokenRequest
+		wantReason string // Substring of the denial; empty when allowed
+	}{
+		{"default isolation needs no approval", request("actor-activity-registration-scoped", "actor-activity-registration-scoped", "", "au-1"), ""},
+		{"approved", request("actor-activity-registration-scoped", "actor-course-registration-scoped", "course-1", "au-1"), ""},
+		{"elevated without course_id", request("actor-activity-registration-scoped", "actor-course-registration-scoped", "", "au-1"),
+			"statements_read permission actor-course-registration-scoped requires approval; course_id is required"},
+		{"other AU", request("actor-activity-registration-scoped", "actor-course-registration-scoped", "course-1", "au-2"),
+			"statements_read permission actor-course-registration-scoped not approved for course course-1 activity au-2"},
+		{"higher scope than approved", request("actor-activity-registration-scoped", "course-aggregate-only", "course-1", "au-1"),
+			"statements_read permission course-aggregate-only not approved"},
+		{"elevated write not approved", request("actor-course-registration-scoped", "actor-course-registration-scoped", "course-1", "au-1"),
+			"statements_write permission actor-course-registration-scoped not approved"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := h.checkApprovals(context.Background(), tenant, tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantReason == "" && reason != "" || !strings.Contains(reason, tt.wantReason) {
+				t.Errorf("checkApprovals = %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+
+	// Stores that can't hold approvals refuse every elevated permission
+	h.tenantStore = tenantOnlyStore{h.tenantStore}
+	reason, err := h.checkApprovals(context.Background(), tenant, tests[1].req)
+	if err != nil || !strings.Contains(reason, "requires approval") {
+		t.Errorf("checkApprovals without an ApprovalStore = %q, %v; want a denial", reason, err)
+	}
+}
+
+func TestApprovalDecisions(t *testing.T) {
+	h, dbStore := newTestDatabaseHandler(t, "acme")
+	tenant, err := dbStore.GetByID(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serveAdmin := func(handler http.HandlerFunc, method, path string, vars map[string]string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r = mux.SetURLVars(r, vars)
+		principal := &admin.Principal{Name: "alice@example.com", Role: admin.RoleTenantAdmin, TenantID: "acme"}
+		r = r.WithContext(context.WithValue(r.Context(), middleware.AdminPrincipalKey, principal))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	w := serveAdmin(h.RequestApproval, http.MethodPost, "/admin/tenants/acme/approvals", map[string]string{"id": "acme"},
+		`{"course_id": "course-1", "au_id": "au-1", "permission_type": "statements_read", "permission_scope": "actor-course-registration-scoped"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("request status = %d: %s", w.Code, w.Body)
+	}
+	var approval store.PermissionApproval
+	if err := json.NewDecoder(w.Body).Decode(&approval); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &models.TokenRequest{
+		Permissions: models.Permissions{Write: "actor-activity-registration-scoped", Read: "actor-course-registration-scoped"},
+		CourseID:    "course-1",
+		ActivityID:  "au-1",
+	}
+	if reason, err := h.checkApprovals(context.Background(), tenant, req); err != nil || reason == "" {
+		t.Errorf("checkApprovals for a pending request = %q, %v; want a denial", reason, err)
+	}
+
+	vars := map[string]string{"id": "acme", "approval_id": strconv.Itoa(approval.ID)}
+	w = serveAdmin(h.ApproveApproval, http.MethodPost, "/admin/tenants/acme/approvals/1/approve", vars, "")
+	if err := json.NewDecoder(w.Body).Decode(&approval); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("approve = %d, %v", w.Code, err)
+	}
+	if !approval.Approved || approval.ApprovedBy != "alice@example.com" {
+		t.Errorf("approval = %+v, want approved by the admin principal", approval)
+	}
+	if reason, err := h.checkApprovals(context.Background(), tenant, req); err != nil || reason != "" {
+		t.Errorf("checkApprovals after approval = %q, %v", reason, err)
+	}
+
+	w = serveAdmin(h.RevokeApproval, http.MethodPost, "/admin/tenants/acme/approvals/1/revoke", vars, "")
+	if err := json.NewDecoder(w.Body).Decode(&approval); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("revoke = %d, %v", w.Code, err)
+	}
+	if !approval.Revoked || approval.RevokedBy != "alice@example.com" {
+		t.Errorf("approval = %+v, want revoked by the admin principal", approval)
+	}
+	if reason, err := h.checkApprovals(context.Background(), tenant, req); err != nil || reason == "" {
+		t.Errorf("checkApprovals after revocation = %q, %v; want a denial", reason, err)
+	}
+	if w := serveAdmin(h.ApproveApproval, http.MethodPost, "/admin/tenants/acme/approvals/1/approve", vars, ""); w.Code != http.StatusNotFound {
+		t.Errorf("approving a revoked approval status = %d, want 404", w.Code)
+	}
+}
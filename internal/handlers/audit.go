@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/admin"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/middleware"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// tokenEvent starts an audit event for a content token request
+func tokenEvent(r *http.Request, tenant *store.TenantConfig, req *models.TokenRequest) *audit.Event {
+	e := audit.NewEvent(r, tenant.TenantID, audit.OpTokenIssue)
+	e.ActorMbox = req.Actor.Identifier()
+	e.Registration = req.Registration
+	e.ActivityID = req.ActivityID
+	e.PermissionWrite = req.Permissions.Write
+	e.PermissionRead = req.Permissions.Read
+	return e
+}
+
+// accessEvent starts an audit event for an xAPI request made with a content
+// token
+func accessEvent(r *http.Request, claims *models.Claims, operation string) *audit.Event {
+	e := audit.NewEvent(r, claims.TenantID, operation)
+	e.ActorMbox = claims.Actor.Identifier()
+	e.Registration = claims.Registration
+	e.ActivityID = claims.ActivityID
+	e.PermissionWrite = claims.Permissions.Write
+	e.PermissionRead = claims.Permissions.Read
+	return e
+}
+
+// AuditStats handles GET /admin/audit/stats
+func (h *Handler) AuditStats(w http.ResponseWriter, r *http.Request) {
+	writer, ok := h.audit.(*audit.Writer)
+	if !ok {
+		http.Error(w, "Audit log not enabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(writer.Stats())
+}
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+	// auditExportBatch is how many events an export reads per query
+	auditExportBatch = 1000
+)
+
+// QueryAudit handles GET /admin/audit
+func (h *Handler) QueryAudit(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	filter, ok := auditFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.Limit = defaultAuditPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxAuditPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxAuditPageSize), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		id, err := decodeAuditCursor(v)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.BeforeID = id
+	}
+
+	// One extra event tells whether there is another page
+	pageSize := filter.Limit
+	filter.Limit++
+	records, err := dbStore.QueryAuditEvents(r.Context(), filter)
+	if err != nil {
+		log.WithError(err).Error("Failed to query audit log")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]interface{}{}
+	if len(records) > pageSize {
+		records = records[:pageSize]
+		resp["next_cursor"] = encodeAuditCursor(records[pageSize-1].ID)
+	}
+	if records == nil {
+		records = []*audit.Record{}
+	}
+	resp["events"] = records
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ExportAudit handles GET /admin/audit/export. Events are streamed in
+// batches, so arbitrarily large ranges can be exported.
+func (h *Handler) ExportAudit(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	filter, ok := auditFilter(w, r)
+	if !ok {
+		return
+	}
+
+	var enc auditEncoder
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc = &ndjsonAuditEncoder{enc: json.NewEncoder(w)}
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		enc = &csvAuditEncoder{w: csv.NewWriter(w)}
+	default:
+		http.Error(w, "format must be csv or ndjson", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.%s"`,
+		time.Now().UTC().Format("20060102T150405Z"), enc.extension()))
+
+	rc := http.NewResponseController(w)
+	filter.Limit = auditExportBatch
+	for {
+		// Keep long exports alive past the server's write timeout
+		rc.SetWriteDeadline(time.Now().Add(30 * time.Second))
+
+		records, err := dbStore.QueryAuditEvents(r.Context(), filter)
+		if err != nil {
+			// Headers are already sent once a batch has been written, so
+			// the export is cut short and the client sees a truncated body
+			log.WithError(err).Error("Failed to export audit log")
+			if filter.BeforeID == 0 {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		for _, rec := range records {
+			if err := enc.encode(rec); err != nil {
+				return
+			}
+		}
+		if err := enc.flush(); err != nil {
+			return
+		}
+		if len(records) < auditExportBatch {
+			return
+		}
+		rc.Flush()
+		filter.BeforeID = records[len(records)-1].ID
+	}
+}
+
+// auditActor turns the actor filter into the identifier stored with audit
+// events. It accepts an xAPI agent as JSON, a stored identifier (mailto:,
+// account:, an openid URI or an mbox_sha1sum) or a bare email address.
+func auditActor(v string) (string, error) {
+	if strings.HasPrefix(strings.TrimSpace(v), "{") {
+		var actor models.Actor
+		if err := json.Unmarshal([]byte(v), &actor); err != nil {
+			return "", fmt.Errorf("actor is not a valid agent: %v", err)
+		}
+		id := actor.Identifier()
+		if id == "" {
+			return "", fmt.Errorf("actor has no mbox, mbox_sha1sum, openid or account")
+		}
+		return id, nil
+	}
+	if strings.Contains(v, ":") || !strings.Contains(v, "@") {
+		return v, nil
+	}
+	return "mailto:" + v, nil
+}
+
+// auditFilter reads the filters shared by QueryAudit and ExportAudit.
+// Tenant-admins only see their own tenant's events.
+func auditFilter(w http.ResponseWriter, r *http.Request) (*store.AuditFilter, bool) {
+	q := r.URL.Query()
+	filter := &store.AuditFilter{
+		TenantID:     q.Get("tenant_id"),
+		Registration: q.Get("registration"),
+		ActivityID:   q.Get("activity_id"),
+		Operation:    q.Get("operation"),
+	}
+	if v := q.Get("actor"); v != "" {
+		actor, err := auditActor(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+		filter.ActorMbox = actor
+	}
+
+	principal := r.Context().Value(middleware.AdminPrincipalKey).(*admin.Principal)
+	if filter.TenantID == "" && principal.Role == admin.RoleTenantAdmin {
+		filter.TenantID = principal.TenantID
+	}
+	if !principal.Can(admin.AccessRead, filter.TenantID) {
+		log.WithFields(log.Fields{
+			"principal": principal.Name,
+			"role":      principal.Role,
+			"tenant_id": filter.TenantID,
+		}).Warn("Admin audit access denied")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	if v := q.Get("success"); v != "" {
+		success, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "success must be true or false", http.StatusBadRequest)
+			return nil, false
+		}
+		filter.Success = &success
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, p.name+" must be an RFC 3339 time", http.StatusBadRequest)
+			return nil, false
+		}
+		*p.dst = &t
+	}
+	return filter, true
+}
+
+// encodeAuditCursor makes an opaque pagination cursor from an event ID
+func encodeAuditCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodeAuditCursor reverses encodeAuditCursor
+func decodeAuditCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	}
+	return id, nil
+}
+
+// auditEncoder writes exported audit events in one format
+type auditEncoder interface {
+	encode(rec *audit.Record) error
+	flush() error
+	extension() string
+}
+
+// ndjsonAuditEncoder writes one JSON object per line
+type ndjsonAuditEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonAuditEncoder) encode(rec *audit.Record) error { return e.enc.Encode(rec) }
+func (e *ndjsonAuditEncoder) flush() error                   { return nil }
+func (e *ndjsonAuditEncoder) extension() string              { return "ndjson" }
+
+// auditCSVHeader lists the exported columns
+var auditCSVHeader = []string{
+	"id", "timestamp", "tenant_id", "operation", "actor_mbox", "registration", "activity_id",
+	"permission_write", "permission_read", "success", "reason", "ip_address", "user_agent",
+	"admin_principal", "admin_role", "request_method", "request_path", "chain_id", "prev_hash", "hash",
+}
+
+// csvAuditEncoder writes a header row, then one row per event
+type csvAuditEncoder struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (e *csvAuditEncoder) encode(rec *audit.Record) error {
+	if !e.wroteHeader {
+		e.wroteHeader = true
+		if err := e.w.Write(auditCSVHeader); err != nil {
+			return err
+		}
+	}
+	row := []string{
+		strconv.FormatInt(rec.ID, 10), rec.Timestamp.Format(time.RFC3339Nano), rec.TenantID, rec.Operation,
+		rec.ActorMbox, rec.Registration, rec.ActivityID, rec.PermissionWrite, rec.PermissionRead,
+		strconv.FormatBool(rec.Success), rec.Reason, rec.IPAddress, rec.UserAgent,
+		rec.AdminPrincipal, rec.AdminRole, rec.RequestMethod, rec.RequestPath, rec.ChainID, rec.PrevHash, rec.Hash,
+	}
+	for i, cell := range row {
+		row[i] = csvCell(cell)
+	}
+	return e.w.Write(row)
+}
+
+// csvCell keeps spreadsheets from evaluating a cell as a formula. Most
+// columns hold request-controlled values, so cells starting with a formula
+// character are prefixed with a quote.
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+func (e *csvAuditEncoder) flush() error {
+	// An empty export still has a header
+	if !e.wroteHeader {
+		e.wroteHeader = true
+		if err := e.w.Write(auditCSVHeader); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvAuditEncoder) extension() string { return "csv" }
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
+)
+
+func TestCSVCell(t *testing.T) {
+	for v, want := range map[string]string{
+		"":                         "",
+		"mailto:a@example.com":     "mailto:a@example.com",
+		"=HYPERLINK(\"http://x\")": "'=HYPERLINK(\"http://x\")",
+		"+1":                       "'+1",
+		"-2+3":                     "'-2+3",
+		"@SUM(A1)":                 "'@SUM(A1)",
+		"\t=1":                     "'\t=1",
+		"\r=1":                     "'\r=1",
+		"a=1":                      "a=1",
+	} {
+		if got := csvCell(v); got != want {
+			t.Errorf("csvCell(%q) = %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestQueryAuditPages(t *testing.T) {
+	router, dbStore := newTestAdminRouter(t)
+	var events []*audit.Event
+	for i := 0; i < 5; i++ {
+		events = append(events, &audit.Event{TenantID: "acme", Timestamp: time.Now(), Operation: audit.OpTokenIssue, Success: true})
+	}
+	events = append(events, &audit.Event{TenantID: "globex", Timestamp: time.Now(), Operation: audit.OpTokenIssue, Success: true})
+	if err := dbStore.WriteAuditEvents(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+
+	type page struct {
+		Events     []*audit.Record `json:"events"`
+		NextCursor string          `json:"next_cursor"`
+	}
+	query := func(token string, params url.Values) page {
+		t.Helper()
+		w := serveAdminRequest(router, token, "GET", "/admin/audit?"+params.Encode(), "")
+		var p page
+		if err := json.NewDecoder(w.Body).Decode(&p); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("GET /admin/audit?%s = %d, %v", params.Encode(), w.Code, err)
+		}
+		return p
+	}
+
+	// Following next_cursor visits every event once, newest first. The
+	// tenant-admin's empty tenant_id filter is narrowed to its own tenant.
+	var ids []int64
+	var sizes []int
+	params := url.Values{"limit": {"2"}}
+	for {
+		p := query("acme-admin", params)
+		sizes = append(sizes, len(p.Events))
+		for _, e := range p.Events {
+			if e.TenantID != "acme" {
+				t.Errorf("tenant-admin saw an event of %s", e.TenantID)
+			}
+			ids = append(ids, e.ID)
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		params.Set("cursor", p.NextCursor)
+	}
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[1] != 2 || sizes[2] != 1 {
+		t.Errorf("page sizes = %v, want 2, 2, 1", sizes)
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] >= ids[i-1] {
+			t.Errorf("event IDs = %v, want strictly decreasing", ids)
+			break
+		}
+	}
+	if len(ids) != 5 {
+		t.Errorf("visited %d events, want 5", len(ids))
+	}
+
+	// A page exactly filled by the remaining events has no next cursor
+	if p := query("auditor", url.Values{"limit": {"6"}}); len(p.Events) != 6 || p.NextCursor != "" {
+		t.Errorf("full page = %d events, cursor %q; want 6 and none", len(p.Events), p.NextCursor)
+	}
+	if p := query("auditor", url.Values{"limit": {strconv.Itoa(maxAuditPageSize)}}); len(p.Events) != 6 {
+		t.Errorf("largest page = %d events, want 6", len(p.Events))
+	}
+
+	for _, params := range []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"-1"}},
+		{"limit": {strconv.Itoa(maxAuditPageSize + 1)}},
+		{"limit": {"ten"}},
+		{"cursor": {"not base64!"}},
+		{"cursor": {encodeAuditCursor(0)}},
+	} {
+		if w := serveAdminRequest(router, "auditor", "GET", "/admin/audit?"+params.Encode(), ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET /admin/audit?%s = %d, want 400", params.Encode(), w.Code)
+		}
+	}
+}
+
+func TestAuditCursorRoundTrip(t *testing.T) {
+	for _, id := range []int64{1, 42, 1 << 40} {
+		got, err := decodeAuditCursor(encodeAuditCursor(id))
+		if err != nil || got != id {
+			t.Errorf("decodeAuditCursor(encodeAuditCursor(%d)) = %d, %v", id, got, err)
+		}
+	}
+}
+
+func TestExportAudit(t *testing.T) {
+	router, dbStore := newTestAdminRouter(t)
+	if err := dbStore.WriteAuditEvents(context.Background(), []*audit.Event{
+		{
+			TenantID:    "acme",
+			Timestamp:   time.Now(),
+			Operation:   audit.OpAuthenticate,
+			ActorMbox:   "@evil",
+			Reason:      "+cmd|' /C calc'!A0",
+			UserAgent:   `=HYPERLINK("https://evil.example.com")`,
+			RequestPath: "-1+1",
+		},
+		{TenantID: "globex", Timestamp: time.Now(), Operation: audit.OpTokenIssue, Success: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveAdminRequest(router, "acme-admin", "GET", "/admin/audit/export?format=csv", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("CSV export = %d %s: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("CSV export has %d rows, want a header and acme's event", len(rows))
+	}
+	row := make(map[string]string)
+	for i, name := range rows[0] {
+		row[name] = rows[1][i]
+	}
+	for column, want := range map[string]string{
+		"tenant_id":    "acme",
+		"actor_mbox":   "'@evil",
+		"reason":       "'+cmd|' /C calc'!A0",
+		"user_agent":   `'=HYPERLINK("https://evil.example.com")`,
+		"request_path": "'-1+1",
+		"success":      "false",
+	} {
+		if row[column] != want {
+			t.Errorf("%s = %q, want %q", column, row[column], want)
+		}
+	}
+
+	// The NDJSON export keeps values as they are, and auditors see every
+	// tenant
+	w = serveAdminRequest(router, "auditor", "GET", "/admin/audit/export", "")
+	var tenants []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var rec audit.Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatal(err)
+		}
+		tenants = append(tenants, rec.TenantID)
+		if rec.TenantID == "acme" && rec.ActorMbox != "@evil" {
+			t.Errorf("NDJSON actor_mbox = %q, want it unchanged", rec.ActorMbox)
+		}
+	}
+	if len(tenants) != 2 {
+		t.Errorf("auditor export tenants = %v, want both", tenants)
+	}
+
+	if w := serveAdminRequest(router, "auditor", "GET", "/admin/audit/export?format=xml", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("XML export = %d, want 400", w.Code)
+	}
+}
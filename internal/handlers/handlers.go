@@ -3,30 +3,52 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/admin"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/metrics"
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/middleware"
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/oauth"
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/tracing"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/usage"
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/validator"
 )
 
 // Handler contains all HTTP handlers
 type Handler struct {
 	tenantStore store.TenantStore
+	revocations store.TokenRevocationList
+	fetchTokens store.FetchTokenStore
+	ltiNonces   store.NonceStore
+	audit       audit.Recorder
+	meter       *usage.Meter
 }
 
 // New creates a new Handler
-func New(tenantStore store.TenantStore) *Handler {
+func New(tenantStore store.TenantStore, revocations store.TokenRevocationList, fetchTokens store.FetchTokenStore,
+	ltiNonces store.NonceStore, recorder audit.Recorder, meter *usage.Meter) *Handler {
 	return &Handler{
 		tenantStore: tenantStore,
+		revocations: revocations,
+		fetchTokens: fetchTokens,
+		ltiNonces:   ltiNonces,
+		audit:       recorder,
+		meter:       meter,
 	}
 }
 
@@ -50,6 +72,85 @@ func (h *Handler) IssueToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// API keys are limited to their configured permission ceilings
+	if key, ok := r.Context().Value(middleware.APIKeyKey).(*store.LMSAPIKey); ok {
+		if err := key.Authorize(&req); err != nil {
+			log.WithFields(log.Fields{
+				"tenant_id": tenant.TenantID,
+				"error":     err.Error(),
+			}).Warn("Token request exceeds API key limits")
+			h.audit.Record(tokenEvent(r, tenant, &req).Deny(err.Error()))
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	// OAuth clients are limited to the scopes granted to their access token
+	if accessClaims, ok := r.Context().Value(middleware.AccessClaimsKey).(*oauth.AccessClaims); ok {
+		if err := accessClaims.Allows(req.Permissions); err != nil {
+			log.WithFields(log.Fields{
+				"tenant_id": tenant.TenantID,
+				"client_id": accessClaims.ClientID,
+				"error":     err.Error(),
+			}).Warn("Token request exceeds OAuth scope")
+			h.audit.Record(tokenEvent(r, tenant, &req).Deny(err.Error()))
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	// Elevated permissions require an LMS admin approval for the AU
+	reason, err := h.checkApprovals(r.Context(), tenant, &req)
+	if err != nil {
+		log.WithError(err).Error("Failed to check permission approvals")
+		http.Error(w, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
+	if reason != "" {
+		log.WithFields(log.Fields{
+			"tenant_id":   tenant.TenantID,
+			"course_id":   req.CourseID,
+			"activity_id": req.ActivityID,
+			"reason":      reason,
+		}).Warn("Token request for unapproved permission")
+		h.audit.Record(tokenEvent(r, tenant, &req).Deny(reason))
+		http.Error(w, reason, http.StatusForbidden)
+		return
+	}
+
+	if h.quotaExceeded(w, tenant, usage.TokensIssued) {
+		return
+	}
+
+	resp, err := h.issueToken(r, tenant, &req)
+	if err != nil {
+		log.WithError(err).Error("Failed to sign JWT")
+		http.Error(w, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
+
+	// cmi5: the AU redeems the token once from a fetch URL
+	if req.Fetch {
+		if err := h.storeFetchToken(r, tenant, resp); err != nil {
+			log.WithError(err).Error("Failed to store fetch token")
+			http.Error(w, "Token generation failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// issueToken signs a content JWT for an already authorized token request
+// and records the issuance in the audit log
+func (h *Handler) issueToken(r *http.Request, tenant *store.TenantConfig, req *models.TokenRequest) (*models.TokenResponse, error) {
+	// Token IDs let administrators revoke individual tokens
+	tokenID, err := newTokenID()
+	if err != nil {
+		return nil, err
+	}
+
 	// Create JWT claims
 	expiresAt := time.Now().Add(time.Duration(tenant.JWTTTLSeconds) * time.Second)
 	claims := &models.Claims{
@@ -65,7 +166,8 @@ func (h *Handler) IssueToken(w http.ResponseWriter, r *http.Request) {
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "xapi-lrs-auth-proxy",
-			Subject:   req.Actor.Mbox,
+			Subject:   req.Actor.Identifier(),
+			ID:        tokenID,
 		},
 	}
 
@@ -73,28 +175,27 @@ func (h *Handler) IssueToken(w http.ResponseWriter, r *http.Request) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(tenant.JWTSecret)
 	if err != nil {
-		log.WithError(err).Error("Failed to sign JWT")
-		http.Error(w, "Token generation failed", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
 	// Log token issuance
 	log.WithFields(log.Fields{
 		"tenant_id":    tenant.TenantID,
-		"actor":        req.Actor.Mbox,
+		"token_id":     tokenID,
+		"actor":        req.Actor.Identifier(),
 		"registration": req.Registration,
 		"activity_id":  req.ActivityID,
 		"permissions":  fmt.Sprintf("write:%s read:%s", req.Permissions.Write, req.Permissions.Read),
 	}).Info("JWT token issued")
+	h.audit.Record(tokenEvent(r, tenant, req))
+	h.meter.Add(tenant.TenantID, usage.Counts{TokensIssued: 1})
+	metrics.TokensIssued.WithLabelValues(tenant.TenantID, req.Permissions.Write, req.Permissions.Read).Inc()
 
-	// Return token
-	resp := models.TokenResponse{
+	return &models.TokenResponse{
 		Token:     tokenString,
+		TokenID:   tokenID,
 		ExpiresAt: expiresAt,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	}, nil
 }
 
 // ProxyStatements handles xAPI statements endpoint
@@ -137,21 +238,34 @@ func (h *Handler) proxyStatementsWrite(w http.ResponseWriter, r *http.Request, t
 	}
 
 	// Validate each statement against permissions
+	span := startValidation(r, claims, audit.OpStatementsWrite, claims.Permissions.Write)
 	for i, stmt := range statements {
 		if err := v.ValidateWrite(claims, &stmt); err != nil {
+			endValidation(span, err)
 			log.WithFields(log.Fields{
-				"tenant_id":    tenant.TenantID,
-				"registration": claims.Registration,
+				"tenant_id":     tenant.TenantID,
+				"registration":  claims.Registration,
 				"statement_num": i,
-				"error":        err.Error(),
+				"error":         err.Error(),
 			}).Warn("Statement write denied")
+			metrics.ValidatorDenials.WithLabelValues(tenant.TenantID, claims.Permissions.Write, validator.Reason(err)).Inc()
+			h.audit.Record(accessEvent(r, claims, audit.OpStatementsWrite).Deny(fmt.Sprintf("statement %d: %s", i, err.Error())))
 			http.Error(w, fmt.Sprintf("Statement %d: %s", i, err.Error()), http.StatusForbidden)
 			return
 		}
 	}
 
+	endValidation(span, nil)
+	h.audit.Record(accessEvent(r, claims, audit.OpStatementsWrite))
+
+	if h.quotaExceeded(w, tenant, usage.StatementsWritten) {
+		return
+	}
+
 	// Forward to LRS
-	h.forwardToLRS(w, r, tenant, body)
+	if status := h.forwardToLRS(w, r, tenant, body); status >= 200 && status < 300 {
+		h.meter.Add(tenant.TenantID, usage.Counts{StatementsWritten: int64(len(statements))})
+	}
 }
 
 // proxyStatementsRead handles statement reads
@@ -165,18 +279,32 @@ func (h *Handler) proxyStatementsRead(w http.ResponseWriter, r *http.Request, te
 	}
 
 	// Validate read permissions
-	if err := v.ValidateRead(claims, query); err != nil {
+	span := startValidation(r, claims, audit.OpStatementsRead, claims.Permissions.Read)
+	err := v.ValidateRead(claims, query)
+	endValidation(span, err)
+	if err != nil {
 		log.WithFields(log.Fields{
 			"tenant_id":    tenant.TenantID,
 			"registration": claims.Registration,
 			"error":        err.Error(),
 		}).Warn("Statement read denied")
+		metrics.ValidatorDenials.WithLabelValues(tenant.TenantID, claims.Permissions.Read, validator.Reason(err)).Inc()
+		h.audit.Record(accessEvent(r, claims, audit.OpStatementsRead).Deny(err.Error()))
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
+	h.audit.Record(accessEvent(r, claims, audit.OpStatementsRead))
 
-	// Forward to LRS
-	h.forwardToLRS(w, r, tenant, nil)
+	if h.quotaExceeded(w, tenant, usage.StatementsRead) {
+		return
+	}
+
+	// Forward to LRS, counting the statements returned
+	counter := newStatementCounter(w)
+	status := h.forwardToLRS(counter, r, tenant, nil)
+	if count := counter.Count(); status == http.StatusOK && count > 0 {
+		h.meter.Add(tenant.TenantID, usage.Counts{StatementsRead: count})
+	}
 }
 
 // ProxyState handles xAPI state endpoint
@@ -192,14 +320,20 @@ func (h *Handler) ProxyState(w http.ResponseWriter, r *http.Request) {
 	registration := r.URL.Query().Get("registration")
 
 	// Validate state access
-	if err := v.ValidateStateAccess(claims, activityID, agent, registration); err != nil {
+	span := startValidation(r, claims, audit.OpStateAccess, claims.Permissions.Read)
+	err := v.ValidateStateAccess(claims, activityID, agent, registration)
+	endValidation(span, err)
+	if err != nil {
 		log.WithFields(log.Fields{
 			"tenant_id": tenant.TenantID,
 			"error":     err.Error(),
 		}).Warn("State access denied")
+		metrics.ValidatorDenials.WithLabelValues(tenant.TenantID, claims.Permissions.Read, validator.Reason(err)).Inc()
+		h.audit.Record(accessEvent(r, claims, audit.OpStateAccess).Deny(err.Error()))
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
+	h.audit.Record(accessEvent(r, claims, audit.OpStateAccess))
 
 	// Read body if present
 	var body []byte
@@ -220,6 +354,9 @@ func (h *Handler) ProxyState(w http.ResponseWriter, r *http.Request) {
 // ProxyActivityProfile handles xAPI activity profile endpoint
 func (h *Handler) ProxyActivityProfile(w http.ResponseWriter, r *http.Request) {
 	tenant := r.Context().Value(middleware.TenantKey).(*store.TenantConfig)
+	claims := r.Context().Value(middleware.ClaimsKey).(*models.Claims)
+
+	h.audit.Record(accessEvent(r, claims, audit.OpActivityProfile))
 
 	var body []byte
 	if r.Method == "POST" || r.Method == "PUT" {
@@ -245,9 +382,10 @@ func (h *Handler) ProxyAgentProfile(w http.ResponseWriter, r *http.Request) {
 	// Simplified validation - in production, parse full agent JSON
 	// and verify it matches claims.Actor
 
-	_ = claims // Use claims for validation
 	_ = agent
 
+	h.audit.Record(accessEvent(r, claims, audit.OpAgentProfile))
+
 	var body []byte
 	if r.Method == "POST" || r.Method == "PUT" {
 		var err error
@@ -268,8 +406,13 @@ func (h *Handler) ProxyAbout(w http.ResponseWriter, r *http.Request) {
 	h.forwardToLRS(w, r, tenant, nil)
 }
 
-// forwardToLRS forwards the request to the tenant's LRS
-func (h *Handler) forwardToLRS(w http.ResponseWriter, r *http.Request, tenant *store.TenantConfig, body []byte) {
+// forwardToLRS forwards the request to the tenant's LRS and returns the LRS
+// response status, or 0 if the request was not forwarded
+func (h *Handler) forwardToLRS(w http.ResponseWriter, r *http.Request, tenant *store.TenantConfig, body []byte) int {
+	if h.quotaExceeded(w, tenant, usage.BytesProxied) {
+		return 0
+	}
+
 	// Build LRS URL
 	lrsURL := tenant.LRSEndpoint + r.URL.Path[5:] // Remove "/xapi" prefix
 	if r.URL.RawQuery != "" {
@@ -282,11 +425,25 @@ func (h *Handler) forwardToLRS(w http.ResponseWriter, r *http.Request, tenant *s
 		reqBody = bytes.NewReader(body)
 	}
 
-	req, err := http.NewRequest(r.Method, lrsURL, reqBody)
+	// The span covers the LRS round trip including the response body copy
+	ctx, span := tracing.Start(r.Context(), "forwardToLRS",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.TenantKey.String(tenant.TenantID),
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path[5:]),
+		))
+	defer span.End()
+	if claims, ok := r.Context().Value(middleware.ClaimsKey).(*models.Claims); ok {
+		span.SetAttributes(tracing.RegistrationKey.String(claims.Registration))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, lrsURL, reqBody)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		log.WithError(err).Error("Failed to create LRS request")
 		http.Error(w, "Failed to forward request", http.StatusInternalServerError)
-		return
+		return 0
 	}
 
 	// Copy headers (except Authorization - we use LRS credentials)
@@ -301,6 +458,10 @@ func (h *Handler) forwardToLRS(w http.ResponseWriter, r *http.Request, tenant *s
 	// Add LRS credentials
 	req.SetBasicAuth(tenant.LRSUsername, tenant.LRSPassword)
 
+	// Continue the trace at the LRS
+	tracing.Inject(ctx, req.Header)
+	span.SetAttributes(semconv.ServerAddress(req.URL.Hostname()))
+
 	// Ensure xAPI version header
 	if req.Header.Get("X-Experience-API-Version") == "" {
 		req.Header.Set("X-Experience-API-Version", "1.0.3")
@@ -311,13 +472,25 @@ func (h *Handler) forwardToLRS(w http.ResponseWriter, r *http.Request, tenant *s
 		Timeout: 30 * time.Second,
 	}
 
+	start := time.Now()
 	resp, err := client.Do(req)
+	metrics.LRSDuration.WithLabelValues(tenant.TenantID, r.Method).Observe(time.Since(start).Seconds())
 	if err != nil {
+		metrics.LRSRequests.WithLabelValues(tenant.TenantID, r.Method, "error").Inc()
+		metrics.LRSErrors.WithLabelValues(tenant.TenantID, "transport").Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "LRS request failed")
 		log.WithError(err).Error("LRS request failed")
 		http.Error(w, "LRS request failed", http.StatusBadGateway)
-		return
+		return 0
 	}
 	defer resp.Body.Close()
+	metrics.LRSRequests.WithLabelValues(tenant.TenantID, r.Method, strconv.Itoa(resp.StatusCode)).Inc()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		metrics.LRSErrors.WithLabelValues(tenant.TenantID, "server").Inc()
+		span.SetStatus(codes.Error, resp.Status)
+	}
 
 	// Copy response headers
 	for key, values := range resp.Header {
@@ -330,17 +503,56 @@ func (h *Handler) forwardToLRS(w http.ResponseWriter, r *http.Request, tenant *s
 	w.WriteHeader(resp.StatusCode)
 
 	// Copy response body
-	if _, err := io.Copy(w, resp.Body); err != nil {
+	copied, err := io.Copy(w, resp.Body)
+	if err != nil {
+		span.RecordError(err)
 		log.WithError(err).Error("Failed to copy LRS response")
 	}
+	h.meter.Add(tenant.TenantID, usage.Counts{BytesProxied: int64(len(body)) + copied})
 
 	// Log successful proxy
 	log.WithFields(log.Fields{
-		"tenant_id": tenant.TenantID,
-		"method":    r.Method,
-		"path":      r.URL.Path,
+		"tenant_id":  tenant.TenantID,
+		"method":     r.Method,
+		"path":       r.URL.Path,
 		"lrs_status": resp.StatusCode,
 	}).Debug("Request proxied to LRS")
+
+	return resp.StatusCode
+}
+
+// AdminRoutes registers the admin API on r. Every route requires an
+// authenticated admin; routes addressing a tenant also require the
+// principal's access to that tenant.
+func (h *Handler) AdminRoutes(r *mux.Router, authn *admin.Authenticator) {
+	r.Use(middleware.AdminAuthMiddleware(authn, h.audit))
+	route := func(path string, access admin.Access, handler http.HandlerFunc, method string) {
+		r.Handle(path, middleware.RequireAdmin(access, handler)).Methods(method)
+	}
+	route("/tenants", admin.AccessManage, h.CreateTenant, "POST")
+	route("/tenants", admin.AccessRead, h.ListTenants, "GET")
+	route("/cache/stats", admin.AccessRead, h.CacheStats, "GET")
+	route("/audit/stats", admin.AccessRead, h.AuditStats, "GET")
+	// Audit and usage queries check tenant access against the tenant_id filter
+	r.HandleFunc("/audit", h.QueryAudit).Methods("GET")
+	r.HandleFunc("/audit/export", h.ExportAudit).Methods("GET")
+	r.HandleFunc("/usage", h.UsageReport).Methods("GET")
+	route("/secrets/reencrypt", admin.AccessManage, h.ReencryptSecrets, "POST")
+	route("/tenants/{id}", admin.AccessRead, h.GetTenant, "GET")
+	route("/tenants/{id}", admin.AccessWrite, h.UpdateTenant, "PUT")
+	route("/tenants/{id}", admin.AccessWrite, h.UpdateTenant, "PATCH")
+	route("/tenants/{id}", admin.AccessManage, h.DeleteTenant, "DELETE")
+	route("/tenants/{id}/suspend", admin.AccessManage, h.SuspendTenant, "POST")
+	route("/tenants/{id}/resume", admin.AccessManage, h.ResumeTenant, "POST")
+	route("/tenants/{id}/api-keys", admin.AccessWrite, h.CreateAPIKey, "POST")
+	route("/tenants/{id}/api-keys", admin.AccessRead, h.ListAPIKeys, "GET")
+	route("/tenants/{id}/api-keys/{prefix}", admin.AccessWrite, h.RevokeAPIKey, "DELETE")
+	route("/tenants/{id}/api-keys/{prefix}/rotate", admin.AccessWrite, h.RotateAPIKey, "POST")
+	route("/tenants/{id}/tokens/revoke", admin.AccessWrite, h.RevokeToken, "POST")
+	route("/tenants/{id}/approvals", admin.AccessWrite, h.RequestApproval, "POST")
+	route("/tenants/{id}/approvals", admin.AccessRead, h.ListApprovals, "GET")
+	route("/tenants/{id}/approvals/{approval_id}/approve", admin.AccessWrite, h.ApproveApproval, "POST")
+	route("/tenants/{id}/approvals/{approval_id}/revoke", admin.AccessWrite, h.RevokeApproval, "POST")
 }
 
 // CreateTenant handles POST /admin/tenants
@@ -357,25 +569,31 @@ func (h *Handler) CreateTenant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := dbStore.CreateTenant(r.Context(), &req); err != nil {
+	apiKeys, err := dbStore.CreateTenant(r.Context(), &req)
+	if err != nil {
 		log.WithError(err).Error("Failed to create tenant")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Generated API keys are returned only in this response
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"status": "created"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "created",
+		"lms_api_keys": apiKeys,
+	})
 }
 
 // ListTenants handles GET /admin/tenants
 func (h *Handler) ListTenants(w http.ResponseWriter, r *http.Request) {
-	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	lister, ok := h.tenantStore.(store.TenantLister)
 	if !ok {
 		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
 		return
 	}
 
-	tenants, err := dbStore.ListTenants(r.Context())
+	tenants, err := lister.ListTenants(r.Context())
 	if err != nil {
 		log.WithError(err).Error("Failed to list tenants")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -388,6 +606,41 @@ func (h *Handler) ListTenants(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// CacheStats handles GET /admin/cache/stats
+func (h *Handler) CacheStats(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dbStore.CacheStats())
+}
+
+// ReencryptSecrets handles POST /admin/secrets/reencrypt
+func (h *Handler) ReencryptSecrets(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	result, err := dbStore.ReencryptSecrets(r.Context())
+	if errors.Is(err, store.ErrNoMasterKey) {
+		http.Error(w, "No master key configured", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to re-encrypt secrets")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
 // GetTenant handles GET /admin/tenants/{id}
 func (h *Handler) GetTenant(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -403,10 +656,64 @@ func (h *Handler) GetTenant(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(tenant)
 }
 
-// UpdateTenant handles PUT /admin/tenants/{id}
+// UpdateTenant handles PUT and PATCH /admin/tenants/{id}. PUT replaces
+// hosts, LRS and auth settings and requires all of them; PATCH changes only
+// the fields present. Changing hosts or the LRS endpoint requires manage
+// access, so a tenant admin cannot claim another tenant's hosts.
 func (h *Handler) UpdateTenant(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement tenant updates
-	http.Error(w, "Not implemented", http.StatusNotImplemented)
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	var req store.UpdateTenantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	validate := req.Validate
+	if r.Method == http.MethodPut {
+		validate = req.ValidateComplete
+	}
+	if err := validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tenantID := mux.Vars(r)["id"]
+	principal := r.Context().Value(middleware.AdminPrincipalKey).(*admin.Principal)
+	if req.ChangesRouting() && !principal.Can(admin.AccessManage, tenantID) {
+		log.WithFields(log.Fields{
+			"principal": principal.Name,
+			"role":      principal.Role,
+			"tenant_id": tenantID,
+		}).Warn("Admin tenant routing change denied")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	err := dbStore.UpdateTenant(r.Context(), tenantID, &req)
+	if errors.Is(err, store.ErrTenantNotFound) {
+		http.Error(w, "Tenant not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to update tenant")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tenant, err := dbStore.GetByID(r.Context(), tenantID)
+	if err != nil {
+		log.WithError(err).Error("Failed to load updated tenant")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenant)
 }
 
 // DeleteTenant handles DELETE /admin/tenants/{id}
@@ -420,7 +727,12 @@ func (h *Handler) DeleteTenant(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	tenantID := vars["id"]
 
-	if err := dbStore.DeleteTenant(r.Context(), tenantID); err != nil {
+	err := dbStore.DeleteTenant(r.Context(), tenantID)
+	if errors.Is(err, store.ErrTenantNotFound) {
+		http.Error(w, "Tenant not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
 		log.WithError(err).Error("Failed to delete tenant")
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -428,3 +740,53 @@ func (h *Handler) DeleteTenant(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// SuspendTenant handles POST /admin/tenants/{id}/suspend
+func (h *Handler) SuspendTenant(w http.ResponseWriter, r *http.Request) {
+	h.setTenantStatus(w, r, true)
+}
+
+// ResumeTenant handles POST /admin/tenants/{id}/resume
+func (h *Handler) ResumeTenant(w http.ResponseWriter, r *http.Request) {
+	h.setTenantStatus(w, r, false)
+}
+
+// setTenantStatus suspends or resumes a tenant
+func (h *Handler) setTenantStatus(w http.ResponseWriter, r *http.Request, suspend bool) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	tenantID := mux.Vars(r)["id"]
+	var err error
+	if suspend {
+		err = dbStore.SuspendTenant(r.Context(), tenantID)
+	} else {
+		err = dbStore.ResumeTenant(r.Context(), tenantID)
+	}
+	if errors.Is(err, store.ErrTenantNotFound) {
+		http.Error(w, "Tenant not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrTenantStatusConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to change tenant status")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tenant, err := dbStore.GetByID(r.Context(), tenantID)
+	if err != nil {
+		log.WithError(err).Error("Failed to load tenant")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenant)
+}
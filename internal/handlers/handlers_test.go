@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/middleware"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/usage"
+)
+
+const testJWTSecret = "test-secret-with-at-least-32-bytes!!"
+
+// newTestHandler serves a single tenant configured by cfg. The mode, LRS
+// and JWT secret are filled in.
+func newTestHandler(t *testing.T, cfg config.Config) (*Handler, *store.TenantConfig) {
+	t.Helper()
+	cfg.Mode = "single-tenant"
+	cfg.LRS = config.LRSConfig{Endpoint: "https://lrs.example.com/xapi/"}
+	cfg.Auth.JWTSecret = testJWTSecret
+	if cfg.Auth.JWTTTLSeconds == 0 {
+		cfg.Auth.JWTTTLSeconds = 3600
+	}
+	if cfg.Auth.PermissionPolicy == "" {
+		cfg.Auth.PermissionPolicy = "strict"
+	}
+	tenantStore, err := store.NewSingleTenantStore(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant, err := tenantStore.GetByID(context.Background(), "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(tenantStore, store.NewMemoryRevocationList(), store.NewMemoryFetchTokenStore(),
+		store.NewMemoryNonceStore(), audit.Discard, usage.NewMeter(nil))
+	return h, tenant
+}
+
+// serveTenant runs handler for r as a request to tenant
+func serveTenant(handler http.HandlerFunc, tenant *store.TenantConfig, r *http.Request) *httptest.ResponseRecorder {
+	ctx := context.WithValue(r.Context(), middleware.TenantKey, tenant)
+	w := httptest.NewRecorder()
+	handler(w, r.WithContext(ctx))
+	return w
+}
+
+// parseContentToken verifies a content JWT issued by a test handler
+func parseContentToken(t *testing.T, token string) *models.Claims {
+	t.Helper()
+	claims := &models.Claims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(testJWTSecret), nil
+	}, jwt.WithValidMethods([]string{"HS256"})); err != nil {
+		t.Fatalf("content token: %v", err)
+	}
+	return claims
+}
+
+func TestIssueTokenAPIKeyLimits(t *testing.T) {
+	h, tenant := newTestHandler(t, config.Config{Auth: config.AuthConfig{
+		LMSAPIKeys: []config.LMSAPIKeyConfig{{
+			Key:                     "lms-key",
+			MaxReadPermission:       "actor-activity-registration-scoped",
+			AllowedCourseIDs:        []string{"course-1"},
+			AllowedActivityPrefixes: []string{"https://example.com/course-1/"},
+		}},
+	}})
+	key, err := tenant.LookupAPIKey("lms-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		read       string
+		courseID   string
+		activityID string
+		wantStatus int
+		wantBody   string
+	}{
+		{"within limits", "actor-activity-registration-scoped", "course-1", "https://example.com/course-1/au-1", http.StatusOK, ""},
+		{"read above maximum", "actor-course-registration-scoped", "course-1", "https://example.com/course-1/au-1",
+			http.StatusForbidden, "read permission actor-course-registration-scoped exceeds API key maximum actor-activity-registration-scoped"},
+		{"other course", "actor-activity-registration-scoped", "course-2", "https://example.com/course-1/au-1",
+			http.StatusForbidden, `course "course-2" not allowed for API key`},
+		{"other activity", "actor-activity-registration-scoped", "course-1", "https://example.com/course-2/au-1",
+			http.StatusForbidden, `activity "https://example.com/course-2/au-1" not allowed for API key`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := json.Marshal(models.TokenRequest{
+				Actor:        models.Actor{Mbox: "mailto:learner@example.com"},
+				Registration: "reg-1",
+				ActivityID:   tt.activityID,
+				CourseID:     tt.courseID,
+				Permissions:  models.Permissions{Write: "actor-activity-registration-scoped", Read: tt.read},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/auth/token", bytes.NewReader(body))
+			r = r.WithContext(context.WithValue(r.Context(), middleware.APIKeyKey, key))
+
+			w := serveTenant(h.IssueToken, tenant, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(w.Body.String()) != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// newTestDatabaseHandler serves tenants from a migrated SQLite database
+// holding each of tenantIDs at <id>.example.com
+func newTestDatabaseHandler(t *testing.T, tenantIDs ...string) (*Handler, *store.DatabaseTenantStore) {
+	t.Helper()
+	ctx := context.Background()
+	connStr := "sqlite://" + filepath.Join(t.TempDir(), "tenants.db")
+	m, err := store.OpenMigrator(connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Up(ctx)
+	m.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbStore, err := store.NewDatabaseTenantStore(connStr, store.CacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dbStore.Close() })
+	for _, tenantID := range tenantIDs {
+		if _, err := dbStore.CreateTenant(ctx, &store.CreateTenantRequest{
+			TenantID: tenantID,
+			Hosts:    []string{tenantID + ".example.com"},
+			LRS:      store.LRSConfigRequest{Endpoint: "https://lrs.example.com/xapi/", Username: tenantID, Password: tenantID + "-password"},
+			Auth: store.AuthConfigRequest{
+				JWTSecret:        testJWTSecret,
+				JWTTTLSeconds:    3600,
+				PermissionPolicy: "strict",
+				LMSAPIKeys:       []store.LMSAPIKeyRequest{{Description: "test"}},
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := New(dbStore, store.NewMemoryRevocationList(), store.NewMemoryFetchTokenStore(),
+		store.NewMemoryNonceStore(), audit.Discard, usage.NewMeter(nil))
+	return h, dbStore
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/lti"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/middleware"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/usage"
+)
+
+// LTILogin handles GET/POST /lti/login - LTI 1.3 OIDC login initiation
+func (h *Handler) LTILogin(w http.ResponseWriter, r *http.Request) {
+	tenant := r.Context().Value(middleware.TenantKey).(*store.TenantConfig)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	login, err := lti.ParseLoginRequest(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	platform, err := lti.FindPlatform(tenant, login.Issuer, login.ClientID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"issuer":    login.Issuer,
+			"error":     err.Error(),
+		}).Warn("LTI login from unknown platform")
+		http.Error(w, "Unknown LTI platform", http.StatusBadRequest)
+		return
+	}
+
+	state, nonce, err := lti.NewState(tenant, platform)
+	if err != nil {
+		log.WithError(err).Error("Failed to create LTI state")
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+		return
+	}
+
+	redirect, err := lti.AuthRedirectURL(platform, login, baseURL(r)+"/lti/launch", state, nonce)
+	if err != nil {
+		log.WithError(err).Error("Failed to build LTI auth redirect")
+		http.Error(w, "Login failed", http.StatusInternalServerError)
+		return
+	}
+
+	// The launch is a cross-site POST from the platform, possibly in an
+	// iframe, so the cookie must be SameSite=None (and therefore Secure)
+	http.SetCookie(w, &http.Cookie{
+		Name:     lti.StateCookieName(nonce),
+		Value:    state,
+		Path:     launchPath(r),
+		MaxAge:   int(lti.StateTTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// LTILaunch handles POST /lti/launch - validates the platform id_token,
+// issues a proxy token and redirects the learner to the content
+func (h *Handler) LTILaunch(w http.ResponseWriter, r *http.Request) {
+	tenant := r.Context().Value(middleware.TenantKey).(*store.TenantConfig)
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if errCode := r.PostForm.Get("error"); errCode != "" {
+		log.WithFields(log.Fields{
+			"tenant_id":   tenant.TenantID,
+			"error":       errCode,
+			"description": r.PostForm.Get("error_description"),
+		}).Warn("LTI platform returned authentication error")
+		http.Error(w, "LTI authentication failed", http.StatusUnauthorized)
+		return
+	}
+
+	state := r.PostForm.Get("state")
+	issuer, nonce, err := lti.ParseState(tenant, state)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"error":     err.Error(),
+		}).Warn("LTI launch with invalid state")
+		http.Error(w, "Invalid launch state", http.StatusUnauthorized)
+		return
+	}
+
+	// The state must come back to the browser that started the login
+	cookie, err := r.Cookie(lti.StateCookieName(nonce))
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"issuer":    issuer,
+		}).Warn("LTI launch without the login's state cookie")
+		http.Error(w, "Invalid launch state", http.StatusUnauthorized)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookie.Name,
+		Path:     launchPath(r),
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+
+	platform, err := lti.FindPlatform(tenant, issuer, "")
+	if err != nil {
+		http.Error(w, "Unknown LTI platform", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := lti.VerifyLaunch(platform, r.PostForm.Get("id_token"), nonce)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"issuer":    issuer,
+			"error":     err.Error(),
+		}).Warn("LTI launch rejected")
+		http.Error(w, "Invalid LTI launch", http.StatusUnauthorized)
+		return
+	}
+
+	fresh, err := h.ltiNonces.UseNonce(r.Context(), nonce, lti.StateTTL)
+	if err != nil {
+		log.WithError(err).Error("Failed to record LTI nonce")
+		http.Error(w, "Launch failed", http.StatusInternalServerError)
+		return
+	}
+	if !fresh {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"issuer":    issuer,
+		}).Warn("LTI launch replayed")
+		http.Error(w, "Invalid LTI launch", http.StatusUnauthorized)
+		return
+	}
+
+	contentURL, err := claims.ContentURL(platform)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"issuer":    issuer,
+			"error":     err.Error(),
+		}).Warn("LTI launch to disallowed content")
+		http.Error(w, "Content URL not allowed", http.StatusForbidden)
+		return
+	}
+
+	req := models.TokenRequest{
+		Actor:        claims.Actor(),
+		Registration: claims.Registration(),
+		ActivityID:   claims.ActivityID(),
+		CourseID:     claims.CourseID(),
+		Permissions:  platform.Permissions,
+	}
+
+	reason, err := h.checkApprovals(r.Context(), tenant, &req)
+	if err != nil {
+		log.WithError(err).Error("Failed to check permission approvals")
+		http.Error(w, "Launch failed", http.StatusInternalServerError)
+		return
+	}
+	if reason != "" {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"issuer":    issuer,
+			"reason":    reason,
+		}).Warn("LTI launch for unapproved permission")
+		h.audit.Record(tokenEvent(r, tenant, &req).Deny(reason))
+		http.Error(w, reason, http.StatusForbidden)
+		return
+	}
+
+	if h.quotaExceeded(w, tenant, usage.TokensIssued) {
+		return
+	}
+
+	resp, err := h.issueToken(r, tenant, &req)
+	if err != nil {
+		log.WithError(err).Error("Failed to sign JWT")
+		http.Error(w, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.storeFetchToken(r, tenant, resp); err != nil {
+		log.WithError(err).Error("Failed to store fetch token")
+		http.Error(w, "Launch failed", http.StatusInternalServerError)
+		return
+	}
+
+	launchURL, err := lti.LaunchURL(contentURL, baseURL(r)+"/xapi/", resp.FetchURL, req.Actor, req.Registration, req.ActivityID)
+	if err != nil {
+		log.WithError(err).Error("Failed to build content launch URL")
+		http.Error(w, "Launch failed", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, launchURL, http.StatusFound)
+}
+
+// launchPath returns the path of the launch endpoint under the tenant path
+// prefix the request came in under, which scopes the state cookie
+func launchPath(r *http.Request) string {
+	basePath, _ := r.Context().Value(middleware.BasePathKey).(string)
+	return basePath + "/lti/launch"
+}
+
+// baseURL returns the proxy's externally visible scheme and host, and the
+// tenant path prefix the request came in under
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	basePath, _ := r.Context().Value(middleware.BasePathKey).(string)
+	return scheme + "://" + r.Host + basePath
+}
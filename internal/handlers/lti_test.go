@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/lti"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// ltiTestLogin starts a login and returns the state, its nonce and the
+// state cookie set for the browser
+func ltiTestLogin(t *testing.T, h *Handler, tenant *store.TenantConfig) (string, string, *http.Cookie) {
+	t.Helper()
+	form := url.Values{
+		"iss":             {"https://lms.example.com"},
+		"login_hint":      {"learner-1"},
+		"target_link_uri": {"https://content.example.com/course/1"},
+		"client_id":       {"tool-1"},
+	}
+	r := httptest.NewRequest(http.MethodGet, "https://proxy.example.com/lti/login?"+form.Encode(), nil)
+	w := serveTenant(h.LTILogin, tenant, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d: %s", w.Code, w.Body)
+	}
+
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, nonce := redirect.Query().Get("state"), redirect.Query().Get("nonce")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != lti.StateCookieName(nonce) || cookies[0].Value != state {
+		t.Fatalf("login cookies = %v, want the state under %s", cookies, lti.StateCookieName(nonce))
+	}
+	if !cookies[0].Secure || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteNoneMode {
+		t.Errorf("state cookie = %+v, want Secure, HttpOnly and SameSite=None", cookies[0])
+	}
+	return state, nonce, cookies[0]
+}
+
+// ltiTestLaunch posts a launch with an id_token and an optional cookie
+func ltiTestLaunch(h *Handler, tenant *store.TenantConfig, state, idToken string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	form := url.Values{"state": {state}, "id_token": {idToken}}
+	r := httptest.NewRequest(http.MethodPost, "https://proxy.example.com/lti/launch", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	return serveTenant(h.LTILaunch, tenant, r)
+}
+
+func TestLTILaunch(t *testing.T) {
+	lmsKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, tenant := newTestHandler(t, config.Config{
+		Auth: config.AuthConfig{LMSAPIKeys: []config.LMSAPIKeyConfig{{Key: "lms-key"}}},
+		LTI: config.LTIConfig{Platforms: []config.LTIPlatformConfig{{
+			Issuer:             "https://lms.example.com",
+			ClientID:           "tool-1",
+			DeploymentIDs:      []string{"deployment-1"},
+			AuthLoginURL:       "https://lms.example.com/auth",
+			JWKSFile:           writeTestJWKS(t, lmsKey, "lms-1"),
+			ContentURLPrefixes: []string{"https://content.example.com/"},
+		}}},
+	})
+
+	idToken := func(nonce string, edit func(jwt.MapClaims)) string {
+		claims := jwt.MapClaims{
+			"iss":   "https://lms.example.com",
+			"aud":   "tool-1",
+			"sub":   "learner-1",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": nonce,
+			"https://purl.imsglobal.org/spec/lti/claim/message_type":    lti.MessageTypeResourceLink,
+			"https://purl.imsglobal.org/spec/lti/claim/version":         lti.Version,
+			"https://purl.imsglobal.org/spec/lti/claim/deployment_id":   "deployment-1",
+			"https://purl.imsglobal.org/spec/lti/claim/target_link_uri": "https://content.example.com/course/1",
+			"https://purl.imsglobal.org/spec/lti/claim/resource_link":   map[string]string{"id": "link-1"},
+		}
+		if edit != nil {
+			edit(claims)
+		}
+		return signTestJWT(t, lmsKey, "lms-1", claims)
+	}
+
+	t.Run("launch", func(t *testing.T) {
+		state, nonce, cookie := ltiTestLogin(t, h, tenant)
+		w := ltiTestLaunch(h, tenant, state, idToken(nonce, nil), cookie)
+		if w.Code != http.StatusFound {
+			t.Fatalf("launch status = %d: %s", w.Code, w.Body)
+		}
+		if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+			t.Errorf("launch cookies = %v, want the state cookie deleted", cookies)
+		}
+
+		launch, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := launch.Query()
+		if !strings.HasPrefix(launch.String(), "https://content.example.com/course/1?") || q.Has("auth") {
+			t.Fatalf("launch URL = %s, want the content with no token", launch)
+		}
+		fetchURL := q.Get("fetch")
+		if !strings.HasPrefix(fetchURL, "https://proxy.example.com/fetch/") {
+			t.Fatalf("fetch = %q, want a fetch URL", fetchURL)
+		}
+
+		fetch := func() *httptest.ResponseRecorder {
+			r := httptest.NewRequest(http.MethodPost, fetchURL, nil)
+			r = mux.SetURLVars(r, map[string]string{"id": strings.TrimPrefix(fetchURL, "https://proxy.example.com/fetch/")})
+			return serveTenant(h.FetchToken, tenant, r)
+		}
+		w = fetch()
+		var fetched map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&fetched); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("fetch = %d, %v", w.Code, err)
+		}
+		claims := parseContentToken(t, fetched["auth-token"])
+		if claims.Subject != "account:learner-1@https://lms.example.com" || claims.Actor.Identifier() != claims.Subject {
+			t.Errorf("token sub = %q, actor = %+v; want the learner's account", claims.Subject, claims.Actor)
+		}
+		if claims.Registration != q.Get("registration") || claims.ActivityID != "https://content.example.com/course/1" {
+			t.Errorf("token claims = %+v, launch query = %v", claims, q)
+		}
+		if w := fetch(); w.Code != http.StatusUnauthorized {
+			t.Errorf("second fetch status = %d, want 401", w.Code)
+		}
+
+		// The same id_token, state and cookie can't launch again
+		if w := ltiTestLaunch(h, tenant, state, idToken(nonce, nil), cookie); w.Code != http.StatusUnauthorized {
+			t.Errorf("replayed launch status = %d, want 401", w.Code)
+		}
+	})
+
+	t.Run("state cookie", func(t *testing.T) {
+		state, nonce, cookie := ltiTestLogin(t, h, tenant)
+		if w := ltiTestLaunch(h, tenant, state, idToken(nonce, nil), nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("launch without cookie status = %d, want 401", w.Code)
+		}
+
+		// Another browser's login cookie doesn't match this state
+		_, _, other := ltiTestLogin(t, h, tenant)
+		other.Name = cookie.Name
+		if w := ltiTestLaunch(h, tenant, state, idToken(nonce, nil), other); w.Code != http.StatusUnauthorized {
+			t.Errorf("launch with another login's cookie status = %d, want 401", w.Code)
+		}
+
+		// A failed launch doesn't use up the nonce
+		if w := ltiTestLaunch(h, tenant, state, idToken(nonce, nil), cookie); w.Code != http.StatusFound {
+			t.Errorf("launch with the login's cookie status = %d: %s", w.Code, w.Body)
+		}
+	})
+
+	rejected := []struct {
+		name       string
+		edit       func(jwt.MapClaims)
+		wantStatus int
+	}{
+		{"other nonce", func(c jwt.MapClaims) { c["nonce"] = "other" }, http.StatusUnauthorized},
+		{"unknown deployment", func(c jwt.MapClaims) {
+			c["https://purl.imsglobal.org/spec/lti/claim/deployment_id"] = "deployment-2"
+		}, http.StatusUnauthorized},
+		{"content outside the allowed prefixes", func(c jwt.MapClaims) {
+			c["https://purl.imsglobal.org/spec/lti/claim/custom"] = map[string]string{"content_url": "https://evil.example.com/"}
+		}, http.StatusForbidden},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			state, nonce, cookie := ltiTestLogin(t, h, tenant)
+			w := ltiTestLaunch(h, tenant, state, idToken(nonce, tt.edit), cookie)
+			if w.Code != tt.wantStatus {
+				t.Errorf("launch status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
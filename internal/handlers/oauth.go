@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/middleware"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/oauth"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/usage"
+)
+
+// OAuthToken handles POST /oauth/token - OAuth 2.0 token endpoint for LMS clients
+func (h *Handler) OAuthToken(w http.ResponseWriter, r *http.Request) {
+	tenant := r.Context().Value(middleware.TenantKey).(*store.TenantConfig)
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, oauth.InvalidRequest("malformed form body"))
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	switch grantType {
+	case oauth.GrantTypeClientCredentials:
+		h.clientCredentialsGrant(w, r, tenant)
+	case oauth.GrantTypeTokenExchange:
+		h.tokenExchangeGrant(w, r, tenant)
+	case "":
+		writeOAuthError(w, oauth.InvalidRequest("grant_type is required"))
+	default:
+		writeOAuthError(w, oauth.UnsupportedGrantType(grantType))
+	}
+}
+
+// clientCredentialsGrant issues an LMS access token (RFC 6749 section 4.4)
+func (h *Handler) clientCredentialsGrant(w http.ResponseWriter, r *http.Request, tenant *store.TenantConfig) {
+	client, err := oauth.AuthenticateClient(r, tenant, tokenEndpointURL(r))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"error":     err.Error(),
+		}).Warn("OAuth client authentication failed")
+		h.audit.Record(audit.NewEvent(r, tenant.TenantID, audit.OpAuthenticate).Deny(err.Error()))
+		writeOAuthError(w, err)
+		return
+	}
+
+	scopes, err := oauth.GrantScopes(client, r.PostForm.Get("scope"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	accessToken, expiresAt, err := oauth.IssueAccessToken(tenant, client, scopes)
+	if err != nil {
+		log.WithError(err).Error("Failed to sign access token")
+		http.Error(w, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"tenant_id": tenant.TenantID,
+		"client_id": client.ClientID,
+		"scope":     strings.Join(scopes, " "),
+	}).Info("OAuth access token issued")
+
+	writeOAuthToken(w, models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(expiresAt).Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	})
+}
+
+// tokenExchangeGrant exchanges an upstream identity token for a content
+// JWT (RFC 8693). The caller authenticates as an OAuth client, as for the
+// client_credentials grant, and the permissions requested via scope must be
+// within both the client's scopes and the issuer's ceiling. The
+// registration, activity and course are passed as extension parameters.
+func (h *Handler) tokenExchangeGrant(w http.ResponseWriter, r *http.Request, tenant *store.TenantConfig) {
+	form := r.PostForm
+
+	client, err := oauth.AuthenticateClient(r, tenant, tokenEndpointURL(r))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"error":     err.Error(),
+		}).Warn("OAuth client authentication failed")
+		h.audit.Record(audit.NewEvent(r, tenant.TenantID, audit.OpAuthenticate).Deny(err.Error()))
+		writeOAuthError(w, err)
+		return
+	}
+
+	switch form.Get("subject_token_type") {
+	case oauth.TokenTypeJWT, oauth.TokenTypeIDToken, oauth.TokenTypeAccessToken:
+	case "":
+		writeOAuthError(w, oauth.InvalidRequest("subject_token_type is required"))
+		return
+	default:
+		writeOAuthError(w, oauth.InvalidRequest("unsupported subject_token_type"))
+		return
+	}
+	if t := form.Get("requested_token_type"); t != "" && t != oauth.TokenTypeJWT {
+		writeOAuthError(w, oauth.InvalidRequest("unsupported requested_token_type"))
+		return
+	}
+	if form.Get("actor_token") != "" {
+		writeOAuthError(w, oauth.InvalidRequest("delegation via actor_token is not supported"))
+		return
+	}
+
+	subjectToken := form.Get("subject_token")
+	if subjectToken == "" {
+		writeOAuthError(w, oauth.InvalidRequest("subject_token is required"))
+		return
+	}
+
+	req := models.TokenRequest{
+		Registration: form.Get("registration"),
+		ActivityID:   form.Get("activity_id"),
+		CourseID:     form.Get("course_id"),
+	}
+	if req.Registration == "" || req.ActivityID == "" {
+		writeOAuthError(w, oauth.InvalidRequest("registration and activity_id are required"))
+		return
+	}
+
+	issuer, claims, err := oauth.VerifySubjectToken(tenant, subjectToken)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"error":     err.Error(),
+		}).Warn("Token exchange subject token rejected")
+		h.audit.Record(tokenEvent(r, tenant, &req).Deny(err.Error()))
+		writeOAuthError(w, err)
+		return
+	}
+
+	req.Actor, err = oauth.MapActor(issuer, claims)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"issuer":    issuer.Issuer,
+			"error":     err.Error(),
+		}).Warn("Token exchange claim mapping failed")
+		writeOAuthError(w, oauth.InvalidRequest("%v", err))
+		return
+	}
+
+	req.Permissions, err = oauth.ExchangePermissions(issuer, form.Get("scope"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+	if err := oauth.ClientAllows(client, req.Permissions); err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"client_id": client.ClientID,
+			"error":     err.Error(),
+		}).Warn("Token exchange permissions exceed client scope")
+		h.audit.Record(tokenEvent(r, tenant, &req).Deny(err.Error()))
+		writeOAuthError(w, oauth.InvalidScope("%v", err))
+		return
+	}
+
+	reason, err := h.checkApprovals(r.Context(), tenant, &req)
+	if err != nil {
+		log.WithError(err).Error("Failed to check permission approvals")
+		writeOAuthError(w, err)
+		return
+	}
+	if reason != "" {
+		h.audit.Record(tokenEvent(r, tenant, &req).Deny(reason))
+		writeOAuthError(w, oauth.InvalidScope("%s", reason))
+		return
+	}
+
+	if h.quotaExceeded(w, tenant, usage.TokensIssued) {
+		return
+	}
+
+	resp, err := h.issueToken(r, tenant, &req)
+	if err != nil {
+		log.WithError(err).Error("Failed to sign JWT")
+		http.Error(w, "Token generation failed", http.StatusInternalServerError)
+		return
+	}
+
+	writeOAuthToken(w, models.OAuthTokenResponse{
+		AccessToken:     resp.Token,
+		IssuedTokenType: oauth.TokenTypeJWT,
+		TokenType:       "Bearer",
+		ExpiresIn:       int(time.Until(resp.ExpiresAt).Seconds()),
+		Scope:           "write:" + req.Permissions.Write + " read:" + req.Permissions.Read,
+	})
+}
+
+// tokenEndpointURL returns the absolute URL of the token endpoint as seen by
+// the client, used as the expected audience of client assertions
+func tokenEndpointURL(r *http.Request) string {
+	return baseURL(r) + r.URL.Path
+}
+
+// writeOAuthToken writes a successful token response (RFC 6749 section 5.1)
+func writeOAuthToken(w http.ResponseWriter, resp models.OAuthTokenResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeOAuthError writes an error response (RFC 6749 section 5.2)
+func writeOAuthError(w http.ResponseWriter, err error) {
+	oauthErr, ok := err.(*oauth.Error)
+	if !ok {
+		oauthErr = &oauth.Error{Code: "server_error", Status: http.StatusInternalServerError}
+	}
+	if oauthErr.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(oauthErr.Status)
+	json.NewEncoder(w).Encode(oauthErr)
+}
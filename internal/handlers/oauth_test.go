@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/oauth"
+)
+
+// writeTestJWKS writes a JWKS file holding key's public half under kid
+func writeTestJWKS(t *testing.T, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// signTestJWT signs claims with key under kid
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestTokenExchangeGrant(t *testing.T) {
+	idpKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, tenant := newTestHandler(t, config.Config{Auth: config.AuthConfig{
+		OAuthClients: []config.OAuthClientConfig{
+			{ClientID: "lms", ClientSecret: "lms-secret", Scopes: []string{
+				"write:actor-activity-registration-scoped", "read:actor-course-registration-scoped",
+			}},
+			{ClientID: "narrow", ClientSecret: "narrow-secret", Scopes: []string{"write:false", "read:false"}},
+		},
+		TokenExchange: config.TokenExchangeConfig{Issuers: []config.TokenExchangeIssuerConfig{{
+			Issuer:            "https://idp.example.com",
+			Audience:          "xapi-proxy",
+			JWKSFile:          writeTestJWKS(t, idpKey, "idp-1"),
+			MaxReadPermission: "actor-course-registration-scoped",
+		}}},
+	}})
+	subjectToken := func(audience string) string {
+		return signTestJWT(t, idpKey, "idp-1", jwt.MapClaims{
+			"iss": "https://idp.example.com",
+			"aud": audience,
+			"sub": "learner-1",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+	}
+
+	tests := []struct {
+		name       string
+		client     string // "id:secret" sent with client_secret_basic
+		audience   string
+		scope      string
+		wantStatus int
+		wantError  string
+	}{
+		{"no client authentication", "", "xapi-proxy", "", http.StatusUnauthorized, "invalid_client"},
+		{"wrong client secret", "lms:wrong", "xapi-proxy", "", http.StatusUnauthorized, "invalid_client"},
+		{"subject token for another audience", "lms:lms-secret", "other-app", "", http.StatusBadRequest, "invalid_request"},
+		{"above the issuer ceiling", "lms:lms-secret", "xapi-proxy", "read:course-aggregate-only", http.StatusBadRequest, "invalid_scope"},
+		{"above the client's scopes", "narrow:narrow-secret", "xapi-proxy", "", http.StatusBadRequest, "invalid_scope"},
+		{"exchanged", "lms:lms-secret", "xapi-proxy", "", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{
+				"grant_type":         {oauth.GrantTypeTokenExchange},
+				"subject_token":      {subjectToken(tt.audience)},
+				"subject_token_type": {oauth.TokenTypeIDToken},
+				"registration":       {"reg-1"},
+				"activity_id":        {"https://example.com/activity/1"},
+				"scope":              {tt.scope},
+			}
+			r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if id, secret, ok := strings.Cut(tt.client, ":"); ok {
+				r.SetBasicAuth(id, secret)
+			}
+
+			w := serveTenant(h.OAuthToken, tenant, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantError != "" {
+				var resp oauth.Error
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Code != tt.wantError {
+					t.Errorf("error = %+v, %v; want %s", resp, err, tt.wantError)
+				}
+				return
+			}
+
+			var resp models.OAuthTokenResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			claims := parseContentToken(t, resp.AccessToken)
+			if got := claims.Actor.Identifier(); got != "account:learner-1@https://idp.example.com" {
+				t.Errorf("actor = %q, want the mapped account", got)
+			}
+			if claims.Permissions.Read != "actor-activity-registration-scoped" || claims.Registration != "reg-1" {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
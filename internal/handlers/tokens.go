@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/middleware"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// RevokeTokenRequest identifies a content JWT to revoke
+type RevokeTokenRequest struct {
+	TokenID   string     `json:"token_id"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Defaults to now + the tenant JWT TTL
+}
+
+// newTokenID returns a random JWT ID (jti)
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// fetchTokenKey scopes a fetch ID to its tenant so a fetch URL can only be
+// redeemed on the tenant's own hosts
+func fetchTokenKey(tenantID, id string) string {
+	return tenantID + ":" + id
+}
+
+// storeFetchToken moves the token in resp behind a single-use fetch URL
+func (h *Handler) storeFetchToken(r *http.Request, tenant *store.TenantConfig, resp *models.TokenResponse) error {
+	id, err := newTokenID()
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(resp.ExpiresAt)
+	if err := h.fetchTokens.PutFetchToken(r.Context(), fetchTokenKey(tenant.TenantID, id), resp.Token, ttl); err != nil {
+		return err
+	}
+	resp.FetchURL = baseURL(r) + "/fetch/" + id
+	resp.Token = ""
+	return nil
+}
+
+// FetchToken handles POST /fetch/{id}, the cmi5 fetch URL. The token is
+// returned once; later calls fail.
+func (h *Handler) FetchToken(w http.ResponseWriter, r *http.Request) {
+	tenant := r.Context().Value(middleware.TenantKey).(*store.TenantConfig)
+
+	token, err := h.fetchTokens.TakeFetchToken(r.Context(), fetchTokenKey(tenant.TenantID, mux.Vars(r)["id"]))
+	if err != nil {
+		if !errors.Is(err, store.ErrFetchTokenNotFound) {
+			log.WithError(err).Error("Failed to read fetch token")
+		}
+		writeFetchError(w, "Fetch URL is invalid, expired or already used")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"auth-token": token})
+}
+
+// writeFetchError writes a cmi5 fetch URL error response
+func writeFetchError(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error-code": "1",
+		"error-text": text,
+	})
+}
+
+// RevokeToken handles POST /admin/tenants/{id}/tokens/revoke
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	tenantID := mux.Vars(r)["id"]
+
+	var req RevokeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TokenID == "" {
+		http.Error(w, "token_id is required", http.StatusBadRequest)
+		return
+	}
+
+	tenant, err := h.tenantStore.GetByID(r.Context(), tenantID)
+	if err != nil {
+		http.Error(w, "Tenant not found", http.StatusNotFound)
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(tenant.JWTTTLSeconds) * time.Second)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+	if !expiresAt.After(time.Now()) {
+		http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.revocations.RevokeToken(r.Context(), tenantID, req.TokenID, expiresAt); err != nil {
+		log.WithError(err).Error("Failed to revoke token")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"tenant_id": tenantID,
+		"token_id":  req.TokenID,
+	}).Info("Token revoked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
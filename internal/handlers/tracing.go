@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/tracing"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/validator"
+)
+
+// startValidation starts a span for a permission check of a content token
+// request
+func startValidation(r *http.Request, claims *models.Claims, operation, scope string) trace.Span {
+	_, span := tracing.Start(r.Context(), "validate "+operation, trace.WithAttributes(
+		tracing.TenantKey.String(claims.TenantID),
+		tracing.ScopeKey.String(scope),
+		tracing.RegistrationKey.String(claims.Registration),
+	))
+	return span
+}
+
+// endValidation ends a validation span, marking denials with their reason
+func endValidation(span trace.Span, err error) {
+	if err != nil {
+		span.SetAttributes(tracing.DenyReasonKey.String(validator.Reason(err)))
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
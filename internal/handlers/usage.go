@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/admin"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/middleware"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/usage"
+)
+
+// quotaExceeded checks the tenant's monthly quotas on metrics. Past a hard
+// quota it answers the request and returns true; past a soft quota it adds
+// an X-Quota-Warning header and lets the request through.
+func (h *Handler) quotaExceeded(w http.ResponseWriter, tenant *store.TenantConfig, metrics ...string) bool {
+	var used *usage.Counts
+	for _, metric := range metrics {
+		quota := tenant.Quotas.For(metric)
+		if quota == nil {
+			continue
+		}
+		if used == nil {
+			counts := h.meter.Usage(tenant.TenantID)
+			used = &counts
+		}
+		count := used.Get(metric)
+
+		if quota.Hard > 0 && count >= quota.Hard {
+			log.WithFields(log.Fields{
+				"tenant_id": tenant.TenantID,
+				"metric":    metric,
+				"used":      count,
+				"quota":     quota.Hard,
+			}).Warn("Monthly quota exceeded")
+			if quota.ExceededStatus == http.StatusTooManyRequests {
+				nextMonth := usage.MonthStart(time.Now()).AddDate(0, 1, 0)
+				w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(nextMonth).Seconds())+1))
+			}
+			http.Error(w, fmt.Sprintf("Monthly %s quota exceeded", metric), quota.ExceededStatus)
+			return true
+		}
+
+		if quota.Soft > 0 && count >= quota.Soft {
+			w.Header().Add("X-Quota-Warning", fmt.Sprintf("%s: %d of soft quota %d used this month", metric, count, quota.Soft))
+			if h.meter.FirstWarning(tenant.TenantID, metric) {
+				log.WithFields(log.Fields{
+					"tenant_id": tenant.TenantID,
+					"metric":    metric,
+					"used":      count,
+					"quota":     quota.Soft,
+				}).Warn("Monthly soft quota exceeded")
+			}
+		}
+	}
+	return false
+}
+
+// statementCounter is a ResponseWriter that counts the statements in a
+// statements response as it streams past, without buffering it
+type statementCounter struct {
+	http.ResponseWriter
+	pw    *io.PipeWriter
+	count chan int64
+}
+
+// newStatementCounter starts counting the statements written to w
+func newStatementCounter(w http.ResponseWriter) *statementCounter {
+	pr, pw := io.Pipe()
+	c := &statementCounter{ResponseWriter: w, pw: pw, count: make(chan int64, 1)}
+	go func() {
+		n := countStatements(json.NewDecoder(pr))
+		// Drain the rest, so writes never block on an undecodable body
+		io.Copy(io.Discard, pr)
+		c.count <- n
+	}()
+	return c
+}
+
+func (c *statementCounter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.pw.Write(p[:n])
+	return n, err
+}
+
+// Count ends the response and returns the number of statements in it
+func (c *statementCounter) Count() int64 {
+	c.pw.Close()
+	return <-c.count
+}
+
+// countStatements counts the statements in a StatementResult, or 1 for a
+// single statement (GET with statementId)
+func countStatements(dec *json.Decoder) int64 {
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return 0
+	}
+	var count int64
+	single := false
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return count
+		}
+		if key != "statements" {
+			if key == "id" {
+				single = true
+			}
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return count
+			}
+			continue
+		}
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return count
+		}
+		for dec.More() {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return count
+			}
+			count++
+		}
+		if _, err := dec.Token(); err != nil {
+			return count
+		}
+	}
+	if single {
+		return 1
+	}
+	return count
+}
+
+const usageDateLayout = "2006-01-02"
+
+// UsageReport handles GET /admin/usage
+func (h *Handler) UsageReport(w http.ResponseWriter, r *http.Request) {
+	dbStore, ok := h.tenantStore.(*store.DatabaseTenantStore)
+	if !ok {
+		http.Error(w, "Multi-tenant mode not enabled", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	tenantID := q.Get("tenant_id")
+	principal := r.Context().Value(middleware.AdminPrincipalKey).(*admin.Principal)
+	if tenantID == "" && principal.Role == admin.RoleTenantAdmin {
+		tenantID = principal.TenantID
+	}
+	if !principal.Can(admin.AccessRead, tenantID) {
+		log.WithFields(log.Fields{
+			"principal": principal.Name,
+			"role":      principal.Role,
+			"tenant_id": tenantID,
+		}).Warn("Admin usage access denied")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	granularity := q.Get("granularity")
+	if granularity == "" {
+		granularity = "day"
+	}
+	if granularity != "hour" && granularity != "day" && granularity != "month" {
+		http.Error(w, "granularity must be hour, day or month", http.StatusBadRequest)
+		return
+	}
+
+	// Default to the current month
+	now := time.Now().UTC()
+	since, until := usage.MonthStart(now), now
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &since}, {"until", &until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(usageDateLayout, v)
+		if err != nil {
+			t, err = time.Parse(time.RFC3339, v)
+		}
+		if err != nil {
+			http.Error(w, p.name+" must be a date (YYYY-MM-DD) or an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		*p.dst = t.UTC()
+	}
+	if !until.After(since) {
+		http.Error(w, "until must be after since", http.StatusBadRequest)
+		return
+	}
+
+	records, err := dbStore.QueryUsage(r.Context(), tenantID, since, until)
+	if err != nil {
+		log.WithError(err).Error("Failed to query usage")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	records = rollUpUsage(records, granularity)
+
+	totals := make(map[string]usage.Counts)
+	for _, rec := range records {
+		total := totals[rec.TenantID]
+		total.Add(rec.Counts)
+		totals[rec.TenantID] = total
+	}
+	if records == nil {
+		records = []*usage.Record{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"since":       since,
+		"until":       until,
+		"granularity": granularity,
+		"usage":       records,
+		"totals":      totals,
+	})
+}
+
+// rollUpUsage sums hourly records, ordered by tenant and hour, into days or
+// months
+func rollUpUsage(records []*usage.Record, granularity string) []*usage.Record {
+	if granularity == "hour" {
+		return records
+	}
+	var rolled []*usage.Record
+	var last *usage.Record
+	for _, rec := range records {
+		period := time.Date(rec.Period.Year(), rec.Period.Month(), rec.Period.Day(), 0, 0, 0, 0, time.UTC)
+		if granularity == "month" {
+			period = usage.MonthStart(period)
+		}
+		if last == nil || last.TenantID != rec.TenantID || !last.Period.Equal(period) {
+			last = &usage.Record{TenantID: rec.TenantID, Period: period}
+			rolled = append(rolled, last)
+		}
+		last.Add(rec.Counts)
+	}
+	return rolled
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/usage"
+)
+
+func TestQuotaExceeded(t *testing.T) {
+	h, tenant := newTestHandler(t, config.Config{Auth: config.AuthConfig{
+		LMSAPIKeys: []config.LMSAPIKeyConfig{{Key: "lms-key"}},
+	}})
+	h.meter.Add(tenant.TenantID, usage.Counts{StatementsWritten: 10, StatementsRead: 10, TokensIssued: 5})
+
+	tests := []struct {
+		name       string
+		quotas     store.Quotas
+		metrics    []string
+		wantStatus int // 0 when the request is let through
+		wantWarn   int // Number of X-Quota-Warning headers
+	}{
+		{
+			name:    "no quotas",
+			metrics: []string{usage.StatementsWritten},
+		},
+		{
+			name:    "under the quotas",
+			quotas:  store.Quotas{StatementsWritten: &store.Quota{Soft: 11, Hard: 20, ExceededStatus: http.StatusPaymentRequired}},
+			metrics: []string{usage.StatementsWritten},
+		},
+		{
+			name:     "soft quota reached",
+			quotas:   store.Quotas{StatementsWritten: &store.Quota{Soft: 10, Hard: 20, ExceededStatus: http.StatusPaymentRequired}},
+			metrics:  []string{usage.StatementsWritten},
+			wantWarn: 1,
+		},
+		{
+			name:       "hard quota reached",
+			quotas:     store.Quotas{StatementsWritten: &store.Quota{Hard: 10, ExceededStatus: http.StatusPaymentRequired}},
+			metrics:    []string{usage.StatementsWritten},
+			wantStatus: http.StatusPaymentRequired,
+		},
+		{
+			name:       "hard quota answering 429",
+			quotas:     store.Quotas{TokensIssued: &store.Quota{Hard: 5, ExceededStatus: http.StatusTooManyRequests}},
+			metrics:    []string{usage.TokensIssued},
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name: "soft quota of one metric and hard quota of another",
+			quotas: store.Quotas{
+				StatementsWritten: &store.Quota{Soft: 5, ExceededStatus: http.StatusPaymentRequired},
+				StatementsRead:    &store.Quota{Hard: 10, ExceededStatus: http.StatusPaymentRequired},
+			},
+			metrics:    []string{usage.StatementsWritten, usage.StatementsRead},
+			wantStatus: http.StatusPaymentRequired,
+			wantWarn:   1,
+		},
+		{
+			name:    "quota of another metric",
+			quotas:  store.Quotas{StatementsRead: &store.Quota{Hard: 1, ExceededStatus: http.StatusPaymentRequired}},
+			metrics: []string{usage.StatementsWritten},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotaTenant := *tenant
+			quotaTenant.Quotas = tt.quotas
+			w := httptest.NewRecorder()
+			exceeded := h.quotaExceeded(w, &quotaTenant, tt.metrics...)
+
+			if exceeded != (tt.wantStatus != 0) || (exceeded && w.Code != tt.wantStatus) {
+				t.Errorf("exceeded = %v with status %d, want status %d", exceeded, w.Code, tt.wantStatus)
+			}
+			if warnings := w.Header().Values("X-Quota-Warning"); len(warnings) != tt.wantWarn {
+				t.Errorf("warnings = %q, want %d", warnings, tt.wantWarn)
+			}
+
+			// Only 429 says when to retry: at the start of next month
+			retryAfter := w.Header().Get("Retry-After")
+			if tt.wantStatus != http.StatusTooManyRequests {
+				if retryAfter != "" {
+					t.Errorf("Retry-After = %q, want none", retryAfter)
+				}
+				return
+			}
+			seconds, err := strconv.Atoi(retryAfter)
+			wait := time.Until(usage.MonthStart(time.Now()).AddDate(0, 1, 0))
+			if err != nil || time.Duration(seconds)*time.Second < wait || time.Duration(seconds)*time.Second > wait+5*time.Second {
+				t.Errorf("Retry-After = %q, want about %v", retryAfter, wait)
+			}
+			if !strings.Contains(w.Body.String(), usage.TokensIssued) {
+				t.Errorf("body = %q, want the metric named", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeySet is a parsed JSON Web Key Set (RFC 7517)
+type KeySet struct {
+	keys map[string]crypto.PublicKey // kid -> key
+	// Keys without a kid, tried in order when a token omits its kid
+	anonymous []crypto.PublicKey
+}
+
+// jsonWebKey is the subset of JWK members needed for signature verification
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadFile reads a JWKS document from disk
+func LoadFile(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse parses a JWKS document. Encryption keys and unsupported key types
+// are skipped; a set with no usable signing keys is an error.
+func Parse(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	set := &KeySet{keys: make(map[string]crypto.PublicKey)}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: %w", k.Kid, err)
+		}
+		if key == nil {
+			continue
+		}
+		if k.Kid == "" {
+			set.anonymous = append(set.anonymous, key)
+		} else {
+			set.keys[k.Kid] = key
+		}
+	}
+
+	if len(set.keys) == 0 && len(set.anonymous) == 0 {
+		return nil, fmt.Errorf("JWKS contains no signing keys")
+	}
+	return set, nil
+}
+
+// Keyfunc returns the verification key for a token, selected by its kid header
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key, ok := s.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+
+	// No kid: only unambiguous if the set holds exactly one key
+	if len(s.anonymous) == 1 && len(s.keys) == 0 {
+		return s.anonymous[0], nil
+	}
+	if len(s.keys) == 1 && len(s.anonymous) == 0 {
+		for _, key := range s.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("token has no kid and key set is ambiguous")
+}
+
+// SigningMethods lists the asymmetric JWS algorithms accepted with JWKS keys
+var SigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// publicKey converts a JWK into a crypto.PublicKey. Unsupported key types
+// return nil without error.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() < 3 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+// decodeBigInt decodes a base64url (unpadded) big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
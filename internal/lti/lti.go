@@ -0,0 +1,323 @@
+package lti
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/jwks"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+const (
+	// MessageTypeResourceLink is the only LTI message type the tool accepts
+	MessageTypeResourceLink = "LtiResourceLinkRequest"
+
+	// Version is the supported LTI version
+	Version = "1.3.0"
+
+	// stateAudience scopes state tokens so they cannot be replayed elsewhere
+	stateAudience = "xapi-lrs-auth-proxy/lti-state"
+
+	// StateTTL bounds the time between login initiation and launch
+	StateTTL = 5 * time.Minute
+)
+
+// registrationNamespace is the UUID namespace for registrations derived
+// from LTI launches
+var registrationNamespace = [16]byte{
+	0x6f, 0x2c, 0x1e, 0x8a, 0x93, 0x4b, 0x4d, 0x1f,
+	0xa0, 0x53, 0x5e, 0x2d, 0x7c, 0x19, 0x0b, 0x44,
+}
+
+// LoginRequest is an OIDC third-party login initiation from a platform
+type LoginRequest struct {
+	Issuer         string
+	LoginHint      string
+	TargetLinkURI  string
+	LTIMessageHint string
+	ClientID       string
+	DeploymentID   string
+}
+
+// ParseLoginRequest reads login initiation parameters from a parsed form
+func ParseLoginRequest(form url.Values) (*LoginRequest, error) {
+	req := &LoginRequest{
+		Issuer:         form.Get("iss"),
+		LoginHint:      form.Get("login_hint"),
+		TargetLinkURI:  form.Get("target_link_uri"),
+		LTIMessageHint: form.Get("lti_message_hint"),
+		ClientID:       form.Get("client_id"),
+		DeploymentID:   form.Get("lti_deployment_id"),
+	}
+	if req.Issuer == "" || req.LoginHint == "" || req.TargetLinkURI == "" {
+		return nil, fmt.Errorf("iss, login_hint and target_link_uri are required")
+	}
+	return req, nil
+}
+
+// FindPlatform returns the tenant's platform registration for a login request
+func FindPlatform(tenant *store.TenantConfig, issuer, clientID string) (*store.LTIPlatform, error) {
+	platform, ok := tenant.LTIPlatforms[issuer]
+	if !ok {
+		return nil, fmt.Errorf("unknown LTI platform: %s", issuer)
+	}
+	if clientID != "" && clientID != platform.ClientID {
+		return nil, fmt.Errorf("unknown client_id for platform %s", issuer)
+	}
+	return platform, nil
+}
+
+// stateClaims binds a launch to the login that initiated it
+type stateClaims struct {
+	Nonce    string `json:"nonce"`
+	ClientID string `json:"client_id"`
+	jwt.RegisteredClaims
+}
+
+// NewState returns a signed state value and the nonce it commits to
+func NewState(tenant *store.TenantConfig, platform *store.LTIPlatform) (state, nonce string, err error) {
+	nonce, err = randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	claims := &stateClaims{
+		Nonce:    nonce,
+		ClientID: platform.ClientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    platform.Issuer,
+			Audience:  jwt.ClaimStrings{stateAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(StateTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	state, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(tenant.JWTSecret)
+	if err != nil {
+		return "", "", err
+	}
+	return state, nonce, nil
+}
+
+// StateCookieName names the cookie that binds a state to the browser that
+// started the login. Each login has its own, so launches in several tabs
+// don't overwrite each other.
+func StateCookieName(nonce string) string {
+	return "lti_state_" + nonce
+}
+
+// ParseState verifies a state value and returns its platform issuer and nonce
+func ParseState(tenant *store.TenantConfig, state string) (issuer, nonce string, err error) {
+	claims := &stateClaims{}
+	_, err = jwt.ParseWithClaims(state, claims, func(token *jwt.Token) (interface{}, error) {
+		return tenant.JWTSecret, nil
+	},
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithAudience(stateAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid state: %w", err)
+	}
+	return claims.Issuer, claims.Nonce, nil
+}
+
+// AuthRedirectURL builds the platform authentication request (OIDC implicit
+// flow with form_post) that completes login initiation
+func AuthRedirectURL(platform *store.LTIPlatform, login *LoginRequest, redirectURI, state, nonce string) (string, error) {
+	u, err := url.Parse(platform.AuthLoginURL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("scope", "openid")
+	q.Set("response_type", "id_token")
+	q.Set("response_mode", "form_post")
+	q.Set("prompt", "none")
+	q.Set("client_id", platform.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("login_hint", login.LoginHint)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	if login.LTIMessageHint != "" {
+		q.Set("lti_message_hint", login.LTIMessageHint)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// LaunchClaims are the id_token claims of an LTI 1.3 resource link launch
+type LaunchClaims struct {
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp,omitempty"`
+	Name            string `json:"name,omitempty"`
+
+	MessageType   string `json:"https://purl.imsglobal.org/spec/lti/claim/message_type"`
+	Version       string `json:"https://purl.imsglobal.org/spec/lti/claim/version"`
+	DeploymentID  string `json:"https://purl.imsglobal.org/spec/lti/claim/deployment_id"`
+	TargetLinkURI string `json:"https://purl.imsglobal.org/spec/lti/claim/target_link_uri"`
+	ResourceLink  struct {
+		ID    string `json:"id"`
+		Title string `json:"title,omitempty"`
+	} `json:"https://purl.imsglobal.org/spec/lti/claim/resource_link"`
+	Context *struct {
+		ID    string `json:"id"`
+		Label string `json:"label,omitempty"`
+		Title string `json:"title,omitempty"`
+	} `json:"https://purl.imsglobal.org/spec/lti/claim/context,omitempty"`
+	Custom map[string]interface{} `json:"https://purl.imsglobal.org/spec/lti/claim/custom,omitempty"`
+
+	jwt.RegisteredClaims
+}
+
+// VerifyLaunch validates a launch id_token against the platform key set and
+// the nonce committed to by the state
+func VerifyLaunch(platform *store.LTIPlatform, idToken, nonce string) (*LaunchClaims, error) {
+	claims := &LaunchClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, platform.Keys.Keyfunc,
+		jwt.WithValidMethods(jwks.SigningMethods),
+		jwt.WithIssuer(platform.Issuer),
+		jwt.WithAudience(platform.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	// OIDC core 3.1.3.7: azp must be our client when multiple audiences are present
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != platform.ClientID {
+		return nil, fmt.Errorf("invalid id_token: azp does not match client_id")
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("invalid id_token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("anonymous launches are not supported")
+	}
+	if claims.MessageType != MessageTypeResourceLink {
+		return nil, fmt.Errorf("unsupported message type: %s", claims.MessageType)
+	}
+	if claims.Version != Version {
+		return nil, fmt.Errorf("unsupported LTI version: %s", claims.Version)
+	}
+	if claims.ResourceLink.ID == "" {
+		return nil, fmt.Errorf("resource_link id is required")
+	}
+	if len(platform.DeploymentIDs) > 0 && !platform.DeploymentIDs[claims.DeploymentID] {
+		return nil, fmt.Errorf("unknown deployment_id: %s", claims.DeploymentID)
+	}
+
+	return claims, nil
+}
+
+// Actor returns the learner as an xAPI account on the platform
+func (c *LaunchClaims) Actor() models.Actor {
+	return models.Actor{
+		ObjectType: "Agent",
+		Name:       c.Name,
+		Account: &models.Account{
+			HomePage: c.Issuer,
+			Name:     c.Subject,
+		},
+	}
+}
+
+// CourseID returns the LTI context ID, if the launch has a context
+func (c *LaunchClaims) CourseID() string {
+	if c.Context == nil {
+		return ""
+	}
+	return c.Context.ID
+}
+
+// Registration derives a stable UUID (version 5) for the learner's
+// enrollment in this resource link
+func (c *LaunchClaims) Registration() string {
+	name := strings.Join([]string{c.Issuer, c.DeploymentID, c.CourseID(), c.ResourceLink.ID, c.Subject}, "\x1f")
+
+	h := sha1.New()
+	h.Write(registrationNamespace[:])
+	h.Write([]byte(name))
+	sum := h.Sum(nil)
+
+	var u [16]byte
+	copy(u[:], sum[:16])
+	u[6] = (u[6] & 0x0f) | 0x50 // version 5
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	b := hex.EncodeToString(u[:])
+	return b[0:8] + "-" + b[8:12] + "-" + b[12:16] + "-" + b[16:20] + "-" + b[20:32]
+}
+
+// ActivityID returns the xAPI activity for the launch: the "activity_id"
+// custom parameter if set, otherwise the target link URI
+func (c *LaunchClaims) ActivityID() string {
+	if id, ok := c.Custom["activity_id"].(string); ok && id != "" {
+		return id
+	}
+	return c.TargetLinkURI
+}
+
+// ContentURL returns the content to launch, which must match one of the
+// platform's allowed URL prefixes. The "content_url" custom parameter takes
+// precedence over the target link URI.
+func (c *LaunchClaims) ContentURL(platform *store.LTIPlatform) (string, error) {
+	contentURL := c.TargetLinkURI
+	if custom, ok := c.Custom["content_url"].(string); ok && custom != "" {
+		contentURL = custom
+	}
+
+	for _, prefix := range platform.ContentURLPrefixes {
+		if strings.HasPrefix(contentURL, prefix) {
+			return contentURL, nil
+		}
+	}
+	return "", fmt.Errorf("content URL not allowed: %s", contentURL)
+}
+
+// LaunchURL appends xAPI launch parameters (endpoint, fetch, actor,
+// registration, activity_id) to the content URL. The content redeems the
+// single-use fetch URL for its token, as in cmi5, so the token itself never
+// appears in browser history, Referer headers or the content host's logs.
+func LaunchURL(contentURL, endpoint, fetchURL string, actor models.Actor, registration, activityID string) (string, error) {
+	u, err := url.Parse(contentURL)
+	if err != nil {
+		return "", err
+	}
+
+	actorJSON, err := json.Marshal(actor)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("endpoint", endpoint)
+	q.Set("fetch", fetchURL)
+	q.Set("actor", string(actorJSON))
+	q.Set("registration", registration)
+	q.Set("activity_id", activityID)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// randomToken returns 128 bits of randomness, hex encoded
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
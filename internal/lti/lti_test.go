@@ -0,0 +1,215 @@
+package lti
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/jwks"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// newTestPlatform registers a platform signing with the returned key
+func newTestPlatform(t *testing.T, deploymentIDs ...string) (*rsa.PrivateKey, *store.LTIPlatform) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "lms-1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := jwks.Parse(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployments := make(map[string]bool)
+	for _, id := range deploymentIDs {
+		deployments[id] = true
+	}
+	return key, &store.LTIPlatform{
+		Issuer:             "https://lms.example.com",
+		ClientID:           "tool-1",
+		DeploymentIDs:      deployments,
+		AuthLoginURL:       "https://lms.example.com/auth",
+		Keys:               keys,
+		ContentURLPrefixes: []string{"https://content.example.com/"},
+	}
+}
+
+// launchClaims returns the claims of a valid launch with nonce
+func launchClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   "https://lms.example.com",
+		"aud":   "tool-1",
+		"sub":   "learner-1",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": nonce,
+		"https://purl.imsglobal.org/spec/lti/claim/message_type":    MessageTypeResourceLink,
+		"https://purl.imsglobal.org/spec/lti/claim/version":         Version,
+		"https://purl.imsglobal.org/spec/lti/claim/deployment_id":   "deployment-1",
+		"https://purl.imsglobal.org/spec/lti/claim/target_link_uri": "https://content.example.com/course/1",
+		"https://purl.imsglobal.org/spec/lti/claim/resource_link":   map[string]string{"id": "link-1"},
+	}
+}
+
+// signIDToken signs launch claims with the platform key
+func signIDToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "lms-1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyLaunch(t *testing.T) {
+	key, platform := newTestPlatform(t, "deployment-1")
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := launchClaims("nonce-1")
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		idToken string
+		ok      bool
+	}{
+		{"valid", signIDToken(t, key, launchClaims("nonce-1")), true},
+		{"other nonce", signIDToken(t, key, launchClaims("nonce-2")), false},
+		{"no nonce", signIDToken(t, key, with("nonce", nil)), false},
+		{"other audience", signIDToken(t, key, with("aud", "tool-2")), false},
+		{"several audiences without azp", signIDToken(t, key, with("aud", []string{"tool-1", "tool-2"})), false},
+		{"other issuer", signIDToken(t, key, with("iss", "https://evil.example.com")), false},
+		{"expired", signIDToken(t, key, with("exp", time.Now().Add(-time.Minute).Unix())), false},
+		{"wrong key", signIDToken(t, otherKey, launchClaims("nonce-1")), false},
+		{"anonymous", signIDToken(t, key, with("sub", nil)), false},
+		{"unknown deployment", signIDToken(t, key, with("https://purl.imsglobal.org/spec/lti/claim/deployment_id", "deployment-2")), false},
+		{"deep linking", signIDToken(t, key, with("https://purl.imsglobal.org/spec/lti/claim/message_type", "LtiDeepLinkingRequest")), false},
+		{"no resource link", signIDToken(t, key, with("https://purl.imsglobal.org/spec/lti/claim/resource_link", nil)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := VerifyLaunch(platform, tt.idToken, "nonce-1")
+			if tt.ok && err != nil {
+				t.Errorf("VerifyLaunch: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("VerifyLaunch = %+v, want an error", claims)
+			}
+		})
+	}
+
+	// Platforms without deployment IDs accept any deployment
+	clear(platform.DeploymentIDs)
+	if _, err := VerifyLaunch(platform, signIDToken(t, key, with("https://purl.imsglobal.org/spec/lti/claim/deployment_id", "deployment-2")), "nonce-1"); err != nil {
+		t.Errorf("VerifyLaunch with any deployment allowed: %v", err)
+	}
+}
+
+func TestState(t *testing.T) {
+	_, platform := newTestPlatform(t)
+	tenant := &store.TenantConfig{TenantID: "acme", JWTSecret: []byte("acme-secret-with-at-least-32-bytes")}
+
+	state, nonce, err := NewState(tenant, platform)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, parsedNonce, err := ParseState(tenant, state)
+	if err != nil || issuer != platform.Issuer || parsedNonce != nonce {
+		t.Errorf("ParseState = %s, %s, %v; want %s, %s", issuer, parsedNonce, err, platform.Issuer, nonce)
+	}
+
+	other := &store.TenantConfig{TenantID: "globex", JWTSecret: []byte("globex-secret-with-at-least-32-bytes")}
+	if _, _, err := ParseState(other, state); err == nil {
+		t.Error("state signed for another tenant accepted")
+	}
+	if _, _, err := ParseState(tenant, state+"x"); err == nil {
+		t.Error("tampered state accepted")
+	}
+}
+
+func TestContentURL(t *testing.T) {
+	_, platform := newTestPlatform(t)
+
+	tests := []struct {
+		target string
+		custom string
+		want   string // Empty when the URL is not allowed
+	}{
+		{"https://content.example.com/course/1", "", "https://content.example.com/course/1"},
+		{"https://lms.example.com/launch", "https://content.example.com/course/2", "https://content.example.com/course/2"},
+		{"https://content.example.com/course/1", "https://evil.example.com/", ""},
+		{"https://content.example.com.evil.example.com/", "", ""},
+		{"https://evil.example.com/?next=https://content.example.com/", "", ""},
+	}
+
+	for _, tt := range tests {
+		claims := &LaunchClaims{TargetLinkURI: tt.target}
+		if tt.custom != "" {
+			claims.Custom = map[string]interface{}{"content_url": tt.custom}
+		}
+		got, err := claims.ContentURL(platform)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ContentURL(%s, %s) = %s, want an error", tt.target, tt.custom, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ContentURL(%s, %s) = %s, %v; want %s", tt.target, tt.custom, got, err, tt.want)
+		}
+	}
+}
+
+func TestLaunchURL(t *testing.T) {
+	actor := models.Actor{ObjectType: "Agent", Account: &models.Account{HomePage: "https://lms.example.com", Name: "learner-1"}}
+	launch, err := LaunchURL("https://content.example.com/course/1?lang=en", "https://proxy.example.com/xapi/",
+		"https://proxy.example.com/fetch/abc", actor, "reg-1", "https://example.com/activity/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(launch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("fetch") != "https://proxy.example.com/fetch/abc" || q.Get("lang") != "en" || q.Get("registration") != "reg-1" {
+		t.Errorf("launch URL query = %v", q)
+	}
+	if q.Has("auth") || strings.Contains(launch, "Bearer") {
+		t.Errorf("launch URL carries a token: %s", launch)
+	}
+}
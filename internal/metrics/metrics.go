@@ -0,0 +1,143 @@
+// Package metrics defines the proxy's Prometheus metrics. They are
+// registered in their own registry, served by Handler on the metrics
+// listener rather than on the public port.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+const namespace = "xlp"
+
+// Registry holds every metric of the proxy, and Go runtime and process
+// metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts requests by route template, method, status and
+	// tenant
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method, status and tenant.",
+	}, []string{"route", "method", "status", "tenant"})
+
+	// HTTPDuration observes request latency
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method, status and tenant.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status", "tenant"})
+
+	// LRSRequests counts requests forwarded to an LRS by response status,
+	// or "error" when no response was received
+	LRSRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lrs_requests_total",
+		Help:      "Requests forwarded to the LRS by tenant, method and response status.",
+	}, []string{"tenant", "method", "status"})
+
+	// LRSDuration observes LRS latency up to the response headers
+	LRSDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "lrs_request_duration_seconds",
+		Help:      "LRS latency until response headers, by tenant and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"tenant", "method"})
+
+	// LRSErrors counts failed LRS requests: "transport" when the LRS could
+	// not be reached, "server" for 5xx responses
+	LRSErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lrs_errors_total",
+		Help:      "Failed LRS requests by tenant and kind (transport or server).",
+	}, []string{"tenant", "kind"})
+
+	// ValidatorDenials counts xAPI requests denied by the permission
+	// validator
+	ValidatorDenials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validator_denials_total",
+		Help:      "xAPI requests denied by permission scope and reason.",
+	}, []string{"tenant", "scope", "reason"})
+
+	// TokensIssued counts content tokens by write and read permission
+	TokensIssued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Content tokens issued by tenant and write/read permission.",
+	}, []string{"tenant", "write", "read"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		LRSRequests,
+		LRSDuration,
+		LRSErrors,
+		ValidatorDenials,
+		TokensIssued,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// CacheStatsSource reports the effectiveness of a tenant cache
+type CacheStatsSource interface {
+	CacheStats() store.CacheStats
+}
+
+// RegisterTenantCache exports a tenant cache's hits, misses, hit ratio and
+// size, labeled with the cache name
+func RegisterTenantCache(name string, source CacheStatsSource) {
+	Registry.MustRegister(&cacheCollector{name: name, source: source})
+}
+
+var (
+	cacheHitsDesc = prometheus.NewDesc(namespace+"_tenant_cache_hits_total",
+		"Tenant cache lookups served from the cache.", []string{"cache"}, nil)
+	cacheMissesDesc = prometheus.NewDesc(namespace+"_tenant_cache_misses_total",
+		"Tenant cache lookups that went to the backing store.", []string{"cache"}, nil)
+	cacheRatioDesc = prometheus.NewDesc(namespace+"_tenant_cache_hit_ratio",
+		"Share of tenant cache lookups served from the cache since startup.", []string{"cache"}, nil)
+	cacheEntriesDesc = prometheus.NewDesc(namespace+"_tenant_cache_entries",
+		"Tenants in the cache.", []string{"cache"}, nil)
+)
+
+// cacheCollector reads cache statistics at scrape time
+type cacheCollector struct {
+	name   string
+	source CacheStatsSource
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheRatioDesc
+	ch <- cacheEntriesDesc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.source.CacheStats()
+	var ratio float64
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		ratio = float64(stats.Hits) / float64(lookups)
+	}
+	ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stats.Hits), c.name)
+	ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stats.Misses), c.name)
+	ch <- prometheus.MustNewConstMetric(cacheRatioDesc, prometheus.GaugeValue, ratio, c.name)
+	ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(stats.Entries), c.name)
+}
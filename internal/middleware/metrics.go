@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/metrics"
+)
+
+// requestTenantKey holds a *requestTenant that TenantMiddleware fills in, so
+// that middleware running before tenant resolution can label the request
+const requestTenantKey ContextKey = "request_tenant"
+
+// requestTenant is the tenant a request was resolved to
+type requestTenant struct {
+	id string
+}
+
+// withRequestTenant returns r carrying a requestTenant, reusing one set by
+// an outer middleware
+func withRequestTenant(r *http.Request) (*http.Request, *requestTenant) {
+	if rt, ok := r.Context().Value(requestTenantKey).(*requestTenant); ok {
+		return r, rt
+	}
+	rt := &requestTenant{}
+	return r.WithContext(context.WithValue(r.Context(), requestTenantKey, rt)), rt
+}
+
+// MetricsMiddleware counts requests and observes their latency, labeled by
+// route template rather than path so that IDs in paths do not create series
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, tenant := withRequestTenant(r)
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next.ServeHTTP(wrapped, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		labels := []string{route, r.Method, strconv.Itoa(wrapped.statusCode), tenant.id}
+		metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+		metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	})
+}
@@ -2,15 +2,23 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/admin"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/oauth"
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/tracing"
 )
 
 // ContextKey type for context keys
@@ -19,145 +27,339 @@ type ContextKey string
 const (
 	TenantKey ContextKey = "tenant"
 	ClaimsKey ContextKey = "claims"
+	// APIKeyKey holds the *store.LMSAPIKey the LMS authenticated with
+	APIKeyKey ContextKey = "api_key"
+	// AccessClaimsKey holds *oauth.AccessClaims when the LMS authenticated
+	// with an OAuth access token instead of a static API key
+	AccessClaimsKey ContextKey = "access_claims"
+	// AdminPrincipalKey holds the authenticated *admin.Principal
+	AdminPrincipalKey ContextKey = "admin_principal"
 )
 
-// TenantMiddleware resolves tenant from Host header
-func TenantMiddleware(tenantStore store.TenantStore) func(http.Handler) http.Handler {
+// TenantMiddleware resolves the request's tenant
+func TenantMiddleware(resolver TenantResolver) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			tenant, err := tenantStore.GetByHost(r.Context(), r.Host)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"host":  r.Host,
-					"error": err.Error(),
-				}).Warn("Tenant not found")
-				http.Error(w, "Tenant not found", http.StatusNotFound)
+			spanCtx, span := tracing.Start(r.Context(), "TenantMiddleware")
+			tenant, ok := resolveTenant(w, r.WithContext(spanCtx), resolver)
+			if ok {
+				span.SetAttributes(tracing.TenantKey.String(tenant.TenantID))
+			} else {
+				span.SetStatus(codes.Error, "tenant not served")
+			}
+			span.End()
+			if !ok {
 				return
 			}
 
 			// Add tenant to context
+			if rt, ok := r.Context().Value(requestTenantKey).(*requestTenant); ok {
+				rt.id = tenant.TenantID
+			}
 			ctx := context.WithValue(r.Context(), TenantKey, tenant)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
-// LMSAuthMiddleware validates LMS API key
-func LMSAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tenant := r.Context().Value(TenantKey).(*store.TenantConfig)
+// resolveTenant resolves the request's tenant and checks it is active,
+// answering the request if not
+func resolveTenant(w http.ResponseWriter, r *http.Request, resolver TenantResolver) (*store.TenantConfig, bool) {
+	tenant, err := resolver.ResolveTenant(r)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"host":  r.Host,
+			"error": err.Error(),
+		}).Warn("Tenant not found")
+		http.Error(w, "Tenant not found", http.StatusNotFound)
+		return nil, false
+	}
 
-		// Extract API key from Authorization header
-		auth := r.Header.Get("Authorization")
-		if auth == "" {
-			http.Error(w, "Authorization required", http.StatusUnauthorized)
-			return
+	// Suspended and deleted tenants serve nothing, so tokens issued
+	// before the status change stop working as well
+	if err := tenant.CheckStatus(); err != nil {
+		log.WithFields(log.Fields{
+			"host":      r.Host,
+			"tenant_id": tenant.TenantID,
+			"status":    tenant.Status,
+		}).Warn("Request for inactive tenant")
+		switch {
+		case errors.Is(err, store.ErrTenantSuspended):
+			http.Error(w, "Tenant suspended", http.StatusForbidden)
+		case errors.Is(err, store.ErrTenantDeleted):
+			http.Error(w, "Tenant deleted", http.StatusGone)
+		default:
+			http.Error(w, "Tenant unavailable", http.StatusServiceUnavailable)
 		}
+		return nil, false
+	}
 
-		// Parse Bearer token
-		parts := strings.SplitN(auth, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
-			return
-		}
+	return tenant, true
+}
+
+// LMSAuthMiddleware validates LMS API key or OAuth access token. Key usage
+// is recorded when the store supports it, and rejected credentials in the
+// audit log.
+func LMSAuthMiddleware(tenantStore store.TenantStore, auditor audit.Recorder) func(http.Handler) http.Handler {
+	recorder, _ := tenantStore.(store.APIKeyUsageRecorder)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant := r.Context().Value(TenantKey).(*store.TenantConfig)
+
+			// Extract API key from Authorization header
+			auth := r.Header.Get("Authorization")
+			if auth == "" {
+				http.Error(w, "Authorization required", http.StatusUnauthorized)
+				return
+			}
+
+			// Parse Bearer token
+			parts := strings.SplitN(auth, " ", 2)
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
+				return
+			}
+
+			apiKey := parts[1]
+
+			// Validate API key against tenant's keys
+			key, err := tenant.LookupAPIKey(apiKey)
+			if err == nil {
+				if recorder != nil && key.ID != 0 && key.ShouldTouch(time.Now()) {
+					go touchAPIKey(recorder, tenant.TenantID, key)
+				}
+				ctx := context.WithValue(r.Context(), APIKeyKey, key)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			if errors.Is(err, store.ErrAPIKeyExpired) {
+				log.WithFields(log.Fields{
+					"tenant_id":  tenant.TenantID,
+					"key_prefix": key.Prefix,
+				}).Warn("Expired LMS API key")
+				auditor.Record(audit.NewEvent(r, tenant.TenantID, audit.OpAuthenticate).Deny("API key expired"))
+				http.Error(w, "API key expired", http.StatusUnauthorized)
+				return
+			}
 
-		apiKey := parts[1]
+			// Fall back to an OAuth access token from /oauth/token
+			if len(tenant.OAuthClients) > 0 {
+				accessClaims, err := oauth.ParseAccessToken(tenant, apiKey)
+				if err == nil {
+					ctx := context.WithValue(r.Context(), AccessClaimsKey, accessClaims)
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+			}
 
-		// Validate API key against tenant's keys
-		if !tenant.LMSAPIKeys[apiKey] {
 			log.WithFields(log.Fields{
 				"tenant_id": tenant.TenantID,
 			}).Warn("Invalid LMS API key")
+			auditor.Record(audit.NewEvent(r, tenant.TenantID, audit.OpAuthenticate).Deny("invalid API key"))
 			http.Error(w, "Invalid API key", http.StatusUnauthorized)
-			return
-		}
+		})
+	}
+}
 
-		next.ServeHTTP(w, r)
-	})
+// touchAPIKey records a key's last use without holding up the request
+func touchAPIKey(recorder store.APIKeyUsageRecorder, tenantID string, key *store.LMSAPIKey) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := recorder.TouchAPIKey(ctx, tenantID, key.ID); err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id":  tenantID,
+			"key_prefix": key.Prefix,
+			"error":      err.Error(),
+		}).Warn("Failed to record API key use")
+	}
+}
+
+// JWTAuthMiddleware validates JWT token and rejects revoked token IDs.
+// Rejected tokens are recorded in the audit log.
+func JWTAuthMiddleware(revocations store.TokenRevocationList, auditor audit.Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return jwtAuth(revocations, auditor, next)
+	}
 }
 
-// JWTAuthMiddleware validates JWT token
-func JWTAuthMiddleware(next http.Handler) http.Handler {
+// jwtAuth is the JWTAuthMiddleware handler for one route tree
+func jwtAuth(revocations store.TokenRevocationList, auditor audit.Recorder, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tenant := r.Context().Value(TenantKey).(*store.TenantConfig)
 
-		// Extract JWT from Authorization header
-		auth := r.Header.Get("Authorization")
-		if auth == "" {
-			http.Error(w, "Authorization required", http.StatusUnauthorized)
+		spanCtx, span := tracing.Start(r.Context(), "JWTAuthMiddleware",
+			trace.WithAttributes(tracing.TenantKey.String(tenant.TenantID)))
+		claims, ok := authenticateJWT(w, r.WithContext(spanCtx), tenant, revocations, auditor)
+		if ok {
+			span.SetAttributes(
+				tracing.RegistrationKey.String(claims.Registration),
+				tracing.WriteScopeKey.String(claims.Permissions.Write),
+				tracing.ReadScopeKey.String(claims.Permissions.Read),
+			)
+		} else {
+			span.SetStatus(codes.Error, "token rejected")
+		}
+		span.End()
+		if !ok {
 			return
 		}
 
-		// Parse Bearer token
-		parts := strings.SplitN(auth, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
-			return
+		// Add claims to context
+		ctx := context.WithValue(r.Context(), ClaimsKey, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateJWT validates the request's content token for the tenant,
+// answering the request if it is rejected
+func authenticateJWT(w http.ResponseWriter, r *http.Request, tenant *store.TenantConfig,
+	revocations store.TokenRevocationList, auditor audit.Recorder) (*models.Claims, bool) {
+	// Extract JWT from Authorization header
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		http.Error(w, "Authorization required", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Parse Bearer token
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	tokenString := parts[1]
+
+	// Parse and validate JWT
+	token, err := jwt.ParseWithClaims(tokenString, &models.Claims{}, func(token *jwt.Token) (interface{}, error) {
+		// Verify signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
 		}
+		return tenant.JWTSecret, nil
+	})
 
-		tokenString := parts[1]
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenant.TenantID,
+			"error":     err.Error(),
+		}).Warn("JWT validation failed")
+		auditor.Record(audit.NewEvent(r, tenant.TenantID, audit.OpAuthenticate).Deny(err.Error()))
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
 
-		// Parse and validate JWT
-		token, err := jwt.ParseWithClaims(tokenString, &models.Claims{}, func(token *jwt.Token) (interface{}, error) {
-			// Verify signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return tenant.JWTSecret, nil
-		})
+	if !token.Valid {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	claims, ok := token.Claims.(*models.Claims)
+	if !ok {
+		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// LMS access tokens are not valid for the xAPI proxy
+	if oauth.HasAudience(claims.RegisteredClaims) {
+		log.WithField("tenant_id", tenant.TenantID).Warn("LMS access token presented to xAPI proxy")
+		auditor.Record(audit.NewEvent(r, tenant.TenantID, audit.OpAuthenticate).Deny("LMS access token presented"))
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Verify tenant matches
+	if claims.TenantID != tenant.TenantID {
+		log.WithFields(log.Fields{
+			"token_tenant": claims.TenantID,
+			"host_tenant":  tenant.TenantID,
+		}).Warn("Tenant mismatch in token")
+		auditor.Record(audit.NewEvent(r, tenant.TenantID, audit.OpAuthenticate).Deny("token issued for tenant " + claims.TenantID))
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil, false
+	}
 
+	if claims.ID != "" {
+		revoked, err := revocations.IsTokenRevoked(r.Context(), tenant.TenantID, claims.ID)
 		if err != nil {
+			log.WithError(err).Error("Token revocation check failed")
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return nil, false
+		}
+		if revoked {
 			log.WithFields(log.Fields{
 				"tenant_id": tenant.TenantID,
-				"error":     err.Error(),
-			}).Warn("JWT validation failed")
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
+				"token_id":  claims.ID,
+			}).Warn("Revoked token presented")
+			e := audit.NewEvent(r, tenant.TenantID, audit.OpAuthenticate).Deny("token revoked")
+			e.ActorMbox = claims.Actor.Identifier()
+			e.Registration = claims.Registration
+			auditor.Record(e)
+			http.Error(w, "Token revoked", http.StatusUnauthorized)
+			return nil, false
 		}
+	}
 
-		if !token.Valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
+	return claims, true
+}
 
-		claims, ok := token.Claims.(*models.Claims)
-		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-			return
-		}
+// AdminAuthMiddleware authenticates admin API callers and records every
+// admin request, allowed or not, in the audit log
+func AdminAuthMiddleware(authn *admin.Authenticator, recorder audit.Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			var principal *admin.Principal
+			defer func() {
+				recordAdminAction(r, principal, wrapped.statusCode, recorder)
+			}()
+
+			auth := r.Header.Get("Authorization")
+			if auth == "" {
+				http.Error(wrapped, "Authorization required", http.StatusUnauthorized)
+				return
+			}
 
-		// Verify tenant matches
-		if claims.TenantID != tenant.TenantID {
-			log.WithFields(log.Fields{
-				"token_tenant": claims.TenantID,
-				"host_tenant":  tenant.TenantID,
-			}).Warn("Tenant mismatch in token")
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
+			parts := strings.SplitN(auth, " ", 2)
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				http.Error(wrapped, "Invalid authorization format", http.StatusUnauthorized)
+				return
+			}
 
-		// Add claims to context
-		ctx := context.WithValue(r.Context(), ClaimsKey, claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+			p, err := authn.Authenticate(parts[1])
+			if err != nil {
+				log.WithFields(log.Fields{
+					"path":  r.URL.Path,
+					"error": err.Error(),
+				}).Warn("Admin authentication failed")
+				http.Error(wrapped, "Invalid admin credentials", http.StatusUnauthorized)
+				return
+			}
+			principal = p
+
+			ctx := context.WithValue(r.Context(), AdminPrincipalKey, principal)
+			next.ServeHTTP(wrapped, r.WithContext(ctx))
+		})
+	}
 }
 
-// AdminAuthMiddleware validates admin API access
-func AdminAuthMiddleware(next http.Handler) http.Handler {
+// RequireAdmin rejects admin principals without the given access to the
+// tenant named by the route's {id} variable
+func RequireAdmin(access admin.Access, next http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// In production, implement proper admin authentication
-		// For now, just check for admin token
-		auth := r.Header.Get("Authorization")
-		if auth == "" {
-			http.Error(w, "Authorization required", http.StatusUnauthorized)
-			return
-		}
+		principal := r.Context().Value(AdminPrincipalKey).(*admin.Principal)
+		tenantID := mux.Vars(r)["id"]
 
-		// TODO: Implement proper admin auth (OAuth, API keys, etc.)
-		// For reference implementation, accept any Bearer token
-		parts := strings.SplitN(auth, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization format", http.StatusUnauthorized)
+		if !principal.Can(access, tenantID) {
+			log.WithFields(log.Fields{
+				"principal": principal.Name,
+				"role":      principal.Role,
+				"tenant_id": tenantID,
+				"path":      r.URL.Path,
+			}).Warn("Admin access denied")
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
@@ -165,31 +367,49 @@ func AdminAuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// recordAdminAction writes an admin request to the audit log
+func recordAdminAction(r *http.Request, principal *admin.Principal, status int, recorder audit.Recorder) {
+	event := audit.NewEvent(r, mux.Vars(r)["id"], audit.OpAdminAction)
+	if principal != nil {
+		event.AdminPrincipal = principal.Name
+		event.AdminRole = string(principal.Role)
+	}
+	if status >= 400 {
+		event.Deny(http.StatusText(status))
+	}
+
+	log.WithFields(log.Fields{
+		"principal": event.AdminPrincipal,
+		"role":      event.AdminRole,
+		"tenant_id": event.TenantID,
+		"method":    event.RequestMethod,
+		"path":      event.RequestPath,
+		"status":    status,
+	}).Info("Admin action")
+
+	recorder.Record(event)
+}
+
 // LoggingMiddleware logs all requests
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		r, tenant := withRequestTenant(r)
 
 		// Create response writer wrapper to capture status code
 		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 
 		next.ServeHTTP(wrapped, r)
 
-		// Get tenant if available
-		var tenantID string
-		if tenant, ok := r.Context().Value(TenantKey).(*store.TenantConfig); ok {
-			tenantID = tenant.TenantID
-		}
-
 		// Log request
 		log.WithFields(log.Fields{
-			"method":     r.Method,
-			"path":       r.URL.Path,
-			"status":     wrapped.statusCode,
-			"duration":   time.Since(start).Milliseconds(),
-			"tenant_id":  tenantID,
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      wrapped.statusCode,
+			"duration":    time.Since(start).Milliseconds(),
+			"tenant_id":   tenant.id,
 			"remote_addr": r.RemoteAddr,
-			"user_agent": r.UserAgent(),
+			"user_agent":  r.UserAgent(),
 		}).Info("Request processed")
 	})
 }
@@ -222,3 +442,8 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
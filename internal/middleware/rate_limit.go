@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/oauth"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// rateLimitBucket is a token bucket a request is counted against
+type rateLimitBucket struct {
+	scope string
+	store.RateLimitBucket
+}
+
+// RateLimitMiddleware enforces the tenant's rate limits, answering 429 with
+// Retry-After when a bucket is empty. It runs after authentication, so that
+// requests are also counted per API key, OAuth client or content token actor
+// and registration. A request is only counted if every bucket allows it.
+// Requests are let through if the limiter fails, so an outage of shared
+// counters does not take every tenant down.
+func RateLimitMiddleware(limiter store.RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant := r.Context().Value(TenantKey).(*store.TenantConfig)
+
+			buckets := rateLimitBuckets(r, tenant)
+			if len(buckets) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limits := make([]store.RateLimitBucket, len(buckets))
+			for i, bucket := range buckets {
+				limits[i] = bucket.RateLimitBucket
+			}
+
+			empty, retryAfter, err := limiter.Allow(r.Context(), limits)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"tenant_id": tenant.TenantID,
+					"error":     err.Error(),
+				}).Warn("Rate limit check failed")
+			} else if empty >= 0 {
+				log.WithFields(log.Fields{
+					"tenant_id": tenant.TenantID,
+					"scope":     buckets[empty].scope,
+					"path":      r.URL.Path,
+				}).Warn("Rate limit exceeded")
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds, at least one
+func retryAfterSeconds(wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// rateLimitBuckets returns the configured buckets a request is counted
+// against, narrowest first, so the narrowest empty bucket is the one logged
+func rateLimitBuckets(r *http.Request, tenant *store.TenantConfig) []rateLimitBucket {
+	limits := tenant.RateLimits
+	prefix := tenant.TenantID + ":"
+	var buckets []rateLimitBucket
+
+	if limits.APIKey != nil {
+		if key, ok := r.Context().Value(APIKeyKey).(*store.LMSAPIKey); ok {
+			buckets = append(buckets, rateLimitBucket{store.RateLimitAPIKey, store.RateLimitBucket{Key: "key:" + prefix + apiKeyID(key), Limit: limits.APIKey}})
+		} else if claims, ok := r.Context().Value(AccessClaimsKey).(*oauth.AccessClaims); ok {
+			buckets = append(buckets, rateLimitBucket{store.RateLimitAPIKey, store.RateLimitBucket{Key: "client:" + prefix + claims.ClientID, Limit: limits.APIKey}})
+		}
+	}
+	if limits.Actor != nil {
+		if claims, ok := r.Context().Value(ClaimsKey).(*models.Claims); ok {
+			buckets = append(buckets, rateLimitBucket{store.RateLimitActor, store.RateLimitBucket{Key: "actor:" + prefix + actorID(claims), Limit: limits.Actor}})
+		}
+	}
+	if limits.Tenant != nil {
+		buckets = append(buckets, rateLimitBucket{store.RateLimitTenant, store.RateLimitBucket{Key: "tenant:" + tenant.TenantID, Limit: limits.Tenant}})
+	}
+	return buckets
+}
+
+// apiKeyID identifies an API key without its secret: by prefix, or for
+// legacy keys by its stored hash
+func apiKeyID(key *store.LMSAPIKey) string {
+	if key.Prefix != "" {
+		return key.Prefix
+	}
+	return key.Hash
+}
+
+// actorID identifies a content token's actor and registration. It is
+// hashed so that learner identifiers are not kept in counter keys.
+func actorID(claims *models.Claims) string {
+	actor := claims.Actor
+	id := actor.Mbox + "\x00" + actor.MboxSHA1 + "\x00" + actor.OpenID
+	if actor.Account != nil {
+		id += "\x00" + actor.Account.HomePage + "\x00" + actor.Account.Name
+	}
+	sum := sha256.Sum256([]byte(id + "\x00" + claims.Registration))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// fakeRateLimiter records the buckets it is asked about and answers with
+// fixed results
+type fakeRateLimiter struct {
+	empty   int
+	wait    time.Duration
+	err     error
+	buckets []store.RateLimitBucket
+}
+
+func (l *fakeRateLimiter) Allow(ctx context.Context, buckets []store.RateLimitBucket) (int, time.Duration, error) {
+	l.buckets = buckets
+	return l.empty, l.wait, l.err
+}
+
+// serveRateLimited sends a request for tenant through RateLimitMiddleware,
+// authenticated with key if it is not nil
+func serveRateLimited(limiter store.RateLimiter, tenant *store.TenantConfig, key *store.LMSAPIKey) *httptest.ResponseRecorder {
+	handler := RateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ctx := context.WithValue(context.Background(), TenantKey, tenant)
+	if key != nil {
+		ctx = context.WithValue(ctx, APIKeyKey, key)
+	}
+	r := httptest.NewRequest("POST", "/auth/token", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	tenant := &store.TenantConfig{
+		TenantID: "acme",
+		RateLimits: store.RateLimits{
+			Tenant: &store.RateLimit{RequestsPerMinute: 60, Burst: 2},
+			APIKey: &store.RateLimit{RequestsPerMinute: 60, Burst: 1},
+		},
+	}
+	limiter := store.NewMemoryRateLimiter()
+	key := &store.LMSAPIKey{Prefix: "lk_one"}
+	other := &store.LMSAPIKey{Prefix: "lk_two"}
+
+	if w := serveRateLimited(limiter, tenant, key); w.Code != http.StatusNoContent {
+		t.Fatalf("first request = %d", w.Code)
+	}
+	w := serveRateLimited(limiter, tenant, key)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("request over the key's burst = %d, Retry-After %q; want 429 and 1", w.Code, w.Header().Get("Retry-After"))
+	}
+	// The rejected request did not take from the tenant's bucket, so
+	// another key still gets its turn
+	if w := serveRateLimited(limiter, tenant, other); w.Code != http.StatusNoContent {
+		t.Errorf("other key = %d, want the tenant's second request allowed", w.Code)
+	}
+	if w := serveRateLimited(limiter, tenant, nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request over the tenant's burst = %d, want 429", w.Code)
+	}
+
+	// Tenants without limits are not counted
+	fake := &fakeRateLimiter{empty: -1}
+	if w := serveRateLimited(fake, &store.TenantConfig{TenantID: "globex"}, key); w.Code != http.StatusNoContent || fake.buckets != nil {
+		t.Errorf("unlimited tenant = %d with buckets %v", w.Code, fake.buckets)
+	}
+	// Buckets are checked narrowest first
+	serveRateLimited(fake, tenant, key)
+	if len(fake.buckets) != 2 || fake.buckets[0].Key != "key:acme:lk_one" || fake.buckets[1].Key != "tenant:acme" {
+		t.Errorf("buckets = %+v, want the key's then the tenant's", fake.buckets)
+	}
+
+	// A failing limiter lets requests through
+	failing := &fakeRateLimiter{err: errors.New("redis unavailable")}
+	if w := serveRateLimited(failing, tenant, key); w.Code != http.StatusNoContent {
+		t.Errorf("failing limiter = %d, want the request let through", w.Code)
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	tenant := &store.TenantConfig{TenantID: "acme", RateLimits: store.RateLimits{Tenant: &store.RateLimit{RequestsPerMinute: 1, Burst: 1}}}
+	for wait, want := range map[time.Duration]string{
+		0:                        "1",
+		time.Millisecond:         "1",
+		time.Second:              "1",
+		1001 * time.Millisecond:  "2",
+		59500 * time.Millisecond: "60",
+	} {
+		w := serveRateLimited(&fakeRateLimiter{empty: 0, wait: wait}, tenant, nil)
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != want {
+			t.Errorf("wait %v = %d, Retry-After %q; want 429 and %s", wait, w.Code, w.Header().Get("Retry-After"), want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+const (
+	// PathTenantKey holds the tenant ID taken from a /t/{tenant}/ path prefix
+	PathTenantKey ContextKey = "path_tenant"
+	// BasePathKey holds the path prefix stripped by TenantPathPrefix, which
+	// links back to the proxy must include
+	BasePathKey ContextKey = "base_path"
+)
+
+// TenantResolver finds the tenant a request is for. It returns nil without
+// an error when the request carries nothing it recognizes, so that the next
+// resolver is tried.
+type TenantResolver interface {
+	ResolveTenant(r *http.Request) (*store.TenantConfig, error)
+}
+
+// TenantResolverFunc adapts a function to TenantResolver
+type TenantResolverFunc func(r *http.Request) (*store.TenantConfig, error)
+
+// ResolveTenant calls f(r)
+func (f TenantResolverFunc) ResolveTenant(r *http.Request) (*store.TenantConfig, error) {
+	return f(r)
+}
+
+// TenantResolverChain tries resolvers in order. The first resolver that
+// recognizes the request decides: a tenant identifier that does not resolve
+// is an error rather than a reason to try the next resolver.
+type TenantResolverChain []TenantResolver
+
+// ResolveTenant implements TenantResolver
+func (c TenantResolverChain) ResolveTenant(r *http.Request) (*store.TenantConfig, error) {
+	for _, resolver := range c {
+		tenant, err := resolver.ResolveTenant(r)
+		if err != nil || tenant != nil {
+			return tenant, err
+		}
+	}
+	return nil, fmt.Errorf("no tenant for host %s", r.Host)
+}
+
+// HostResolver resolves tenants by Host header. An unmapped host is not an
+// error, since every request has a host.
+func HostResolver(tenantStore store.TenantStore) TenantResolver {
+	return TenantResolverFunc(func(r *http.Request) (*store.TenantConfig, error) {
+		tenant, err := tenantStore.GetByHost(r.Context(), r.Host)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"host":  r.Host,
+				"error": err.Error(),
+			}).Debug("Host resolves to no tenant")
+			return nil, nil
+		}
+		return tenant, nil
+	})
+}
+
+// PathResolver resolves tenants named by a path prefix, as extracted by
+// TenantPathPrefix
+func PathResolver(tenantStore store.TenantStore) TenantResolver {
+	return TenantResolverFunc(func(r *http.Request) (*store.TenantConfig, error) {
+		tenantID, _ := r.Context().Value(PathTenantKey).(string)
+		if tenantID == "" {
+			return nil, nil
+		}
+		return tenantStore.GetByID(r.Context(), tenantID)
+	})
+}
+
+// HeaderResolver resolves tenants by a header set by an upstream gateway.
+// The header is ignored on requests that do not come from a trusted proxy.
+func HeaderResolver(tenantStore store.TenantStore, header string, trustedProxies []*net.IPNet) TenantResolver {
+	return TenantResolverFunc(func(r *http.Request) (*store.TenantConfig, error) {
+		tenantID := r.Header.Get(header)
+		if tenantID == "" {
+			return nil, nil
+		}
+		if !fromTrustedProxy(r, trustedProxies) {
+			log.WithFields(log.Fields{
+				"header":      header,
+				"remote_addr": r.RemoteAddr,
+			}).Warn("Ignoring tenant header from untrusted client")
+			return nil, nil
+		}
+		return tenantStore.GetByID(r.Context(), tenantID)
+	})
+}
+
+// fromTrustedProxy reports whether the request's peer is in a trusted network
+func fromTrustedProxy(r *http.Request, trustedProxies []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenResolver resolves tenants by the tenant_id claim of the bearer
+// token. The claim is read without verification: the token must still pass
+// the route's authentication against the tenant it names.
+func TokenResolver(tenantStore store.TenantStore) TenantResolver {
+	parser := jwt.NewParser()
+	return TenantResolverFunc(func(r *http.Request) (*store.TenantConfig, error) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || strings.Count(token, ".") != 2 {
+			return nil, nil
+		}
+		claims := jwt.MapClaims{}
+		if _, _, err := parser.ParseUnverified(token, claims); err != nil {
+			return nil, nil
+		}
+		tenantID, _ := claims["tenant_id"].(string)
+		if tenantID == "" {
+			return nil, nil
+		}
+		return tenantStore.GetByID(r.Context(), tenantID)
+	})
+}
+
+// NewTenantResolver builds the resolver chain configured by cfg.Order
+func NewTenantResolver(tenantStore store.TenantStore, cfg config.TenantResolutionConfig) (TenantResolver, error) {
+	var chain TenantResolverChain
+	seen := make(map[string]bool)
+	for _, name := range cfg.Order {
+		if seen[name] {
+			return nil, fmt.Errorf("tenant resolver %q listed twice", name)
+		}
+		seen[name] = true
+
+		switch name {
+		case "host":
+			chain = append(chain, HostResolver(tenantStore))
+		case "path":
+			if strings.Trim(cfg.PathPrefix, "/") == "" {
+				return nil, fmt.Errorf("tenant_resolution.path_prefix must not be empty")
+			}
+			chain = append(chain, PathResolver(tenantStore))
+		case "header":
+			if len(cfg.TrustedProxies) == 0 {
+				return nil, fmt.Errorf("tenant_resolution.trusted_proxies is required for the header resolver")
+			}
+			var networks []*net.IPNet
+			for _, cidr := range cfg.TrustedProxies {
+				_, network, err := net.ParseCIDR(cidr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+				}
+				networks = append(networks, network)
+			}
+			chain = append(chain, HeaderResolver(tenantStore, cfg.Header, networks))
+		case "token":
+			chain = append(chain, TokenResolver(tenantStore))
+		default:
+			return nil, fmt.Errorf("unknown tenant resolver %q (want host, path, header or token)", name)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("tenant_resolution.order must name at least one resolver")
+	}
+	return chain, nil
+}
+
+// TenantPathPrefix strips a {prefix}{tenant}/ path prefix, such as
+// /t/acme-corp/xapi/statements, before routing. The tenant ID is left for
+// PathResolver and the stripped prefix for building links.
+func TenantPathPrefix(prefix string) func(http.Handler) http.Handler {
+	prefix = "/" + strings.Trim(prefix, "/") + "/"
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tenantID, path, ok := strings.Cut(rest, "/")
+			if !ok || tenantID == "" {
+				http.NotFound(w, r)
+				return
+			}
+
+			base := prefix + tenantID
+			r2 := r.Clone(context.WithValue(
+				context.WithValue(r.Context(), PathTenantKey, tenantID),
+				BasePathKey, base))
+			r2.URL.Path = "/" + path
+			r2.URL.RawPath = ""
+			r2.RequestURI = r2.URL.RequestURI()
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// newResolverTestStore loads tenants mapping the given hosts from files
+func newResolverTestStore(t *testing.T, hosts map[string]string) *store.FileTenantStore {
+	t.Helper()
+	dir := t.TempDir()
+	for tenantID, host := range hosts {
+		data := fmt.Sprintf(`hosts: [%q]
+lrs:
+  endpoint: https://lrs.example.com/xapi/
+  username: %[2]s
+  password: %[2]s-password
+auth:
+  jwt_secret: %[2]s-secret-with-at-least-32-bytes
+  lms_api_keys:
+    - key: %[2]s-api-key
+`, host, tenantID)
+		if err := os.WriteFile(filepath.Join(dir, tenantID+".yaml"), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := store.NewFileTenantStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestTenantResolverChain(t *testing.T) {
+	tenants := newResolverTestStore(t, map[string]string{
+		"exact":    "shop.acme.example.com",
+		"wildcard": "*.acme.example.com",
+		"path":     "path.example.org",
+		"header":   "header.example.org",
+		"token":    "token.example.org",
+	})
+	resolver, err := NewTenantResolver(tenants, config.TenantResolutionConfig{
+		Order:          []string{"path", "header", "token", "host"},
+		PathPrefix:     "/t/",
+		Header:         "X-Tenant-ID",
+		TrustedProxies: []string{"10.0.0.0/8"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"tenant_id": "token"}).
+		SignedString([]byte("unverified-by-the-resolver"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		host       string
+		pathTenant string
+		header     string
+		remoteAddr string
+		token      string
+		want       string // Tenant ID; empty for an error
+	}{
+		{name: "exact host", host: "shop.acme.example.com", want: "exact"},
+		{name: "host case, port and trailing dot", host: "SHOP.Acme.example.com.:443", want: "exact"},
+		{name: "host with non-default port", host: "shop.acme.example.com:8443", want: "exact"},
+		{name: "wildcard host", host: "www.acme.example.com", want: "wildcard"},
+		{name: "wildcard host with port", host: "WWW.acme.example.com:80", want: "wildcard"},
+		{name: "unmapped host", host: "unknown.example.org"},
+		{name: "invalid host", host: "shop.acme.example.com:99999"},
+		{name: "path before host", host: "shop.acme.example.com", pathTenant: "path", want: "path"},
+		{name: "path before header and token", host: "shop.acme.example.com", pathTenant: "path",
+			header: "header", remoteAddr: "10.1.2.3:5000", token: token, want: "path"},
+		{name: "unknown path tenant does not fall through", host: "shop.acme.example.com", pathTenant: "missing"},
+		{name: "trusted header before token and host", host: "shop.acme.example.com",
+			header: "header", remoteAddr: "10.1.2.3:5000", token: token, want: "header"},
+		{name: "untrusted header ignored", host: "shop.acme.example.com",
+			header: "header", remoteAddr: "192.0.2.1:5000", want: "exact"},
+		{name: "token before host", host: "shop.acme.example.com", token: token, want: "token"},
+		{name: "non-JWT bearer ignored", host: "www.acme.example.com", token: "xlp_1234abcd_secret", want: "wildcard"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/xapi/statements", nil)
+			r.Host = tt.host
+			if tt.remoteAddr != "" {
+				r.RemoteAddr = tt.remoteAddr
+			}
+			if tt.header != "" {
+				r.Header.Set("X-Tenant-ID", tt.header)
+			}
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.pathTenant != "" {
+				var captured *http.Request
+				TenantPathPrefix("/t/")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					captured = r
+				})).ServeHTTP(httptest.NewRecorder(), withPath(r, "/t/"+tt.pathTenant+"/xapi/statements"))
+				r = captured
+			}
+
+			tenant, err := resolver.ResolveTenant(r)
+			var got string
+			if err == nil && tenant != nil {
+				got = tenant.TenantID
+			}
+			if got != tt.want {
+				t.Errorf("resolved %q (err %v), want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// withPath returns r with another URL path
+func withPath(r *http.Request, path string) *http.Request {
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = path
+	r2.RequestURI = path
+	return r2
+}
+
+func TestNewTenantResolverValidation(t *testing.T) {
+	tenants := newResolverTestStore(t, map[string]string{"acme": "acme.example.com"})
+	for _, cfg := range []config.TenantResolutionConfig{
+		{},
+		{Order: []string{"host", "host"}},
+		{Order: []string{"cookie"}},
+		{Order: []string{"path"}},
+		{Order: []string{"header"}, Header: "X-Tenant-ID"},
+		{Order: []string{"header"}, Header: "X-Tenant-ID", TrustedProxies: []string{"10.0.0.0"}},
+	} {
+		if _, err := NewTenantResolver(tenants, cfg); err == nil {
+			t.Errorf("NewTenantResolver(%+v) succeeded, want error", cfg)
+		}
+	}
+}
+
+func TestTokenResolverCachesTenant(t *testing.T) {
+	ctx := context.Background()
+	connStr := "sqlite://" + filepath.Join(t.TempDir(), "tenants.db")
+	m, err := store.OpenMigrator(connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Up(ctx)
+	m.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := store.NewDatabaseTenantStore(connStr, store.CacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tenants.CreateTenant(ctx, &store.CreateTenantRequest{
+		TenantID: "acme",
+		LRS:      store.LRSConfigRequest{Endpoint: "https://lrs.example.com/xapi/", Username: "acme", Password: "acme-password"},
+		Auth: store.AuthConfigRequest{
+			JWTSecret:        "acme-secret-with-at-least-32-bytes",
+			JWTTTLSeconds:    3600,
+			PermissionPolicy: "strict",
+			LMSAPIKeys:       []store.LMSAPIKeyRequest{{Description: "test"}},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"tenant_id": "acme"}).
+		SignedString([]byte("unverified-by-the-resolver"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve := func() (*store.TenantConfig, error) {
+		r := httptest.NewRequest(http.MethodPost, "/auth/token", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return TokenResolver(tenants).ResolveTenant(r)
+	}
+
+	first, err := resolve()
+	if err != nil || first == nil {
+		t.Fatalf("first lookup = %v, %v", first, err)
+	}
+
+	// With the database closed, only the cache can answer
+	tenants.Close()
+	second, err := resolve()
+	if err != nil || second != first {
+		t.Errorf("second lookup = %v, %v; want the cached tenant", second, err)
+	}
+	if stats := tenants.CacheStats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("cache stats = %+v, want 1 hit and 1 miss", stats)
+	}
+}
@@ -16,11 +16,15 @@ type TokenRequest struct {
 	Permissions  Permissions            `json:"permissions"`
 	Group        *Group                 `json:"group,omitempty"` // For group-scoped permissions
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	// Fetch returns a one-time cmi5 fetch URL instead of the token
+	Fetch bool `json:"fetch,omitempty"`
 }
 
 // TokenResponse represents the response containing a JWT token
 type TokenResponse struct {
-	Token     string    `json:"token"`
+	Token     string    `json:"token,omitempty"`
+	FetchURL  string    `json:"fetch_url,omitempty"`
+	TokenID   string    `json:"token_id"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
@@ -115,6 +119,23 @@ func (a *Actor) Equals(other Actor) bool {
 	return false
 }
 
+// Identifier returns the actor's inverse functional identifier as a single
+// string: the mbox, mbox_sha1sum or openid as given, or
+// "account:<name>@<homePage>". It is empty when no identifier is set.
+func (a *Actor) Identifier() string {
+	switch {
+	case a.Mbox != "":
+		return a.Mbox
+	case a.MboxSHA1 != "":
+		return a.MboxSHA1
+	case a.OpenID != "":
+		return a.OpenID
+	case a.Account != nil && a.Account.Name != "":
+		return "account:" + a.Account.Name + "@" + a.Account.HomePage
+	}
+	return ""
+}
+
 // IsMember checks if an actor is a member of a group
 func (g *Group) IsMember(actor Actor) bool {
 	for _, member := range g.Member {
@@ -158,3 +179,18 @@ func PermissionLevel(scope string) int {
 	}
 	return levels[scope]
 }
+
+// OAuthTokenResponse represents an OAuth 2.0 access token response
+type OAuthTokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"` // Token exchange only
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int    `json:"expires_in"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// IsElevatedPermission reports whether a scope grants more than the default
+// cmi5 isolation and therefore requires LMS admin approval
+func IsElevatedPermission(scope string) bool {
+	return PermissionLevel(scope) > PermissionLevel("actor-activity-registration-scoped")
+}
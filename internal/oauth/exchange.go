@@ -0,0 +1,147 @@
+package oauth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/jwks"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+const (
+	// GrantTypeTokenExchange is the RFC 8693 token exchange grant
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// Token type identifiers (RFC 8693 section 3)
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+	TokenTypeIDToken     = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+// defaultExchangePermission is requested when the scope omits read or write
+const defaultExchangePermission = "actor-activity-registration-scoped"
+
+// VerifySubjectToken verifies an upstream identity token against the
+// tenant's trusted issuers and returns the issuer and verified claims
+func VerifySubjectToken(tenant *store.TenantConfig, subjectToken string) (*store.TokenExchangeIssuer, jwt.MapClaims, error) {
+	var unverified jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(subjectToken, &unverified); err != nil {
+		return nil, nil, InvalidRequest("malformed subject_token")
+	}
+
+	issuer, ok := tenant.TokenExchangeIssuers[unverified.Issuer]
+	if !ok {
+		return nil, nil, InvalidRequest("subject_token issuer is not trusted")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(subjectToken, claims, issuer.Keys.Keyfunc,
+		jwt.WithValidMethods(jwks.SigningMethods),
+		jwt.WithIssuer(issuer.Issuer),
+		jwt.WithAudience(issuer.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, nil, InvalidRequest("invalid subject_token: %v", err)
+	}
+
+	return issuer, claims, nil
+}
+
+// MapActor builds an xAPI actor from subject token claims using the
+// issuer's claim mappings
+func MapActor(issuer *store.TokenExchangeIssuer, claims jwt.MapClaims) (models.Actor, error) {
+	actor := models.Actor{ObjectType: "Agent"}
+
+	value := func(field string) string {
+		claim, ok := issuer.ClaimMappings[field]
+		if !ok {
+			return ""
+		}
+		return claimString(claims, claim)
+	}
+
+	actor.Name = value("name")
+	if mbox := value("mbox"); mbox != "" {
+		if !strings.HasPrefix(mbox, "mailto:") {
+			mbox = "mailto:" + mbox
+		}
+		actor.Mbox = mbox
+	}
+	actor.MboxSHA1 = value("mbox_sha1sum")
+	actor.OpenID = value("openid")
+	if name := value("account_name"); name != "" {
+		homePage := value("account_home_page")
+		if homePage == "" {
+			homePage = issuer.AccountHomePage
+		}
+		actor.Account = &models.Account{HomePage: homePage, Name: name}
+	}
+
+	// xAPI requires exactly one inverse functional identifier
+	ifis := 0
+	for _, set := range []bool{actor.Mbox != "", actor.MboxSHA1 != "", actor.OpenID != "", actor.Account != nil} {
+		if set {
+			ifis++
+		}
+	}
+	if ifis != 1 {
+		return models.Actor{}, fmt.Errorf("claim mappings must produce exactly one actor identifier, got %d", ifis)
+	}
+
+	return actor, nil
+}
+
+// claimString resolves a claim by name; dotted names address nested objects
+func claimString(claims jwt.MapClaims, name string) string {
+	var current interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		current = obj[part]
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v
+	case float64, bool:
+		return fmt.Sprint(v)
+	default:
+		return ""
+	}
+}
+
+// ExchangePermissions parses the requested permissions of a token exchange
+// ("read:<permission> write:<permission>") and enforces the issuer ceiling
+func ExchangePermissions(issuer *store.TokenExchangeIssuer, scope string) (models.Permissions, error) {
+	perms := models.Permissions{
+		Read:  defaultExchangePermission,
+		Write: defaultExchangePermission,
+	}
+
+	for _, s := range strings.Fields(scope) {
+		if err := ValidateScope(s); err != nil {
+			return models.Permissions{}, InvalidScope("%v", err)
+		}
+		op, permission, _ := strings.Cut(s, ":")
+		if op == "read" {
+			perms.Read = permission
+		} else {
+			perms.Write = permission
+		}
+	}
+
+	if models.PermissionLevel(perms.Read) > models.PermissionLevel(issuer.MaxReadPermission) {
+		return models.Permissions{}, InvalidScope("read permission %s exceeds issuer ceiling %s", perms.Read, issuer.MaxReadPermission)
+	}
+	if models.PermissionLevel(perms.Write) > models.PermissionLevel(issuer.MaxWritePermission) {
+		return models.Permissions{}, InvalidScope("write permission %s exceeds issuer ceiling %s", perms.Write, issuer.MaxWritePermission)
+	}
+
+	return perms, nil
+}
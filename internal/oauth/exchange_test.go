@@ -0,0 +1,223 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "xapi-proxy"
+)
+
+// writeTestJWKS writes a JWKS file holding key's public half under kid
+func writeTestJWKS(t *testing.T, key *rsa.PrivateKey, kid string) string {
+	t.Helper()
+	doc := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestExchangeTenant trusts one issuer whose signing key is returned
+func newTestExchangeTenant(t *testing.T, mappings map[string]string, maxRead, maxWrite string) (*rsa.PrivateKey, *store.TenantConfig) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := store.NewTokenExchangeIssuer(testIssuer, testAudience, writeTestJWKS(t, key, "idp-1"),
+		mappings, "", maxRead, maxWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, &store.TenantConfig{
+		TenantID:             "acme",
+		TokenExchangeIssuers: map[string]*store.TokenExchangeIssuer{testIssuer: issuer},
+	}
+}
+
+// signSubjectToken signs claims with key as the issuer's "idp-1" key
+func signSubjectToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "idp-1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifySubjectToken(t *testing.T) {
+	key, tenant := newTestExchangeTenant(t, nil, "", "")
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": testIssuer,
+			"aud": testAudience,
+			"sub": "learner-1",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+	}
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", signSubjectToken(t, key, valid()), true},
+		{"audience in a list", signSubjectToken(t, key, with("aud", []string{"other-app", testAudience})), true},
+		{"other audience", signSubjectToken(t, key, with("aud", "other-app")), false},
+		{"no audience", signSubjectToken(t, key, with("aud", nil)), false},
+		{"unknown issuer", signSubjectToken(t, key, with("iss", "https://evil.example.com")), false},
+		{"expired", signSubjectToken(t, key, with("exp", time.Now().Add(-time.Minute).Unix())), false},
+		{"no expiry", signSubjectToken(t, key, with("exp", nil)), false},
+		{"wrong key", signSubjectToken(t, otherKey, valid()), false},
+		{"malformed", "not-a-jwt", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer, claims, err := VerifySubjectToken(tenant, tt.token)
+			if !tt.ok {
+				var oauthErr *Error
+				if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_request" {
+					t.Errorf("VerifySubjectToken error = %v, want invalid_request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifySubjectToken: %v", err)
+			}
+			if issuer.Issuer != testIssuer || claims["sub"] != "learner-1" {
+				t.Errorf("VerifySubjectToken = %s, %v", issuer.Issuer, claims)
+			}
+		})
+	}
+
+	// HMAC tokens are refused even when keyed with the issuer's public key
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, valid())
+	signed, err := hmac.SignedString(key.N.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VerifySubjectToken(tenant, signed); err == nil {
+		t.Error("HS256 subject token accepted")
+	}
+}
+
+func TestMapActor(t *testing.T) {
+	claims := jwt.MapClaims{
+		"sub":   "learner-1",
+		"name":  "Ada",
+		"email": "ada@example.com",
+		"ext":   map[string]interface{}{"employee_id": float64(42)},
+	}
+
+	tests := []struct {
+		name     string
+		mappings map[string]string
+		want     string // Identifier of the mapped actor; empty for an error
+	}{
+		{"default maps sub to an account", nil, "account:learner-1@" + testIssuer},
+		{"mbox gains mailto", map[string]string{"mbox": "email", "name": "name"}, "mailto:ada@example.com"},
+		{"nested claim", map[string]string{"account_name": "ext.employee_id"}, "account:42@" + testIssuer},
+		{"account home page claim", map[string]string{"account_name": "sub", "account_home_page": "ext.missing"}, "account:learner-1@" + testIssuer},
+		{"two identifiers", map[string]string{"mbox": "email", "account_name": "sub"}, ""},
+		{"missing claim", map[string]string{"openid": "openid"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, tenant := newTestExchangeTenant(t, tt.mappings, "", "")
+			actor, err := MapActor(tenant.TokenExchangeIssuers[testIssuer], claims)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("MapActor = %+v, want an error", actor)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MapActor: %v", err)
+			}
+			if got := actor.Identifier(); got != tt.want {
+				t.Errorf("MapActor identifier = %q, want %q", got, tt.want)
+			}
+			if tt.mappings["name"] != "" && actor.Name != "Ada" {
+				t.Errorf("MapActor name = %q, want Ada", actor.Name)
+			}
+		})
+	}
+}
+
+func TestExchangePermissions(t *testing.T) {
+	_, tenant := newTestExchangeTenant(t, nil, "actor-course-registration-scoped", "actor-activity-registration-scoped")
+	issuer := tenant.TokenExchangeIssuers[testIssuer]
+
+	tests := []struct {
+		scope     string
+		wantRead  string
+		wantWrite string // Empty for an invalid_scope error
+	}{
+		{"", "actor-activity-registration-scoped", "actor-activity-registration-scoped"},
+		{"read:actor-course-registration-scoped", "actor-course-registration-scoped", "actor-activity-registration-scoped"},
+		{"write:false read:actor-activity-registration-scoped", "actor-activity-registration-scoped", "false"},
+		{"read:course-aggregate-only", "", ""},
+		{"write:actor-course-registration-scoped", "", ""},
+		{"read:everything", "", ""},
+	}
+
+	for _, tt := range tests {
+		perms, err := ExchangePermissions(issuer, tt.scope)
+		if tt.wantWrite == "" {
+			var oauthErr *Error
+			if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_scope" {
+				t.Errorf("ExchangePermissions(%q) = %+v, %v; want invalid_scope", tt.scope, perms, err)
+			}
+			continue
+		}
+		if err != nil || perms.Read != tt.wantRead || perms.Write != tt.wantWrite {
+			t.Errorf("ExchangePermissions(%q) = %+v, %v; want read %s write %s", tt.scope, perms, err, tt.wantRead, tt.wantWrite)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/jwks"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+const (
+	// GrantTypeClientCredentials is the RFC 6749 client_credentials grant
+	GrantTypeClientCredentials = "client_credentials"
+
+	// ClientAssertionTypeJWTBearer is the RFC 7523 client assertion type
+	// used by private_key_jwt client authentication
+	ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	// Audience identifies access tokens that authorize calls to /auth/token.
+	// Content-facing JWTs never carry this audience.
+	Audience = "xapi-lrs-auth-proxy/auth"
+
+	// Issuer is the issuer of all tokens minted by the proxy
+	Issuer = "xapi-lrs-auth-proxy"
+)
+
+// Error is an RFC 6749 section 5.2 error response
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	Status      int    `json:"-"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+// InvalidRequest returns an invalid_request error
+func InvalidRequest(format string, args ...interface{}) *Error {
+	return &Error{Code: "invalid_request", Description: fmt.Sprintf(format, args...), Status: http.StatusBadRequest}
+}
+
+// InvalidClient returns an invalid_client error
+func InvalidClient(format string, args ...interface{}) *Error {
+	return &Error{Code: "invalid_client", Description: fmt.Sprintf(format, args...), Status: http.StatusUnauthorized}
+}
+
+// InvalidScope returns an invalid_scope error
+func InvalidScope(format string, args ...interface{}) *Error {
+	return &Error{Code: "invalid_scope", Description: fmt.Sprintf(format, args...), Status: http.StatusBadRequest}
+}
+
+// UnsupportedGrantType returns an unsupported_grant_type error
+func UnsupportedGrantType(grantType string) *Error {
+	return &Error{Code: "unsupported_grant_type", Description: fmt.Sprintf("grant_type %q is not supported", grantType), Status: http.StatusBadRequest}
+}
+
+// AccessClaims represents the claims of an LMS access token
+type AccessClaims struct {
+	TenantID string `json:"tenant_id"`
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// AuthenticateClient authenticates the client of a token request using
+// client_secret_basic, client_secret_post or private_key_jwt. The form must
+// already be parsed. tokenEndpoint is the absolute URL of the token endpoint
+// and must appear in the audience of client assertions.
+func AuthenticateClient(r *http.Request, tenant *store.TenantConfig, tokenEndpoint string) (*store.OAuthClient, error) {
+	if assertionType := r.PostForm.Get("client_assertion_type"); assertionType != "" {
+		if assertionType != ClientAssertionTypeJWTBearer {
+			return nil, InvalidClient("unsupported client_assertion_type")
+		}
+		return authenticateAssertion(r.PostForm.Get("client_assertion"), r.PostForm.Get("client_id"), tenant, tokenEndpoint)
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		// RFC 6749 section 2.3.1: credentials are form-urlencoded before Basic encoding
+		if id, err := url.QueryUnescape(clientID); err == nil {
+			clientID = id
+		}
+		if s, err := url.QueryUnescape(secret); err == nil {
+			secret = s
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" || secret == "" {
+		return nil, InvalidClient("client authentication required")
+	}
+
+	client, ok := tenant.OAuthClients[clientID]
+	if !ok || !client.MatchesSecret(secret) {
+		return nil, InvalidClient("client authentication failed")
+	}
+
+	return client, nil
+}
+
+// authenticateAssertion verifies an RFC 7523 client assertion
+func authenticateAssertion(assertion, clientID string, tenant *store.TenantConfig, tokenEndpoint string) (*store.OAuthClient, error) {
+	if assertion == "" {
+		return nil, InvalidClient("client_assertion is required")
+	}
+
+	// The issuer identifies the client when client_id is not supplied
+	if clientID == "" {
+		var unverified jwt.RegisteredClaims
+		if _, _, err := jwt.NewParser().ParseUnverified(assertion, &unverified); err != nil {
+			return nil, InvalidClient("malformed client_assertion")
+		}
+		clientID = unverified.Issuer
+	}
+
+	client, ok := tenant.OAuthClients[clientID]
+	if !ok || client.PublicKey == nil {
+		return nil, InvalidClient("client authentication failed")
+	}
+
+	_, err := jwt.ParseWithClaims(assertion, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return client.PublicKey, nil
+	},
+		jwt.WithValidMethods(jwks.SigningMethods),
+		jwt.WithIssuer(clientID),
+		jwt.WithSubject(clientID),
+		jwt.WithAudience(tokenEndpoint),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, InvalidClient("invalid client_assertion: %v", err)
+	}
+
+	return client, nil
+}
+
+// GrantScopes returns the scopes to grant for a requested scope string.
+// An empty request grants every scope registered for the client.
+func GrantScopes(client *store.OAuthClient, requested string) ([]string, error) {
+	if strings.TrimSpace(requested) == "" {
+		return client.Scopes, nil
+	}
+
+	allowed := make(map[string]bool, len(client.Scopes))
+	for _, scope := range client.Scopes {
+		allowed[scope] = true
+	}
+
+	var granted []string
+	for _, scope := range strings.Fields(requested) {
+		if err := ValidateScope(scope); err != nil {
+			return nil, InvalidScope("%v", err)
+		}
+		if !allowed[scope] {
+			return nil, InvalidScope("scope %s not permitted for client", scope)
+		}
+		granted = append(granted, scope)
+	}
+	return granted, nil
+}
+
+// ValidateScope checks that a scope has the form "read:<permission>" or
+// "write:<permission>" with a known permission scope
+func ValidateScope(scope string) error {
+	op, permission, ok := strings.Cut(scope, ":")
+	if !ok || (op != "read" && op != "write") {
+		return fmt.Errorf("invalid scope: %s", scope)
+	}
+	return models.ValidatePermission(permission)
+}
+
+// IssueAccessToken signs a short-lived access token for an authenticated client
+func IssueAccessToken(tenant *store.TenantConfig, client *store.OAuthClient, scopes []string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(tenant.OAuthTokenTTLSeconds) * time.Second)
+
+	claims := &AccessClaims{
+		TenantID: tenant.TenantID,
+		ClientID: client.ClientID,
+		Scope:    strings.Join(scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    Issuer,
+			Subject:   client.ClientID,
+			Audience:  jwt.ClaimStrings{Audience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(tenant.JWTSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expiresAt, nil
+}
+
+// ParseAccessToken validates an access token issued by IssueAccessToken
+func ParseAccessToken(tenant *store.TenantConfig, tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return tenant.JWTSecret, nil
+	},
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithAudience(Audience),
+		jwt.WithIssuer(Issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.TenantID != tenant.TenantID {
+		return nil, errors.New("tenant mismatch in access token")
+	}
+	if _, ok := tenant.OAuthClients[claims.ClientID]; !ok {
+		return nil, errors.New("client no longer registered")
+	}
+	return claims, nil
+}
+
+// Allows checks requested token permissions against the granted scopes.
+// A "read:<permission>" scope permits any read permission at or below the
+// level of <permission>; likewise for write.
+func (c *AccessClaims) Allows(p models.Permissions) error {
+	return permissionsAllowed(c.Scope, p)
+}
+
+// ClientAllows checks token permissions against the scopes registered for
+// a client, like Allows does for an access token granting all of them
+func ClientAllows(client *store.OAuthClient, p models.Permissions) error {
+	return permissionsAllowed(strings.Join(client.Scopes, " "), p)
+}
+
+// permissionsAllowed checks write and read permissions against a scope string
+func permissionsAllowed(scope string, p models.Permissions) error {
+	if err := allowedBy(scope, "write", p.Write); err != nil {
+		return err
+	}
+	return allowedBy(scope, "read", p.Read)
+}
+
+// allowedBy checks a single operation's permission against a scope string
+func allowedBy(scope, op, permission string) error {
+	if permission == "false" {
+		return nil
+	}
+
+	level := models.PermissionLevel(permission)
+	for _, s := range strings.Fields(scope) {
+		sOp, granted, ok := strings.Cut(s, ":")
+		if ok && sOp == op && models.PermissionLevel(granted) >= level {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s permission %s exceeds granted scope", op, permission)
+}
+
+// HasAudience reports whether a set of registered claims is addressed to
+// the LMS token API
+func HasAudience(claims jwt.RegisteredClaims) bool {
+	for _, aud := range claims.Audience {
+		if aud == Audience {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package redisstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// takeTokenScript refills token buckets for the time since they were last
+// used and, if none is empty, takes one token from each. ARGV holds each
+// bucket's rate and burst in turn. The Redis clock is used, so replica clocks
+// need not agree. Returns {index of the first empty bucket or -1,
+// milliseconds until every bucket has a token}.
+var takeTokenScript = redis.NewScript(`
+local now = redis.call('TIME')
+now = tonumber(now[1]) + tonumber(now[2]) / 1000000
+
+local tokens, empty, wait = {}, -1, 0
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[2 * i - 1])
+	local burst = tonumber(ARGV[2 * i])
+	local bucket = redis.call('HMGET', key, 'tokens', 'updated')
+	local t = tonumber(bucket[1])
+	if t == nil then
+		t = burst
+	else
+		t = math.min(burst, t + math.max(0, now - tonumber(bucket[2])) * rate)
+	end
+	if t < 1 then
+		if empty < 0 then
+			empty = i - 1
+		end
+		wait = math.max(wait, math.ceil((1 - t) / rate * 1000))
+	end
+	tokens[i] = t
+end
+
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[2 * i - 1])
+	local burst = tonumber(ARGV[2 * i])
+	if empty < 0 then
+		tokens[i] = tokens[i] - 1
+	end
+	redis.call('HSET', key, 'tokens', tostring(tokens[i]), 'updated', tostring(now))
+	redis.call('PEXPIRE', key, math.ceil((burst - tokens[i]) / rate * 1000) + 1000)
+end
+return {empty, wait}
+`)
+
+// RateLimiter is a store.RateLimiter whose buckets are shared by all
+// replicas. A bucket expires once it has refilled.
+type RateLimiter struct {
+	client *redis.Client
+}
+
+// NewRateLimiter creates a Redis-backed rate limiter
+func NewRateLimiter(client *redis.Client) *RateLimiter {
+	return &RateLimiter{client: client}
+}
+
+// rateLimitKey names a token bucket
+func rateLimitKey(key string) string {
+	return keyPrefix + "ratelimit:" + key
+}
+
+// Allow implements store.RateLimiter
+func (l *RateLimiter) Allow(ctx context.Context, buckets []store.RateLimitBucket) (int, time.Duration, error) {
+	keys := make([]string, len(buckets))
+	args := make([]interface{}, 0, 2*len(buckets))
+	for i, bucket := range buckets {
+		keys[i] = rateLimitKey(bucket.Key)
+		args = append(args, bucket.Limit.Rate(), bucket.Limit.Burst)
+	}
+	result, err := takeTokenScript.Run(ctx, l.client, keys, args...).Int64Slice()
+	if err != nil {
+		return -1, 0, err
+	}
+	return int(result[0]), time.Duration(result[1]) * time.Millisecond, nil
+}
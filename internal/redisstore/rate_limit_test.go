@@ -0,0 +1,74 @@
+package redisstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	mr, client := newTestClient(t)
+	l := NewRateLimiter(client)
+	limit := &store.RateLimit{RequestsPerMinute: 60, Burst: 3}
+	allow := func(keys ...string) (int, time.Duration) {
+		t.Helper()
+		var buckets []store.RateLimitBucket
+		for _, key := range keys {
+			buckets = append(buckets, store.RateLimitBucket{Key: key, Limit: limit})
+		}
+		empty, wait, err := l.Allow(ctx, buckets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return empty, wait
+	}
+
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	mr.SetTime(now)
+
+	// The bucket starts full
+	for i := 0; i < 3; i++ {
+		if empty, _ := allow("acme"); empty != -1 {
+			t.Fatalf("request %d rejected", i+1)
+		}
+	}
+	empty, wait := allow("acme")
+	if empty != 0 {
+		t.Fatal("request over burst allowed")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait = %v, want up to 1s at one request per second", wait)
+	}
+
+	// Buckets are per key
+	if empty, _ := allow("globex"); empty != -1 {
+		t.Error("other key rejected")
+	}
+
+	// A request rejected by one bucket takes nothing from the others
+	for i := 0; i < 5; i++ {
+		if empty, _ := allow("client", "acme"); empty != 1 {
+			t.Fatalf("request %d: empty bucket %d, want acme's", i+1, empty)
+		}
+	}
+	if tokens := mr.HGet(rateLimitKey("client"), "tokens"); tokens != "3" {
+		t.Errorf("client bucket tokens = %s, want 3 after rejected requests", tokens)
+	}
+
+	// One token refills per second
+	mr.SetTime(now.Add(time.Second))
+	if empty, _ := allow("client", "acme"); empty != -1 {
+		t.Error("rejected after refill")
+	}
+	if empty, _ := allow("acme"); empty != 0 {
+		t.Error("allowed after taking the refilled token")
+	}
+
+	// An idle bucket expires once it would be full again
+	if ttl := mr.TTL(rateLimitKey("acme")); ttl <= 0 || ttl > 5*time.Second {
+		t.Errorf("bucket TTL = %v, want about the refill time", ttl)
+	}
+}
@@ -0,0 +1,78 @@
+// Package redisstore keeps state shared by proxy replicas in Redis: cached
+// tenant configs, revoked tokens, one-time fetch tokens, LTI launch nonces
+// and rate limit counters.
+package redisstore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+)
+
+// keyPrefix namespaces every key written by the proxy
+const keyPrefix = "xlp:"
+
+// NewClient connects to the configured Redis server
+func NewClient(cfg config.RedisConfig) (*redis.Client, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return client, nil
+}
+
+// sealer encrypts values with AES-256-GCM before they leave the process
+type sealer struct {
+	aead cipher.AEAD
+}
+
+// newSealer parses a base64 encoded 32-byte key
+func newSealer(encodedKey string) (*sealer, error) {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("redis encryption_key must be 32 bytes, base64 encoded")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead}, nil
+}
+
+// seal encrypts plaintext, binding it to the Redis key it is stored under
+func (s *sealer) seal(plaintext []byte, key string) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, []byte(key)), nil
+}
+
+// open decrypts a value written by seal under the same Redis key
+func (s *sealer) open(ciphertext []byte, key string) ([]byte, error) {
+	n := s.aead.NonceSize()
+	if len(ciphertext) < n {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return s.aead.Open(nil, ciphertext[:n], ciphertext[n:], []byte(key))
+}
@@ -0,0 +1,237 @@
+package redisstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// maxBuilt bounds the number of built configs kept in process
+const maxBuilt = 1024
+
+// TenantStore is a store.TenantStore decorator that shares tenant
+// snapshots between replicas through Redis. Snapshots are encrypted since
+// they carry LRS passwords and JWT secrets. Redis failures fall through to
+// the wrapped store.
+type TenantStore struct {
+	next   store.TenantStore
+	client *redis.Client
+	ttl    time.Duration
+	sealer *sealer
+
+	// Built configs by digest of their sealed snapshot, so JWKS files and
+	// keys are parsed once per snapshot rather than once per request
+	mu    sync.Mutex
+	built map[[sha256.Size]byte]*store.TenantConfig
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// NewTenantStore wraps next with a Redis cache. encryptionKey is a base64
+// encoded 32-byte AES key shared by all replicas.
+func NewTenantStore(next store.TenantStore, client *redis.Client, ttl time.Duration, encryptionKey string) (*TenantStore, error) {
+	sealer, err := newSealer(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return &TenantStore{
+		next:   next,
+		client: client,
+		ttl:    ttl,
+		sealer: sealer,
+		built:  make(map[[sha256.Size]byte]*store.TenantConfig),
+	}, nil
+}
+
+// hostKey, idKey and hostsKey name a tenant's cache entries
+func hostKey(host string) string      { return keyPrefix + "tenant:host:" + host }
+func idKey(tenantID string) string    { return keyPrefix + "tenant:id:" + tenantID }
+func hostsKey(tenantID string) string { return keyPrefix + "tenant:hosts:" + tenantID }
+
+// GetByHost implements store.TenantStore
+func (s *TenantStore) GetByHost(ctx context.Context, host string) (*store.TenantConfig, error) {
+	// Spellings of the same host share an entry; invalid hosts are left
+	// for the wrapped store to reject
+	if normalized, err := store.NormalizeHost(host); err == nil {
+		host = normalized
+	}
+	if config, ok := s.get(ctx, hostKey(host)); ok {
+		return config, nil
+	}
+
+	config, err := s.next.GetByHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	s.put(ctx, config, host)
+	return config, nil
+}
+
+// GetByID implements store.TenantStore
+func (s *TenantStore) GetByID(ctx context.Context, tenantID string) (*store.TenantConfig, error) {
+	if config, ok := s.get(ctx, idKey(tenantID)); ok {
+		return config, nil
+	}
+
+	config, err := s.next.GetByID(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	s.put(ctx, config, "")
+	return config, nil
+}
+
+// CacheStats returns Redis cache hit and miss counts since startup. Entries
+// are the configs built from cached snapshots held in process.
+func (s *TenantStore) CacheStats() store.CacheStats {
+	s.mu.Lock()
+	entries := len(s.built)
+	s.mu.Unlock()
+
+	return store.CacheStats{
+		Hits:    s.hits.Load(),
+		Misses:  s.misses.Load(),
+		Entries: entries,
+	}
+}
+
+// get reads and decrypts a cached snapshot, counting the lookup
+func (s *TenantStore) get(ctx context.Context, key string) (*store.TenantConfig, bool) {
+	config, ok := s.lookup(ctx, key)
+	if ok {
+		s.hits.Add(1)
+	} else {
+		s.misses.Add(1)
+	}
+	return config, ok
+}
+
+// lookup reads and decrypts a cached snapshot
+func (s *TenantStore) lookup(ctx context.Context, key string) (*store.TenantConfig, bool) {
+	sealed, err := s.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.WithError(err).Warn("Redis tenant cache read failed")
+		}
+		return nil, false
+	}
+
+	digest := sha256.Sum256(sealed)
+	s.mu.Lock()
+	config, ok := s.built[digest]
+	s.mu.Unlock()
+	if ok {
+		return config, true
+	}
+
+	plaintext, err := s.sealer.open(sealed, key)
+	if err != nil {
+		log.WithError(err).Warn("Discarding undecryptable Redis tenant cache entry")
+		return nil, false
+	}
+	var snapshot store.TenantSnapshot
+	if err := json.Unmarshal(plaintext, &snapshot); err != nil {
+		log.WithError(err).Warn("Discarding malformed Redis tenant cache entry")
+		return nil, false
+	}
+
+	config = snapshot.Build()
+	s.mu.Lock()
+	if len(s.built) >= maxBuilt {
+		s.built = make(map[[sha256.Size]byte]*store.TenantConfig)
+	}
+	s.built[digest] = config
+	s.mu.Unlock()
+
+	return config, true
+}
+
+// put caches a tenant under its ID and, if given, the host it was resolved by
+func (s *TenantStore) put(ctx context.Context, config *store.TenantConfig, host string) {
+	snapshot := config.Snapshot()
+	if snapshot == nil {
+		return
+	}
+	plaintext, err := json.Marshal(snapshot)
+	if err != nil {
+		log.WithError(err).Warn("Failed to encode tenant for Redis cache")
+		return
+	}
+
+	keys := []string{idKey(config.TenantID)}
+	if host != "" {
+		keys = append(keys, hostKey(host))
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			sealed, err := s.sealer.seal(plaintext, key)
+			if err != nil {
+				return err
+			}
+			pipe.Set(ctx, key, sealed, s.ttl)
+		}
+		if host != "" {
+			// Remember cached hosts so the tenant can be evicted by ID
+			pipe.SAdd(ctx, hostsKey(config.TenantID), host)
+			pipe.Expire(ctx, hostsKey(config.TenantID), s.ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Warn("Redis tenant cache write failed")
+	}
+}
+
+// Invalidate evicts a tenant from Redis, or every tenant if tenantID is ""
+func (s *TenantStore) Invalidate(tenantID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var err error
+	if tenantID == "" {
+		err = s.invalidateAll(ctx)
+	} else {
+		err = s.invalidateTenant(ctx, tenantID)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"tenant_id": tenantID,
+			"error":     err.Error(),
+		}).Error("Failed to evict tenant from Redis cache")
+	}
+}
+
+// invalidateTenant deletes a tenant's ID entry and every cached host
+func (s *TenantStore) invalidateTenant(ctx context.Context, tenantID string) error {
+	hosts, err := s.client.SMembers(ctx, hostsKey(tenantID)).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{idKey(tenantID), hostsKey(tenantID)}
+	for _, host := range hosts {
+		keys = append(keys, hostKey(host))
+	}
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// invalidateAll deletes every cached tenant
+func (s *TenantStore) invalidateAll(ctx context.Context) error {
+	iter := s.client.Scan(ctx, 0, keyPrefix+"tenant:*", 500).Iterator()
+	for iter.Next(ctx) {
+		if err := s.client.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
@@ -0,0 +1,203 @@
+package redisstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// newTestClient starts an in-process Redis and connects to it
+func newTestClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+// newTestKey returns a random base64 encoded encryption key
+func newTestKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// countingStore serves tenants built from snapshots and counts lookups
+type countingStore struct {
+	tenants map[string]*store.TenantSnapshot // host -> tenant
+	calls   int
+}
+
+func (s *countingStore) GetByHost(ctx context.Context, host string) (*store.TenantConfig, error) {
+	s.calls++
+	if snapshot, ok := s.tenants[host]; ok {
+		return snapshot.Build(), nil
+	}
+	return nil, store.ErrTenantNotFound
+}
+
+func (s *countingStore) GetByID(ctx context.Context, tenantID string) (*store.TenantConfig, error) {
+	s.calls++
+	for _, snapshot := range s.tenants {
+		if snapshot.TenantID == tenantID {
+			return snapshot.Build(), nil
+		}
+	}
+	return nil, store.ErrTenantNotFound
+}
+
+// newTestTenantStore caches a store serving one tenant at acme.example.com
+func newTestTenantStore(t *testing.T, ttl time.Duration) (*miniredis.Miniredis, *countingStore, *TenantStore) {
+	t.Helper()
+	mr, client := newTestClient(t)
+	next := &countingStore{tenants: map[string]*store.TenantSnapshot{
+		"acme.example.com": {
+			TenantID:         "acme",
+			Status:           store.TenantStatusActive,
+			Hosts:            []string{"acme.example.com"},
+			LRSEndpoint:      "https://lrs.example.com/xapi/",
+			LRSUsername:      "acme",
+			LRSPassword:      "acme-password",
+			JWTSecret:        "acme-secret-with-at-least-32-bytes",
+			JWTTTLSeconds:    3600,
+			PermissionPolicy: "strict",
+		},
+	}}
+	s, err := NewTenantStore(next, client, ttl, newTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mr, next, s
+}
+
+func TestTenantStoreCachesSnapshots(t *testing.T) {
+	ctx := context.Background()
+	mr, next, s := newTestTenantStore(t, time.Minute)
+
+	for _, host := range []string{"acme.example.com", "ACME.example.com:443", "acme.example.com."} {
+		tenant, err := s.GetByHost(ctx, host)
+		if err != nil || tenant.TenantID != "acme" || tenant.LRSPassword != "acme-password" {
+			t.Fatalf("GetByHost(%q) = %+v, %v", host, tenant, err)
+		}
+	}
+	if next.calls != 1 {
+		t.Errorf("wrapped store called %d times, want 1", next.calls)
+	}
+	if tenant, err := s.GetByID(ctx, "acme"); err != nil || tenant.TenantID != "acme" {
+		t.Errorf("GetByID = %+v, %v", tenant, err)
+	}
+	if next.calls != 1 {
+		t.Errorf("GetByID after GetByHost called the wrapped store")
+	}
+	if stats := s.CacheStats(); stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("CacheStats = %+v, want 3 hits and 1 miss", stats)
+	}
+
+	// Snapshots are encrypted: the LRS password is not stored in the clear
+	sealed, err := mr.Get(hostKey("acme.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sealed) == 0 || strings.Contains(sealed, "acme-password") {
+		t.Errorf("cached snapshot is not encrypted: %q", sealed)
+	}
+
+	// Lookup failures are not cached
+	if _, err := s.GetByHost(ctx, "unknown.example.com"); !errors.Is(err, store.ErrTenantNotFound) {
+		t.Errorf("GetByHost(unknown) error = %v, want ErrTenantNotFound", err)
+	}
+	if mr.Exists(hostKey("unknown.example.com")) {
+		t.Error("missing tenant was cached")
+	}
+}
+
+func TestTenantStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	mr, next, s := newTestTenantStore(t, time.Minute)
+
+	if _, err := s.GetByHost(ctx, "acme.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{hostKey("acme.example.com"), idKey("acme"), hostsKey("acme")} {
+		if ttl := mr.TTL(key); ttl != time.Minute {
+			t.Errorf("TTL(%s) = %v, want 1m", key, ttl)
+		}
+	}
+
+	mr.FastForward(59 * time.Second)
+	if _, err := s.GetByHost(ctx, "acme.example.com"); err != nil || next.calls != 1 {
+		t.Fatalf("lookup before expiry: err %v, %d calls", err, next.calls)
+	}
+
+	mr.FastForward(2 * time.Second)
+	if _, err := s.GetByHost(ctx, "acme.example.com"); err != nil || next.calls != 2 {
+		t.Errorf("lookup after expiry: err %v, %d calls; want a reload", err, next.calls)
+	}
+}
+
+func TestTenantStoreInvalidate(t *testing.T) {
+	ctx := context.Background()
+	mr, next, s := newTestTenantStore(t, time.Minute)
+
+	if _, err := s.GetByHost(ctx, "acme.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	mr.Set(keyPrefix+"other", "kept")
+
+	s.Invalidate("acme")
+	for _, key := range []string{hostKey("acme.example.com"), idKey("acme"), hostsKey("acme")} {
+		if mr.Exists(key) {
+			t.Errorf("%s survived Invalidate", key)
+		}
+	}
+	if _, err := s.GetByHost(ctx, "acme.example.com"); err != nil || next.calls != 2 {
+		t.Errorf("lookup after Invalidate: err %v, %d calls; want a reload", err, next.calls)
+	}
+
+	s.Invalidate("")
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != keyPrefix+"other" {
+		t.Errorf("keys after Invalidate(\"\") = %q, want only %s", keys, keyPrefix+"other")
+	}
+}
+
+func TestTenantStoreRejectsForeignEntries(t *testing.T) {
+	ctx := context.Background()
+	mr, next, s := newTestTenantStore(t, time.Minute)
+
+	// A replica with another key, or a value moved between keys, can't be
+	// decrypted and falls through to the wrapped store
+	if _, err := s.GetByID(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := mr.Get(idKey("acme"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.Set(hostKey("acme.example.com"), sealed)
+
+	if tenant, err := s.GetByHost(ctx, "acme.example.com"); err != nil || tenant.TenantID != "acme" || next.calls != 2 {
+		t.Errorf("GetByHost with a moved entry = %+v, %v, %d calls; want a reload", tenant, err, next.calls)
+	}
+}
+
+func TestTenantStoreRedisDown(t *testing.T) {
+	mr, next, s := newTestTenantStore(t, time.Minute)
+	mr.Close()
+
+	tenant, err := s.GetByHost(context.Background(), "acme.example.com")
+	if err != nil || tenant.TenantID != "acme" || next.calls != 1 {
+		t.Errorf("GetByHost with Redis down = %+v, %v; want the wrapped store's tenant", tenant, err)
+	}
+}
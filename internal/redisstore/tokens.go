@@ -0,0 +1,115 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+// RevocationList is a store.TokenRevocationList shared by all replicas.
+// Entries expire with the tokens they revoke.
+type RevocationList struct {
+	client *redis.Client
+}
+
+// NewRevocationList creates a Redis-backed revocation list
+func NewRevocationList(client *redis.Client) *RevocationList {
+	return &RevocationList{client: client}
+}
+
+// revokedKey names a revoked token
+func revokedKey(tenantID, tokenID string) string {
+	return keyPrefix + "revoked:" + tenantID + ":" + tokenID
+}
+
+// RevokeToken implements store.TokenRevocationList
+func (l *RevocationList) RevokeToken(ctx context.Context, tenantID, tokenID string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil // Already expired
+	}
+	return l.client.Set(ctx, revokedKey(tenantID, tokenID), 1, ttl).Err()
+}
+
+// IsTokenRevoked implements store.TokenRevocationList
+func (l *RevocationList) IsTokenRevoked(ctx context.Context, tenantID, tokenID string) (bool, error) {
+	n, err := l.client.Exists(ctx, revokedKey(tenantID, tokenID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// FetchTokenStore is a store.FetchTokenStore shared by all replicas, so a
+// fetch URL can be redeemed on any replica but only once
+type FetchTokenStore struct {
+	client *redis.Client
+	sealer *sealer
+}
+
+// NewFetchTokenStore creates a Redis-backed fetch token store. Tokens are
+// encrypted with the same key as cached tenants.
+func NewFetchTokenStore(client *redis.Client, encryptionKey string) (*FetchTokenStore, error) {
+	sealer, err := newSealer(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return &FetchTokenStore{client: client, sealer: sealer}, nil
+}
+
+// fetchKey names a pending fetch token
+func fetchKey(id string) string {
+	return keyPrefix + "fetch:" + id
+}
+
+// PutFetchToken implements store.FetchTokenStore
+func (s *FetchTokenStore) PutFetchToken(ctx context.Context, id, token string, ttl time.Duration) error {
+	sealed, err := s.sealer.seal([]byte(token), fetchKey(id))
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, fetchKey(id), sealed, ttl).Err()
+}
+
+// TakeFetchToken implements store.FetchTokenStore. GETDEL makes redemption
+// atomic across replicas.
+func (s *FetchTokenStore) TakeFetchToken(ctx context.Context, id string) (string, error) {
+	sealed, err := s.client.GetDel(ctx, fetchKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return "", store.ErrFetchTokenNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	token, err := s.sealer.open(sealed, fetchKey(id))
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+// NonceStore is a store.NonceStore shared by all replicas, so a launch
+// replayed against another replica is still rejected
+type NonceStore struct {
+	client *redis.Client
+}
+
+// NewNonceStore creates a Redis-backed nonce store
+func NewNonceStore(client *redis.Client) *NonceStore {
+	return &NonceStore{client: client}
+}
+
+// nonceKey names a consumed nonce
+func nonceKey(nonce string) string {
+	return keyPrefix + "nonce:" + nonce
+}
+
+// UseNonce implements store.NonceStore. SET NX makes the check and the
+// mark one atomic step.
+func (s *NonceStore) UseNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, nonceKey(nonce), 1, ttl).Result()
+}
@@ -0,0 +1,105 @@
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/store"
+)
+
+func TestRevocationList(t *testing.T) {
+	ctx := context.Background()
+	mr, client := newTestClient(t)
+	l := NewRevocationList(client)
+
+	if err := l.RevokeToken(ctx, "acme", "jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.RevokeToken(ctx, "acme", "jti-expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		tenantID, tokenID string
+		want              bool
+	}{
+		{"acme", "jti-1", true},
+		{"globex", "jti-1", false},
+		{"acme", "jti-2", false},
+		{"acme", "jti-expired", false},
+	} {
+		if got, err := l.IsTokenRevoked(ctx, tt.tenantID, tt.tokenID); err != nil || got != tt.want {
+			t.Errorf("IsTokenRevoked(%s, %s) = %v, %v; want %v", tt.tenantID, tt.tokenID, got, err, tt.want)
+		}
+	}
+
+	// Entries expire with the token
+	mr.FastForward(time.Hour + time.Second)
+	if got, err := l.IsTokenRevoked(ctx, "acme", "jti-1"); err != nil || got {
+		t.Errorf("IsTokenRevoked after expiry = %v, %v; want false", got, err)
+	}
+}
+
+func TestFetchTokenStore(t *testing.T) {
+	ctx := context.Background()
+	mr, client := newTestClient(t)
+	s, err := NewFetchTokenStore(client, newTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.PutFetchToken(ctx, "id-1", "content-jwt", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL(fetchKey("id-1")); ttl != time.Minute {
+		t.Errorf("TTL = %v, want 1m", ttl)
+	}
+	if sealed, _ := mr.Get(fetchKey("id-1")); sealed == "content-jwt" {
+		t.Error("fetch token stored in the clear")
+	}
+
+	// Redeemed once only
+	if token, err := s.TakeFetchToken(ctx, "id-1"); err != nil || token != "content-jwt" {
+		t.Errorf("TakeFetchToken = %q, %v", token, err)
+	}
+	if _, err := s.TakeFetchToken(ctx, "id-1"); !errors.Is(err, store.ErrFetchTokenNotFound) {
+		t.Errorf("second TakeFetchToken error = %v, want ErrFetchTokenNotFound", err)
+	}
+
+	// Expired
+	if err := s.PutFetchToken(ctx, "id-2", "content-jwt", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(time.Minute + time.Second)
+	if _, err := s.TakeFetchToken(ctx, "id-2"); !errors.Is(err, store.ErrFetchTokenNotFound) {
+		t.Errorf("TakeFetchToken after expiry error = %v, want ErrFetchTokenNotFound", err)
+	}
+
+	if _, err := NewFetchTokenStore(client, "short"); err == nil {
+		t.Error("NewFetchTokenStore accepted an invalid key")
+	}
+}
+
+func TestNonceStore(t *testing.T) {
+	ctx := context.Background()
+	mr, client := newTestClient(t)
+	s := NewNonceStore(client)
+
+	if fresh, err := s.UseNonce(ctx, "nonce-1", time.Minute); err != nil || !fresh {
+		t.Fatalf("first UseNonce = %v, %v; want fresh", fresh, err)
+	}
+	// Another replica sharing the Redis sees the nonce as used
+	if fresh, err := NewNonceStore(client).UseNonce(ctx, "nonce-1", time.Minute); err != nil || fresh {
+		t.Errorf("replayed UseNonce = %v, %v; want used", fresh, err)
+	}
+	if fresh, err := s.UseNonce(ctx, "nonce-2", time.Minute); err != nil || !fresh {
+		t.Errorf("UseNonce(other) = %v, %v; want fresh", fresh, err)
+	}
+
+	mr.FastForward(time.Minute + time.Second)
+	if mr.Exists(nonceKey("nonce-1")) {
+		t.Error("nonce outlived its TTL")
+	}
+}
@@ -0,0 +1,474 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+)
+
+const (
+	// DefaultMaxPermission is the ceiling applied to API keys that do not
+	// configure one: the default cmi5 isolation scope
+	DefaultMaxPermission = "actor-activity-registration-scoped"
+
+	// APIKeyPrefix starts every generated LMS API key. The prefix plus eight
+	// hex characters identify a key without revealing it.
+	APIKeyPrefix = "xlp_"
+
+	// apiKeyIDLength is the length of a key's public identifier (prefix + 8 hex)
+	apiKeyIDLength = len(APIKeyPrefix) + 8
+
+	// apiKeyTouchInterval throttles last_used_at updates per key
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	// ErrAPIKeyInvalid is returned when no active key matches
+	ErrAPIKeyInvalid = errors.New("invalid API key")
+	// ErrAPIKeyExpired is returned when the matching key is past expires_at
+	ErrAPIKeyExpired = errors.New("API key expired")
+	// ErrAPIKeyNotFound is returned when a key prefix is unknown or revoked
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// LMSAPIKey is a salted hash of an LMS API key plus the limits on the
+// tokens it may request. The plaintext key is never retained.
+type LMSAPIKey struct {
+	ID                      int
+	Prefix                  string // Public identifier; empty for legacy keys
+	Salt                    string
+	Hash                    string // Hex SHA-256 of salt || key
+	ExpiresAt               *time.Time
+	MaxReadPermission       string
+	MaxWritePermission      string
+	AllowedCourseIDs        []string // Empty allows any course
+	AllowedActivityPrefixes []string // Empty allows any activity
+
+	lastTouched atomic.Int64 // Unix seconds of the last last_used_at update
+}
+
+// APIKeyUsageRecorder records when API keys are used
+type APIKeyUsageRecorder interface {
+	TouchAPIKey(ctx context.Context, tenantID string, keyID int) error
+}
+
+// NewLMSAPIKey validates and normalizes API key limits
+func NewLMSAPIKey(maxRead, maxWrite string, courseIDs, activityPrefixes []string) (*LMSAPIKey, error) {
+	if maxRead == "" {
+		maxRead = DefaultMaxPermission
+	}
+	if maxWrite == "" {
+		maxWrite = DefaultMaxPermission
+	}
+	if err := models.ValidatePermission(maxRead); err != nil {
+		return nil, fmt.Errorf("max_read_permission: %w", err)
+	}
+	if err := models.ValidatePermission(maxWrite); err != nil {
+		return nil, fmt.Errorf("max_write_permission: %w", err)
+	}
+
+	return &LMSAPIKey{
+		MaxReadPermission:       maxRead,
+		MaxWritePermission:      maxWrite,
+		AllowedCourseIDs:        courseIDs,
+		AllowedActivityPrefixes: activityPrefixes,
+	}, nil
+}
+
+// GenerateAPIKey returns a new random API key and its public prefix
+func GenerateAPIKey() (key, prefix string, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	prefix = APIKeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// NewAPIKeySalt returns a random per-key salt
+func NewAPIKeySalt() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashAPIKey returns the hex SHA-256 digest of salt || key
+func HashAPIKey(salt, key string) string {
+	sum := sha256.Sum256([]byte(salt + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefixOf returns the public prefix of a generated key, or "" for
+// keys not generated by GenerateAPIKey
+func APIKeyPrefixOf(key string) string {
+	if !strings.HasPrefix(key, APIKeyPrefix) || len(key) <= apiKeyIDLength || key[apiKeyIDLength] != '_' {
+		return ""
+	}
+	return key[:apiKeyIDLength]
+}
+
+// SetSecret stores the salted hash of a plaintext key
+func (k *LMSAPIKey) SetSecret(key string) error {
+	salt, err := NewAPIKeySalt()
+	if err != nil {
+		return err
+	}
+	k.Prefix = APIKeyPrefixOf(key)
+	k.Salt = salt
+	k.Hash = HashAPIKey(salt, key)
+	return nil
+}
+
+// Matches reports in constant time whether a presented key hashes to this key
+func (k *LMSAPIKey) Matches(presented string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(k.Salt, presented)), []byte(k.Hash)) == 1
+}
+
+// Expired reports whether the key is past its expiry
+func (k *LMSAPIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// ShouldTouch reports whether last_used_at is due for an update, claiming
+// the update so concurrent requests don't all write it
+func (k *LMSAPIKey) ShouldTouch(now time.Time) bool {
+	last := k.lastTouched.Load()
+	if now.Unix()-last < int64(apiKeyTouchInterval/time.Second) {
+		return false
+	}
+	return k.lastTouched.CompareAndSwap(last, now.Unix())
+}
+
+// LookupAPIKey finds the active key matching a presented API key. Keys are
+// bucketed by public prefix and compared by salted hash in constant time.
+// An expired key is returned together with ErrAPIKeyExpired.
+func (t *TenantConfig) LookupAPIKey(presented string) (*LMSAPIKey, error) {
+	var match *LMSAPIKey
+	for _, k := range t.LMSAPIKeys[APIKeyPrefixOf(presented)] {
+		// Compare every candidate so timing doesn't reveal which one matched
+		if k.Matches(presented) {
+			match = k
+		}
+	}
+	if match == nil {
+		return nil, ErrAPIKeyInvalid
+	}
+	if match.Expired(time.Now()) {
+		return match, ErrAPIKeyExpired
+	}
+	return match, nil
+}
+
+// addAPIKey indexes a key by its public prefix
+func (t *TenantConfig) addAPIKey(k *LMSAPIKey) {
+	t.LMSAPIKeys[k.Prefix] = append(t.LMSAPIKeys[k.Prefix], k)
+}
+
+// Authorize checks a token request against the key's limits, returning a
+// reason suitable for the client when it is denied
+func (k *LMSAPIKey) Authorize(req *models.TokenRequest) error {
+	if models.PermissionLevel(req.Permissions.Write) > models.PermissionLevel(k.MaxWritePermission) {
+		return fmt.Errorf("write permission %s exceeds API key maximum %s", req.Permissions.Write, k.MaxWritePermission)
+	}
+	if models.PermissionLevel(req.Permissions.Read) > models.PermissionLevel(k.MaxReadPermission) {
+		return fmt.Errorf("read permission %s exceeds API key maximum %s", req.Permissions.Read, k.MaxReadPermission)
+	}
+
+	if len(k.AllowedCourseIDs) > 0 {
+		allowed := false
+		for _, id := range k.AllowedCourseIDs {
+			if req.CourseID == id {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("course %q not allowed for API key", req.CourseID)
+		}
+	}
+
+	if len(k.AllowedActivityPrefixes) > 0 {
+		allowed := false
+		for _, prefix := range k.AllowedActivityPrefixes {
+			if strings.HasPrefix(req.ActivityID, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("activity %q not allowed for API key", req.ActivityID)
+		}
+	}
+
+	return nil
+}
+
+// LMSAPIKeyRequest requests a new server-generated API key
+type LMSAPIKeyRequest struct {
+	Description             string     `json:"description,omitempty"`
+	ExpiresAt               *time.Time `json:"expires_at,omitempty"`
+	MaxReadPermission       string     `json:"max_read_permission,omitempty"`
+	MaxWritePermission      string     `json:"max_write_permission,omitempty"`
+	AllowedCourseIDs        []string   `json:"allowed_course_ids,omitempty"`
+	AllowedActivityPrefixes []string   `json:"allowed_activity_prefixes,omitempty"`
+}
+
+// APIKeyInfo describes a stored API key without its secret
+type APIKeyInfo struct {
+	Prefix                  string     `json:"prefix"`
+	Description             string     `json:"description,omitempty"`
+	CreatedAt               time.Time  `json:"created_at"`
+	ExpiresAt               *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt              *time.Time `json:"last_used_at,omitempty"`
+	Revoked                 bool       `json:"revoked"`
+	RevokedAt               *time.Time `json:"revoked_at,omitempty"`
+	MaxReadPermission       string     `json:"max_read_permission"`
+	MaxWritePermission      string     `json:"max_write_permission"`
+	AllowedCourseIDs        []string   `json:"allowed_course_ids,omitempty"`
+	AllowedActivityPrefixes []string   `json:"allowed_activity_prefixes,omitempty"`
+}
+
+// CreatedAPIKey is a newly generated key. Key is shown only once.
+type CreatedAPIKey struct {
+	Key string `json:"key"`
+	APIKeyInfo
+}
+
+// execer is satisfied by *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertAPIKey generates a key, stores its salted hash and returns the plaintext once
+func insertAPIKey(ctx context.Context, db execer, tenantID string, req *LMSAPIKeyRequest) (*CreatedAPIKey, error) {
+	limits, err := NewLMSAPIKey(req.MaxReadPermission, req.MaxWritePermission, req.AllowedCourseIDs, req.AllowedActivityPrefixes)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	key, _, err := GenerateAPIKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate API key: %w", err)
+	}
+	if err := limits.SetSecret(key); err != nil {
+		return nil, fmt.Errorf("failed to hash API key: %w", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO tenant_lms_api_keys
+			(tenant_id, key_prefix, salt, api_key_hash, description, expires_at,
+			 max_read_permission, max_write_permission, allowed_course_ids, allowed_activity_prefixes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, tenantID, limits.Prefix, limits.Salt, limits.Hash, req.Description, req.ExpiresAt,
+		limits.MaxReadPermission, limits.MaxWritePermission,
+		strings.Join(limits.AllowedCourseIDs, " "), strings.Join(limits.AllowedActivityPrefixes, " "), now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return &CreatedAPIKey{
+		Key: key,
+		APIKeyInfo: APIKeyInfo{
+			Prefix:                  limits.Prefix,
+			Description:             req.Description,
+			CreatedAt:               now,
+			ExpiresAt:               req.ExpiresAt,
+			MaxReadPermission:       limits.MaxReadPermission,
+			MaxWritePermission:      limits.MaxWritePermission,
+			AllowedCourseIDs:        limits.AllowedCourseIDs,
+			AllowedActivityPrefixes: limits.AllowedActivityPrefixes,
+		},
+	}, nil
+}
+
+// CreateAPIKey generates a new API key for a tenant
+func (s *DatabaseTenantStore) CreateAPIKey(ctx context.Context, tenantID string, req *LMSAPIKeyRequest) (*CreatedAPIKey, error) {
+	created, err := insertAPIKey(ctx, s.db, tenantID, req)
+	if err != nil {
+		return nil, err
+	}
+	s.invalidateTenant(tenantID)
+
+	log.WithFields(log.Fields{
+		"tenant_id":  tenantID,
+		"key_prefix": created.Prefix,
+	}).Info("API key created")
+
+	return created, nil
+}
+
+// ListAPIKeys returns a tenant's API keys, identified by prefix
+func (s *DatabaseTenantStore) ListAPIKeys(ctx context.Context, tenantID string) ([]*APIKeyInfo, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(key_prefix, ''), COALESCE(description, ''), created_at, expires_at, last_used_at,
+		       revoked, revoked_at, max_read_permission, max_write_permission,
+		       COALESCE(allowed_course_ids, ''), COALESCE(allowed_activity_prefixes, '')
+		FROM tenant_lms_api_keys
+		WHERE tenant_id = $1
+		ORDER BY created_at, id
+	`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*APIKeyInfo
+	for rows.Next() {
+		k := &APIKeyInfo{}
+		var expiresAt, lastUsedAt, revokedAt sql.NullTime
+		var courseIDs, activityPrefixes string
+		if err := rows.Scan(&k.Prefix, &k.Description, &k.CreatedAt, &expiresAt, &lastUsedAt,
+			&k.Revoked, &revokedAt, &k.MaxReadPermission, &k.MaxWritePermission,
+			&courseIDs, &activityPrefixes); err != nil {
+			return nil, err
+		}
+		k.ExpiresAt = nullTimePtr(expiresAt)
+		k.LastUsedAt = nullTimePtr(lastUsedAt)
+		k.RevokedAt = nullTimePtr(revokedAt)
+		k.AllowedCourseIDs = strings.Fields(courseIDs)
+		k.AllowedActivityPrefixes = strings.Fields(activityPrefixes)
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes a tenant's API key by prefix
+func (s *DatabaseTenantStore) RevokeAPIKey(ctx context.Context, tenantID, prefix string) error {
+	if err := revokeAPIKey(ctx, s.db, tenantID, prefix); err != nil {
+		return err
+	}
+	s.invalidateTenant(tenantID)
+
+	log.WithFields(log.Fields{
+		"tenant_id":  tenantID,
+		"key_prefix": prefix,
+	}).Info("API key revoked")
+
+	return nil
+}
+
+// revokeAPIKey marks an active key revoked
+func revokeAPIKey(ctx context.Context, db execer, tenantID, prefix string) error {
+	result, err := db.ExecContext(ctx, `
+		UPDATE tenant_lms_api_keys
+		SET revoked = true, revoked_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = $1 AND key_prefix = $2 AND revoked = false
+	`, tenantID, prefix)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, prefix)
+	}
+	return nil
+}
+
+// RotateAPIKey replaces a key with a new one carrying the same description
+// and limits. With a grace period the old key keeps working until it
+// elapses; otherwise it is revoked immediately.
+func (s *DatabaseTenantStore) RotateAPIKey(ctx context.Context, tenantID, prefix string, grace time.Duration) (*CreatedAPIKey, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	req := &LMSAPIKeyRequest{}
+	var expiresAt sql.NullTime
+	var courseIDs, activityPrefixes string
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(description, ''), expires_at, max_read_permission, max_write_permission,
+		       COALESCE(allowed_course_ids, ''), COALESCE(allowed_activity_prefixes, '')
+		FROM tenant_lms_api_keys
+		WHERE tenant_id = $1 AND key_prefix = $2 AND revoked = false
+		FOR UPDATE
+	`, tenantID, prefix).Scan(&req.Description, &expiresAt, &req.MaxReadPermission, &req.MaxWritePermission,
+		&courseIDs, &activityPrefixes)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, prefix)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key: %w", err)
+	}
+	req.AllowedCourseIDs = strings.Fields(courseIDs)
+	req.AllowedActivityPrefixes = strings.Fields(activityPrefixes)
+	if expiresAt.Valid && expiresAt.Time.After(time.Now()) {
+		req.ExpiresAt = &expiresAt.Time
+	}
+
+	created, err := insertAPIKey(ctx, tx, tenantID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if grace > 0 {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE tenant_lms_api_keys
+			SET expires_at = $3
+			WHERE tenant_id = $1 AND key_prefix = $2 AND (expires_at IS NULL OR expires_at > $3)
+		`, tenantID, prefix, time.Now().Add(grace).UTC())
+		if err != nil {
+			return nil, fmt.Errorf("failed to expire rotated API key: %w", err)
+		}
+	} else if err := revokeAPIKey(ctx, tx, tenantID, prefix); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.invalidateTenant(tenantID)
+
+	log.WithFields(log.Fields{
+		"tenant_id":      tenantID,
+		"old_key_prefix": prefix,
+		"new_key_prefix": created.Prefix,
+		"grace_seconds":  int(grace.Seconds()),
+	}).Info("API key rotated")
+
+	return created, nil
+}
+
+// TouchAPIKey implements APIKeyUsageRecorder
+func (s *DatabaseTenantStore) TouchAPIKey(ctx context.Context, tenantID string, keyID int) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE tenant_lms_api_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = $1 AND id = $2
+	`, tenantID, keyID)
+	return err
+}
+
+// nullTimePtr converts a nullable timestamp to a pointer
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+)
+
+func TestNewLMSAPIKey(t *testing.T) {
+	key, err := NewLMSAPIKey("", "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.MaxReadPermission != DefaultMaxPermission || key.MaxWritePermission != DefaultMaxPermission {
+		t.Errorf("default limits = %s, %s; want %s", key.MaxReadPermission, key.MaxWritePermission, DefaultMaxPermission)
+	}
+	if _, err := NewLMSAPIKey("everything", "", nil, nil); err == nil {
+		t.Error("NewLMSAPIKey accepted an unknown read permission")
+	}
+	if _, err := NewLMSAPIKey("", "everything", nil, nil); err == nil {
+		t.Error("NewLMSAPIKey accepted an unknown write permission")
+	}
+}
+
+func TestLMSAPIKeyAuthorize(t *testing.T) {
+	key, err := NewLMSAPIKey("actor-course-registration-scoped", "actor-activity-registration-scoped",
+		[]string{"course-1", "course-2"}, []string{"https://example.com/course-1/", "https://example.com/shared/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlimited, err := NewLMSAPIKey("course-aggregate-only", "course-aggregate-only", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(write, read, courseID, activityID string) *models.TokenRequest {
+		return &models.TokenRequest{
+			Permissions: models.Permissions{Write: write, Read: read},
+			CourseID:    courseID,
+			ActivityID:  activityID,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		key     *LMSAPIKey
+		req     *models.TokenRequest
+		wantErr string // Substring of the denial; empty when allowed
+	}{
+		{"within limits", key,
+			request("actor-activity-registration-scoped", "actor-course-registration-scoped", "course-1", "https://example.com/course-1/au-1"), ""},
+		{"no permissions", key,
+			request("false", "false", "course-2", "https://example.com/shared/au"), ""},
+		{"write above maximum", key,
+			request("actor-course-registration-scoped", "false", "course-1", "https://example.com/course-1/au-1"),
+			"write permission actor-course-registration-scoped exceeds API key maximum actor-activity-registration-scoped"},
+		{"read above maximum", key,
+			request("false", "course-aggregate-only", "course-1", "https://example.com/course-1/au-1"),
+			"read permission course-aggregate-only exceeds API key maximum actor-course-registration-scoped"},
+		{"other course", key,
+			request("false", "false", "course-3", "https://example.com/course-1/au-1"), `course "course-3" not allowed`},
+		{"no course", key,
+			request("false", "false", "", "https://example.com/course-1/au-1"), `course "" not allowed`},
+		{"other activity", key,
+			request("false", "false", "course-1", "https://example.com/course-2/au-1"), `activity "https://example.com/course-2/au-1" not allowed`},
+		{"activity prefix is not a substring match", key,
+			request("false", "false", "course-1", "https://evil.example.com/?https://example.com/course-1/"), "not allowed"},
+		{"unrestricted key", unlimited,
+			request("course-aggregate-only", "course-aggregate-only", "", "https://anywhere.example.com/"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.key.Authorize(tt.req)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Authorize: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Authorize error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+)
+
+// Permission types recorded in permission_approvals
+const (
+	PermissionTypeStatementsRead  = "statements_read"
+	PermissionTypeStatementsWrite = "statements_write"
+)
+
+// ErrApprovalNotFound is returned when an approval does not exist or is
+// already revoked
+var ErrApprovalNotFound = errors.New("approval not found")
+
+// ApprovalStore checks LMS admin approvals for elevated permissions
+type ApprovalStore interface {
+	// IsApproved reports whether an approved, unrevoked approval exists for
+	// the given AU, permission type and scope
+	IsApproved(ctx context.Context, tenantID, courseID, auID, permissionType, scope string) (bool, error)
+}
+
+// PermissionApproval is a request for, and decision on, an elevated
+// permission for an assignable unit (AU)
+type PermissionApproval struct {
+	ID              int        `json:"id"`
+	TenantID        string     `json:"tenant_id"`
+	CourseID        string     `json:"course_id"`
+	AUID            string     `json:"au_id"`
+	PermissionType  string     `json:"permission_type"`
+	PermissionScope string     `json:"permission_scope"`
+	Justification   string     `json:"justification,omitempty"`
+	Approved        bool       `json:"approved"`
+	ApprovedBy      string     `json:"approved_by,omitempty"`
+	ApprovedAt      *time.Time `json:"approved_at,omitempty"`
+	Revoked         bool       `json:"revoked"`
+	RevokedBy       string     `json:"revoked_by,omitempty"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// ApprovalRequest requests an elevated permission for an AU
+type ApprovalRequest struct {
+	CourseID        string `json:"course_id"`
+	AUID            string `json:"au_id"`
+	PermissionType  string `json:"permission_type"`
+	PermissionScope string `json:"permission_scope"`
+	Justification   string `json:"justification"`
+}
+
+// Validate checks an approval request
+func (r *ApprovalRequest) Validate() error {
+	if r.CourseID == "" || r.AUID == "" {
+		return fmt.Errorf("course_id and au_id are required")
+	}
+	if r.PermissionType != PermissionTypeStatementsRead && r.PermissionType != PermissionTypeStatementsWrite {
+		return fmt.Errorf("invalid permission_type: %s", r.PermissionType)
+	}
+	if err := models.ValidatePermission(r.PermissionScope); err != nil {
+		return err
+	}
+	if !models.IsElevatedPermission(r.PermissionScope) {
+		return fmt.Errorf("permission %s does not require approval", r.PermissionScope)
+	}
+	return nil
+}
+
+// IsApproved implements ApprovalStore using approvals from configuration
+func (s *SingleTenantStore) IsApproved(ctx context.Context, tenantID, courseID, auID, permissionType, scope string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, a := range s.approvals {
+		if a.CourseID == courseID && a.AUID == auID && a.PermissionType == permissionType && a.PermissionScope == scope {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IsApproved implements ApprovalStore
+func (s *DatabaseTenantStore) IsApproved(ctx context.Context, tenantID, courseID, auID, permissionType, scope string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM permission_approvals
+			WHERE tenant_id = $1 AND course_id = $2 AND au_id = $3
+			  AND permission_type = $4 AND permission_scope = $5
+			  AND approved = true AND revoked = false
+		)
+	`, tenantID, courseID, auID, permissionType, scope).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check permission approval: %w", err)
+	}
+	return exists, nil
+}
+
+// RequestApproval records a pending approval request. Re-requesting an AU's
+// permission type resets any previous decision.
+func (s *DatabaseTenantStore) RequestApproval(ctx context.Context, tenantID string, req *ApprovalRequest) (*PermissionApproval, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO permission_approvals (tenant_id, course_id, au_id, permission_type, permission_scope, justification)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant_id, course_id, au_id, permission_type) DO UPDATE SET
+			permission_scope = EXCLUDED.permission_scope,
+			justification = EXCLUDED.justification,
+			approved = false, approved_by = NULL, approved_at = NULL,
+			revoked = false, revoked_by = NULL, revoked_at = NULL,
+			created_at = CURRENT_TIMESTAMP
+		RETURNING id
+	`, tenantID, req.CourseID, req.AUID, req.PermissionType, req.PermissionScope, req.Justification).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request approval: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"tenant_id":   tenantID,
+		"approval_id": id,
+		"course_id":   req.CourseID,
+		"au_id":       req.AUID,
+		"scope":       req.PermissionScope,
+	}).Info("Permission approval requested")
+
+	return s.GetApproval(ctx, tenantID, id)
+}
+
+// ApproveApproval approves a pending request, recording the approver
+func (s *DatabaseTenantStore) ApproveApproval(ctx context.Context, tenantID string, id int, approvedBy string) (*PermissionApproval, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE permission_approvals
+		SET approved = true, approved_by = $3, approved_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = $1 AND id = $2 AND revoked = false
+	`, tenantID, id, approvedBy)
+	if err := checkApprovalUpdate(result, err, tenantID, id); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"tenant_id":   tenantID,
+		"approval_id": id,
+		"approved_by": approvedBy,
+	}).Info("Permission approved")
+
+	return s.GetApproval(ctx, tenantID, id)
+}
+
+// RevokeApproval revokes an approval, recording who revoked it
+func (s *DatabaseTenantStore) RevokeApproval(ctx context.Context, tenantID string, id int, revokedBy string) (*PermissionApproval, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE permission_approvals
+		SET revoked = true, revoked_by = $3, revoked_at = CURRENT_TIMESTAMP
+		WHERE tenant_id = $1 AND id = $2 AND revoked = false
+	`, tenantID, id, revokedBy)
+	if err := checkApprovalUpdate(result, err, tenantID, id); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"tenant_id":   tenantID,
+		"approval_id": id,
+		"revoked_by":  revokedBy,
+	}).Info("Permission approval revoked")
+
+	return s.GetApproval(ctx, tenantID, id)
+}
+
+// checkApprovalUpdate maps a no-op approval update to a not-found error
+func checkApprovalUpdate(result sql.Result, err error, tenantID string, id int) error {
+	if err != nil {
+		return fmt.Errorf("failed to update approval: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("%w: approval %d for tenant %s", ErrApprovalNotFound, id, tenantID)
+	}
+	return nil
+}
+
+// GetApproval returns a single approval
+func (s *DatabaseTenantStore) GetApproval(ctx context.Context, tenantID string, id int) (*PermissionApproval, error) {
+	rows, err := s.queryApprovals(ctx, `WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: approval %d for tenant %s", ErrApprovalNotFound, id, tenantID)
+	}
+	return rows[0], nil
+}
+
+// ListApprovals returns a tenant's approvals, optionally for one course
+func (s *DatabaseTenantStore) ListApprovals(ctx context.Context, tenantID, courseID string) ([]*PermissionApproval, error) {
+	if courseID != "" {
+		return s.queryApprovals(ctx, `WHERE tenant_id = $1 AND course_id = $2 ORDER BY id`, tenantID, courseID)
+	}
+	return s.queryApprovals(ctx, `WHERE tenant_id = $1 ORDER BY id`, tenantID)
+}
+
+// queryApprovals selects approvals matching a WHERE clause
+func (s *DatabaseTenantStore) queryApprovals(ctx context.Context, where string, args ...interface{}) ([]*PermissionApproval, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, tenant_id, course_id, au_id, permission_type, permission_scope,
+		       COALESCE(justification, ''), approved, COALESCE(approved_by, ''), approved_at,
+		       revoked, COALESCE(revoked_by, ''), revoked_at, created_at
+		FROM permission_approvals
+	`+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query approvals: %w", err)
+	}
+	defer rows.Close()
+
+	var approvals []*PermissionApproval
+	for rows.Next() {
+		a := &PermissionApproval{}
+		var approvedAt, revokedAt sql.NullTime
+		if err := rows.Scan(&a.ID, &a.TenantID, &a.CourseID, &a.AUID, &a.PermissionType, &a.PermissionScope,
+			&a.Justification, &a.Approved, &a.ApprovedBy, &approvedAt,
+			&a.Revoked, &a.RevokedBy, &revokedAt, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if approvedAt.Valid {
+			a.ApprovedAt = &approvedAt.Time
+		}
+		if revokedAt.Valid {
+			a.RevokedAt = &revokedAt.Time
+		}
+		approvals = append(approvals, a)
+	}
+	return approvals, rows.Err()
+}
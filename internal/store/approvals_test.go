@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+)
+
+// approvalCases checks an ApprovalStore holding a single approval of
+// actor-course-registration-scoped reads for course-1/au-1
+func approvalCases(t *testing.T, s ApprovalStore, tenantID string) {
+	t.Helper()
+	tests := []struct {
+		name                                      string
+		tenantID, courseID, auID, permType, scope string
+		want                                      bool
+	}{
+		{"approved", tenantID, "course-1", "au-1", PermissionTypeStatementsRead, "actor-course-registration-scoped", true},
+		{"higher scope", tenantID, "course-1", "au-1", PermissionTypeStatementsRead, "course-aggregate-only", false},
+		{"other elevated scope", tenantID, "course-1", "au-1", PermissionTypeStatementsRead, "actor-activity-all-registrations", false},
+		{"other permission type", tenantID, "course-1", "au-1", PermissionTypeStatementsWrite, "actor-course-registration-scoped", false},
+		{"other AU", tenantID, "course-1", "au-2", PermissionTypeStatementsRead, "actor-course-registration-scoped", false},
+		{"other course", tenantID, "course-2", "au-1", PermissionTypeStatementsRead, "actor-course-registration-scoped", false},
+	}
+	for _, tt := range tests {
+		approved, err := s.IsApproved(context.Background(), tt.tenantID, tt.courseID, tt.auID, tt.permType, tt.scope)
+		if err != nil || approved != tt.want {
+			t.Errorf("%s: IsApproved = %v, %v; want %v", tt.name, approved, err, tt.want)
+		}
+	}
+}
+
+func TestSingleTenantStoreApprovals(t *testing.T) {
+	cfg := &config.Config{
+		Mode: "single-tenant",
+		LRS:  config.LRSConfig{Endpoint: "https://lrs.example.com/xapi/"},
+		Auth: config.AuthConfig{
+			JWTSecret:  "default-secret-with-at-least-32-bytes",
+			LMSAPIKeys: []config.LMSAPIKeyConfig{{Key: "lms-key"}},
+			PermissionApprovals: []config.ApprovalConfig{{
+				CourseID:        "course-1",
+				AUID:            "au-1",
+				PermissionType:  PermissionTypeStatementsRead,
+				PermissionScope: "actor-course-registration-scoped",
+				ApprovedBy:      "alice@example.com",
+			}},
+		},
+	}
+	s, err := NewSingleTenantStore(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approvalCases(t, s, "default")
+
+	// Every configured approval names who approved it
+	cfg.Auth.PermissionApprovals[0].ApprovedBy = ""
+	if _, err := NewSingleTenantStore(cfg); err == nil {
+		t.Error("approval without approved_by accepted")
+	}
+}
+
+func TestFileTenantStoreApprovals(t *testing.T) {
+	dir := t.TempDir()
+	data := `hosts: ["acme.example.com"]
+lrs:
+  endpoint: https://lrs.example.com/xapi/
+  username: acme
+  password: acme-password
+auth:
+  jwt_secret: acme-secret-with-at-least-32-bytes
+  lms_api_keys: [lms-key]
+  permission_approvals:
+    - course_id: course-1
+      au_id: au-1
+      permission_type: statements_read
+      permission_scope: actor-course-registration-scoped
+      approved_by: alice@example.com
+`
+	if err := os.WriteFile(filepath.Join(dir, "acme.yaml"), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFileTenantStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.GetByID(context.Background(), "acme"); err != nil {
+		t.Fatal(err)
+	}
+	approvalCases(t, s, "acme")
+	if approved, err := s.IsApproved(context.Background(), "globex", "course-1", "au-1",
+		PermissionTypeStatementsRead, "actor-course-registration-scoped"); err != nil || approved {
+		t.Errorf("IsApproved for another tenant = %v, %v; want false", approved, err)
+	}
+}
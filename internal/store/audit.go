@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
+)
+
+// WriteAuditEvents implements audit.Sink, inserting a batch of events into
+// audit_log in one transaction. Each event extends its tenant's hash chain.
+func (s *DatabaseTenantStore) WriteAuditEvents(ctx context.Context, events []*audit.Event) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Replicas append to the same chains, so each batch reads and extends
+	// the chain heads under a lock that still allows reads. SQLite
+	// transactions already lock the database.
+	if s.db.dialect == dialectPostgres {
+		if _, err := tx.ExecContext(ctx, `LOCK TABLE audit_log IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return fmt.Errorf("failed to lock audit log: %w", err)
+		}
+	}
+
+	chainIDs := make(map[string]string)
+	heads := make(map[string]string)
+	for _, e := range events {
+		chainID, ok := chainIDs[e.TenantID]
+		if !ok {
+			if chainID, err = auditChainID(ctx, tx, e.TenantID); err != nil {
+				return err
+			}
+			chainIDs[e.TenantID] = chainID
+		}
+		head, ok := heads[chainID]
+		if !ok {
+			if head, err = auditChainHead(ctx, tx, chainID); err != nil {
+				return err
+			}
+		}
+
+		// Hash the values as the database returns them, so that the hash
+		// can be recomputed from a stored or exported record
+		stored := *e
+		stored.Timestamp = e.Timestamp.UTC().Truncate(time.Microsecond)
+		stored.IPAddress = ""
+		if parsed := net.ParseIP(e.IPAddress); parsed != nil {
+			stored.IPAddress = parsed.String()
+		}
+		hash := audit.ChainHash(chainID, head, &stored)
+
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO audit_log
+				(tenant_id, timestamp, operation, actor_mbox, registration, activity_id,
+				 permission_write, permission_read, success, error_message, ip_address, user_agent,
+				 admin_principal, admin_role, request_method, request_path, chain_id, prev_hash, hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		`, nullString(chainID), stored.Timestamp, stored.Operation, nullString(stored.ActorMbox), nullString(stored.Registration),
+			nullString(stored.ActivityID), nullString(stored.PermissionWrite), nullString(stored.PermissionRead),
+			stored.Success, nullString(stored.Reason), nullString(stored.IPAddress), nullString(stored.UserAgent),
+			nullString(stored.AdminPrincipal), nullString(stored.AdminRole), nullString(stored.RequestMethod), nullString(stored.RequestPath),
+			chainID, nullString(head), hash)
+		if err != nil {
+			return fmt.Errorf("failed to insert audit event: %w", err)
+		}
+		heads[chainID] = hash
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// auditChainID returns the chain an event for tenantID belongs to. tenant_id
+// references tenants, so events naming an unknown tenant (including failed
+// creates) are recorded without it, in the "" chain.
+func auditChainID(ctx context.Context, tx *sqlTx, tenantID string) (string, error) {
+	if tenantID == "" {
+		return "", nil
+	}
+	var id string
+	err := tx.QueryRowContext(ctx, `SELECT tenant_id FROM tenants WHERE tenant_id = $1`, tenantID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up audit tenant: %w", err)
+	}
+	return id, nil
+}
+
+// auditChainHead returns the hash of a chain's latest record, or "" for a
+// new chain
+func auditChainHead(ctx context.Context, tx *sqlTx, chainID string) (string, error) {
+	var hash string
+	err := tx.QueryRowContext(ctx, `
+		SELECT hash FROM audit_log
+		WHERE chain_id = $1 AND hash IS NOT NULL
+		ORDER BY id DESC LIMIT 1
+	`, chainID).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read audit chain head: %w", err)
+	}
+	return hash, nil
+}
+
+// nullString maps "" to NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// AuditFilter selects audit events. Empty fields match everything.
+type AuditFilter struct {
+	TenantID     string
+	ActorMbox    string
+	Registration string
+	ActivityID   string
+	Operation    string
+	Success      *bool
+	Since        *time.Time // Inclusive
+	Until        *time.Time // Exclusive
+	BeforeID     int64      // Cursor: only events older than this ID
+	Limit        int
+}
+
+// QueryAuditEvents returns the events matching filter, newest first
+func (s *DatabaseTenantStore) QueryAuditEvents(ctx context.Context, filter *AuditFilter) ([]*audit.Record, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.TenantID != "" {
+		where("tenant_id = $%d", filter.TenantID)
+	}
+	if filter.ActorMbox != "" {
+		where("actor_mbox = $%d", filter.ActorMbox)
+	}
+	if filter.Registration != "" {
+		where("registration = $%d", filter.Registration)
+	}
+	if filter.ActivityID != "" {
+		where("activity_id = $%d", filter.ActivityID)
+	}
+	if filter.Operation != "" {
+		where("operation = $%d", filter.Operation)
+	}
+	if filter.Success != nil {
+		where("success = $%d", *filter.Success)
+	}
+	if filter.Since != nil {
+		where("timestamp >= $%d", filter.Since.UTC())
+	}
+	if filter.Until != nil {
+		where("timestamp < $%d", filter.Until.UTC())
+	}
+	if filter.BeforeID > 0 {
+		where("id < $%d", filter.BeforeID)
+	}
+
+	query := auditRecordColumns + `
+		FROM audit_log`
+	if len(conditions) > 0 {
+		query += "\n\t\tWHERE " + strings.Join(conditions, " AND ")
+	}
+	query += "\n\t\tORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*audit.Record
+	for rows.Next() {
+		rec, err := scanAuditRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// auditRecordColumns selects the columns read by scanAuditRecord
+const auditRecordColumns = `
+		SELECT id, COALESCE(tenant_id, ''), timestamp, operation, COALESCE(actor_mbox, ''),
+		       COALESCE(registration, ''), COALESCE(activity_id, ''), COALESCE(permission_write, ''),
+		       COALESCE(permission_read, ''), COALESCE(success, TRUE), COALESCE(error_message, ''), ip_address,
+		       COALESCE(user_agent, ''), COALESCE(admin_principal, ''), COALESCE(admin_role, ''),
+		       COALESCE(request_method, ''), COALESCE(request_path, ''),
+		       chain_id, COALESCE(prev_hash, ''), COALESCE(hash, '')`
+
+// scanAuditRecord reads a row selected with auditRecordColumns
+func scanAuditRecord(rows *sql.Rows) (*audit.Record, error) {
+	rec := &audit.Record{}
+	var ip sql.NullString
+	if err := rows.Scan(&rec.ID, &rec.TenantID, &rec.Timestamp, &rec.Operation, &rec.ActorMbox,
+		&rec.Registration, &rec.ActivityID, &rec.PermissionWrite,
+		&rec.PermissionRead, &rec.Success, &rec.Reason, &ip,
+		&rec.UserAgent, &rec.AdminPrincipal, &rec.AdminRole,
+		&rec.RequestMethod, &rec.RequestPath,
+		&rec.ChainID, &rec.PrevHash, &rec.Hash); err != nil {
+		return nil, err
+	}
+	rec.IPAddress = ip.String
+	rec.Timestamp = rec.Timestamp.UTC()
+	return rec, nil
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
+)
+
+// WriteAuditCheckpoints signs the head of every audit chain that has grown
+// since its last checkpoint and returns the new checkpoints
+func (s *DatabaseTenantStore) WriteAuditCheckpoints(ctx context.Context, key ed25519.PrivateKey) ([]*audit.Checkpoint, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Replicas checkpoint on the same schedule; only one signs each head
+	if s.db.dialect == dialectPostgres {
+		if _, err := tx.ExecContext(ctx, `LOCK TABLE audit_checkpoints IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+			return nil, fmt.Errorf("failed to lock audit checkpoints: %w", err)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT a.chain_id, a.id, a.hash
+		FROM audit_log a
+		WHERE a.id = (SELECT MAX(b.id) FROM audit_log b WHERE b.chain_id = a.chain_id AND b.hash IS NOT NULL)
+		  AND a.id > COALESCE((SELECT MAX(c.audit_id) FROM audit_checkpoints c WHERE c.chain_id = a.chain_id), 0)
+		ORDER BY a.chain_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit chain heads: %w", err)
+	}
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	var checkpoints []*audit.Checkpoint
+	for rows.Next() {
+		cp := &audit.Checkpoint{CreatedAt: createdAt}
+		if err := rows.Scan(&cp.ChainID, &cp.AuditID, &cp.Hash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, cp := range checkpoints {
+		cp.Sign(key)
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO audit_checkpoints (chain_id, audit_id, hash, signature, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, cp.ChainID, cp.AuditID, cp.Hash, cp.Signature, cp.CreatedAt).Scan(&cp.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert audit checkpoint: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return checkpoints, nil
+}
+
+// AuditLog reads the audit log directly, for verification outside the proxy
+type AuditLog struct {
+	db *sqlDB
+}
+
+// OpenAuditLog connects to the database at connStr
+func OpenAuditLog(connStr string) (*AuditLog, error) {
+	db, err := openDatabase(connStr)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSchema(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &AuditLog{db: db}, nil
+}
+
+// Close closes the database connection
+func (l *AuditLog) Close() error {
+	return l.db.Close()
+}
+
+// Chains returns the ID of every audit chain, including chains whose
+// records are all gone but that were checkpointed
+func (l *AuditLog) Chains(ctx context.Context) ([]string, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT chain_id FROM audit_log
+		UNION
+		SELECT chain_id FROM audit_checkpoints
+		ORDER BY 1
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit chains: %w", err)
+	}
+	defer rows.Close()
+
+	var chains []string
+	for rows.Next() {
+		var chainID string
+		if err := rows.Scan(&chainID); err != nil {
+			return nil, err
+		}
+		chains = append(chains, chainID)
+	}
+	return chains, rows.Err()
+}
+
+// WalkChain calls fn for each record of a chain, oldest first, stopping at
+// and returning the first error fn returns
+func (l *AuditLog) WalkChain(ctx context.Context, chainID string, fn func(*audit.Record) error) error {
+	rows, err := l.db.QueryContext(ctx, auditRecordColumns+`
+		FROM audit_log
+		WHERE chain_id = $1
+		ORDER BY id
+	`, chainID)
+	if err != nil {
+		return fmt.Errorf("failed to read audit chain: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rec, err := scanAuditRecord(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Checkpoints returns a chain's checkpoints, oldest first
+func (l *AuditLog) Checkpoints(ctx context.Context, chainID string) ([]*audit.Checkpoint, error) {
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT id, chain_id, audit_id, hash, signature, created_at
+		FROM audit_checkpoints
+		WHERE chain_id = $1
+		ORDER BY id
+	`, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []*audit.Checkpoint
+	for rows.Next() {
+		cp := &audit.Checkpoint{}
+		if err := rows.Scan(&cp.ID, &cp.ChainID, &cp.AuditID, &cp.Hash, &cp.Signature, &cp.CreatedAt); err != nil {
+			return nil, err
+		}
+		cp.CreatedAt = cp.CreatedAt.UTC()
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, rows.Err()
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// tenantChangeChannel is the NOTIFY channel written by the tenant table
+// triggers in the schema migrations; the payload is the tenant ID
+const tenantChangeChannel = "tenant_changed"
+
+// CacheOptions tunes the DatabaseTenantStore cache
+type CacheOptions struct {
+	// TTL bounds how long a cached tenant is served without reloading
+	TTL time.Duration
+	// RefreshInterval flushes the whole cache periodically in case a
+	// notification was missed
+	RefreshInterval time.Duration
+}
+
+// setDefaults fills unset options
+func (o *CacheOptions) setDefaults() {
+	if o.TTL <= 0 {
+		o.TTL = 5 * time.Minute
+	}
+	if o.RefreshInterval <= 0 {
+		o.RefreshInterval = 15 * time.Minute
+	}
+}
+
+// CacheStats reports tenant cache effectiveness
+type CacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// cacheEntry is a cached tenant config
+type cacheEntry struct {
+	config  *TenantConfig
+	expires time.Time
+}
+
+// cacheCounters counts cache lookups
+type cacheCounters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// cached returns an unexpired cache entry for a host
+func (s *DatabaseTenantStore) cached(host string) (*TenantConfig, bool) {
+	s.mu.RLock()
+	entry, ok := s.cache[host]
+	s.mu.RUnlock()
+	return s.countLookup(entry, ok)
+}
+
+// cachedByID returns an unexpired cache entry for a tenant ID
+func (s *DatabaseTenantStore) cachedByID(tenantID string) (*TenantConfig, bool) {
+	s.mu.RLock()
+	entry, ok := s.byID[tenantID]
+	s.mu.RUnlock()
+	return s.countLookup(entry, ok)
+}
+
+// countLookup counts a cache lookup, treating expired entries as misses
+func (s *DatabaseTenantStore) countLookup(entry *cacheEntry, ok bool) (*TenantConfig, bool) {
+	if !ok || time.Now().After(entry.expires) {
+		s.stats.misses.Add(1)
+		return nil, false
+	}
+	s.stats.hits.Add(1)
+	return entry.config, true
+}
+
+// CacheStats returns cache hit and miss counts since startup
+func (s *DatabaseTenantStore) CacheStats() CacheStats {
+	s.mu.RLock()
+	entries := len(s.cache) + len(s.byID)
+	s.mu.RUnlock()
+
+	return CacheStats{
+		Hits:    s.stats.hits.Load(),
+		Misses:  s.stats.misses.Load(),
+		Entries: entries,
+	}
+}
+
+// flushCache evicts every cached tenant
+func (s *DatabaseTenantStore) flushCache() {
+	s.mu.Lock()
+	s.cache = make(map[string]*cacheEntry)
+	s.byID = make(map[string]*cacheEntry)
+	hooks := s.onInvalidate
+	s.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook("")
+	}
+}
+
+// OnInvalidate registers a function called whenever a tenant is evicted
+// from the cache, by a local change or a notification from another replica.
+// An empty tenant ID means every tenant was evicted.
+func (s *DatabaseTenantStore) OnInvalidate(fn func(tenantID string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onInvalidate = append(s.onInvalidate, fn)
+}
+
+// watchChanges evicts tenants changed by any replica, as announced by the
+// schema triggers, and flushes the cache every refresh interval and after
+// the listener reconnects, since notifications may have been missed
+func (s *DatabaseTenantStore) watchChanges(connStr string, refreshInterval time.Duration) {
+	listener := pq.NewListener(connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.WithError(err).Warn("Tenant change listener error")
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(tenantChangeChannel); err != nil {
+		log.WithError(err).Error("Failed to listen for tenant changes; relying on cache TTL and periodic refresh")
+	}
+
+	refresh := time.NewTicker(refreshInterval)
+	defer refresh.Stop()
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case n := <-listener.Notify:
+			if n == nil {
+				// Reconnected: anything could have changed meanwhile
+				s.flushCache()
+				continue
+			}
+			if n.Extra == "" {
+				// Host mappings changed, which can affect any tenant
+				s.flushCache()
+				continue
+			}
+			s.invalidateTenant(n.Extra)
+			log.WithField("tenant_id", n.Extra).Debug("Tenant cache invalidated by notification")
+		case <-refresh.C:
+			s.flushCache()
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
+
+// Close stops the change listener and closes the database
+func (s *DatabaseTenantStore) Close() error {
+	close(s.stop)
+	return s.db.Close()
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dialect is the SQL database behind a DatabaseTenantStore. Queries are
+// written for PostgreSQL and translated for other dialects.
+type dialect int
+
+const (
+	dialectPostgres dialect = iota
+	dialectSQLite
+)
+
+var (
+	// placeholderPattern matches Postgres $N placeholders
+	placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+	// forUpdatePattern matches row locks, which SQLite doesn't have; its
+	// transactions lock the whole database instead
+	forUpdatePattern = regexp.MustCompile(`(?i)\s+FOR\s+UPDATE\b`)
+)
+
+// rebind translates a Postgres query for the dialect
+func (d dialect) rebind(query string) string {
+	if d != dialectSQLite {
+		return query
+	}
+	query = forUpdatePattern.ReplaceAllString(query, "")
+	return placeholderPattern.ReplaceAllString(query, "?$1")
+}
+
+// args normalizes query arguments for the dialect. SQLite stores times as
+// text, so they are written in UTC to keep them comparable.
+func (d dialect) args(args []interface{}) []interface{} {
+	if d != dialectSQLite {
+		return args
+	}
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			args[i] = v.UTC()
+		case *time.Time:
+			if v != nil {
+				utc := v.UTC()
+				args[i] = &utc
+			}
+		}
+	}
+	return args
+}
+
+// sqlDB is a *sql.DB whose queries are translated for its dialect
+type sqlDB struct {
+	*sql.DB
+	dialect dialect
+}
+
+// ExecContext executes a translated query
+func (db *sqlDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.dialect.rebind(query), db.dialect.args(args)...)
+}
+
+// QueryContext runs a translated query
+func (db *sqlDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, db.dialect.rebind(query), db.dialect.args(args)...)
+}
+
+// QueryRowContext runs a translated single-row query
+func (db *sqlDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.dialect.rebind(query), db.dialect.args(args)...)
+}
+
+// BeginTx starts a transaction whose queries are translated too
+func (db *sqlDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sqlTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// sqlTx is a *sql.Tx whose queries are translated for its dialect
+type sqlTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+// ExecContext executes a translated query
+func (tx *sqlTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.dialect.rebind(query), tx.dialect.args(args)...)
+}
+
+// QueryContext runs a translated query
+func (tx *sqlTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.dialect.rebind(query), tx.dialect.args(args)...)
+}
+
+// QueryRowContext runs a translated single-row query
+func (tx *sqlTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.dialect.rebind(query), tx.dialect.args(args)...)
+}
+
+// openDatabase connects to a PostgreSQL database, or to a SQLite database
+// for sqlite:///path
+func openDatabase(connStr string) (*sqlDB, error) {
+	var db *sql.DB
+	var err error
+	d := dialectPostgres
+	if strings.HasPrefix(connStr, "sqlite://") {
+		d = dialectSQLite
+		db, err = openSQLite(sqlitePath(connStr))
+	} else {
+		db, err = sql.Open("postgres", connStr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+	return &sqlDB{DB: db, dialect: d}, nil
+}
+
+// sqlitePath returns the database file of a sqlite:// connection string,
+// or "" for other connection strings
+func sqlitePath(connStr string) string {
+	if !strings.HasPrefix(connStr, "sqlite://") {
+		return ""
+	}
+	return strings.TrimPrefix(connStr, "sqlite://")
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrFetchTokenNotFound is returned when a fetch token is unknown, expired
+// or already used
+var ErrFetchTokenNotFound = errors.New("fetch token not found")
+
+// FetchTokenStore holds content JWTs for cmi5 fetch URLs. Each token can be
+// taken exactly once.
+type FetchTokenStore interface {
+	PutFetchToken(ctx context.Context, id, token string, ttl time.Duration) error
+	TakeFetchToken(ctx context.Context, id string) (string, error)
+}
+
+// MemoryFetchTokenStore is a per-process FetchTokenStore
+type MemoryFetchTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]fetchToken
+}
+
+// fetchToken is a stored token and its expiry
+type fetchToken struct {
+	token   string
+	expires time.Time
+}
+
+// NewMemoryFetchTokenStore creates an empty fetch token store
+func NewMemoryFetchTokenStore() *MemoryFetchTokenStore {
+	return &MemoryFetchTokenStore{tokens: make(map[string]fetchToken)}
+}
+
+// PutFetchToken implements FetchTokenStore
+func (s *MemoryFetchTokenStore) PutFetchToken(ctx context.Context, id, token string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, t := range s.tokens {
+		if now.After(t.expires) {
+			delete(s.tokens, k)
+		}
+	}
+	s.tokens[id] = fetchToken{token: token, expires: now.Add(ttl)}
+	return nil
+}
+
+// TakeFetchToken implements FetchTokenStore
+func (s *MemoryFetchTokenStore) TakeFetchToken(ctx context.Context, id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	delete(s.tokens, id)
+	if !ok || time.Now().After(t.expires) {
+		return "", ErrFetchTokenNotFound
+	}
+	return t.token, nil
+}
@@ -0,0 +1,486 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+)
+
+// DefaultFilePollInterval is how often a FileTenantStore rescans its directory
+const DefaultFilePollInterval = 5 * time.Second
+
+// tenantIDPattern restricts tenant IDs taken from tenant files
+var tenantIDPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,99}$`)
+
+// TenantFile is one tenant's YAML file in a FileTenantStore directory. The
+// lrs, auth, lti, rate_limits and quotas sections have the same layout as in
+// single-tenant mode.
+type TenantFile struct {
+	TenantID   string                  `yaml:"tenant_id"` // Defaults to the file name
+	Status     string                  `yaml:"status"`    // "active" (default) or "suspended"
+	Hosts      []string                `yaml:"hosts"`
+	LRS        config.LRSConfig        `yaml:"lrs"`
+	Auth       config.AuthConfig       `yaml:"auth"`
+	LTI        config.LTIConfig        `yaml:"lti,omitempty"`
+	RateLimits config.RateLimitsConfig `yaml:"rate_limits,omitempty"`
+	Quotas     config.QuotasConfig     `yaml:"quotas,omitempty"`
+}
+
+// FileTenantStore implements TenantStore from a directory with one YAML file
+// per tenant. The directory is rescanned periodically; changed files are
+// validated and swapped in atomically, and a file that fails validation
+// keeps its previously loaded version.
+type FileTenantStore struct {
+	dir   string
+	state atomic.Pointer[fileTenants]
+	stop  chan struct{}
+
+	reloadMu sync.Mutex
+	// Rejected files, so they are reported once per change
+	rejected map[string]rejectedFile
+	// Set while a reload resolves secret references again
+	refreshRefs bool
+}
+
+// rejectedFile is a tenant file that failed to load
+type rejectedFile struct {
+	digest [sha256.Size]byte
+	// Conflicting files are retried when other tenants change
+	conflict bool
+}
+
+// fileTenants is an immutable view of the loaded tenant files
+type fileTenants struct {
+	byFile map[string]*fileTenant
+	byID   map[string]*fileTenant
+	byHost map[string]*fileTenant
+}
+
+// fileTenant is a loaded tenant file
+type fileTenant struct {
+	digest    [sha256.Size]byte
+	config    *TenantConfig
+	approvals []*ApprovalRequest
+	// Whether any secret is a reference, and a digest of the resolved
+	// secrets to tell whether a refresh changed them
+	refs    bool
+	secrets [sha256.Size]byte
+}
+
+// NewFileTenantStore loads the tenant files in dir and rescans it every
+// interval. Files that fail validation are logged and skipped.
+func NewFileTenantStore(dir string, interval time.Duration) (*FileTenantStore, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tenant directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	if interval <= 0 {
+		interval = DefaultFilePollInterval
+	}
+
+	s := &FileTenantStore{
+		dir:      dir,
+		stop:     make(chan struct{}),
+		rejected: make(map[string]rejectedFile),
+	}
+	s.state.Store(&fileTenants{
+		byFile: make(map[string]*fileTenant),
+		byID:   make(map[string]*fileTenant),
+		byHost: make(map[string]*fileTenant),
+	})
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"dir":     dir,
+		"tenants": len(s.state.Load().byID),
+	}).Info("Loaded tenant files")
+
+	go s.watch(interval)
+
+	return s, nil
+}
+
+// GetByHost looks up a tenant by host header, preferring an exact host
+// mapping over the longest matching wildcard
+func (s *FileTenantStore) GetByHost(ctx context.Context, host string) (*TenantConfig, error) {
+	host, err := NormalizeHost(host)
+	if err != nil {
+		return nil, fmt.Errorf("tenant not found for host: %w", err)
+	}
+	byHost := s.state.Load().byHost
+	for _, candidate := range hostCandidates(host) {
+		if tenant, ok := byHost[candidate]; ok {
+			return tenant.config, nil
+		}
+	}
+	return nil, fmt.Errorf("tenant not found for host: %s", host)
+}
+
+// GetByID looks up a tenant by ID
+func (s *FileTenantStore) GetByID(ctx context.Context, tenantID string) (*TenantConfig, error) {
+	tenant, ok := s.state.Load().byID[tenantID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	return tenant.config, nil
+}
+
+// IsApproved implements ApprovalStore using approvals from the tenant files
+func (s *FileTenantStore) IsApproved(ctx context.Context, tenantID, courseID, auID, permissionType, scope string) (bool, error) {
+	tenant, ok := s.state.Load().byID[tenantID]
+	if !ok {
+		return false, nil
+	}
+	for _, a := range tenant.approvals {
+		if a.CourseID == courseID && a.AUID == auID && a.PermissionType == permissionType && a.PermissionScope == scope {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListTenants returns the loaded tenant IDs
+func (s *FileTenantStore) ListTenants(ctx context.Context) ([]string, error) {
+	var tenants []string
+	for tenantID := range s.state.Load().byID {
+		tenants = append(tenants, tenantID)
+	}
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// Close stops watching the directory
+func (s *FileTenantStore) Close() error {
+	close(s.stop)
+	return nil
+}
+
+// watch rescans the directory until the store is closed
+func (s *FileTenantStore) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				log.WithError(err).Error("Failed to rescan tenant directory")
+			}
+		}
+	}
+}
+
+// RefreshSecretRefs resolves the secret references of loaded tenant files
+// again every interval until ctx is done, swapping in tenants whose secrets
+// changed. Resolution errors are logged and the previous values kept.
+func (s *FileTenantStore) RefreshSecretRefs(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.reloadMu.Lock()
+			s.refreshRefs = true
+			s.reloadMu.Unlock()
+			if err := s.Reload(); err != nil {
+				log.WithError(err).Error("Failed to refresh tenant file secrets")
+			}
+		}
+	}
+}
+
+// Reload rescans the directory and swaps in changed tenants. Unchanged
+// files are not parsed again. It fails only if the directory can't be read.
+func (s *FileTenantStore) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	defer func() { s.refreshRefs = false }()
+
+	files, err := s.tenantFiles()
+	if err != nil {
+		return err
+	}
+
+	current := s.state.Load()
+	next := &fileTenants{
+		byFile: make(map[string]*fileTenant),
+		byID:   make(map[string]*fileTenant),
+		byHost: make(map[string]*fileTenant),
+	}
+	changed := false
+
+	// Unchanged files first, so a changed file can't steal their tenant ID
+	// or hosts
+	var pending []string
+	contents := make(map[string][]byte)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.WithFields(log.Fields{"file": file, "error": err.Error()}).Error("Failed to read tenant file")
+			if previous, ok := current.byFile[file]; ok {
+				next.add(file, previous)
+			}
+			continue
+		}
+		digest := sha256.Sum256(data)
+		previous, loaded := current.byFile[file]
+		refresh := s.refreshRefs && loaded && previous.refs && previous.digest == digest
+		if loaded && previous.digest == digest && !refresh {
+			next.add(file, previous)
+			continue
+		}
+		if rejected, ok := s.rejected[file]; ok && rejected.digest == digest && !refresh {
+			if loaded {
+				next.add(file, previous)
+			}
+			continue
+		}
+		contents[file] = data
+		pending = append(pending, file)
+	}
+
+	for _, file := range pending {
+		tenant, err := loadTenantFile(file, contents[file])
+		conflict := false
+		if err == nil {
+			err = next.conflicts(tenant)
+			conflict = err != nil
+		}
+		if err != nil {
+			log.WithFields(log.Fields{"file": file, "error": err.Error()}).Error("Rejected tenant file")
+			s.rejected[file] = rejectedFile{digest: sha256.Sum256(contents[file]), conflict: conflict}
+			if previous, ok := current.byFile[file]; ok && next.conflicts(previous) == nil {
+				next.add(file, previous)
+			}
+			continue
+		}
+		delete(s.rejected, file)
+		if previous, ok := current.byFile[file]; ok && previous.digest == tenant.digest && previous.secrets == tenant.secrets {
+			// Refreshed, and the secrets haven't changed
+			next.add(file, previous)
+			continue
+		}
+		next.add(file, tenant)
+		changed = true
+		log.WithFields(log.Fields{"file": file, "tenant_id": tenant.config.TenantID}).Info("Tenant file loaded")
+	}
+
+	for file, previous := range current.byFile {
+		if _, ok := next.byFile[file]; !ok {
+			changed = true
+			log.WithFields(log.Fields{"file": file, "tenant_id": previous.config.TenantID}).Info("Tenant file removed")
+		}
+	}
+
+	if changed {
+		s.state.Store(next)
+		for file, rejected := range s.rejected {
+			if rejected.conflict {
+				delete(s.rejected, file)
+			}
+		}
+	}
+	return nil
+}
+
+// tenantFiles lists the YAML files in the directory. Hidden entries (such
+// as the ..data links of Kubernetes ConfigMaps) are skipped.
+func (s *FileTenantStore) tenantFiles() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenant directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if strings.HasPrefix(name, ".") || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		files = append(files, filepath.Join(s.dir, name))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// add indexes a tenant
+func (t *fileTenants) add(file string, tenant *fileTenant) {
+	t.byFile[file] = tenant
+	t.byID[tenant.config.TenantID] = tenant
+	for _, host := range tenant.config.Hosts {
+		t.byHost[host] = tenant
+	}
+}
+
+// conflicts reports a tenant ID or host already taken by another file
+func (t *fileTenants) conflicts(tenant *fileTenant) error {
+	if _, ok := t.byID[tenant.config.TenantID]; ok {
+		return fmt.Errorf("duplicate tenant ID: %s", tenant.config.TenantID)
+	}
+	for _, host := range tenant.config.Hosts {
+		if other, ok := t.byHost[host]; ok {
+			return fmt.Errorf("host %s already belongs to tenant %s", host, other.config.TenantID)
+		}
+	}
+	return nil
+}
+
+// loadTenantFile parses and validates a tenant file
+func loadTenantFile(file string, data []byte) (*fileTenant, error) {
+	var tf TenantFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&tf); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+
+	if tf.TenantID == "" {
+		tf.TenantID = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	tf.setDefaults()
+	refs, secrets, err := tf.resolveSecrets()
+	if err != nil {
+		return nil, err
+	}
+	if err := tf.Validate(); err != nil {
+		return nil, err
+	}
+
+	tenantCfg, approvals, err := buildTenantConfig(tf.TenantID, tf.LRS, tf.Auth, tf.LTI, tf.RateLimits, tf.Quotas)
+	if err != nil {
+		return nil, err
+	}
+	tenantCfg.Status = tf.Status
+	tenantCfg.Hosts, err = normalizeHosts(tf.Hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileTenant{
+		digest:    sha256.Sum256(data),
+		config:    tenantCfg,
+		approvals: approvals,
+		refs:      refs,
+		secrets:   secrets,
+	}, nil
+}
+
+// setDefaults fills unset fields like config.Load does
+func (tf *TenantFile) setDefaults() {
+	if tf.Status == "" {
+		tf.Status = TenantStatusActive
+	}
+	if tf.Auth.JWTTTLSeconds == 0 {
+		tf.Auth.JWTTTLSeconds = 3600
+	}
+	if tf.Auth.PermissionPolicy == "" {
+		tf.Auth.PermissionPolicy = "strict"
+	}
+	if tf.Auth.OAuthTokenTTLSeconds == 0 {
+		tf.Auth.OAuthTokenTTLSeconds = 300
+	}
+}
+
+// resolveSecrets expands environment variable references and resolves
+// secret references in the secret fields. Tenant files are written by
+// operators, so every scheme is allowed. It reports whether any field was a
+// reference, and a digest of the resolved values.
+func (tf *TenantFile) resolveSecrets() (bool, [sha256.Size]byte, error) {
+	fields := map[string]*string{
+		"lrs.password":    &tf.LRS.Password,
+		"auth.jwt_secret": &tf.Auth.JWTSecret,
+	}
+	for i := range tf.Auth.LMSAPIKeys {
+		fields[fmt.Sprintf("auth.lms_api_keys[%d].key", i)] = &tf.Auth.LMSAPIKeys[i].Key
+	}
+	for i := range tf.Auth.OAuthClients {
+		fields[fmt.Sprintf("auth.oauth_clients[%d].client_secret", i)] = &tf.Auth.OAuthClients[i].ClientSecret
+	}
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	refs := false
+	digest := sha256.New()
+	for _, path := range paths {
+		field := fields[path]
+		value := config.ExpandSecretEnv(*field)
+		if config.SecretScheme(value) != "" {
+			refs = true
+		}
+		secret, err := config.ResolveSecret(context.Background(), value)
+		if err != nil {
+			return false, [sha256.Size]byte{}, fmt.Errorf("%s: %w", path, err)
+		}
+		*field = secret
+		fmt.Fprintf(digest, "%s=%q\n", path, secret)
+	}
+	var sum [sha256.Size]byte
+	digest.Sum(sum[:0])
+	return refs, sum, nil
+}
+
+// Validate checks a tenant file
+func (tf *TenantFile) Validate() error {
+	if !tenantIDPattern.MatchString(tf.TenantID) {
+		return fmt.Errorf("invalid tenant_id: %q", tf.TenantID)
+	}
+	if tf.Status != TenantStatusActive && tf.Status != TenantStatusSuspended {
+		return fmt.Errorf("status must be %q or %q", TenantStatusActive, TenantStatusSuspended)
+	}
+
+	hosts := tf.Hosts
+	update := &UpdateTenantRequest{
+		Hosts: &hosts,
+		LRS: &LRSConfigUpdate{
+			Endpoint: &tf.LRS.Endpoint,
+			Username: &tf.LRS.Username,
+			Password: &tf.LRS.Password,
+		},
+		Auth: &AuthConfigUpdate{
+			JWTSecret:            &tf.Auth.JWTSecret,
+			JWTTTLSeconds:        &tf.Auth.JWTTTLSeconds,
+			PermissionPolicy:     &tf.Auth.PermissionPolicy,
+			OAuthTokenTTLSeconds: &tf.Auth.OAuthTokenTTLSeconds,
+		},
+	}
+	if err := update.ValidateComplete(); err != nil {
+		return err
+	}
+
+	if len(tf.Auth.LMSAPIKeys) == 0 && len(tf.Auth.OAuthClients) == 0 {
+		return fmt.Errorf("at least one LMS API key or OAuth client is required")
+	}
+	return nil
+}
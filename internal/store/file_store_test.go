@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileTenantStoreSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(t.TempDir(), "lrs-password")
+	if err := os.WriteFile(secretFile, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	data := `hosts: ["acme.example.com"]
+lrs:
+  endpoint: https://lrs.example.com/xapi/
+  username: acme
+  password: file://` + secretFile + `
+auth:
+  jwt_secret: acme-secret-with-at-least-32-bytes
+  lms_api_keys:
+    - key: literal-$key-with-${dollars}
+`
+	if err := os.WriteFile(filepath.Join(dir, "acme.yaml"), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewFileTenantStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tenant, err := s.GetByID(context.Background(), "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.LRSPassword != "first" {
+		t.Errorf("LRSPassword = %q, want the referenced file's contents", tenant.LRSPassword)
+	}
+	if _, err := tenant.LookupAPIKey("literal-$key-with-${dollars}"); err != nil {
+		t.Errorf("API key containing $ was changed: %v", err)
+	}
+
+	// A refresh with unchanged secrets keeps the loaded tenant
+	refresh := func() {
+		s.reloadMu.Lock()
+		s.refreshRefs = true
+		s.reloadMu.Unlock()
+		if err := s.Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refresh()
+	if again, _ := s.GetByID(context.Background(), "acme"); again != tenant {
+		t.Error("refresh without changes replaced the tenant")
+	}
+
+	// A plain rescan doesn't resolve references again; a refresh does
+	if err := os.WriteFile(secretFile, []byte("second\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if tenant, _ = s.GetByID(context.Background(), "acme"); tenant.LRSPassword != "first" {
+		t.Errorf("rescan resolved the reference again: %q", tenant.LRSPassword)
+	}
+	refresh()
+	if tenant, _ = s.GetByID(context.Background(), "acme"); tenant.LRSPassword != "second" {
+		t.Errorf("LRSPassword after refresh = %q, want second", tenant.LRSPassword)
+	}
+
+	// A failing reference keeps the previous value, and later refreshes retry
+	os.Remove(secretFile)
+	refresh()
+	if tenant, _ = s.GetByID(context.Background(), "acme"); tenant.LRSPassword != "second" {
+		t.Errorf("LRSPassword after a failed refresh = %q, want second", tenant.LRSPassword)
+	}
+	if err := os.WriteFile(secretFile, []byte("third\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	refresh()
+	if tenant, _ = s.GetByID(context.Background(), "acme"); tenant.LRSPassword != "third" {
+		t.Errorf("LRSPassword after recovery = %q, want third", tenant.LRSPassword)
+	}
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// wildcardPrefix marks a host pattern matching every subdomain of the rest
+const wildcardPrefix = "*."
+
+// NormalizeHost puts a Host header or host mapping in canonical form:
+// lowercase ASCII (IDNA), no trailing dot and no default port. Other ports
+// are kept. A leading "*." wildcard label is preserved.
+func NormalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", fmt.Errorf("empty host")
+	}
+
+	name, port := host, ""
+	if strings.HasPrefix(host, "[") || strings.Count(host, ":") == 1 {
+		h, p, err := net.SplitHostPort(host)
+		if err != nil {
+			// A bracketed IPv6 literal without a port
+			if !strings.HasPrefix(host, "[") || !strings.HasSuffix(host, "]") {
+				return "", fmt.Errorf("invalid host %q: %v", host, err)
+			}
+			h = host[1 : len(host)-1]
+		}
+		name, port = h, p
+	}
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n <= 0 || n > 65535 {
+			return "", fmt.Errorf("invalid port in host %q", host)
+		}
+		if n == 80 || n == 443 {
+			port = ""
+		}
+	}
+
+	if ip := net.ParseIP(name); ip != nil {
+		name = ip.String()
+		if strings.Contains(name, ":") {
+			name = "[" + name + "]"
+		}
+	} else {
+		wildcard := strings.HasPrefix(name, wildcardPrefix)
+		name = strings.TrimSuffix(strings.TrimPrefix(name, wildcardPrefix), ".")
+		ascii, err := idna.Lookup.ToASCII(name)
+		if err != nil || ascii == "" {
+			return "", fmt.Errorf("invalid host %q", host)
+		}
+		name = ascii
+		if wildcard {
+			name = wildcardPrefix + name
+		}
+	}
+
+	if port != "" {
+		return name + ":" + port, nil
+	}
+	return name, nil
+}
+
+// normalizeHostPattern normalizes a host mapping. A wildcard
+// "*.acme.example.com" matches any name ending in ".acme.example.com"; it
+// needs at least two labels after the "*" and cannot carry a port.
+func normalizeHostPattern(pattern string) (string, error) {
+	host, err := NormalizeHost(pattern)
+	if err != nil {
+		return "", err
+	}
+	rest := strings.TrimPrefix(host, wildcardPrefix)
+	if strings.Contains(rest, "*") {
+		return "", fmt.Errorf("invalid host %q: \"*\" is only allowed as the whole first label", pattern)
+	}
+	if rest != host && (strings.Contains(rest, ":") || strings.Count(rest, ".") < 1) {
+		return "", fmt.Errorf("invalid host %q: wildcards need a domain of two or more labels and no port", pattern)
+	}
+	return host, nil
+}
+
+// normalizeHosts normalizes a tenant's host mappings, rejecting duplicates
+func normalizeHosts(hosts []string) ([]string, error) {
+	normalized := make([]string, 0, len(hosts))
+	seen := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		n, err := normalizeHostPattern(host)
+		if err != nil {
+			return nil, err
+		}
+		if seen[n] {
+			return nil, fmt.Errorf("duplicate host: %s", n)
+		}
+		seen[n] = true
+		normalized = append(normalized, n)
+	}
+	return normalized, nil
+}
+
+// hostCandidates returns the host mappings that could match a normalized
+// request host, most specific first: the host with its port, the bare host,
+// then wildcards from the longest suffix to the shortest. The first mapping
+// that exists wins, so "*.eu.acme.example.com" takes precedence over
+// "*.acme.example.com", and an exact mapping over both.
+func hostCandidates(host string) []string {
+	var candidates []string
+	if i := strings.LastIndex(host, ":"); i > strings.LastIndex(host, "]") {
+		candidates = append(candidates, host)
+		host = host[:i]
+	}
+	candidates = append(candidates, host)
+	if strings.HasPrefix(host, "[") || net.ParseIP(host) != nil {
+		return candidates
+	}
+
+	// Wildcards match one or more labels, but never a bare top-level domain
+	labels := strings.Split(host, ".")
+	for i := 1; i < len(labels)-1; i++ {
+		candidates = append(candidates, wildcardPrefix+strings.Join(labels[i:], "."))
+	}
+	return candidates
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		want    string
+		wantErr bool
+	}{
+		{host: "example.com", want: "example.com"},
+		{host: "Tenant.Example.COM", want: "tenant.example.com"},
+		{host: "tenant.example.com.", want: "tenant.example.com"},
+		{host: "tenant.example.com:443", want: "tenant.example.com"},
+		{host: "tenant.example.com:80", want: "tenant.example.com"},
+		{host: "Tenant.Example.com.:443", want: "tenant.example.com"},
+		{host: "tenant.example.com:8443", want: "tenant.example.com:8443"},
+		{host: "*.Acme.Example.com", want: "*.acme.example.com"},
+		{host: "bücher.example.com", want: "xn--bcher-kva.example.com"},
+		{host: "BÜCHER.example.com:443", want: "xn--bcher-kva.example.com"},
+		{host: "127.0.0.1:80", want: "127.0.0.1"},
+		{host: "127.0.0.1:8080", want: "127.0.0.1:8080"},
+		{host: "[::1]", want: "[::1]"},
+		{host: "[::1]:443", want: "[::1]"},
+		{host: "[0:0::1]:8443", want: "[::1]:8443"},
+		{host: "::1", want: "[::1]"},
+		{host: "", wantErr: true},
+		{host: "example.com:0", wantErr: true},
+		{host: "example.com:65536", wantErr: true},
+		{host: "example.com:https", wantErr: true},
+		{host: "[::1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeHost(tt.host)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NormalizeHost(%q) = %q, want error", tt.host, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeHost(%q) = %q, %v; want %q", tt.host, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeHostPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		wantErr bool
+	}{
+		{pattern: "*.acme.example.com", want: "*.acme.example.com"},
+		{pattern: "*.example.com", want: "*.example.com"},
+		{pattern: "*.ACME.example.com.", want: "*.acme.example.com"},
+		{pattern: "*.com", wantErr: true},
+		{pattern: "*.acme.example.com:8443", wantErr: true},
+		{pattern: "shop.*.example.com", wantErr: true},
+		{pattern: "*shop.example.com", wantErr: true},
+		{pattern: "*.*.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeHostPattern(tt.pattern)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("normalizeHostPattern(%q) = %q, want error", tt.pattern, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeHostPattern(%q) = %q, %v; want %q", tt.pattern, got, err, tt.want)
+		}
+	}
+}
+
+func TestNormalizeHostsRejectsDuplicates(t *testing.T) {
+	for _, hosts := range [][]string{
+		{"acme.example.com", "ACME.example.com"},
+		{"acme.example.com", "acme.example.com:443"},
+		{"acme.example.com.", "acme.example.com:80"},
+		{"*.acme.example.com", "*.Acme.Example.Com"},
+	} {
+		if _, err := normalizeHosts(hosts); err == nil || !strings.Contains(err.Error(), "duplicate host") {
+			t.Errorf("normalizeHosts(%q) error = %v, want duplicate host", hosts, err)
+		}
+	}
+
+	got, err := normalizeHosts([]string{"acme.example.com", "acme.example.com:8443", "*.acme.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"acme.example.com", "acme.example.com:8443", "*.acme.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeHosts = %q, want %q", got, want)
+	}
+}
+
+func TestHostCandidates(t *testing.T) {
+	tests := []struct {
+		host string
+		want []string
+	}{
+		{"localhost", []string{"localhost"}},
+		{"example.com", []string{"example.com"}},
+		{"acme.example.com", []string{"acme.example.com", "*.example.com"}},
+		{"shop.eu.acme.example.com", []string{
+			"shop.eu.acme.example.com",
+			"*.eu.acme.example.com",
+			"*.acme.example.com",
+			"*.example.com",
+		}},
+		{"shop.acme.example.com:8443", []string{
+			"shop.acme.example.com:8443",
+			"shop.acme.example.com",
+			"*.acme.example.com",
+			"*.example.com",
+		}},
+		{"127.0.0.1", []string{"127.0.0.1"}},
+		{"127.0.0.1:8080", []string{"127.0.0.1:8080", "127.0.0.1"}},
+		{"[::1]", []string{"[::1]"}},
+		{"[::1]:8443", []string{"[::1]:8443", "[::1]"}},
+	}
+	for _, tt := range tests {
+		if got := hostCandidates(tt.host); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("hostCandidates(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+// writeTenantFile writes a minimal valid tenant file mapping hosts
+func writeTenantFile(t *testing.T, dir, tenantID string, hosts ...string) {
+	t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "tenant_id: %s\nhosts:\n", tenantID)
+	for _, host := range hosts {
+		fmt.Fprintf(&b, "  - %q\n", host)
+	}
+	fmt.Fprintf(&b, `lrs:
+  endpoint: https://lrs.example.com/xapi/
+  username: %[1]s
+  password: %[1]s-password
+auth:
+  jwt_secret: %[1]s-secret-with-at-least-32-bytes
+  lms_api_keys:
+    - key: %[1]s-api-key
+`, tenantID)
+	if err := os.WriteFile(filepath.Join(dir, tenantID+".yaml"), []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetByHostPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeTenantFile(t, dir, "shop", "Shop.Acme.Example.com")
+	writeTenantFile(t, dir, "shop-tls", "shop.acme.example.com:8443")
+	writeTenantFile(t, dir, "acme", "*.acme.example.com")
+	writeTenantFile(t, dir, "acme-eu", "*.eu.acme.example.com")
+	writeTenantFile(t, dir, "catchall", "*.example.com")
+
+	s, err := NewFileTenantStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		host string
+		want string // Tenant ID; empty for no tenant
+	}{
+		// An exact mapping wins over every wildcard, in any spelling
+		{"shop.acme.example.com", "shop"},
+		{"SHOP.acme.example.com.", "shop"},
+		{"shop.acme.example.com:443", "shop"},
+		{"shop.acme.example.com:80", "shop"},
+		// A mapping with a port wins over the bare host on that port only
+		{"shop.acme.example.com:8443", "shop-tls"},
+		{"shop.acme.example.com:9000", "shop"},
+		// The longest wildcard wins
+		{"www.acme.example.com", "acme"},
+		{"a.b.acme.example.com", "acme"},
+		{"x.eu.acme.example.com", "acme-eu"},
+		{"X.EU.Acme.Example.com:443", "acme-eu"},
+		// A wildcard matches subdomains, not the domain itself
+		{"eu.acme.example.com", "acme"},
+		{"acme.example.com", "catchall"},
+		{"other.example.com", "catchall"},
+		{"example.com", ""},
+		{"example.org", ""},
+	}
+	for _, tt := range tests {
+		tenant, err := s.GetByHost(context.Background(), tt.host)
+		var got string
+		if err == nil {
+			got = tenant.TenantID
+		}
+		if got != tt.want {
+			t.Errorf("GetByHost(%q) = %q (err %v), want %q", tt.host, got, err, tt.want)
+		}
+	}
+}
+
+func TestFileTenantStoreRejectsAmbiguousHosts(t *testing.T) {
+	dir := t.TempDir()
+	writeTenantFile(t, dir, "a-first", "acme.example.com", "*.acme.example.com")
+	// Same mappings in another spelling: the later file is rejected
+	writeTenantFile(t, dir, "b-second", "ACME.example.com:443")
+	writeTenantFile(t, dir, "c-third", "*.Acme.Example.com.")
+
+	s, err := NewFileTenantStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, host := range []string{"acme.example.com", "www.acme.example.com"} {
+		tenant, err := s.GetByHost(context.Background(), host)
+		if err != nil || tenant.TenantID != "a-first" {
+			t.Errorf("GetByHost(%q) = %v, %v; want a-first", host, tenant, err)
+		}
+	}
+	for _, id := range []string{"b-second", "c-third"} {
+		if _, err := s.GetByID(context.Background(), id); err == nil {
+			t.Errorf("tenant %s with a conflicting host was loaded", id)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/jwks"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+)
+
+// LTIPlatform is an LTI 1.3 platform (LMS) registered with this tool
+type LTIPlatform struct {
+	Issuer             string
+	ClientID           string
+	DeploymentIDs      map[string]bool // Empty accepts any deployment
+	AuthLoginURL       string          // Platform OIDC authorization endpoint
+	Keys               *jwks.KeySet
+	ContentURLPrefixes []string // Allowed content launch URLs
+	Permissions        models.Permissions
+}
+
+// NewLTIPlatform validates a platform registration and loads its JWKS file
+func NewLTIPlatform(issuer, clientID string, deploymentIDs []string, authLoginURL, jwksFile string, contentURLPrefixes []string, permissions models.Permissions) (*LTIPlatform, error) {
+	if issuer == "" || clientID == "" {
+		return nil, fmt.Errorf("LTI platform issuer and client_id are required")
+	}
+	if u, err := url.Parse(authLoginURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("LTI platform %s: invalid auth_login_url", issuer)
+	}
+	if len(contentURLPrefixes) == 0 {
+		return nil, fmt.Errorf("LTI platform %s: at least one content URL prefix is required", issuer)
+	}
+
+	if permissions.Write == "" {
+		permissions.Write = "actor-activity-registration-scoped"
+	}
+	if permissions.Read == "" {
+		permissions.Read = "actor-activity-registration-scoped"
+	}
+	if err := models.ValidatePermission(permissions.Write); err != nil {
+		return nil, fmt.Errorf("LTI platform %s: %w", issuer, err)
+	}
+	if err := models.ValidatePermission(permissions.Read); err != nil {
+		return nil, fmt.Errorf("LTI platform %s: %w", issuer, err)
+	}
+
+	keys, err := jwks.LoadFile(jwksFile)
+	if err != nil {
+		return nil, fmt.Errorf("LTI platform %s: %w", issuer, err)
+	}
+
+	deployments := make(map[string]bool, len(deploymentIDs))
+	for _, id := range deploymentIDs {
+		deployments[id] = true
+	}
+
+	return &LTIPlatform{
+		Issuer:             issuer,
+		ClientID:           clientID,
+		DeploymentIDs:      deployments,
+		AuthLoginURL:       authLoginURL,
+		Keys:               keys,
+		ContentURLPrefixes: contentURLPrefixes,
+		Permissions:        permissions,
+	}, nil
+}
@@ -0,0 +1,383 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// migrationFiles holds the versioned schema, one directory per dialect.
+// Files are named NNNN_description.up.sql and NNNN_description.down.sql.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaOutdated is returned when the database schema is older than the
+// binary expects
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Migrator applies and rolls back the embedded schema migrations
+type Migrator struct {
+	db         *sqlDB
+	migrations []Migration
+}
+
+// OpenMigrator connects to the database named by connStr, which takes the
+// same forms as for NewDatabaseTenantStore
+func OpenMigrator(connStr string) (*Migrator, error) {
+	db, err := openDatabase(connStr)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Close closes the database connection
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// loadMigrations reads the embedded migrations of a dialect in version order
+func loadMigrations(d dialect) ([]Migration, error) {
+	dir := "migrations/postgres"
+	if d == dialectSQLite {
+		dir = "migrations/sqlite"
+	}
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, desc, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %s", name)
+		}
+		body, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: desc}
+			byVersion[version] = mig
+		} else if mig.Name != desc {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, mig.Name, desc)
+		}
+		if direction == "up" {
+			mig.up = string(body)
+		} else {
+			mig.down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// LatestVersion returns the schema version this binary expects
+func (m *Migrator) LatestVersion() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// ensureTable creates the schema_migrations table. A database set up by
+// hand from schema.sql before migrations existed is recorded as being at
+// version 1, the original schema.sql; migration 2 tolerates the changes
+// later revisions of that file already made.
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	exists, err := m.tableExists(ctx, "schema_migrations")
+	if err != nil || exists {
+		return err
+	}
+	baseline, err := m.tableExists(ctx, "tenants")
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	if baseline {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO schema_migrations (version, name) VALUES (1, $1)
+			ON CONFLICT (version) DO NOTHING
+		`, m.migrations[0].Name); err != nil {
+			return fmt.Errorf("failed to record baseline schema: %w", err)
+		}
+		log.Info("Existing schema recorded as migration 1")
+	}
+	return tx.Commit()
+}
+
+// tableExists reports whether a table exists
+func (m *Migrator) tableExists(ctx context.Context, table string) (bool, error) {
+	query := `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1`
+	if m.db.dialect == dialectSQLite {
+		query = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = $1`
+	}
+	var n int
+	if err := m.db.QueryRowContext(ctx, query, table).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// rowsQueryer is a *sqlDB or *sqlTx
+type rowsQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// applied returns the applied migrations by version
+func (m *Migrator) applied(ctx context.Context, q rowsQueryer) (map[int]time.Time, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// CurrentVersion returns the highest applied migration, 0 for an empty
+// database
+func (m *Migrator) CurrentVersion(ctx context.Context) (int, error) {
+	exists, err := m.tableExists(ctx, "schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		// A schema.sql database counts as version 1 until migrate records it
+		baseline, err := m.tableExists(ctx, "tenants")
+		if err != nil || !baseline {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	var version sql.NullInt64
+	if err := m.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// Status lists every known migration and when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if at, ok := applied[mig.Version]; ok {
+			s.AppliedAt = &at
+		}
+		status = append(status, s)
+	}
+	return status, nil
+}
+
+// Up applies every pending migration in order and returns those applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range m.migrations {
+		ran, err := m.run(ctx, mig, true)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, mig)
+		}
+	}
+	return done, nil
+}
+
+// Down rolls back the latest steps applied migrations and returns those
+// rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		ran, err := m.run(ctx, m.migrations[i], false)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, m.migrations[i])
+		}
+	}
+	return done, nil
+}
+
+// run applies (up) or rolls back one migration in a transaction, unless
+// another process already did. Postgres DDL is transactional, so a failed
+// migration leaves no trace.
+func (m *Migrator) run(ctx context.Context, mig Migration, up bool) (bool, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Serializes concurrent migrators; SQLite transactions already hold the
+	// database write lock
+	if tx.dialect == dialectPostgres {
+		if _, err := tx.ExecContext(ctx, `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`); err != nil {
+			return false, err
+		}
+	}
+	applied, err := m.applied(ctx, tx)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := applied[mig.Version]; ok == up {
+		return false, nil
+	}
+	if !up && mig.down == "" {
+		return false, fmt.Errorf("migration %d (%s) cannot be rolled back", mig.Version, mig.Name)
+	}
+
+	body, record := mig.up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	recordArgs := []interface{}{mig.Version, mig.Name}
+	if !up {
+		body, record = mig.down, `DELETE FROM schema_migrations WHERE version = $1`
+		recordArgs = recordArgs[:1]
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return false, fmt.Errorf("migration %d (%s) failed: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, recordArgs...); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	msg := "Migration applied"
+	if !up {
+		msg = "Migration rolled back"
+	}
+	log.WithFields(log.Fields{
+		"version": mig.Version,
+		"name":    mig.Name,
+	}).Info(msg)
+	return true, nil
+}
+
+// checkSchema fails unless the database has every migration this binary
+// knows about. A newer schema is accepted so that replicas of the previous
+// release keep running during a rolling upgrade.
+func checkSchema(ctx context.Context, db *sqlDB) error {
+	migrations, err := loadMigrations(db.dialect)
+	if err != nil {
+		return err
+	}
+	m := &Migrator{db: db, migrations: migrations}
+
+	current, err := m.CurrentVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if latest := m.LatestVersion(); current < latest {
+		return fmt.Errorf("%w: database is at version %d, this binary requires %d; run \"xapi-proxy migrate -db ... up\"",
+			ErrSchemaOutdated, current, latest)
+	} else if current > latest {
+		log.WithFields(log.Fields{
+			"schema_version":   current,
+			"expected_version": latest,
+		}).Warn("Database schema is newer than this binary")
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+-- Drops the whole schema, including all tenant data.
+DROP TABLE IF EXISTS permission_approvals;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS tenant_lms_api_keys;
+DROP TABLE IF EXISTS tenant_auth_config;
+DROP TABLE IF EXISTS tenant_lrs_config;
+DROP TABLE IF EXISTS tenant_hosts;
+DROP TABLE IF EXISTS tenants;
+DROP FUNCTION IF EXISTS update_updated_at_column();
@@ -1,4 +1,7 @@
--- PostgreSQL schema for xAPI LRS Auth Proxy multi-tenant mode
+-- Initial PostgreSQL schema for xAPI LRS Auth Proxy multi-tenant mode: the
+-- hand-run schema.sql that predates migrations, unchanged. Databases created
+-- from it are recorded as this version. Every migration has a SQLite twin in
+-- ../sqlite with the same version.
 
 -- Tenants table
 CREATE TABLE tenants (
@@ -116,13 +119,3 @@ CREATE TRIGGER update_tenant_lrs_config_updated_at BEFORE UPDATE ON tenant_lrs_c
 
 CREATE TRIGGER update_tenant_auth_config_updated_at BEFORE UPDATE ON tenant_auth_config
     FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
-
--- Sample data for testing (remove in production)
--- INSERT INTO tenants (tenant_id, status) VALUES ('demo-tenant', 'active');
--- INSERT INTO tenant_hosts (tenant_id, host) VALUES ('demo-tenant', 'demo.proxy.example.com');
--- INSERT INTO tenant_lrs_config (tenant_id, endpoint, username, password) 
---   VALUES ('demo-tenant', 'https://lrs.demo.com/xapi/', 'admin', 'change-me');
--- INSERT INTO tenant_auth_config (tenant_id, jwt_secret, jwt_ttl_seconds, permission_policy)
---   VALUES ('demo-tenant', 'change-this-to-a-secure-random-secret', 3600, 'strict');
--- INSERT INTO tenant_lms_api_keys (tenant_id, api_key_hash, description)
---   VALUES ('demo-tenant', 'demo-lms-api-key', 'Demo LMS API key');
@@ -0,0 +1,34 @@
+-- Returns to the original schema.sql, dropping OAuth clients, token exchange
+-- issuers, LTI platforms and tenant data keys. Secrets encrypted with a data
+-- key become unreadable.
+DROP TRIGGER IF EXISTS notify_tenants_changed ON tenants;
+DROP TRIGGER IF EXISTS notify_tenant_hosts_changed ON tenant_hosts;
+DROP TRIGGER IF EXISTS notify_tenant_lrs_config_changed ON tenant_lrs_config;
+DROP TRIGGER IF EXISTS notify_tenant_auth_config_changed ON tenant_auth_config;
+DROP TRIGGER IF EXISTS notify_tenant_lms_api_keys_changed ON tenant_lms_api_keys;
+DROP FUNCTION IF EXISTS notify_tenant_changed();
+
+DROP TABLE IF EXISTS tenant_data_keys;
+DROP TABLE IF EXISTS tenant_lti_platforms;
+DROP TABLE IF EXISTS tenant_token_exchange_issuers;
+DROP TABLE IF EXISTS tenant_oauth_clients;
+
+DROP INDEX IF EXISTS idx_audit_log_admin;
+ALTER TABLE audit_log
+    DROP COLUMN IF EXISTS admin_principal,
+    DROP COLUMN IF EXISTS admin_role,
+    DROP COLUMN IF EXISTS request_method,
+    DROP COLUMN IF EXISTS request_path;
+
+DROP INDEX IF EXISTS idx_tenant_lms_api_keys_prefix;
+ALTER TABLE tenant_lms_api_keys
+    DROP COLUMN IF EXISTS key_prefix,
+    DROP COLUMN IF EXISTS salt,
+    DROP COLUMN IF EXISTS max_read_permission,
+    DROP COLUMN IF EXISTS max_write_permission,
+    DROP COLUMN IF EXISTS allowed_course_ids,
+    DROP COLUMN IF EXISTS allowed_activity_prefixes,
+    DROP COLUMN IF EXISTS last_used_at;
+CREATE INDEX IF NOT EXISTS idx_tenant_lms_api_keys_hash ON tenant_lms_api_keys(api_key_hash) WHERE revoked = FALSE;
+
+ALTER TABLE tenant_auth_config DROP COLUMN IF EXISTS oauth_token_ttl_seconds;
@@ -0,0 +1,156 @@
+-- Schema changes made to schema.sql before migrations existed: OAuth
+-- clients, token exchange issuers, LTI platforms, API key limits and hashing,
+-- admin audit columns, change notifications and tenant data keys. Databases
+-- created from any revision of schema.sql are recorded as version 1, so
+-- every statement here tolerates the change being there already.
+
+-- OAuth 2.0 client credentials grant
+ALTER TABLE tenant_auth_config ADD COLUMN IF NOT EXISTS oauth_token_ttl_seconds INT DEFAULT 300;
+
+CREATE TABLE IF NOT EXISTS tenant_oauth_clients (
+    id SERIAL PRIMARY KEY,
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    client_id VARCHAR(255) NOT NULL,
+    client_secret_hash VARCHAR(255),  -- SHA-256 hex, for client_secret_basic/post
+    public_key_pem TEXT,  -- For private_key_jwt
+    scopes TEXT NOT NULL DEFAULT '',  -- Space-delimited, e.g. 'write:actor-activity-registration-scoped'
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked BOOLEAN DEFAULT FALSE,
+    revoked_at TIMESTAMP,
+    UNIQUE(tenant_id, client_id),
+    CHECK (client_secret_hash IS NOT NULL OR public_key_pem IS NOT NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_oauth_clients_tenant ON tenant_oauth_clients(tenant_id);
+
+-- Trusted identity providers for RFC 8693 token exchange
+CREATE TABLE IF NOT EXISTS tenant_token_exchange_issuers (
+    id SERIAL PRIMARY KEY,
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    issuer VARCHAR(512) NOT NULL,
+    audience VARCHAR(512),  -- Required aud of subject tokens; issuers without one are skipped
+    jwks_file VARCHAR(1024) NOT NULL,  -- Path to the issuer's JWKS on the proxy host
+    claim_mappings TEXT,  -- JSON object: actor field -> claim name
+    account_home_page VARCHAR(512),  -- Defaults to the issuer
+    max_read_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    max_write_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant_id, issuer)
+);
+
+-- LTI 1.3 platform registrations
+CREATE TABLE IF NOT EXISTS tenant_lti_platforms (
+    id SERIAL PRIMARY KEY,
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    issuer VARCHAR(512) NOT NULL,
+    client_id VARCHAR(255) NOT NULL,
+    deployment_ids TEXT,  -- Space-delimited; empty accepts any deployment
+    auth_login_url VARCHAR(1024) NOT NULL,  -- Platform OIDC authorization endpoint
+    jwks_file VARCHAR(1024) NOT NULL,  -- Path to the platform's JWKS on the proxy host
+    content_url_prefixes TEXT NOT NULL,  -- Space-delimited allowed content URL prefixes
+    write_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    read_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant_id, issuer)
+);
+
+-- LMS API key limits, public prefixes and salted hashes
+ALTER TABLE tenant_lms_api_keys
+    ADD COLUMN IF NOT EXISTS key_prefix VARCHAR(20),  -- Public identifier, e.g. 'xlp_1a2b3c4d'; NULL for legacy keys
+    ADD COLUMN IF NOT EXISTS salt VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS max_read_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    ADD COLUMN IF NOT EXISTS max_write_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    ADD COLUMN IF NOT EXISTS allowed_course_ids TEXT,  -- Space-delimited; empty allows any course
+    ADD COLUMN IF NOT EXISTS allowed_activity_prefixes TEXT,  -- Space-delimited; empty allows any activity
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP;
+
+-- Keys are looked up by prefix, not by hash
+DROP INDEX IF EXISTS idx_tenant_lms_api_keys_hash;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tenant_lms_api_keys_prefix ON tenant_lms_api_keys(key_prefix);
+
+-- Keys created before hashing stored the plaintext key in api_key_hash.
+-- Salt and hash them in place, as store.HashAPIKey does, so they keep
+-- working (without a prefix) until rotated. Hashed keys have a salt, so this
+-- never hashes a key twice.
+WITH legacy AS (
+    SELECT id, md5(random()::text || clock_timestamp()::text || id::text) AS salt
+    FROM tenant_lms_api_keys
+    WHERE key_prefix IS NULL AND salt = ''
+)
+UPDATE tenant_lms_api_keys k
+SET salt = legacy.salt,
+    api_key_hash = encode(sha256(convert_to(legacy.salt || k.api_key_hash, 'UTF8')), 'hex')
+FROM legacy
+WHERE k.id = legacy.id;
+
+-- Admin API requests in the audit log ('admin_action')
+ALTER TABLE audit_log
+    ADD COLUMN IF NOT EXISTS admin_principal VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS admin_role VARCHAR(50),
+    ADD COLUMN IF NOT EXISTS request_method VARCHAR(10),
+    ADD COLUMN IF NOT EXISTS request_path TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_admin ON audit_log(admin_principal, timestamp DESC) WHERE admin_principal IS NOT NULL;
+
+-- Tenant data keys: AES-256 keys that encrypt the tenant's secret columns,
+-- wrapped (encrypted) by a master key that is never stored in the database
+CREATE TABLE IF NOT EXISTS tenant_data_keys (
+    tenant_id VARCHAR(100) PRIMARY KEY REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    master_key_id VARCHAR(100) NOT NULL,
+    wrapped_key TEXT NOT NULL,  -- Base64
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Tenant change notifications: every proxy replica LISTENs on
+-- 'tenant_changed' and evicts the tenant ID in the payload from its cache
+CREATE OR REPLACE FUNCTION notify_tenant_changed()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('tenant_changed', OLD.tenant_id);
+    ELSE
+        PERFORM pg_notify('tenant_changed', NEW.tenant_id);
+        IF TG_OP = 'UPDATE' AND OLD.tenant_id IS DISTINCT FROM NEW.tenant_id THEN
+            PERFORM pg_notify('tenant_changed', OLD.tenant_id);
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS notify_tenants_changed ON tenants;
+CREATE TRIGGER notify_tenants_changed AFTER INSERT OR UPDATE OR DELETE ON tenants
+    FOR EACH ROW EXECUTE FUNCTION notify_tenant_changed();
+
+DROP TRIGGER IF EXISTS notify_tenant_hosts_changed ON tenant_hosts;
+CREATE TRIGGER notify_tenant_hosts_changed AFTER INSERT OR UPDATE OR DELETE ON tenant_hosts
+    FOR EACH ROW EXECUTE FUNCTION notify_tenant_changed();
+
+DROP TRIGGER IF EXISTS notify_tenant_lrs_config_changed ON tenant_lrs_config;
+CREATE TRIGGER notify_tenant_lrs_config_changed AFTER INSERT OR UPDATE OR DELETE ON tenant_lrs_config
+    FOR EACH ROW EXECUTE FUNCTION notify_tenant_changed();
+
+DROP TRIGGER IF EXISTS notify_tenant_auth_config_changed ON tenant_auth_config;
+CREATE TRIGGER notify_tenant_auth_config_changed AFTER INSERT OR UPDATE OR DELETE ON tenant_auth_config
+    FOR EACH ROW EXECUTE FUNCTION notify_tenant_changed();
+
+-- last_used_at updates don't change what is cached
+DROP TRIGGER IF EXISTS notify_tenant_lms_api_keys_changed ON tenant_lms_api_keys;
+CREATE TRIGGER notify_tenant_lms_api_keys_changed
+    AFTER INSERT OR DELETE OR UPDATE OF key_prefix, salt, api_key_hash, expires_at, revoked,
+        max_read_permission, max_write_permission, allowed_course_ids, allowed_activity_prefixes
+    ON tenant_lms_api_keys
+    FOR EACH ROW EXECUTE FUNCTION notify_tenant_changed();
+
+DROP TRIGGER IF EXISTS notify_tenant_oauth_clients_changed ON tenant_oauth_clients;
+CREATE TRIGGER notify_tenant_oauth_clients_changed AFTER INSERT OR UPDATE OR DELETE ON tenant_oauth_clients
+    FOR EACH ROW EXECUTE FUNCTION notify_tenant_changed();
+
+DROP TRIGGER IF EXISTS notify_tenant_token_exchange_issuers_changed ON tenant_token_exchange_issuers;
+CREATE TRIGGER notify_tenant_token_exchange_issuers_changed AFTER INSERT OR UPDATE OR DELETE ON tenant_token_exchange_issuers
+    FOR EACH ROW EXECUTE FUNCTION notify_tenant_changed();
+
+DROP TRIGGER IF EXISTS notify_tenant_lti_platforms_changed ON tenant_lti_platforms;
+CREATE TRIGGER notify_tenant_lti_platforms_changed AFTER INSERT OR UPDATE OR DELETE ON tenant_lti_platforms
+    FOR EACH ROW EXECUTE FUNCTION notify_tenant_changed();
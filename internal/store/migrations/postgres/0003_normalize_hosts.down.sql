@@ -0,0 +1,7 @@
+-- Host normalization is not reversed.
+DROP TRIGGER notify_tenant_hosts_changed ON tenant_hosts;
+
+DROP FUNCTION notify_tenant_hosts_changed();
+
+CREATE TRIGGER notify_tenant_hosts_changed AFTER INSERT OR UPDATE OR DELETE ON tenant_hosts
+    FOR EACH ROW EXECUTE FUNCTION notify_tenant_changed();
@@ -0,0 +1,38 @@
+-- Host mappings are matched in normalized form (see store.NormalizeHost):
+-- lowercase, without a trailing dot or a default port. Unicode host names
+-- are not converted here; re-save those tenants through the admin API.
+--
+-- Mappings that normalize to the same host would violate the unique host
+-- constraint. Of each such group, the mapping already in normalized form is
+-- kept, else the oldest; the others are deleted.
+WITH normalized AS (
+    SELECT tenant_id, host, created_at,
+           regexp_replace(regexp_replace(LOWER(host), ':(80|443)$', ''), '\.$', '') AS normalized
+    FROM tenant_hosts
+), ranked AS (
+    SELECT tenant_id, host,
+           ROW_NUMBER() OVER (PARTITION BY normalized
+                              ORDER BY host = normalized DESC, created_at, tenant_id, host) AS n
+    FROM normalized
+)
+DELETE FROM tenant_hosts
+WHERE (tenant_id, host) IN (SELECT tenant_id, host FROM ranked WHERE n > 1);
+
+UPDATE tenant_hosts
+SET host = regexp_replace(regexp_replace(LOWER(host), ':(80|443)$', ''), '\.$', '');
+
+-- Adding or moving a host mapping, wildcards in particular, can change which
+-- tenant other hosts resolve to, so host changes notify with an empty
+-- payload and every replica flushes its whole tenant cache.
+CREATE OR REPLACE FUNCTION notify_tenant_hosts_changed()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('tenant_changed', '');
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER notify_tenant_hosts_changed ON tenant_hosts;
+
+CREATE TRIGGER notify_tenant_hosts_changed AFTER INSERT OR UPDATE OR DELETE ON tenant_hosts
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_tenant_hosts_changed();
@@ -0,0 +1,5 @@
+DROP TABLE audit_checkpoints;
+DROP INDEX idx_audit_log_chain;
+ALTER TABLE audit_log DROP COLUMN hash;
+ALTER TABLE audit_log DROP COLUMN prev_hash;
+ALTER TABLE audit_log DROP COLUMN chain_id;
@@ -0,0 +1,23 @@
+-- Audit records are hash-chained per tenant: hash covers the record and the
+-- previous record's hash in the same chain. chain_id is the tenant at write
+-- time and, unlike tenant_id, is kept if the tenant is deleted. Records
+-- written before this migration have no hash.
+ALTER TABLE audit_log ADD COLUMN chain_id VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE audit_log ADD COLUMN prev_hash VARCHAR(64);
+ALTER TABLE audit_log ADD COLUMN hash VARCHAR(64);
+UPDATE audit_log SET chain_id = tenant_id WHERE tenant_id IS NOT NULL;
+
+CREATE INDEX idx_audit_log_chain ON audit_log(chain_id, id);
+
+-- Signed checkpoints of each chain's head, so that rewriting or truncating a
+-- chain is detectable without trusting the database
+CREATE TABLE audit_checkpoints (
+    id BIGSERIAL PRIMARY KEY,
+    chain_id VARCHAR(100) NOT NULL,
+    audit_id BIGINT NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_audit_checkpoints_chain ON audit_checkpoints(chain_id, audit_id);
@@ -0,0 +1,2 @@
+DROP TABLE tenant_usage;
+DROP TABLE tenant_quotas;
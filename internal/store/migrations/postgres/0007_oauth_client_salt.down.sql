@@ -0,0 +1,2 @@
+-- Secrets hashed with a salt no longer verify: register those clients again
+ALTER TABLE tenant_oauth_clients DROP COLUMN client_secret_salt;
@@ -0,0 +1,181 @@
+-- Initial SQLite schema for xAPI LRS Auth Proxy multi-tenant mode
+-- (-db sqlite:///path). The SQLite store was added after the changes in
+-- ../postgres/0002_baseline_upgrade.up.sql, so this is the Postgres schema
+-- as of that version.
+
+CREATE TABLE tenants (
+    tenant_id VARCHAR(100) PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    status VARCHAR(20) DEFAULT 'active' CHECK (status IN ('active', 'suspended', 'deleted'))
+);
+
+CREATE TABLE tenant_hosts (
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    host VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, host)
+);
+
+CREATE INDEX idx_tenant_hosts_host ON tenant_hosts(host);
+
+CREATE TABLE tenant_lrs_config (
+    tenant_id VARCHAR(100) PRIMARY KEY REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    endpoint VARCHAR(512) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    password TEXT NOT NULL,
+    connection_timeout INT DEFAULT 30,
+    max_retries INT DEFAULT 3,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE tenant_auth_config (
+    tenant_id VARCHAR(100) PRIMARY KEY REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    jwt_secret TEXT NOT NULL,
+    jwt_ttl_seconds INT DEFAULT 3600,
+    permission_policy VARCHAR(20) DEFAULT 'strict' CHECK (permission_policy IN ('strict', 'permissive')),
+    oauth_token_ttl_seconds INT DEFAULT 300,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE tenant_data_keys (
+    tenant_id VARCHAR(100) PRIMARY KEY REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    master_key_id VARCHAR(100) NOT NULL,
+    wrapped_key TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE tenant_lms_api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    key_prefix VARCHAR(20),
+    salt VARCHAR(64) NOT NULL DEFAULT '',
+    api_key_hash VARCHAR(255) NOT NULL,
+    description TEXT,
+    max_read_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    max_write_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    allowed_course_ids TEXT,
+    allowed_activity_prefixes TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked BOOLEAN DEFAULT FALSE,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_tenant_lms_api_keys_tenant ON tenant_lms_api_keys(tenant_id);
+CREATE UNIQUE INDEX idx_tenant_lms_api_keys_prefix ON tenant_lms_api_keys(key_prefix);
+
+CREATE TABLE tenant_oauth_clients (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    client_id VARCHAR(255) NOT NULL,
+    client_secret_hash VARCHAR(255),
+    public_key_pem TEXT,
+    scopes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    revoked BOOLEAN DEFAULT FALSE,
+    revoked_at TIMESTAMP,
+    UNIQUE(tenant_id, client_id),
+    CHECK (client_secret_hash IS NOT NULL OR public_key_pem IS NOT NULL)
+);
+
+CREATE INDEX idx_tenant_oauth_clients_tenant ON tenant_oauth_clients(tenant_id);
+
+CREATE TABLE tenant_token_exchange_issuers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    issuer VARCHAR(512) NOT NULL,
+    audience VARCHAR(512),
+    jwks_file VARCHAR(1024) NOT NULL,
+    claim_mappings TEXT,
+    account_home_page VARCHAR(512),
+    max_read_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    max_write_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant_id, issuer)
+);
+
+CREATE TABLE tenant_lti_platforms (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    issuer VARCHAR(512) NOT NULL,
+    client_id VARCHAR(255) NOT NULL,
+    deployment_ids TEXT,
+    auth_login_url VARCHAR(1024) NOT NULL,
+    jwks_file VARCHAR(1024) NOT NULL,
+    content_url_prefixes TEXT NOT NULL,
+    write_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    read_permission VARCHAR(100) NOT NULL DEFAULT 'actor-activity-registration-scoped',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant_id, issuer)
+);
+
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE SET NULL,
+    timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    operation VARCHAR(50) NOT NULL,
+    actor_mbox VARCHAR(255),
+    registration VARCHAR(255),
+    activity_id VARCHAR(512),
+    permission_write VARCHAR(100),
+    permission_read VARCHAR(100),
+    success BOOLEAN DEFAULT TRUE,
+    error_message TEXT,
+    ip_address TEXT,
+    user_agent TEXT,
+    admin_principal VARCHAR(255),
+    admin_role VARCHAR(50),
+    request_method VARCHAR(10),
+    request_path TEXT
+);
+
+CREATE INDEX idx_audit_log_tenant ON audit_log(tenant_id, timestamp DESC);
+CREATE INDEX idx_audit_log_actor ON audit_log(actor_mbox, timestamp DESC);
+CREATE INDEX idx_audit_log_registration ON audit_log(registration, timestamp DESC);
+CREATE INDEX idx_audit_log_admin ON audit_log(admin_principal, timestamp DESC) WHERE admin_principal IS NOT NULL;
+
+CREATE TABLE permission_approvals (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    course_id VARCHAR(255) NOT NULL,
+    au_id VARCHAR(255) NOT NULL,
+    permission_type VARCHAR(50) NOT NULL,
+    permission_scope VARCHAR(100) NOT NULL,
+    approved BOOLEAN DEFAULT FALSE,
+    approved_by VARCHAR(255),
+    approved_at TIMESTAMP,
+    justification TEXT,
+    revoked BOOLEAN DEFAULT FALSE,
+    revoked_at TIMESTAMP,
+    revoked_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant_id, course_id, au_id, permission_type)
+);
+
+CREATE INDEX idx_permission_approvals_tenant_course ON permission_approvals(tenant_id, course_id);
+CREATE INDEX idx_permission_approvals_approved ON permission_approvals(tenant_id, approved) WHERE approved = TRUE AND revoked = FALSE;
+
+-- updated_at is maintained by triggers, as in the PostgreSQL schema. There is no
+-- LISTEN/NOTIFY: a SQLite database is served by a single proxy process.
+CREATE TRIGGER update_tenants_updated_at AFTER UPDATE ON tenants
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE tenants SET updated_at = CURRENT_TIMESTAMP WHERE tenant_id = NEW.tenant_id;
+END;
+
+CREATE TRIGGER update_tenant_lrs_config_updated_at AFTER UPDATE ON tenant_lrs_config
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE tenant_lrs_config SET updated_at = CURRENT_TIMESTAMP WHERE tenant_id = NEW.tenant_id;
+END;
+
+CREATE TRIGGER update_tenant_auth_config_updated_at AFTER UPDATE ON tenant_auth_config
+FOR EACH ROW WHEN NEW.updated_at IS OLD.updated_at
+BEGIN
+    UPDATE tenant_auth_config SET updated_at = CURRENT_TIMESTAMP WHERE tenant_id = NEW.tenant_id;
+END;
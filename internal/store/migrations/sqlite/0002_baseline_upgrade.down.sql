@@ -0,0 +1,2 @@
+-- See 0002_baseline_upgrade.up.sql; 0001 down drops these tables.
+SELECT 1;
@@ -0,0 +1,3 @@
+-- Twin of ../postgres/0002_baseline_upgrade.up.sql. SQLite databases were
+-- only ever created with those changes, which are part of 0001 here.
+SELECT 1;
@@ -0,0 +1,2 @@
+-- Host normalization is not reversed.
+SELECT 1;
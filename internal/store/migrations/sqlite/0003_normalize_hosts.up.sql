@@ -0,0 +1,32 @@
+-- Host mappings are matched in normalized form (see store.NormalizeHost):
+-- lowercase, without a trailing dot or a default port. Unicode host names
+-- are not converted here; re-save those tenants through the admin API.
+--
+-- Mappings that normalize to the same host would violate the unique host
+-- constraint. Of each such group, the mapping already in normalized form is
+-- kept, else the oldest; the others are deleted.
+WITH lowered AS (
+    SELECT tenant_id, host, created_at,
+           CASE
+               WHEN LOWER(host) LIKE '%:80' THEN substr(LOWER(host), 1, length(host) - 3)
+               WHEN LOWER(host) LIKE '%:443' THEN substr(LOWER(host), 1, length(host) - 4)
+               ELSE LOWER(host)
+           END AS portless
+    FROM tenant_hosts
+), normalized AS (
+    SELECT tenant_id, host, created_at,
+           CASE WHEN portless LIKE '%.' THEN substr(portless, 1, length(portless) - 1) ELSE portless END AS normalized
+    FROM lowered
+), ranked AS (
+    SELECT tenant_id, host,
+           ROW_NUMBER() OVER (PARTITION BY normalized
+                              ORDER BY host = normalized DESC, created_at, tenant_id, host) AS n
+    FROM normalized
+)
+DELETE FROM tenant_hosts
+WHERE (tenant_id, host) IN (SELECT tenant_id, host FROM ranked WHERE n > 1);
+
+UPDATE tenant_hosts SET host = LOWER(host);
+UPDATE tenant_hosts SET host = substr(host, 1, length(host) - 3) WHERE host LIKE '%:80';
+UPDATE tenant_hosts SET host = substr(host, 1, length(host) - 4) WHERE host LIKE '%:443';
+UPDATE tenant_hosts SET host = substr(host, 1, length(host) - 1) WHERE host LIKE '%.';
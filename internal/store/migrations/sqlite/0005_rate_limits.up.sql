@@ -0,0 +1,10 @@
+-- Token-bucket request limits per tenant. scope is "tenant" (all requests),
+-- "api_key" (per LMS API key or OAuth client) or "actor" (per actor and
+-- registration).
+CREATE TABLE tenant_rate_limits (
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    scope VARCHAR(20) NOT NULL,
+    requests_per_minute INTEGER NOT NULL,
+    burst INTEGER NOT NULL,
+    PRIMARY KEY (tenant_id, scope)
+);
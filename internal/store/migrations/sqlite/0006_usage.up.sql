@@ -0,0 +1,25 @@
+-- Monthly usage quotas per tenant. metric is "statements_written",
+-- "statements_read", "tokens_issued" or "bytes_proxied"; a zero limit is
+-- unset.
+CREATE TABLE tenant_quotas (
+    tenant_id VARCHAR(100) REFERENCES tenants(tenant_id) ON DELETE CASCADE,
+    metric VARCHAR(30) NOT NULL,
+    soft_limit BIGINT NOT NULL DEFAULT 0,
+    hard_limit BIGINT NOT NULL DEFAULT 0,
+    exceeded_status INTEGER NOT NULL DEFAULT 402,
+    PRIMARY KEY (tenant_id, metric)
+);
+
+-- Hourly usage totals, added to by every replica. Rows outlive their
+-- tenant, for billing.
+CREATE TABLE tenant_usage (
+    tenant_id VARCHAR(100) NOT NULL,
+    hour TIMESTAMP NOT NULL,
+    statements_written BIGINT NOT NULL DEFAULT 0,
+    statements_read BIGINT NOT NULL DEFAULT 0,
+    tokens_issued BIGINT NOT NULL DEFAULT 0,
+    bytes_proxied BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, hour)
+);
+
+CREATE INDEX idx_tenant_usage_hour ON tenant_usage(hour);
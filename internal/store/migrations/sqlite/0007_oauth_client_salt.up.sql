@@ -0,0 +1,5 @@
+-- OAuth client secrets are hashed like LMS API keys: SHA-256 of a random
+-- salt followed by the secret. Secrets hashed before this have an empty
+-- salt, which is their unsalted SHA-256, and keep working until the client
+-- is registered again.
+ALTER TABLE tenant_oauth_clients ADD COLUMN client_secret_salt VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// NonceStore remembers consumed one-time values, such as LTI launch nonces,
+// so each can be used only once
+type NonceStore interface {
+	// UseNonce marks a nonce as consumed for ttl, returning false if it
+	// was already used
+	UseNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore is a per-process NonceStore
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time // nonce -> expiry
+}
+
+// NewMemoryNonceStore creates an empty nonce store
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// UseNonce implements NonceStore
+func (s *MemoryNonceStore) UseNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for n, expiry := range s.nonces {
+		if now.After(expiry) {
+			delete(s.nonces, n)
+		}
+	}
+
+	if _, used := s.nonces[nonce]; used {
+		return false, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// OAuthClient represents an LMS registered for the OAuth 2.0
+// client_credentials grant
+type OAuthClient struct {
+	ClientID         string
+	ClientSecretSalt string           // Hex salt of the secret hash; empty for secrets stored before salting
+	ClientSecretHash string           // Hex SHA-256 of salt || client secret (client_secret_basic/post)
+	PublicKey        crypto.PublicKey // Verifies client assertions (private_key_jwt)
+	Scopes           []string         // Maximum scopes the client may be granted
+}
+
+// NewOAuthClient builds an OAuthClient from its plaintext secret and/or
+// PEM encoded public key. At least one credential is required.
+func NewOAuthClient(clientID, clientSecret, publicKeyPEM string, scopes []string) (*OAuthClient, error) {
+	if clientID == "" {
+		return nil, fmt.Errorf("client_id is required")
+	}
+	if clientSecret == "" && publicKeyPEM == "" {
+		return nil, fmt.Errorf("client %s: client_secret or public key is required", clientID)
+	}
+
+	client := &OAuthClient{
+		ClientID: clientID,
+		Scopes:   scopes,
+	}
+	if clientSecret != "" {
+		if err := client.SetSecret(clientSecret); err != nil {
+			return nil, fmt.Errorf("client %s: %w", clientID, err)
+		}
+	}
+	if publicKeyPEM != "" {
+		key, err := ParsePublicKeyPEM(publicKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("client %s: %w", clientID, err)
+		}
+		client.PublicKey = key
+	}
+	return client, nil
+}
+
+// SetSecret stores the salted hash of a plaintext client secret, hashed
+// like LMS API keys
+func (c *OAuthClient) SetSecret(secret string) error {
+	salt, err := NewAPIKeySalt()
+	if err != nil {
+		return err
+	}
+	c.ClientSecretSalt = salt
+	c.ClientSecretHash = HashAPIKey(salt, secret)
+	return nil
+}
+
+// MatchesSecret reports in constant time whether a presented secret hashes
+// to the client's secret. Clients without a secret match nothing.
+func (c *OAuthClient) MatchesSecret(presented string) bool {
+	if c.ClientSecretHash == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(c.ClientSecretSalt, presented)), []byte(c.ClientSecretHash)) == 1
+}
+
+// ParsePublicKeyPEM parses a PEM encoded PKIX public key (RSA or ECDSA)
+func ParsePublicKeyPEM(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+	return key, nil
+}
+
+// splitScopes splits a space-delimited OAuth scope string
+func splitScopes(s string) []string {
+	return strings.Fields(s)
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestOAuthClientSecret(t *testing.T) {
+	a, err := NewOAuthClient("lms", "s3cret", "", []string{"write:actor-activity-registration-scoped"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewOAuthClient("lms", "s3cret", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ClientSecretSalt == "" || a.ClientSecretSalt == b.ClientSecretSalt || a.ClientSecretHash == b.ClientSecretHash {
+		t.Errorf("secrets are not salted: %+v, %+v", a, b)
+	}
+	if !a.MatchesSecret("s3cret") {
+		t.Error("MatchesSecret(secret) = false")
+	}
+	for _, wrong := range []string{"", "s3cre", "s3cret ", a.ClientSecretHash} {
+		if a.MatchesSecret(wrong) {
+			t.Errorf("MatchesSecret(%q) = true", wrong)
+		}
+	}
+
+	// Secrets hashed before salting have an empty salt
+	sum := sha256.Sum256([]byte("s3cret"))
+	legacy := &OAuthClient{ClientID: "lms", ClientSecretHash: hex.EncodeToString(sum[:])}
+	if !legacy.MatchesSecret("s3cret") || legacy.MatchesSecret("other") {
+		t.Error("unsalted secret hash not verified")
+	}
+
+	// A client with only a public key has no secret to match
+	if (&OAuthClient{ClientID: "jwt-only"}).MatchesSecret("") {
+		t.Error("client without a secret matched an empty secret")
+	}
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/usage"
+)
+
+// Quota is a monthly limit on one usage metric. Past Soft, requests succeed
+// with a warning; past Hard they are refused with ExceededStatus. Zero
+// disables a limit.
+type Quota struct {
+	Soft           int64 `json:"soft,omitempty"`
+	Hard           int64 `json:"hard,omitempty"`
+	ExceededStatus int   `json:"exceeded_status,omitempty"` // 402 (default) or 429
+}
+
+// Quotas are a tenant's monthly quotas by metric. A nil quota is unlimited.
+type Quotas struct {
+	StatementsWritten *Quota `json:"statements_written,omitempty"`
+	StatementsRead    *Quota `json:"statements_read,omitempty"`
+	TokensIssued      *Quota `json:"tokens_issued,omitempty"`
+	BytesProxied      *Quota `json:"bytes_proxied,omitempty"`
+}
+
+// byMetric returns the quotas keyed by usage metric
+func (q *Quotas) byMetric() map[string]**Quota {
+	return map[string]**Quota{
+		usage.StatementsWritten: &q.StatementsWritten,
+		usage.StatementsRead:    &q.StatementsRead,
+		usage.TokensIssued:      &q.TokensIssued,
+		usage.BytesProxied:      &q.BytesProxied,
+	}
+}
+
+// For returns the quota on a metric, or nil
+func (q *Quotas) For(metric string) *Quota {
+	if quota, ok := q.byMetric()[metric]; ok {
+		return *quota
+	}
+	return nil
+}
+
+// Normalize validates the quotas and fills in the default status
+func (q *Quotas) Normalize() error {
+	for metric, quota := range q.byMetric() {
+		if *quota == nil {
+			continue
+		}
+		normalized := **quota
+		if normalized.Soft < 0 || normalized.Hard < 0 {
+			return fmt.Errorf("quotas.%s must not be negative", metric)
+		}
+		if normalized.Soft == 0 && normalized.Hard == 0 {
+			return fmt.Errorf("quotas.%s requires soft or hard", metric)
+		}
+		if normalized.Hard > 0 && normalized.Soft > normalized.Hard {
+			return fmt.Errorf("quotas.%s.soft must not exceed hard", metric)
+		}
+		switch normalized.ExceededStatus {
+		case 0:
+			normalized.ExceededStatus = http.StatusPaymentRequired
+		case http.StatusPaymentRequired, http.StatusTooManyRequests:
+		default:
+			return fmt.Errorf("quotas.%s.exceeded_status must be 402 or 429", metric)
+		}
+		*quota = &normalized
+	}
+	return nil
+}
+
+// quotasFromConfig converts YAML quotas
+func quotasFromConfig(cfg config.QuotasConfig) (Quotas, error) {
+	convert := func(c *config.QuotaConfig) *Quota {
+		if c == nil {
+			return nil
+		}
+		return &Quota{Soft: c.Soft, Hard: c.Hard, ExceededStatus: c.ExceededStatus}
+	}
+	quotas := Quotas{
+		StatementsWritten: convert(cfg.StatementsWritten),
+		StatementsRead:    convert(cfg.StatementsRead),
+		TokensIssued:      convert(cfg.TokensIssued),
+		BytesProxied:      convert(cfg.BytesProxied),
+	}
+	return quotas, quotas.Normalize()
+}
+
+// loadQuotas reads a tenant's quotas
+func (s *DatabaseTenantStore) loadQuotas(ctx context.Context, tenantID string) (Quotas, error) {
+	var quotas Quotas
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT metric, soft_limit, hard_limit, exceeded_status
+		FROM tenant_quotas
+		WHERE tenant_id = $1
+	`, tenantID)
+	if err != nil {
+		return quotas, fmt.Errorf("failed to load quotas: %w", err)
+	}
+	defer rows.Close()
+
+	metrics := quotas.byMetric()
+	for rows.Next() {
+		var metric string
+		quota := &Quota{}
+		if err := rows.Scan(&metric, &quota.Soft, &quota.Hard, &quota.ExceededStatus); err != nil {
+			return quotas, err
+		}
+		if dst, ok := metrics[metric]; ok {
+			*dst = quota
+		}
+	}
+	return quotas, rows.Err()
+}
+
+// replaceQuotas stores a tenant's quotas in place of its current ones.
+// quotas must be normalized.
+func replaceQuotas(ctx context.Context, tx *sqlTx, tenantID string, quotas Quotas) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tenant_quotas WHERE tenant_id = $1`, tenantID); err != nil {
+		return fmt.Errorf("failed to update quotas: %w", err)
+	}
+	for metric, quota := range quotas.byMetric() {
+		if *quota == nil {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO tenant_quotas (tenant_id, metric, soft_limit, hard_limit, exceeded_status)
+			VALUES ($1, $2, $3, $4, $5)
+		`, tenantID, metric, (*quota).Soft, (*quota).Hard, (*quota).ExceededStatus)
+		if err != nil {
+			return fmt.Errorf("failed to create %s quota: %w", metric, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+)
+
+// Rate limit scopes, as stored in tenant_rate_limits
+const (
+	RateLimitTenant = "tenant"  // All of the tenant's requests
+	RateLimitAPIKey = "api_key" // Per LMS API key or OAuth client, on /auth/token
+	RateLimitActor  = "actor"   // Per actor and registration, on /xapi
+)
+
+// RateLimit is a token bucket holding up to Burst requests, refilled at
+// RequestsPerMinute
+type RateLimit struct {
+	RequestsPerMinute int `json:"requests_per_minute"`
+	Burst             int `json:"burst,omitempty"` // Default RequestsPerMinute
+}
+
+// Rate returns the refill rate in requests per second
+func (l *RateLimit) Rate() float64 {
+	return float64(l.RequestsPerMinute) / 60
+}
+
+// RateLimits are a tenant's limits by scope. A nil limit is unlimited.
+type RateLimits struct {
+	Tenant *RateLimit `json:"tenant,omitempty"`
+	APIKey *RateLimit `json:"api_key,omitempty"`
+	Actor  *RateLimit `json:"actor,omitempty"`
+}
+
+// byScope returns the limits keyed by scope
+func (l *RateLimits) byScope() map[string]**RateLimit {
+	return map[string]**RateLimit{
+		RateLimitTenant: &l.Tenant,
+		RateLimitAPIKey: &l.APIKey,
+		RateLimitActor:  &l.Actor,
+	}
+}
+
+// Normalize validates the limits and fills in default bursts
+func (l *RateLimits) Normalize() error {
+	for scope, limit := range l.byScope() {
+		if *limit == nil {
+			continue
+		}
+		if (*limit).RequestsPerMinute <= 0 {
+			return fmt.Errorf("rate_limits.%s.requests_per_minute must be positive", scope)
+		}
+		if (*limit).Burst < 0 {
+			return fmt.Errorf("rate_limits.%s.burst must not be negative", scope)
+		}
+		if (*limit).Burst == 0 {
+			normalized := **limit
+			normalized.Burst = normalized.RequestsPerMinute
+			*limit = &normalized
+		}
+	}
+	return nil
+}
+
+// rateLimitsFromConfig converts YAML rate limits
+func rateLimitsFromConfig(cfg config.RateLimitsConfig) (RateLimits, error) {
+	convert := func(c *config.RateLimitConfig) *RateLimit {
+		if c == nil {
+			return nil
+		}
+		return &RateLimit{RequestsPerMinute: c.RequestsPerMinute, Burst: c.Burst}
+	}
+	limits := RateLimits{
+		Tenant: convert(cfg.Tenant),
+		APIKey: convert(cfg.APIKey),
+		Actor:  convert(cfg.Actor),
+	}
+	return limits, limits.Normalize()
+}
+
+// loadRateLimits reads a tenant's rate limits
+func (s *DatabaseTenantStore) loadRateLimits(ctx context.Context, tenantID string) (RateLimits, error) {
+	var limits RateLimits
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT scope, requests_per_minute, burst
+		FROM tenant_rate_limits
+		WHERE tenant_id = $1
+	`, tenantID)
+	if err != nil {
+		return limits, fmt.Errorf("failed to load rate limits: %w", err)
+	}
+	defer rows.Close()
+
+	scopes := limits.byScope()
+	for rows.Next() {
+		var scope string
+		limit := &RateLimit{}
+		if err := rows.Scan(&scope, &limit.RequestsPerMinute, &limit.Burst); err != nil {
+			return limits, err
+		}
+		if dst, ok := scopes[scope]; ok {
+			*dst = limit
+		}
+	}
+	return limits, rows.Err()
+}
+
+// replaceRateLimits stores a tenant's rate limits in place of its current
+// ones. limits must be normalized.
+func replaceRateLimits(ctx context.Context, tx *sqlTx, tenantID string, limits RateLimits) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tenant_rate_limits WHERE tenant_id = $1`, tenantID); err != nil {
+		return fmt.Errorf("failed to update rate limits: %w", err)
+	}
+	for scope, limit := range limits.byScope() {
+		if *limit == nil {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO tenant_rate_limits (tenant_id, scope, requests_per_minute, burst)
+			VALUES ($1, $2, $3, $4)
+		`, tenantID, scope, (*limit).RequestsPerMinute, (*limit).Burst)
+		if err != nil {
+			return fmt.Errorf("failed to create %s rate limit: %w", scope, err)
+		}
+	}
+	return nil
+}
+
+// RateLimitBucket is a token bucket a request is counted against
+type RateLimitBucket struct {
+	Key   string
+	Limit *RateLimit
+}
+
+// RateLimiter takes requests from token buckets identified by key
+type RateLimiter interface {
+	// Allow takes one request from each bucket, which starts full, and
+	// returns -1. If any bucket is empty none is taken, so buckets are not
+	// charged for a request another one rejects; it returns the index of the
+	// first empty bucket and how long until all have a request available.
+	Allow(ctx context.Context, buckets []RateLimitBucket) (int, time.Duration, error)
+}
+
+// rateLimitSweepInterval is how often a MemoryRateLimiter drops idle buckets
+const rateLimitSweepInterval = time.Minute
+
+// MemoryRateLimiter is a per-process RateLimiter
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// tokenBucket is the state of one bucket
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // When the bucket will have refilled, and can be dropped
+}
+
+// NewMemoryRateLimiter creates a rate limiter with no buckets
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{buckets: make(map[string]*tokenBucket), lastSweep: time.Now(), now: time.Now}
+}
+
+// Allow implements RateLimiter
+func (l *MemoryRateLimiter) Allow(ctx context.Context, buckets []RateLimitBucket) (int, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		for k, b := range l.buckets {
+			if now.After(b.full) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	// Refill every bucket before taking from any
+	refilled := make([]*tokenBucket, len(buckets))
+	empty := -1
+	var wait time.Duration
+	for i, bucket := range buckets {
+		rate, burst := bucket.Limit.Rate(), float64(bucket.Limit.Burst)
+		b, ok := l.buckets[bucket.Key]
+		if !ok {
+			b = &tokenBucket{tokens: burst}
+			l.buckets[bucket.Key] = b
+		} else {
+			b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*rate)
+		}
+		b.updated = now
+		refilled[i] = b
+
+		if b.tokens < 1 {
+			if empty < 0 {
+				empty = i
+			}
+			if w := time.Duration((1 - b.tokens) / rate * float64(time.Second)); w > wait {
+				wait = w
+			}
+		}
+	}
+
+	for i, bucket := range buckets {
+		b := refilled[i]
+		if empty < 0 {
+			b.tokens--
+		}
+		rate, burst := bucket.Limit.Rate(), float64(bucket.Limit.Burst)
+		b.full = now.Add(time.Duration((burst - b.tokens) / rate * float64(time.Second)))
+	}
+	return empty, wait, nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// newTestRateLimiter creates a memory rate limiter on a clock the test moves
+func newTestRateLimiter() (*MemoryRateLimiter, *time.Time) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	l := NewMemoryRateLimiter()
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+	return l, &now
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	l, now := newTestRateLimiter()
+	limit := &RateLimit{RequestsPerMinute: 30, Burst: 3}
+	allow := func(keys ...string) (int, time.Duration) {
+		t.Helper()
+		var buckets []RateLimitBucket
+		for _, key := range keys {
+			buckets = append(buckets, RateLimitBucket{Key: key, Limit: limit})
+		}
+		empty, wait, err := l.Allow(ctx, buckets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return empty, wait
+	}
+
+	// The bucket starts full and allows a burst
+	for i := 0; i < 3; i++ {
+		if empty, _ := allow("acme"); empty != -1 {
+			t.Fatalf("request %d of the burst rejected", i+1)
+		}
+	}
+	if empty, wait := allow("acme"); empty != 0 || wait != 2*time.Second {
+		t.Errorf("request over burst = bucket %d, wait %v; want rejected for 2s at one request per 2s", empty, wait)
+	}
+
+	// Half a token has refilled after a second, so the wait shrinks
+	*now = now.Add(time.Second)
+	if empty, wait := allow("acme"); empty != 0 || wait != time.Second {
+		t.Errorf("after 1s = bucket %d, wait %v; want rejected for 1s", empty, wait)
+	}
+	*now = now.Add(time.Second)
+	if empty, _ := allow("acme"); empty != -1 {
+		t.Error("rejected once a token refilled")
+	}
+
+	// Refilling stops at the burst
+	*now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		allow("acme")
+	}
+	if empty, _ := allow("acme"); empty != 0 {
+		t.Error("idle bucket refilled beyond its burst")
+	}
+
+	// A request rejected by one bucket takes nothing from the others, and
+	// the first empty bucket is reported
+	for i := 0; i < 5; i++ {
+		if empty, _ := allow("client", "acme"); empty != 1 {
+			t.Fatalf("request %d: empty bucket %d, want acme's", i+1, empty)
+		}
+	}
+	if tokens := l.buckets["client"].tokens; tokens != 3 {
+		t.Errorf("client bucket has %v tokens after rejected requests, want 3", tokens)
+	}
+
+	// The wait is until every empty bucket has a token
+	slow := &RateLimit{RequestsPerMinute: 6, Burst: 1}
+	l.Allow(ctx, []RateLimitBucket{{Key: "slow", Limit: slow}})
+	empty, wait, _ := l.Allow(ctx, []RateLimitBucket{{Key: "fresh", Limit: limit}, {Key: "acme", Limit: limit}, {Key: "slow", Limit: slow}})
+	if empty != 1 || wait != 10*time.Second {
+		t.Errorf("two empty buckets = bucket %d, wait %v; want acme's, 10s", empty, wait)
+	}
+}
+
+func TestMemoryRateLimiterSweep(t *testing.T) {
+	ctx := context.Background()
+	l, now := newTestRateLimiter()
+	limit := &RateLimit{RequestsPerMinute: 60, Burst: 60}
+	slow := &RateLimit{RequestsPerMinute: 1, Burst: 1}
+	l.Allow(ctx, []RateLimitBucket{{Key: "idle", Limit: limit}})
+
+	// Buckets are only swept once a minute, and only once refilled
+	*now = now.Add(30 * time.Second)
+	l.Allow(ctx, []RateLimitBucket{{Key: "busy", Limit: slow}})
+	if len(l.buckets) != 2 {
+		t.Fatalf("%d buckets before the sweep interval, want 2", len(l.buckets))
+	}
+	*now = now.Add(30 * time.Second)
+	l.Allow(ctx, []RateLimitBucket{{Key: "other", Limit: limit}})
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("refilled idle bucket was kept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("bucket still refilling was dropped")
+	}
+}
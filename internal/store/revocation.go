@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenRevocationList records content JWTs revoked before they expire
+type TokenRevocationList interface {
+	// RevokeToken revokes a token ID until the token's own expiry
+	RevokeToken(ctx context.Context, tenantID, tokenID string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, tenantID, tokenID string) (bool, error)
+}
+
+// MemoryRevocationList is a per-process TokenRevocationList
+type MemoryRevocationList struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time // tenant ID + token ID -> token expiry
+}
+
+// NewMemoryRevocationList creates an empty revocation list
+func NewMemoryRevocationList() *MemoryRevocationList {
+	return &MemoryRevocationList{revoked: make(map[string]time.Time)}
+}
+
+// RevokeToken implements TokenRevocationList
+func (l *MemoryRevocationList) RevokeToken(ctx context.Context, tenantID, tokenID string, expiresAt time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for id, expiry := range l.revoked {
+		if now.After(expiry) {
+			delete(l.revoked, id)
+		}
+	}
+	l.revoked[tenantID+"\x00"+tokenID] = expiresAt
+	return nil
+}
+
+// IsTokenRevoked implements TokenRevocationList
+func (l *MemoryRevocationList) IsTokenRevoked(ctx context.Context, tenantID, tokenID string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expiry, ok := l.revoked[tenantID+"\x00"+tokenID]
+	return ok && time.Now().Before(expiry), nil
+}
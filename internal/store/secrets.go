@@ -0,0 +1,518 @@
+package store
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+)
+
+// encryptedSecretPrefix marks a column value encrypted with a tenant data
+// key. Values without it are legacy cleartext.
+const encryptedSecretPrefix = "enc:v1:"
+
+// dataKeySize is the size of tenant data keys and local master keys (AES-256)
+const dataKeySize = 32
+
+// ErrNoMasterKey is returned when an encrypted secret is read or written
+// without a master key configured
+var ErrNoMasterKey = errors.New("no master key configured")
+
+// MasterKey wraps and unwraps tenant data keys. LocalMasterKey keeps the key
+// in process; a KMS is plugged in by implementing this interface.
+type MasterKey interface {
+	// ID identifies the key so wrapped data keys can find it again
+	ID() string
+	WrapKey(ctx context.Context, dataKey []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// LocalMasterKey is an AES-256-GCM master key held in memory
+type LocalMasterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewLocalMasterKey creates a master key from 32 raw bytes. Its ID is
+// derived from the key so it is stable across restarts.
+func NewLocalMasterKey(key []byte) (*LocalMasterKey, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", dataKeySize, len(key))
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &LocalMasterKey{id: "local:" + hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+// ID implements MasterKey
+func (k *LocalMasterKey) ID() string {
+	return k.id
+}
+
+// WrapKey implements MasterKey
+func (k *LocalMasterKey) WrapKey(ctx context.Context, dataKey []byte) ([]byte, error) {
+	return seal(k.aead, dataKey, []byte(k.id))
+}
+
+// UnwrapKey implements MasterKey
+func (k *LocalMasterKey) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return open(k.aead, wrapped, []byte(k.id))
+}
+
+// Keyring holds the current master key, which wraps new data keys, and
+// previous master keys that are still accepted for unwrapping while data
+// keys are rewrapped
+type Keyring struct {
+	current MasterKey
+	keys    map[string]MasterKey
+}
+
+// NewKeyring creates a keyring
+func NewKeyring(current MasterKey, previous ...MasterKey) *Keyring {
+	k := &Keyring{current: current, keys: map[string]MasterKey{current.ID(): current}}
+	for _, p := range previous {
+		k.keys[p.ID()] = p
+	}
+	return k
+}
+
+// LoadKeyring builds a keyring of local master keys from configuration. It
+// returns nil when no master key is configured.
+func LoadKeyring(cfg config.EncryptionConfig) (*Keyring, error) {
+	if cfg.MasterKey.File == "" && cfg.MasterKey.Env == "" {
+		if len(cfg.PreviousMasterKeys) > 0 {
+			return nil, fmt.Errorf("previous_master_keys requires master_key")
+		}
+		return nil, nil
+	}
+	current, err := loadLocalMasterKey(cfg.MasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("master_key: %w", err)
+	}
+	var previous []MasterKey
+	for i, src := range cfg.PreviousMasterKeys {
+		key, err := loadLocalMasterKey(src)
+		if err != nil {
+			return nil, fmt.Errorf("previous_master_keys[%d]: %w", i, err)
+		}
+		previous = append(previous, key)
+	}
+	return NewKeyring(current, previous...), nil
+}
+
+// loadLocalMasterKey reads a base64 encoded master key from a file or an
+// environment variable
+func loadLocalMasterKey(src config.MasterKeySource) (*LocalMasterKey, error) {
+	var encoded string
+	switch {
+	case src.File != "" && src.Env != "":
+		return nil, fmt.Errorf("set either file or env, not both")
+	case src.File != "":
+		data, err := os.ReadFile(src.File)
+		if err != nil {
+			return nil, err
+		}
+		encoded = string(data)
+	case src.Env != "":
+		encoded = os.Getenv(src.Env)
+		if encoded == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", src.Env)
+		}
+	default:
+		return nil, fmt.Errorf("file or env is required")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key must be base64: %w", err)
+	}
+	return NewLocalMasterKey(key)
+}
+
+// newAEAD creates an AES-GCM cipher
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts with a random nonce, returning nonce||ciphertext
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// open decrypts nonce||ciphertext
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+// queryer is satisfied by *sql.DB and *sql.Tx
+type queryer interface {
+	execer
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// secretCipher encrypts tenant secret columns with per-tenant data keys
+type secretCipher struct {
+	keyring *Keyring
+	// Unwrapped data keys by wrapped form, so the master key (possibly a
+	// KMS call) is used once per data key
+	mu       sync.Mutex
+	dataKeys map[string][]byte
+}
+
+// EnableEncryption encrypts LRS passwords and JWT secrets written from now
+// on with per-tenant data keys wrapped by the keyring's current master key.
+// Existing cleartext values stay readable until ReencryptSecrets runs.
+func (s *DatabaseTenantStore) EnableEncryption(keyring *Keyring) {
+	s.secrets = &secretCipher{keyring: keyring, dataKeys: make(map[string][]byte)}
+}
+
+// dataKey returns a tenant's data key, creating it if create is set and the
+// tenant has none
+func (c *secretCipher) dataKey(ctx context.Context, q queryer, tenantID string, create bool) ([]byte, error) {
+	var masterKeyID, wrapped string
+	err := q.QueryRowContext(ctx, `
+		SELECT master_key_id, wrapped_key FROM tenant_data_keys WHERE tenant_id = $1
+	`, tenantID).Scan(&masterKeyID, &wrapped)
+	if err == sql.ErrNoRows && create {
+		return c.createDataKey(ctx, q, tenantID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data key: %w", err)
+	}
+	return c.unwrap(ctx, masterKeyID, wrapped)
+}
+
+// createDataKey generates and stores a data key for a tenant
+func (c *secretCipher) createDataKey(ctx context.Context, q queryer, tenantID string) ([]byte, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	master := c.keyring.current
+	wrapped, err := master.WrapKey(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO tenant_data_keys (tenant_id, master_key_id, wrapped_key)
+		VALUES ($1, $2, $3)
+	`, tenantID, master.ID(), base64.StdEncoding.EncodeToString(wrapped))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store data key: %w", err)
+	}
+	return key, nil
+}
+
+// unwrap decrypts a stored data key with the master key that wrapped it
+func (c *secretCipher) unwrap(ctx context.Context, masterKeyID, wrapped string) ([]byte, error) {
+	c.mu.Lock()
+	key, ok := c.dataKeys[wrapped]
+	c.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	master, ok := c.keyring.keys[masterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("data key is wrapped by unknown master key %s", masterKeyID)
+	}
+	raw, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped data key: %w", err)
+	}
+	key, err = master.UnwrapKey(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	c.mu.Lock()
+	c.dataKeys[wrapped] = key
+	c.mu.Unlock()
+	return key, nil
+}
+
+// secretAAD binds a ciphertext to its tenant and column so values can't be
+// swapped between rows
+func secretAAD(tenantID, column string) []byte {
+	return []byte(tenantID + "/" + column)
+}
+
+// encryptSecret encrypts a column value. Without encryption enabled the
+// value is stored as is.
+func (s *DatabaseTenantStore) encryptSecret(ctx context.Context, q queryer, tenantID, column, value string) (string, error) {
+	if s.secrets == nil {
+		return value, nil
+	}
+	key, err := s.secrets.dataKey(ctx, q, tenantID, true)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(value), secretAAD(tenantID, column))
+	if err != nil {
+		return "", err
+	}
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// encryptSecretPtr encrypts an optional column value
+func (s *DatabaseTenantStore) encryptSecretPtr(ctx context.Context, q queryer, tenantID, column string, value *string) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	encrypted, err := s.encryptSecret(ctx, q, tenantID, column, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &encrypted, nil
+}
+
+// decryptSecret decrypts a column value. Legacy cleartext values are
+// returned unchanged.
+func (s *DatabaseTenantStore) decryptSecret(ctx context.Context, q queryer, tenantID, column, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedSecretPrefix) {
+		return value, nil
+	}
+	if s.secrets == nil {
+		return "", fmt.Errorf("%s is encrypted: %w", column, ErrNoMasterKey)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted %s: %w", column, err)
+	}
+	key, err := s.secrets.dataKey(ctx, q, tenantID, false)
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, sealed, secretAAD(tenantID, column))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", column, err)
+	}
+	return string(plaintext), nil
+}
+
+// ResolveSecretRefs resolves secret references (see config.SecretProvider)
+// of the given schemes in tenant secret columns. Values of other schemes are
+// used literally.
+func (s *DatabaseTenantStore) ResolveSecretRefs(schemes []string) {
+	s.secretSchemes = make(map[string]bool)
+	for _, scheme := range schemes {
+		s.secretSchemes[scheme] = true
+	}
+}
+
+// readSecret decrypts a column value and resolves it if it is an allowed
+// secret reference
+func (s *DatabaseTenantStore) readSecret(ctx context.Context, tenantID, column, value string) (string, error) {
+	value, err := s.decryptSecret(ctx, s.db, tenantID, column, value)
+	if err != nil {
+		return "", err
+	}
+	if scheme := config.SecretScheme(value); scheme != "" && s.secretSchemes[scheme] {
+		s.mu.Lock()
+		s.refTenants[tenantID] = true
+		s.mu.Unlock()
+		return config.ResolveSecret(ctx, value)
+	}
+	return value, nil
+}
+
+// RefreshSecretRefs evicts the tenants whose secrets were resolved from
+// references every interval until ctx is done, so their next request
+// resolves them again and picks up rotated values
+func (s *DatabaseTenantStore) RefreshSecretRefs(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || len(s.secretSchemes) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			tenants := s.refTenants
+			s.refTenants = make(map[string]bool)
+			s.mu.Unlock()
+
+			for tenantID := range tenants {
+				s.invalidateTenant(tenantID)
+			}
+		}
+	}
+}
+
+// ReencryptResult summarizes a ReencryptSecrets run
+type ReencryptResult struct {
+	Tenants   int `json:"tenants"`
+	Rewrapped int `json:"rewrapped_data_keys"`
+	Encrypted int `json:"encrypted_secrets"`
+	Failed    int `json:"failed"`
+}
+
+// ReencryptSecrets rewraps every tenant data key that isn't wrapped by the
+// current master key and encrypts remaining cleartext secrets. Each tenant
+// is handled in its own transaction, so the proxy keeps serving while it
+// runs and an interrupted run can simply be repeated.
+func (s *DatabaseTenantStore) ReencryptSecrets(ctx context.Context) (*ReencryptResult, error) {
+	if s.secrets == nil {
+		return nil, ErrNoMasterKey
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT tenant_id FROM tenants ORDER BY tenant_id`)
+	if err != nil {
+		return nil, err
+	}
+	var tenantIDs []string
+	for rows.Next() {
+		var tenantID string
+		if err := rows.Scan(&tenantID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &ReencryptResult{Tenants: len(tenantIDs)}
+	for _, tenantID := range tenantIDs {
+		rewrapped, encrypted, err := s.reencryptTenant(ctx, tenantID)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"tenant_id": tenantID,
+				"error":     err.Error(),
+			}).Error("Failed to re-encrypt tenant secrets")
+			result.Failed++
+			continue
+		}
+		if rewrapped {
+			result.Rewrapped++
+		}
+		result.Encrypted += encrypted
+	}
+
+	log.WithFields(log.Fields{
+		"tenants":   result.Tenants,
+		"rewrapped": result.Rewrapped,
+		"encrypted": result.Encrypted,
+		"failed":    result.Failed,
+	}).Info("Tenant secrets re-encrypted")
+
+	return result, nil
+}
+
+// reencryptTenant rewraps one tenant's data key and encrypts its cleartext
+// secrets
+func (s *DatabaseTenantStore) reencryptTenant(ctx context.Context, tenantID string) (bool, int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	current := s.secrets.keyring.current
+	rewrapped := false
+
+	var masterKeyID, wrapped string
+	err = tx.QueryRowContext(ctx, `
+		SELECT master_key_id, wrapped_key FROM tenant_data_keys WHERE tenant_id = $1 FOR UPDATE
+	`, tenantID).Scan(&masterKeyID, &wrapped)
+	if err != nil && err != sql.ErrNoRows {
+		return false, 0, err
+	}
+	if err == nil && masterKeyID != current.ID() {
+		key, err := s.secrets.unwrap(ctx, masterKeyID, wrapped)
+		if err != nil {
+			return false, 0, err
+		}
+		rewrappedKey, err := current.WrapKey(ctx, key)
+		if err != nil {
+			return false, 0, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE tenant_data_keys
+			SET master_key_id = $2, wrapped_key = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE tenant_id = $1
+		`, tenantID, current.ID(), base64.StdEncoding.EncodeToString(rewrappedKey))
+		if err != nil {
+			return false, 0, err
+		}
+		rewrapped = true
+	}
+
+	encrypted := 0
+	for _, col := range []struct{ table, column string }{
+		{"tenant_lrs_config", "password"},
+		{"tenant_auth_config", "jwt_secret"},
+	} {
+		var value string
+		err := tx.QueryRowContext(ctx, fmt.Sprintf(`
+			SELECT %s FROM %s WHERE tenant_id = $1 FOR UPDATE
+		`, col.column, col.table), tenantID).Scan(&value)
+		if err == sql.ErrNoRows || strings.HasPrefix(value, encryptedSecretPrefix) {
+			continue
+		}
+		if err != nil {
+			return false, 0, err
+		}
+		value, err = s.encryptSecret(ctx, tx, tenantID, col.column, value)
+		if err != nil {
+			return false, 0, err
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+			UPDATE %s SET %s = $2 WHERE tenant_id = $1
+		`, col.table, col.column), tenantID, value)
+		if err != nil {
+			return false, 0, err
+		}
+		encrypted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, 0, err
+	}
+	return rewrapped, encrypted, nil
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+)
+
+// newTestMasterKey creates a local master key from random bytes
+func newTestMasterKey(t *testing.T) *LocalMasterKey {
+	t.Helper()
+	raw := make([]byte, dataKeySize)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewLocalMasterKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestLocalMasterKey(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewLocalMasterKey(make([]byte, 16)); err == nil {
+		t.Error("NewLocalMasterKey accepted a 16 byte key")
+	}
+
+	raw := bytes.Repeat([]byte{7}, dataKeySize)
+	key, err := NewLocalMasterKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := NewLocalMasterKey(raw)
+	if key.ID() != again.ID() {
+		t.Errorf("IDs of the same key = %s, %s; want them equal", key.ID(), again.ID())
+	}
+
+	dataKey := bytes.Repeat([]byte{1}, dataKeySize)
+	wrapped, err := key.WrapKey(ctx, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(wrapped, dataKey) {
+		t.Error("wrapped data key contains the data key")
+	}
+	unwrapped, err := again.UnwrapKey(ctx, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("UnwrapKey = %x, %v; want the data key", unwrapped, err)
+	}
+
+	other := newTestMasterKey(t)
+	if other.ID() == key.ID() {
+		t.Error("different keys have the same ID")
+	}
+	if _, err := other.UnwrapKey(ctx, wrapped); err == nil {
+		t.Error("another master key unwrapped the data key")
+	}
+}
+
+func TestSealAAD(t *testing.T) {
+	aead, err := newAEAD(bytes.Repeat([]byte{3}, dataKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := seal(aead, []byte("secret"), secretAAD("acme", "password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := open(aead, sealed, secretAAD("acme", "password")); err != nil || string(plaintext) != "secret" {
+		t.Errorf("open = %q, %v; want the plaintext", plaintext, err)
+	}
+	if _, err := open(aead, sealed, secretAAD("globex", "password")); err == nil {
+		t.Error("ciphertext opened for another tenant")
+	}
+	if _, err := open(aead, sealed, secretAAD("acme", "jwt_secret")); err == nil {
+		t.Error("ciphertext opened for another column")
+	}
+	if _, err := open(aead, sealed[:4], nil); err == nil {
+		t.Error("truncated ciphertext opened")
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	encode := func(b byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, dataKeySize))
+	}
+	file := filepath.Join(t.TempDir(), "master.key")
+	if err := os.WriteFile(file, []byte(encode(1)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_PREVIOUS_MASTER_KEY", encode(2))
+
+	keyring, err := LoadKeyring(config.EncryptionConfig{
+		MasterKey:          config.MasterKeySource{File: file},
+		PreviousMasterKeys: []config.MasterKeySource{{Env: "TEST_PREVIOUS_MASTER_KEY"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, _ := NewLocalMasterKey(bytes.Repeat([]byte{1}, dataKeySize))
+	previous, _ := NewLocalMasterKey(bytes.Repeat([]byte{2}, dataKeySize))
+	if keyring.current.ID() != current.ID() || keyring.keys[previous.ID()] == nil {
+		t.Errorf("keyring = %+v, want the file key current and the env key previous", keyring)
+	}
+
+	if keyring, err := LoadKeyring(config.EncryptionConfig{}); keyring != nil || err != nil {
+		t.Errorf("LoadKeyring without keys = %v, %v; want nil, nil", keyring, err)
+	}
+	for name, cfg := range map[string]config.EncryptionConfig{
+		"previous without current": {PreviousMasterKeys: []config.MasterKeySource{{File: file}}},
+		"file and env":             {MasterKey: config.MasterKeySource{File: file, Env: "TEST_PREVIOUS_MASTER_KEY"}},
+		"unset env":                {MasterKey: config.MasterKeySource{Env: "TEST_UNSET_MASTER_KEY"}},
+		"missing file":             {MasterKey: config.MasterKeySource{File: file + ".missing"}},
+	} {
+		if _, err := LoadKeyring(cfg); err == nil {
+			t.Errorf("%s: LoadKeyring succeeded", name)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+)
+
+// TenantSnapshot is the stored form of a tenant's configuration: plain data
+// that can be serialized and shared, from which a TenantConfig is built
+type TenantSnapshot struct {
+	TenantID             string                        `json:"tenant_id"`
+	Status               string                        `json:"status"`
+	Hosts                []string                      `json:"hosts"`
+	LRSEndpoint          string                        `json:"lrs_endpoint"`
+	LRSUsername          string                        `json:"lrs_username"`
+	LRSPassword          string                        `json:"lrs_password"`
+	JWTSecret            string                        `json:"jwt_secret"`
+	JWTTTLSeconds        int                           `json:"jwt_ttl_seconds"`
+	PermissionPolicy     string                        `json:"permission_policy"`
+	OAuthTokenTTLSeconds int                           `json:"oauth_token_ttl_seconds"`
+	APIKeys              []APIKeySnapshot              `json:"api_keys,omitempty"`
+	OAuthClients         []OAuthClientSnapshot         `json:"oauth_clients,omitempty"`
+	TokenExchangeIssuers []TokenExchangeIssuerSnapshot `json:"token_exchange_issuers,omitempty"`
+	LTIPlatforms         []LTIPlatformSnapshot         `json:"lti_platforms,omitempty"`
+	RateLimits           RateLimits                    `json:"rate_limits"`
+	Quotas               Quotas                        `json:"quotas"`
+}
+
+// APIKeySnapshot is a stored (hashed) LMS API key
+type APIKeySnapshot struct {
+	ID                      int        `json:"id"`
+	Prefix                  string     `json:"prefix"`
+	Salt                    string     `json:"salt"`
+	Hash                    string     `json:"hash"`
+	ExpiresAt               *time.Time `json:"expires_at,omitempty"`
+	MaxReadPermission       string     `json:"max_read_permission"`
+	MaxWritePermission      string     `json:"max_write_permission"`
+	AllowedCourseIDs        []string   `json:"allowed_course_ids,omitempty"`
+	AllowedActivityPrefixes []string   `json:"allowed_activity_prefixes,omitempty"`
+}
+
+// OAuthClientSnapshot is a stored OAuth client
+type OAuthClientSnapshot struct {
+	ClientID         string   `json:"client_id"`
+	ClientSecretSalt string   `json:"client_secret_salt,omitempty"`
+	ClientSecretHash string   `json:"client_secret_hash,omitempty"`
+	PublicKeyPEM     string   `json:"public_key_pem,omitempty"`
+	Scopes           []string `json:"scopes"`
+}
+
+// TokenExchangeIssuerSnapshot is a stored token exchange issuer
+type TokenExchangeIssuerSnapshot struct {
+	Issuer             string            `json:"issuer"`
+	Audience           string            `json:"audience,omitempty"`
+	JWKSFile           string            `json:"jwks_file"`
+	ClaimMappings      map[string]string `json:"claim_mappings,omitempty"`
+	AccountHomePage    string            `json:"account_home_page,omitempty"`
+	MaxReadPermission  string            `json:"max_read_permission"`
+	MaxWritePermission string            `json:"max_write_permission"`
+}
+
+// LTIPlatformSnapshot is a stored LTI platform registration
+type LTIPlatformSnapshot struct {
+	Issuer             string   `json:"issuer"`
+	ClientID           string   `json:"client_id"`
+	DeploymentIDs      []string `json:"deployment_ids,omitempty"`
+	AuthLoginURL       string   `json:"auth_login_url"`
+	JWKSFile           string   `json:"jwks_file"`
+	ContentURLPrefixes []string `json:"content_url_prefixes"`
+	WritePermission    string   `json:"write_permission"`
+	ReadPermission     string   `json:"read_permission"`
+}
+
+// Build parses a snapshot into a TenantConfig. Invalid API keys, clients,
+// issuers and platforms are logged and skipped so one bad row doesn't take
+// the tenant down.
+func (s *TenantSnapshot) Build() *TenantConfig {
+	config := &TenantConfig{
+		TenantID:             s.TenantID,
+		Status:               s.Status,
+		Hosts:                s.Hosts,
+		LRSEndpoint:          s.LRSEndpoint,
+		LRSUsername:          s.LRSUsername,
+		LRSPassword:          s.LRSPassword,
+		JWTSecret:            []byte(s.JWTSecret),
+		JWTTTLSeconds:        s.JWTTTLSeconds,
+		PermissionPolicy:     s.PermissionPolicy,
+		OAuthTokenTTLSeconds: s.OAuthTokenTTLSeconds,
+		LMSAPIKeys:           make(map[string][]*LMSAPIKey),
+		OAuthClients:         make(map[string]*OAuthClient),
+		TokenExchangeIssuers: make(map[string]*TokenExchangeIssuer),
+		LTIPlatforms:         make(map[string]*LTIPlatform),
+		RateLimits:           s.RateLimits,
+		Quotas:               s.Quotas,
+		snapshot:             s,
+	}
+
+	for _, k := range s.APIKeys {
+		apiKey, err := NewLMSAPIKey(k.MaxReadPermission, k.MaxWritePermission, k.AllowedCourseIDs, k.AllowedActivityPrefixes)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"tenant_id": s.TenantID,
+				"error":     err.Error(),
+			}).Warn("Skipping API key with invalid limits")
+			continue
+		}
+		apiKey.ID = k.ID
+		apiKey.Prefix = k.Prefix
+		apiKey.Salt = k.Salt
+		apiKey.Hash = k.Hash
+		apiKey.ExpiresAt = k.ExpiresAt
+		config.addAPIKey(apiKey)
+	}
+
+	for _, c := range s.OAuthClients {
+		client := &OAuthClient{
+			ClientID:         c.ClientID,
+			ClientSecretSalt: c.ClientSecretSalt,
+			ClientSecretHash: c.ClientSecretHash,
+			Scopes:           c.Scopes,
+		}
+		if c.PublicKeyPEM != "" {
+			var err error
+			if client.PublicKey, err = ParsePublicKeyPEM(c.PublicKeyPEM); err != nil {
+				log.WithFields(log.Fields{
+					"tenant_id": s.TenantID,
+					"client_id": c.ClientID,
+					"error":     err.Error(),
+				}).Warn("Skipping OAuth client with invalid public key")
+				continue
+			}
+		}
+		config.OAuthClients[c.ClientID] = client
+	}
+
+	for _, i := range s.TokenExchangeIssuers {
+		issuer, err := NewTokenExchangeIssuer(i.Issuer, i.Audience, i.JWKSFile, i.ClaimMappings,
+			i.AccountHomePage, i.MaxReadPermission, i.MaxWritePermission)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"tenant_id": s.TenantID,
+				"issuer":    i.Issuer,
+				"error":     err.Error(),
+			}).Warn("Skipping invalid token exchange issuer")
+			continue
+		}
+		config.TokenExchangeIssuers[i.Issuer] = issuer
+	}
+
+	for _, p := range s.LTIPlatforms {
+		platform, err := NewLTIPlatform(p.Issuer, p.ClientID, p.DeploymentIDs, p.AuthLoginURL, p.JWKSFile,
+			p.ContentURLPrefixes, models.Permissions{Write: p.WritePermission, Read: p.ReadPermission})
+		if err != nil {
+			log.WithFields(log.Fields{
+				"tenant_id": s.TenantID,
+				"issuer":    p.Issuer,
+				"error":     err.Error(),
+			}).Warn("Skipping invalid LTI platform")
+			continue
+		}
+		config.LTIPlatforms[p.Issuer] = platform
+	}
+
+	return config
+}
+
+// Snapshot returns the stored form the config was built from, or nil for
+// configs that don't come from a store (single-tenant)
+func (t *TenantConfig) Snapshot() *TenantSnapshot {
+	return t.snapshot
+}
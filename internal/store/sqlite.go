@@ -0,0 +1,26 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openSQLite opens a SQLite database, creating an empty file if needed
+func openSQLite(path string) (*sql.DB, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite:// connection string requires a path, e.g. sqlite:///var/lib/xapi-proxy/tenants.db")
+	}
+	params := url.Values{
+		"_busy_timeout": {"5000"},
+		"_foreign_keys": {"on"},
+		// Transactions take the write lock up front, standing in for the
+		// row locks (SELECT ... FOR UPDATE) used with Postgres
+		"_txlock":       {"immediate"},
+		"_journal_mode": {"WAL"},
+	}
+
+	return sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+}
@@ -0,0 +1,665 @@
+package store
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/audit"
+)
+
+// newSQLiteTestStore migrates a new SQLite database and opens a store on it
+func newSQLiteTestStore(t *testing.T) *DatabaseTenantStore {
+	t.Helper()
+	connStr := "sqlite://" + filepath.Join(t.TempDir(), "tenants.db")
+
+	m, err := OpenMigrator(connStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		m.Close()
+		t.Fatal(err)
+	}
+	m.Close()
+
+	s, err := NewDatabaseTenantStore(connStr, CacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// createTestTenant creates a tenant mapping hosts and returns its API key
+func createTestTenant(t *testing.T, s *DatabaseTenantStore, tenantID string, hosts ...string) string {
+	t.Helper()
+	keys, err := s.CreateTenant(context.Background(), &CreateTenantRequest{
+		TenantID: tenantID,
+		Hosts:    hosts,
+		LRS: LRSConfigRequest{
+			Endpoint: "https://lrs.example.com/xapi/",
+			Username: tenantID,
+			Password: tenantID + "-password",
+		},
+		Auth: AuthConfigRequest{
+			JWTSecret:        tenantID + "-secret-with-at-least-32-bytes",
+			JWTTTLSeconds:    3600,
+			LMSAPIKeys:       []LMSAPIKeyRequest{{Description: "test"}},
+			PermissionPolicy: "strict",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("CreateTenant returned %d keys, want 1", len(keys))
+	}
+	return keys[0].Key
+}
+
+func TestSQLiteMigrationsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	m, err := OpenMigrator("sqlite://" + filepath.Join(t.TempDir(), "tenants.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := m.Up(ctx); err != nil {
+			t.Fatalf("up: %v", err)
+		}
+		if v, err := m.CurrentVersion(ctx); err != nil || v != m.LatestVersion() {
+			t.Fatalf("version after up = %d, %v; want %d", v, err, m.LatestVersion())
+		}
+		if _, err := m.Down(ctx, m.LatestVersion()); err != nil {
+			t.Fatalf("down: %v", err)
+		}
+		if v, err := m.CurrentVersion(ctx); err != nil || v != 0 {
+			t.Fatalf("version after down = %d, %v; want 0", v, err)
+		}
+	}
+}
+
+func TestSQLiteTenantLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLiteTestStore(t)
+	key := createTestTenant(t, s, "acme", "acme.example.com", "*.acme.example.com")
+	createTestTenant(t, s, "globex", "globex.example.com")
+
+	for host, want := range map[string]string{
+		"acme.example.com":     "acme",
+		"ACME.example.com:443": "acme",
+		"www.acme.example.com": "acme",
+		"globex.example.com":   "globex",
+	} {
+		tenant, err := s.GetByHost(ctx, host)
+		if err != nil || tenant.TenantID != want {
+			t.Errorf("GetByHost(%q) = %v, %v; want %s", host, tenant, err, want)
+		}
+	}
+	if _, err := s.CreateTenant(ctx, &CreateTenantRequest{
+		TenantID: "initech",
+		Hosts:    []string{"Acme.Example.com"},
+		LRS:      LRSConfigRequest{Endpoint: "https://lrs.example.com/", Username: "u", Password: "p"},
+		Auth:     AuthConfigRequest{JWTSecret: "initech-secret-with-at-least-32-bytes", JWTTTLSeconds: 60},
+	}); err == nil {
+		t.Error("CreateTenant with another tenant's host succeeded")
+	}
+
+	tenant, err := s.GetByID(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tenant.LRSPassword != "acme-password" || tenant.Status != TenantStatusActive {
+		t.Errorf("GetByID = %+v", tenant)
+	}
+	if _, err := tenant.LookupAPIKey(key); err != nil {
+		t.Errorf("LookupAPIKey(created key): %v", err)
+	}
+	if _, err := tenant.LookupAPIKey(key + "x"); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Errorf("LookupAPIKey(wrong key) error = %v, want ErrAPIKeyInvalid", err)
+	}
+
+	hosts := []string{"acme.example.org"}
+	password := "rotated"
+	if err := s.UpdateTenant(ctx, "acme", &UpdateTenantRequest{
+		Hosts: &hosts,
+		LRS:   &LRSConfigUpdate{Password: &password},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetByHost(ctx, "acme.example.com"); err == nil {
+		t.Error("replaced host still resolves")
+	}
+	tenant, err = s.GetByHost(ctx, "acme.example.org")
+	if err != nil || tenant.LRSPassword != "rotated" || tenant.LRSUsername != "acme" {
+		t.Errorf("GetByHost after update = %+v, %v", tenant, err)
+	}
+
+	if err := s.SuspendTenant(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SuspendTenant(ctx, "acme"); !errors.Is(err, ErrTenantStatusConflict) {
+		t.Errorf("second SuspendTenant error = %v, want ErrTenantStatusConflict", err)
+	}
+	if tenant, err = s.GetByID(ctx, "acme"); err != nil || tenant.CheckStatus() == nil {
+		t.Errorf("suspended tenant = %+v, %v; want a status error", tenant, err)
+	}
+	if err := s.ResumeTenant(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteTenant(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateTenant(ctx, "acme", &UpdateTenantRequest{LRS: &LRSConfigUpdate{Password: &password}}); !errors.Is(err, ErrTenantNotFound) {
+		t.Errorf("UpdateTenant(deleted) error = %v, want ErrTenantNotFound", err)
+	}
+	ids, err := s.ListTenants(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "globex" {
+		t.Errorf("ListTenants = %q, want [globex]", ids)
+	}
+}
+
+func TestSQLiteAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLiteTestStore(t)
+	createTestTenant(t, s, "acme", "acme.example.com")
+
+	created, err := s.CreateAPIKey(ctx, "acme", &LMSAPIKeyRequest{
+		Description:       "lms",
+		MaxReadPermission: "actor-course-registration-scoped",
+		AllowedCourseIDs:  []string{"course-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if APIKeyPrefixOf(created.Key) != created.Prefix {
+		t.Errorf("key %q does not start with prefix %q", created.Key, created.Prefix)
+	}
+
+	keys, err := s.ListAPIKeys(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("ListAPIKeys returned %d keys, want 2", len(keys))
+	}
+
+	tenant, err := s.GetByID(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := tenant.LookupAPIKey(created.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.MaxReadPermission != "actor-course-registration-scoped" || len(k.AllowedCourseIDs) != 1 {
+		t.Errorf("key limits = %+v", k)
+	}
+
+	rotated, err := s.RotateAPIKey(ctx, "acme", created.Prefix, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Description != "lms" || rotated.MaxReadPermission != "actor-course-registration-scoped" {
+		t.Errorf("rotated key = %+v, want the old description and limits", rotated.APIKeyInfo)
+	}
+	if tenant, err = s.GetByID(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tenant.LookupAPIKey(created.Key); err == nil {
+		t.Error("rotated key without grace period still works")
+	}
+	if _, err := tenant.LookupAPIKey(rotated.Key); err != nil {
+		t.Errorf("LookupAPIKey(new key): %v", err)
+	}
+
+	if err := s.RevokeAPIKey(ctx, "acme", rotated.Prefix); err != nil {
+		t.Fatal(err)
+	}
+	if tenant, err = s.GetByID(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tenant.LookupAPIKey(rotated.Key); err == nil {
+		t.Error("revoked key still works")
+	}
+	if err := s.RevokeAPIKey(ctx, "globex", rotated.Prefix); err == nil {
+		t.Error("RevokeAPIKey for another tenant succeeded")
+	}
+}
+
+func TestSQLiteRefreshSecretRefs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newSQLiteTestStore(t)
+	s.ResolveSecretRefs([]string{"file"})
+
+	secretFile := filepath.Join(t.TempDir(), "lrs-password")
+	if err := os.WriteFile(secretFile, []byte("first"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	createTestTenant(t, s, "acme", "acme.example.com")
+	ref := "file://" + secretFile
+	if err := s.UpdateTenant(ctx, "acme", &UpdateTenantRequest{LRS: &LRSConfigUpdate{Password: &ref}}); err != nil {
+		t.Fatal(err)
+	}
+	createTestTenant(t, s, "globex", "globex.example.com")
+
+	var mu sync.Mutex
+	var evicted []string
+	s.OnInvalidate(func(tenantID string) {
+		mu.Lock()
+		defer mu.Unlock()
+		evicted = append(evicted, tenantID)
+	})
+	for _, host := range []string{"acme.example.com", "globex.example.com"} {
+		if _, err := s.GetByHost(ctx, host); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tenant, _ := s.GetByHost(ctx, "acme.example.com"); tenant.LRSPassword != "first" {
+		t.Fatalf("LRSPassword = %q, want the referenced file's contents", tenant.LRSPassword)
+	}
+
+	if err := os.WriteFile(secretFile, []byte("second"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	go s.RefreshSecretRefs(ctx, 10*time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tenant, err := s.GetByHost(ctx, "acme.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tenant.LRSPassword == "second" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("rotated secret was not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, tenantID := range evicted {
+		if tenantID != "acme" {
+			t.Errorf("evicted %q, which uses no references", tenantID)
+		}
+	}
+}
+
+func TestSQLiteApprovals(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLiteTestStore(t)
+	createTestTenant(t, s, "acme", "acme.example.com")
+	createTestTenant(t, s, "globex", "globex.example.com")
+
+	approval, err := s.RequestApproval(ctx, "acme", &ApprovalRequest{
+		CourseID:        "course-1",
+		AUID:            "au-1",
+		PermissionType:  PermissionTypeStatementsRead,
+		PermissionScope: "actor-course-registration-scoped",
+		Justification:   "instructor dashboard",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved, err := s.IsApproved(ctx, "acme", "course-1", "au-1", PermissionTypeStatementsRead, "actor-course-registration-scoped"); err != nil || approved {
+		t.Errorf("IsApproved before approval = %v, %v; want false", approved, err)
+	}
+
+	if _, err := s.ApproveApproval(ctx, "globex", approval.ID, "mallory@example.com"); !errors.Is(err, ErrApprovalNotFound) {
+		t.Errorf("ApproveApproval for another tenant error = %v, want ErrApprovalNotFound", err)
+	}
+	approval, err = s.ApproveApproval(ctx, "acme", approval.ID, "alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approval.Approved || approval.ApprovedBy != "alice@example.com" || approval.ApprovedAt == nil {
+		t.Errorf("approved = %+v, want approved by alice@example.com", approval)
+	}
+	approvalCases(t, s, "acme")
+
+	approval, err = s.RevokeApproval(ctx, "acme", approval.ID, "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approval.Revoked || approval.RevokedBy != "bob@example.com" || approval.RevokedAt == nil || approval.ApprovedBy != "alice@example.com" {
+		t.Errorf("revoked = %+v, want revoked by bob@example.com", approval)
+	}
+	if approved, err := s.IsApproved(ctx, "acme", "course-1", "au-1", PermissionTypeStatementsRead, "actor-course-registration-scoped"); err != nil || approved {
+		t.Errorf("IsApproved after revocation = %v, %v; want false", approved, err)
+	}
+	if _, err := s.ApproveApproval(ctx, "acme", approval.ID, "alice@example.com"); !errors.Is(err, ErrApprovalNotFound) {
+		t.Errorf("approving a revoked approval error = %v, want ErrApprovalNotFound", err)
+	}
+
+	// Requesting again starts a new decision
+	again, err := s.RequestApproval(ctx, "acme", &ApprovalRequest{
+		CourseID:        "course-1",
+		AUID:            "au-1",
+		PermissionType:  PermissionTypeStatementsRead,
+		PermissionScope: "actor-course-registration-scoped",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Approved || again.Revoked || again.ApprovedBy != "" {
+		t.Errorf("re-requested approval = %+v, want pending", again)
+	}
+	if _, err := s.ApproveApproval(ctx, "acme", again.ID, "alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	approvalCases(t, s, "acme")
+}
+
+// rawColumn reads a tenant's stored column value
+func rawColumn(t *testing.T, s *DatabaseTenantStore, table, column, tenantID string) string {
+	t.Helper()
+	var value string
+	err := s.db.QueryRowContext(context.Background(),
+		"SELECT "+column+" FROM "+table+" WHERE tenant_id = $1", tenantID).Scan(&value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// setRawColumn overwrites a tenant's stored column value
+func setRawColumn(t *testing.T, s *DatabaseTenantStore, table, column, tenantID, value string) {
+	t.Helper()
+	_, err := s.db.ExecContext(context.Background(),
+		"UPDATE "+table+" SET "+column+" = $2 WHERE tenant_id = $1", tenantID, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkTenantSecrets checks that a tenant's secrets decrypt to the values
+// createTestTenant stored
+func checkTenantSecrets(t *testing.T, s *DatabaseTenantStore, tenantID string) {
+	t.Helper()
+	snapshot, err := s.loadSnapshot(context.Background(), tenantID)
+	if err != nil {
+		t.Fatalf("loading %s: %v", tenantID, err)
+	}
+	if snapshot.LRSPassword != tenantID+"-password" || snapshot.JWTSecret != tenantID+"-secret-with-at-least-32-bytes" {
+		t.Errorf("%s secrets = %q, %q", tenantID, snapshot.LRSPassword, snapshot.JWTSecret)
+	}
+}
+
+func TestSQLiteSecretEncryption(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLiteTestStore(t)
+	oldKey := newTestMasterKey(t)
+	s.EnableEncryption(NewKeyring(oldKey))
+	createTestTenant(t, s, "acme")
+	createTestTenant(t, s, "globex")
+
+	password := rawColumn(t, s, "tenant_lrs_config", "password", "acme")
+	jwtSecret := rawColumn(t, s, "tenant_auth_config", "jwt_secret", "acme")
+	for _, value := range []string{password, jwtSecret} {
+		if !strings.HasPrefix(value, encryptedSecretPrefix) || strings.Contains(value, "acme-") {
+			t.Errorf("stored secret = %q, want it encrypted", value)
+		}
+	}
+	checkTenantSecrets(t, s, "acme")
+
+	// A ciphertext only decrypts in the row and column it was written for
+	setRawColumn(t, s, "tenant_auth_config", "jwt_secret", "acme", password)
+	if _, err := s.loadSnapshot(ctx, "acme"); err == nil {
+		t.Error("password ciphertext decrypted as the JWT secret")
+	}
+	setRawColumn(t, s, "tenant_auth_config", "jwt_secret", "acme", jwtSecret)
+	globexPassword := rawColumn(t, s, "tenant_lrs_config", "password", "globex")
+	setRawColumn(t, s, "tenant_lrs_config", "password", "globex", password)
+	if _, err := s.loadSnapshot(ctx, "globex"); err == nil {
+		t.Error("acme's password decrypted for globex")
+	}
+	setRawColumn(t, s, "tenant_lrs_config", "password", "globex", globexPassword)
+	checkTenantSecrets(t, s, "globex")
+
+	// Secrets written before rotation stay readable with the old key kept
+	// as a previous key, and new tenants use the new key
+	newKey := newTestMasterKey(t)
+	s.EnableEncryption(NewKeyring(newKey, oldKey))
+	checkTenantSecrets(t, s, "acme")
+	createTestTenant(t, s, "initech")
+	if id := rawColumn(t, s, "tenant_data_keys", "master_key_id", "initech"); id != newKey.ID() {
+		t.Errorf("new data key wrapped by %s, want %s", id, newKey.ID())
+	}
+	checkTenantSecrets(t, s, "initech")
+
+	s.EnableEncryption(NewKeyring(newKey))
+	if _, err := s.loadSnapshot(ctx, "acme"); err == nil {
+		t.Error("data key wrapped by a dropped master key was unwrapped")
+	}
+	s.secrets = nil
+	if _, err := s.loadSnapshot(ctx, "acme"); !errors.Is(err, ErrNoMasterKey) {
+		t.Errorf("loading without a master key = %v, want ErrNoMasterKey", err)
+	}
+}
+
+func TestSQLiteReencryptSecrets(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLiteTestStore(t)
+	createTestTenant(t, s, "legacy")
+	if _, err := s.ReencryptSecrets(ctx); !errors.Is(err, ErrNoMasterKey) {
+		t.Errorf("ReencryptSecrets without a master key = %v, want ErrNoMasterKey", err)
+	}
+
+	oldKey, newKey := newTestMasterKey(t), newTestMasterKey(t)
+	s.EnableEncryption(NewKeyring(oldKey))
+	createTestTenant(t, s, "acme")
+	s.EnableEncryption(NewKeyring(newKey, oldKey))
+
+	// acme's data key is rewrapped and legacy's cleartext secrets encrypted
+	result, err := s.ReencryptSecrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *result != (ReencryptResult{Tenants: 2, Rewrapped: 1, Encrypted: 2}) {
+		t.Errorf("first run = %+v", result)
+	}
+	for _, tenantID := range []string{"acme", "legacy"} {
+		if id := rawColumn(t, s, "tenant_data_keys", "master_key_id", tenantID); id != newKey.ID() {
+			t.Errorf("%s data key wrapped by %s, want %s", tenantID, id, newKey.ID())
+		}
+		if value := rawColumn(t, s, "tenant_lrs_config", "password", tenantID); !strings.HasPrefix(value, encryptedSecretPrefix) {
+			t.Errorf("%s password = %q, want it encrypted", tenantID, value)
+		}
+	}
+
+	// The old key is no longer needed
+	s.EnableEncryption(NewKeyring(newKey))
+	checkTenantSecrets(t, s, "acme")
+	checkTenantSecrets(t, s, "legacy")
+
+	// A repeated run finds nothing to do and changes no stored value
+	before := rawColumn(t, s, "tenant_data_keys", "wrapped_key", "acme") + rawColumn(t, s, "tenant_lrs_config", "password", "legacy")
+	result, err = s.ReencryptSecrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *result != (ReencryptResult{Tenants: 2}) {
+		t.Errorf("repeated run = %+v, want no changes", result)
+	}
+	if after := rawColumn(t, s, "tenant_data_keys", "wrapped_key", "acme") + rawColumn(t, s, "tenant_lrs_config", "password", "legacy"); after != before {
+		t.Error("repeated run changed stored values")
+	}
+}
+
+func TestSQLiteTenantCacheByID(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLiteTestStore(t)
+	createTestTenant(t, s, "acme", "acme.example.com")
+
+	first, err := s.GetByID(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.GetByID(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Error("second GetByID reloaded the tenant")
+	}
+	// Host lookups share the config, so per-key state like the last
+	// last_used_at update survives switching resolvers
+	byHost, err := s.GetByHost(ctx, "acme.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byHost != first {
+		t.Error("GetByHost loaded another copy of the tenant")
+	}
+	if stats := s.CacheStats(); stats.Entries != 2 || stats.Hits != 2 {
+		t.Errorf("cache stats = %+v, want 2 entries and 2 hits", stats)
+	}
+
+	// Changes evict the tenant from both caches
+	endpoint := "https://lrs2.example.com/xapi/"
+	if err := s.UpdateTenant(ctx, "acme", &UpdateTenantRequest{LRS: &LRSConfigUpdate{Endpoint: &endpoint}}); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := s.GetByID(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated == first || updated.LRSEndpoint != endpoint {
+		t.Errorf("GetByID after update = %s, want the new endpoint", updated.LRSEndpoint)
+	}
+	if byHost, _ := s.GetByHost(ctx, "acme.example.com"); byHost != updated {
+		t.Error("GetByHost after update served a stale tenant")
+	}
+
+	if err := s.SuspendTenant(ctx, "acme"); err != nil {
+		t.Fatal(err)
+	}
+	if suspended, _ := s.GetByID(ctx, "acme"); suspended.Status != TenantStatusSuspended {
+		t.Errorf("status after suspend = %s", suspended.Status)
+	}
+
+	// Expired entries are reloaded
+	s.cacheTTL = -time.Second
+	s.invalidateTenant("acme")
+	cached, _ := s.GetByID(ctx, "acme")
+	if reloaded, _ := s.GetByID(ctx, "acme"); reloaded == cached {
+		t.Error("expired entry was served")
+	}
+}
+
+func TestSQLiteAuditChain(t *testing.T) {
+	ctx := context.Background()
+	s := newSQLiteTestStore(t)
+	createTestTenant(t, s, "acme")
+	auditLog := &AuditLog{db: s.db}
+
+	// Timestamps finer than the database keeps, zones other than UTC and
+	// IP spellings the database normalizes must still verify once read back
+	at := time.Date(2026, 10, 1, 14, 0, 0, 123456789, time.FixedZone("CEST", 2*60*60))
+	write := func(events ...*audit.Event) {
+		t.Helper()
+		if err := s.WriteAuditEvents(ctx, events); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(
+		&audit.Event{TenantID: "acme", Timestamp: at, Operation: audit.OpTokenIssue, Success: true, IPAddress: "::ffff:192.0.2.1"},
+		&audit.Event{TenantID: "acme", Timestamp: at, Operation: audit.OpStatementsRead, Success: true, IPAddress: "2001:DB8::1"},
+		&audit.Event{TenantID: "unknown", Timestamp: at, Operation: audit.OpAuthenticate, Reason: "Tenant not found"},
+	)
+	// A later batch continues the chain
+	write(&audit.Event{TenantID: "acme", Timestamp: at.Add(time.Second), Operation: audit.OpStatementsWrite, Success: true, UserAgent: "cmi5/1.0"})
+
+	verify := func(chainID string, checkpoints []*audit.Checkpoint) (*audit.ChainVerifier, error) {
+		v := audit.NewChainVerifier(true)
+		for _, cp := range checkpoints {
+			v.Watch(cp.AuditID)
+		}
+		return v, auditLog.WalkChain(ctx, chainID, v.Add)
+	}
+	chains, err := auditLog.Chains(ctx)
+	if err != nil || len(chains) != 2 || chains[0] != "" || chains[1] != "acme" {
+		t.Fatalf("chains = %v, %v; want the tenantless chain and acme", chains, err)
+	}
+	v, err := verify("acme", nil)
+	if err != nil || v.Verified != 3 {
+		t.Fatalf("acme chain verified %d records: %v", v.Verified, err)
+	}
+	if v, err := verify("", nil); err != nil || v.Verified != 1 {
+		t.Errorf("tenantless chain verified %d records: %v", v.Verified, err)
+	}
+
+	// Checkpoints sign each chain head once and verify after a round trip
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, err := s.WriteAuditCheckpoints(ctx, key)
+	if err != nil || len(written) != 2 {
+		t.Fatalf("WriteAuditCheckpoints = %d, %v; want one per chain", len(written), err)
+	}
+	if again, err := s.WriteAuditCheckpoints(ctx, key); err != nil || len(again) != 0 {
+		t.Errorf("second WriteAuditCheckpoints = %d, %v; want none for unchanged chains", len(again), err)
+	}
+	checkpoints, err := auditLog.Checkpoints(ctx, "acme")
+	if err != nil || len(checkpoints) != 1 {
+		t.Fatalf("acme checkpoints = %d, %v", len(checkpoints), err)
+	}
+	cp := checkpoints[0]
+	if !cp.Verify(key.Public().(ed25519.PublicKey)) {
+		t.Error("stored checkpoint signature does not verify")
+	}
+	v, err = verify("acme", checkpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, ok := v.Hash(cp.AuditID); !ok || hash != cp.Hash {
+		t.Errorf("checkpointed hash = %q, %v; want %s", hash, ok, cp.Hash)
+	}
+
+	// Altering a stored field breaks the chain at that record
+	var firstID int64
+	if err := s.db.QueryRowContext(ctx, `SELECT MIN(id) FROM audit_log WHERE chain_id = 'acme'`).Scan(&firstID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE audit_log SET success = false WHERE id = $1`, firstID); err != nil {
+		t.Fatal(err)
+	}
+	var chainBreak *audit.ChainBreak
+	if _, err := verify("acme", nil); !errors.As(err, &chainBreak) || chainBreak.ID != firstID {
+		t.Errorf("tampered chain = %v, want a break at record %d", err, firstID)
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE audit_log SET success = true WHERE id = $1`, firstID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting the checkpointed head leaves a valid chain, which only the
+	// checkpoint shows was truncated
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM audit_log WHERE id = $1`, cp.AuditID); err != nil {
+		t.Fatal(err)
+	}
+	v, err = verify("acme", checkpoints)
+	if err != nil {
+		t.Fatalf("truncated chain: %v", err)
+	}
+	if _, ok := v.Hash(cp.AuditID); ok {
+		t.Error("deleted checkpointed record was seen")
+	}
+}
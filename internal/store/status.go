@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Tenant statuses (tenants.status)
+const (
+	TenantStatusActive    = "active"
+	TenantStatusSuspended = "suspended"
+	TenantStatusDeleted   = "deleted"
+)
+
+var (
+	// ErrTenantSuspended is returned for requests to a suspended tenant
+	ErrTenantSuspended = errors.New("tenant suspended")
+	// ErrTenantDeleted is returned for requests to a deleted tenant
+	ErrTenantDeleted = errors.New("tenant deleted")
+	// ErrTenantStatusConflict is returned when a status change does not
+	// apply to the tenant's current status
+	ErrTenantStatusConflict = errors.New("tenant status conflict")
+)
+
+// CheckStatus returns an error unless the tenant may serve requests
+func (t *TenantConfig) CheckStatus() error {
+	switch t.Status {
+	case TenantStatusActive:
+		return nil
+	case TenantStatusSuspended:
+		return ErrTenantSuspended
+	case TenantStatusDeleted:
+		return ErrTenantDeleted
+	}
+	return fmt.Errorf("unknown tenant status: %q", t.Status)
+}
+
+// SuspendTenant stops an active tenant from serving requests, including
+// requests carrying tokens issued before the suspension
+func (s *DatabaseTenantStore) SuspendTenant(ctx context.Context, tenantID string) error {
+	return s.setTenantStatus(ctx, tenantID, TenantStatusActive, TenantStatusSuspended)
+}
+
+// ResumeTenant reactivates a suspended tenant
+func (s *DatabaseTenantStore) ResumeTenant(ctx context.Context, tenantID string) error {
+	return s.setTenantStatus(ctx, tenantID, TenantStatusSuspended, TenantStatusActive)
+}
+
+// setTenantStatus moves a tenant from one status to another
+func (s *DatabaseTenantStore) setTenantStatus(ctx context.Context, tenantID, from, to string) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE tenants SET status = $3 WHERE tenant_id = $1 AND status = $2
+	`, tenantID, from, to)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		var status string
+		err := s.db.QueryRowContext(ctx, `SELECT status FROM tenants WHERE tenant_id = $1`, tenantID).Scan(&status)
+		if err == sql.ErrNoRows || status == TenantStatusDeleted {
+			return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: tenant %s is %s, not %s", ErrTenantStatusConflict, tenantID, status, from)
+	}
+
+	s.invalidateTenant(tenantID)
+
+	log.WithFields(log.Fields{
+		"tenant_id": tenantID,
+		"status":    to,
+	}).Info("Tenant status changed")
+
+	return nil
+}
@@ -5,25 +5,38 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"os"
+	"strings"
 	"sync"
+	"time"
 
 	_ "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/config"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
 )
 
 // TenantConfig represents a tenant's configuration
 type TenantConfig struct {
-	TenantID         string
-	Hosts            []string
-	LRSEndpoint      string
-	LRSUsername      string
-	LRSPassword      string
-	JWTSecret        []byte
-	JWTTTLSeconds    int
-	LMSAPIKeys       map[string]bool // API key -> enabled
-	PermissionPolicy string          // "strict" or "permissive"
+	TenantID             string
+	Status               string // TenantStatusActive, TenantStatusSuspended or TenantStatusDeleted
+	Hosts                []string
+	LRSEndpoint          string
+	LRSUsername          string
+	LRSPassword          string
+	JWTSecret            []byte
+	JWTTTLSeconds        int
+	LMSAPIKeys           map[string][]*LMSAPIKey // key prefix -> hashed keys
+	PermissionPolicy     string                  // "strict" or "permissive"
+	OAuthTokenTTLSeconds int
+	OAuthClients         map[string]*OAuthClient         // client ID -> client
+	TokenExchangeIssuers map[string]*TokenExchangeIssuer // issuer -> trusted IdP
+	LTIPlatforms         map[string]*LTIPlatform         // issuer -> LTI 1.3 platform
+	RateLimits           RateLimits
+	Quotas               Quotas // Monthly usage quotas
+
+	snapshot *TenantSnapshot // Stored form, if loaded from a store
 }
 
 // TenantStore provides access to tenant configurations
@@ -32,10 +45,16 @@ type TenantStore interface {
 	GetByID(ctx context.Context, tenantID string) (*TenantConfig, error)
 }
 
+// TenantLister is implemented by multi-tenant stores
+type TenantLister interface {
+	ListTenants(ctx context.Context) ([]string, error)
+}
+
 // SingleTenantStore implements TenantStore for single-tenant deployments
 type SingleTenantStore struct {
-	config *TenantConfig
-	mu     sync.RWMutex
+	config    *TenantConfig
+	approvals []*ApprovalRequest
+	mu        sync.RWMutex
 }
 
 // NewSingleTenantStore creates a single-tenant store from configuration
@@ -44,26 +63,138 @@ func NewSingleTenantStore(cfg *config.Config) (*SingleTenantStore, error) {
 		return nil, err
 	}
 
-	apiKeys := make(map[string]bool)
-	for _, key := range cfg.Auth.LMSAPIKeys {
-		apiKeys[key] = true
+	tenantCfg, approvals, err := buildTenantConfig("default", cfg.LRS, cfg.Auth, cfg.LTI, cfg.RateLimits, cfg.Quotas)
+	if err != nil {
+		return nil, err
+	}
+	tenantCfg.Hosts = []string{"*"} // Accept any host
+
+	return &SingleTenantStore{
+		config:    tenantCfg,
+		approvals: approvals,
+	}, nil
+}
+
+// buildTenantConfig builds a tenant and its configured approvals from the
+// YAML configuration shared by single-tenant mode and tenant files
+func buildTenantConfig(tenantID string, lrs config.LRSConfig, auth config.AuthConfig, lti config.LTIConfig,
+	rateLimits config.RateLimitsConfig, quotaCfg config.QuotasConfig) (*TenantConfig, []*ApprovalRequest, error) {
+	apiKeys := make(map[string][]*LMSAPIKey)
+	for i, k := range auth.LMSAPIKeys {
+		if k.Key == "" {
+			return nil, nil, fmt.Errorf("lms_api_keys[%d]: key is required", i)
+		}
+		key, err := NewLMSAPIKey(k.MaxReadPermission, k.MaxWritePermission, k.AllowedCourseIDs, k.AllowedActivityPrefixes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("lms_api_keys[%d]: %w", i, err)
+		}
+		// Only the salted hash is kept in memory
+		if err := key.SetSecret(k.Key); err != nil {
+			return nil, nil, fmt.Errorf("lms_api_keys[%d]: %w", i, err)
+		}
+		if k.ExpiresAt != nil {
+			key.ExpiresAt = k.ExpiresAt
+		}
+		apiKeys[key.Prefix] = append(apiKeys[key.Prefix], key)
+	}
+
+	oauthClients := make(map[string]*OAuthClient)
+	for _, c := range auth.OAuthClients {
+		var publicKeyPEM string
+		if c.PublicKeyFile != "" {
+			data, err := os.ReadFile(c.PublicKeyFile)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to read public key for client %s: %w", c.ClientID, err)
+			}
+			publicKeyPEM = string(data)
+		}
+		client, err := NewOAuthClient(c.ClientID, c.ClientSecret, publicKeyPEM, c.Scopes)
+		if err != nil {
+			return nil, nil, err
+		}
+		oauthClients[client.ClientID] = client
+	}
+
+	exchangeIssuers := make(map[string]*TokenExchangeIssuer)
+	for _, i := range auth.TokenExchange.Issuers {
+		issuer, err := NewTokenExchangeIssuer(i.Issuer, i.Audience, i.JWKSFile, i.ClaimMappings,
+			i.AccountHomePage, i.MaxReadPermission, i.MaxWritePermission)
+		if err != nil {
+			return nil, nil, err
+		}
+		exchangeIssuers[issuer.Issuer] = issuer
+	}
+
+	ltiPlatforms := make(map[string]*LTIPlatform)
+	for _, p := range lti.Platforms {
+		platform, err := NewLTIPlatform(p.Issuer, p.ClientID, p.DeploymentIDs, p.AuthLoginURL, p.JWKSFile,
+			p.ContentURLPrefixes, models.Permissions{Write: p.WritePermission, Read: p.ReadPermission})
+		if err != nil {
+			return nil, nil, err
+		}
+		ltiPlatforms[platform.Issuer] = platform
+	}
+
+	limits, err := rateLimitsFromConfig(rateLimits)
+	if err != nil {
+		return nil, nil, err
+	}
+	quotas, err := quotasFromConfig(quotaCfg)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	tenantCfg := &TenantConfig{
-		TenantID:         "default",
-		Hosts:            []string{"*"}, // Accept any host
-		LRSEndpoint:      cfg.LRS.Endpoint,
-		LRSUsername:      cfg.LRS.Username,
-		LRSPassword:      cfg.LRS.Password,
-		JWTSecret:        []byte(cfg.Auth.JWTSecret),
-		JWTTTLSeconds:    cfg.Auth.JWTTTLSeconds,
-		LMSAPIKeys:       apiKeys,
-		PermissionPolicy: cfg.Auth.PermissionPolicy,
+		TenantID:             tenantID,
+		Status:               TenantStatusActive,
+		LRSEndpoint:          lrs.Endpoint,
+		LRSUsername:          lrs.Username,
+		LRSPassword:          lrs.Password,
+		JWTSecret:            []byte(auth.JWTSecret),
+		JWTTTLSeconds:        auth.JWTTTLSeconds,
+		LMSAPIKeys:           apiKeys,
+		PermissionPolicy:     auth.PermissionPolicy,
+		OAuthTokenTTLSeconds: auth.OAuthTokenTTLSeconds,
+		OAuthClients:         oauthClients,
+		TokenExchangeIssuers: exchangeIssuers,
+		LTIPlatforms:         ltiPlatforms,
+		RateLimits:           limits,
+		Quotas:               quotas,
 	}
 
-	return &SingleTenantStore{
-		config: tenantCfg,
-	}, nil
+	var approvals []*ApprovalRequest
+	for i, a := range auth.PermissionApprovals {
+		approval := &ApprovalRequest{
+			CourseID:        a.CourseID,
+			AUID:            a.AUID,
+			PermissionType:  a.PermissionType,
+			PermissionScope: a.PermissionScope,
+		}
+		if err := approval.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("permission_approvals[%d]: %w", i, err)
+		}
+		if a.ApprovedBy == "" {
+			return nil, nil, fmt.Errorf("permission_approvals[%d]: approved_by is required", i)
+		}
+		approvals = append(approvals, approval)
+	}
+
+	return tenantCfg, approvals, nil
+}
+
+// Reload replaces the tenant config, e.g. after secrets were refreshed.
+// Runtime approvals are kept.
+func (s *SingleTenantStore) Reload(cfg *config.Config) error {
+	reloaded, err := NewSingleTenantStore(cfg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.config = reloaded.config
+	s.mu.Unlock()
+
+	log.Info("Tenant configuration reloaded")
+	return nil
 }
 
 // GetByHost returns the single tenant config (ignores host)
@@ -82,65 +213,122 @@ func (s *SingleTenantStore) GetByID(ctx context.Context, tenantID string) (*Tena
 
 // DatabaseTenantStore implements TenantStore using PostgreSQL
 type DatabaseTenantStore struct {
-	db *sql.DB
+	db *sqlDB
 	mu sync.RWMutex
-	// In-memory cache (optional - could use Redis)
-	cache map[string]*TenantConfig
+	// In-memory caches by host and by tenant ID, kept coherent across
+	// replicas by LISTEN/NOTIFY
+	cache    map[string]*cacheEntry
+	byID     map[string]*cacheEntry
+	cacheTTL time.Duration
+	stats    cacheCounters
+	stop     chan struct{}
+	// Called after a tenant ("" for all tenants) is evicted
+	onInvalidate []func(tenantID string)
+	// Encrypts secret columns; nil stores them in cleartext
+	secrets *secretCipher
+	// Secret reference schemes resolved in tenant rows
+	secretSchemes map[string]bool
+	// Tenants loaded with resolved secret references, guarded by mu
+	refTenants map[string]bool
 }
 
-// NewDatabaseTenantStore creates a database-backed tenant store
-func NewDatabaseTenantStore(connStr string) (*DatabaseTenantStore, error) {
-	db, err := sql.Open("postgres", connStr)
+// NewDatabaseTenantStore creates a database-backed tenant store. connStr is
+// a PostgreSQL connection string, or sqlite:///path for an embedded SQLite
+// database.
+func NewDatabaseTenantStore(connStr string, opts CacheOptions) (*DatabaseTenantStore, error) {
+	db, err := openDatabase(connStr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+	log.Info("Connected to tenant database")
+
+	if err := checkSchema(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	log.Info("Connected to tenant database")
+	opts.setDefaults()
+	s := &DatabaseTenantStore{
+		db:         db,
+		cache:      make(map[string]*cacheEntry),
+		byID:       make(map[string]*cacheEntry),
+		cacheTTL:   opts.TTL,
+		refTenants: make(map[string]bool),
+		stop:       make(chan struct{}),
+	}
+	// A SQLite database has a single writer, this process, so there are no
+	// changes from other replicas to watch for
+	if db.dialect == dialectPostgres {
+		go s.watchChanges(connStr, opts.RefreshInterval)
+	}
 
-	return &DatabaseTenantStore{
-		db:    db,
-		cache: make(map[string]*TenantConfig),
-	}, nil
+	return s, nil
 }
 
-// GetByHost looks up tenant by host header
+// GetByHost looks up tenant by host header, preferring an exact host
+// mapping over the longest matching wildcard
 func (s *DatabaseTenantStore) GetByHost(ctx context.Context, host string) (*TenantConfig, error) {
+	host, err := NormalizeHost(host)
+	if err != nil {
+		return nil, fmt.Errorf("tenant not found for host: %w", err)
+	}
+
 	// Check cache first
-	s.mu.RLock()
-	if cached, ok := s.cache[host]; ok {
-		s.mu.RUnlock()
+	if cached, ok := s.cached(host); ok {
 		return cached, nil
 	}
-	s.mu.RUnlock()
 
-	// Query database
-	var tenantID string
-	err := s.db.QueryRowContext(ctx, `
-		SELECT tenant_id 
-		FROM tenant_hosts 
-		WHERE host = $1
-	`, host).Scan(&tenantID)
-
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("tenant not found for host: %s", host)
+	// Query database: every candidate is a lookup in the host index
+	candidates := hostCandidates(host)
+	placeholders := make([]string, len(candidates))
+	args := make([]interface{}, len(candidates))
+	for i, candidate := range candidates {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = candidate
 	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT host, tenant_id
+		FROM tenant_hosts
+		WHERE host IN (`+strings.Join(placeholders, ", ")+`)
+	`, args...)
 	if err != nil {
 		return nil, fmt.Errorf("database error: %w", err)
 	}
+	matches := make(map[string]string)
+	for rows.Next() {
+		var mapped, tenantID string
+		if err := rows.Scan(&mapped, &tenantID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		matches[mapped] = tenantID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
 
-	// Load full tenant config
-	config, err := s.loadTenantConfig(ctx, tenantID)
+	var tenantID string
+	for _, candidate := range candidates {
+		if id, ok := matches[candidate]; ok {
+			tenantID = id
+			break
+		}
+	}
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant not found for host: %s", host)
+	}
+
+	// Load full tenant config, sharing the entry cached by ID
+	config, err := s.GetByID(ctx, tenantID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Cache it
 	s.mu.Lock()
-	s.cache[host] = config
+	s.cache[host] = &cacheEntry{config: config, expires: time.Now().Add(s.cacheTTL)}
 	s.mu.Unlock()
 
 	return config, nil
@@ -148,40 +336,75 @@ func (s *DatabaseTenantStore) GetByHost(ctx context.Context, host string) (*Tena
 
 // GetByID looks up tenant by ID
 func (s *DatabaseTenantStore) GetByID(ctx context.Context, tenantID string) (*TenantConfig, error) {
-	return s.loadTenantConfig(ctx, tenantID)
+	if cached, ok := s.cachedByID(tenantID); ok {
+		return cached, nil
+	}
+
+	config, err := s.loadTenantConfig(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.byID[tenantID] = &cacheEntry{config: config, expires: time.Now().Add(s.cacheTTL)}
+	s.mu.Unlock()
+
+	return config, nil
 }
 
 // loadTenantConfig loads complete tenant configuration from database
 func (s *DatabaseTenantStore) loadTenantConfig(ctx context.Context, tenantID string) (*TenantConfig, error) {
-	config := &TenantConfig{
-		TenantID:   tenantID,
-		LMSAPIKeys: make(map[string]bool),
+	snapshot, err := s.loadSnapshot(ctx, tenantID)
+	if err != nil {
+		return nil, err
 	}
+	return snapshot.Build(), nil
+}
+
+// loadSnapshot reads a tenant's rows from the database
+func (s *DatabaseTenantStore) loadSnapshot(ctx context.Context, tenantID string) (*TenantSnapshot, error) {
+	snapshot := &TenantSnapshot{TenantID: tenantID}
 
-	// Load LRS config
 	err := s.db.QueryRowContext(ctx, `
+		SELECT status FROM tenants WHERE tenant_id = $1
+	`, tenantID).Scan(&snapshot.Status)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenant: %w", err)
+	}
+
+	// Load LRS config
+	err = s.db.QueryRowContext(ctx, `
 		SELECT endpoint, username, password
 		FROM tenant_lrs_config
 		WHERE tenant_id = $1
-	`, tenantID).Scan(&config.LRSEndpoint, &config.LRSUsername, &config.LRSPassword)
+	`, tenantID).Scan(&snapshot.LRSEndpoint, &snapshot.LRSUsername, &snapshot.LRSPassword)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to load LRS config: %w", err)
 	}
 
 	// Load auth config
-	var jwtSecretStr string
 	err = s.db.QueryRowContext(ctx, `
-		SELECT jwt_secret, jwt_ttl_seconds, permission_policy
+		SELECT jwt_secret, jwt_ttl_seconds, permission_policy, oauth_token_ttl_seconds
 		FROM tenant_auth_config
 		WHERE tenant_id = $1
-	`, tenantID).Scan(&jwtSecretStr, &config.JWTTTLSeconds, &config.PermissionPolicy)
+	`, tenantID).Scan(&snapshot.JWTSecret, &snapshot.JWTTTLSeconds, &snapshot.PermissionPolicy, &snapshot.OAuthTokenTTLSeconds)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to load auth config: %w", err)
 	}
 
-	config.JWTSecret = []byte(jwtSecretStr)
+	snapshot.LRSPassword, err = s.readSecret(ctx, tenantID, "password", snapshot.LRSPassword)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.JWTSecret, err = s.readSecret(ctx, tenantID, "jwt_secret", snapshot.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
 
 	// Load hosts
 	rows, err := s.db.QueryContext(ctx, `
@@ -199,14 +422,17 @@ func (s *DatabaseTenantStore) loadTenantConfig(ctx context.Context, tenantID str
 		if err := rows.Scan(&host); err != nil {
 			return nil, err
 		}
-		config.Hosts = append(config.Hosts, host)
+		snapshot.Hosts = append(snapshot.Hosts, host)
 	}
 
 	// Load API keys
 	rows, err = s.db.QueryContext(ctx, `
-		SELECT api_key_hash
+		SELECT id, COALESCE(key_prefix, ''), salt, api_key_hash, expires_at,
+		       max_read_permission, max_write_permission,
+		       COALESCE(allowed_course_ids, ''), COALESCE(allowed_activity_prefixes, '')
 		FROM tenant_lms_api_keys
 		WHERE tenant_id = $1 AND revoked = false
+		  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
 	`, tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load API keys: %w", err)
@@ -214,21 +440,114 @@ func (s *DatabaseTenantStore) loadTenantConfig(ctx context.Context, tenantID str
 	defer rows.Close()
 
 	for rows.Next() {
-		var key string
-		if err := rows.Scan(&key); err != nil {
+		var k APIKeySnapshot
+		var courseIDs, activityPrefixes string
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Prefix, &k.Salt, &k.Hash, &expiresAt,
+			&k.MaxReadPermission, &k.MaxWritePermission, &courseIDs, &activityPrefixes); err != nil {
 			return nil, err
 		}
-		config.LMSAPIKeys[key] = true
+		k.ExpiresAt = nullTimePtr(expiresAt)
+		k.AllowedCourseIDs = strings.Fields(courseIDs)
+		k.AllowedActivityPrefixes = strings.Fields(activityPrefixes)
+		snapshot.APIKeys = append(snapshot.APIKeys, k)
 	}
 
-	return config, nil
+	// Load OAuth clients
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT client_id, client_secret_salt, COALESCE(client_secret_hash, ''), COALESCE(public_key_pem, ''), scopes
+		FROM tenant_oauth_clients
+		WHERE tenant_id = $1 AND revoked = false
+	`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OAuth clients: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c OAuthClientSnapshot
+		var scopes string
+		if err := rows.Scan(&c.ClientID, &c.ClientSecretSalt, &c.ClientSecretHash, &c.PublicKeyPEM, &scopes); err != nil {
+			return nil, err
+		}
+		c.Scopes = splitScopes(scopes)
+		snapshot.OAuthClients = append(snapshot.OAuthClients, c)
+	}
+
+	// Load token exchange issuers
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT issuer, COALESCE(audience, ''), jwks_file, COALESCE(claim_mappings, '{}'),
+		       COALESCE(account_home_page, ''), max_read_permission, max_write_permission
+		FROM tenant_token_exchange_issuers
+		WHERE tenant_id = $1
+	`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token exchange issuers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i TokenExchangeIssuerSnapshot
+		var mappingsJSON string
+		if err := rows.Scan(&i.Issuer, &i.Audience, &i.JWKSFile, &mappingsJSON, &i.AccountHomePage,
+			&i.MaxReadPermission, &i.MaxWritePermission); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(mappingsJSON), &i.ClaimMappings); err != nil {
+			return nil, fmt.Errorf("invalid claim mappings for issuer %s: %w", i.Issuer, err)
+		}
+		snapshot.TokenExchangeIssuers = append(snapshot.TokenExchangeIssuers, i)
+	}
+
+	// Load LTI platforms
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT issuer, client_id, COALESCE(deployment_ids, ''), auth_login_url, jwks_file,
+		       content_url_prefixes, write_permission, read_permission
+		FROM tenant_lti_platforms
+		WHERE tenant_id = $1
+	`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load LTI platforms: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p LTIPlatformSnapshot
+		var deploymentIDs, prefixes string
+		if err := rows.Scan(&p.Issuer, &p.ClientID, &deploymentIDs, &p.AuthLoginURL, &p.JWKSFile,
+			&prefixes, &p.WritePermission, &p.ReadPermission); err != nil {
+			return nil, err
+		}
+		p.DeploymentIDs = strings.Fields(deploymentIDs)
+		p.ContentURLPrefixes = strings.Fields(prefixes)
+		snapshot.LTIPlatforms = append(snapshot.LTIPlatforms, p)
+	}
+
+	snapshot.RateLimits, err = s.loadRateLimits(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot.Quotas, err = s.loadQuotas(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
 }
 
-// CreateTenant creates a new tenant
-func (s *DatabaseTenantStore) CreateTenant(ctx context.Context, req *CreateTenantRequest) error {
+// CreateTenant creates a new tenant and returns its generated API keys,
+// whose plaintext is not stored
+func (s *DatabaseTenantStore) CreateTenant(ctx context.Context, req *CreateTenantRequest) ([]*CreatedAPIKey, error) {
+	if err := req.RateLimits.Normalize(); err != nil {
+		return nil, err
+	}
+	if err := req.Quotas.Normalize(); err != nil {
+		return nil, err
+	}
+
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer tx.Rollback()
 
@@ -238,71 +557,163 @@ func (s *DatabaseTenantStore) CreateTenant(ctx context.Context, req *CreateTenan
 		VALUES ($1, 'active')
 	`, req.TenantID)
 	if err != nil {
-		return fmt.Errorf("failed to create tenant: %w", err)
+		return nil, fmt.Errorf("failed to create tenant: %w", err)
+	}
+
+	// Encrypt secrets with a new tenant data key
+	password, err := s.encryptSecret(ctx, tx, req.TenantID, "password", req.LRS.Password)
+	if err != nil {
+		return nil, err
+	}
+	jwtSecret, err := s.encryptSecret(ctx, tx, req.TenantID, "jwt_secret", req.Auth.JWTSecret)
+	if err != nil {
+		return nil, err
 	}
 
 	// Insert LRS config
 	_, err = tx.ExecContext(ctx, `
 		INSERT INTO tenant_lrs_config (tenant_id, endpoint, username, password)
 		VALUES ($1, $2, $3, $4)
-	`, req.TenantID, req.LRS.Endpoint, req.LRS.Username, req.LRS.Password)
+	`, req.TenantID, req.LRS.Endpoint, req.LRS.Username, password)
 	if err != nil {
-		return fmt.Errorf("failed to create LRS config: %w", err)
+		return nil, fmt.Errorf("failed to create LRS config: %w", err)
 	}
 
 	// Insert auth config
+	oauthTTL := req.Auth.OAuthTokenTTLSeconds
+	if oauthTTL == 0 {
+		oauthTTL = 300
+	}
 	_, err = tx.ExecContext(ctx, `
-		INSERT INTO tenant_auth_config (tenant_id, jwt_secret, jwt_ttl_seconds, permission_policy)
-		VALUES ($1, $2, $3, $4)
-	`, req.TenantID, req.Auth.JWTSecret, req.Auth.JWTTTLSeconds, req.Auth.PermissionPolicy)
+		INSERT INTO tenant_auth_config (tenant_id, jwt_secret, jwt_ttl_seconds, permission_policy, oauth_token_ttl_seconds)
+		VALUES ($1, $2, $3, $4, $5)
+	`, req.TenantID, jwtSecret, req.Auth.JWTTTLSeconds, req.Auth.PermissionPolicy, oauthTTL)
 	if err != nil {
-		return fmt.Errorf("failed to create auth config: %w", err)
+		return nil, fmt.Errorf("failed to create auth config: %w", err)
 	}
 
 	// Insert hosts
-	for _, host := range req.Hosts {
+	hosts, err := normalizeHosts(req.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
 		_, err = tx.ExecContext(ctx, `
 			INSERT INTO tenant_hosts (tenant_id, host)
 			VALUES ($1, $2)
 		`, req.TenantID, host)
 		if err != nil {
-			return fmt.Errorf("failed to create host mapping: %w", err)
+			return nil, fmt.Errorf("failed to create host mapping: %w", err)
+		}
+	}
+
+	// Generate API keys
+	var apiKeys []*CreatedAPIKey
+	for i := range req.Auth.LMSAPIKeys {
+		k := &req.Auth.LMSAPIKeys[i]
+		if k.Description == "" {
+			k.Description = "Initial API key"
+		}
+		created, err := insertAPIKey(ctx, tx, req.TenantID, k)
+		if err != nil {
+			return nil, fmt.Errorf("lms_api_keys[%d]: %w", i, err)
 		}
+		apiKeys = append(apiKeys, created)
 	}
 
-	// Insert API keys
-	for _, key := range req.Auth.LMSAPIKeys {
+	// Insert OAuth clients
+	for _, c := range req.Auth.OAuthClients {
+		client, err := NewOAuthClient(c.ClientID, c.ClientSecret, c.PublicKeyPEM, c.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		var secretHash, publicKeyPEM sql.NullString
+		if client.ClientSecretHash != "" {
+			secretHash = sql.NullString{String: client.ClientSecretHash, Valid: true}
+		}
+		if c.PublicKeyPEM != "" {
+			publicKeyPEM = sql.NullString{String: c.PublicKeyPEM, Valid: true}
+		}
 		_, err = tx.ExecContext(ctx, `
-			INSERT INTO tenant_lms_api_keys (tenant_id, api_key_hash, description)
-			VALUES ($1, $2, $3)
-		`, req.TenantID, key, "Initial API key")
+			INSERT INTO tenant_oauth_clients (tenant_id, client_id, client_secret_salt, client_secret_hash, public_key_pem, scopes)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, req.TenantID, c.ClientID, client.ClientSecretSalt, secretHash, publicKeyPEM, strings.Join(c.Scopes, " "))
 		if err != nil {
-			return fmt.Errorf("failed to create API key: %w", err)
+			return nil, fmt.Errorf("failed to create OAuth client: %w", err)
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	// Insert token exchange issuers
+	for _, i := range req.Auth.TokenExchangeIssuers {
+		issuer, err := NewTokenExchangeIssuer(i.Issuer, i.Audience, i.JWKSFile, i.ClaimMappings,
+			i.AccountHomePage, i.MaxReadPermission, i.MaxWritePermission)
+		if err != nil {
+			return nil, err
+		}
+		mappings, err := json.Marshal(issuer.ClaimMappings)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO tenant_token_exchange_issuers
+				(tenant_id, issuer, audience, jwks_file, claim_mappings, account_home_page, max_read_permission, max_write_permission)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, req.TenantID, issuer.Issuer, issuer.Audience, i.JWKSFile, string(mappings),
+			issuer.AccountHomePage, issuer.MaxReadPermission, issuer.MaxWritePermission)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create token exchange issuer: %w", err)
+		}
 	}
 
-	// Invalidate cache
-	s.mu.Lock()
-	for _, host := range req.Hosts {
-		delete(s.cache, host)
+	// Insert LTI platforms
+	for _, p := range req.LTIPlatforms {
+		platform, err := NewLTIPlatform(p.Issuer, p.ClientID, p.DeploymentIDs, p.AuthLoginURL, p.JWKSFile,
+			p.ContentURLPrefixes, models.Permissions{Write: p.WritePermission, Read: p.ReadPermission})
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO tenant_lti_platforms
+				(tenant_id, issuer, client_id, deployment_ids, auth_login_url, jwks_file,
+				 content_url_prefixes, write_permission, read_permission)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, req.TenantID, platform.Issuer, platform.ClientID, strings.Join(p.DeploymentIDs, " "),
+			platform.AuthLoginURL, p.JWKSFile, strings.Join(platform.ContentURLPrefixes, " "),
+			platform.Permissions.Write, platform.Permissions.Read)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create LTI platform: %w", err)
+		}
+	}
+
+	if err := replaceRateLimits(ctx, tx, req.TenantID, req.RateLimits); err != nil {
+		return nil, err
+	}
+	if err := replaceQuotas(ctx, tx, req.TenantID, req.Quotas); err != nil {
+		return nil, err
 	}
-	s.mu.Unlock()
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// New host mappings can take over hosts cached for other tenants,
+	// through wildcards or more specific mappings
+	s.flushCache()
 
 	log.WithField("tenant_id", req.TenantID).Info("Tenant created")
 
-	return nil
+	return apiKeys, nil
 }
 
 // CreateTenantRequest represents a request to create a tenant
 type CreateTenantRequest struct {
-	TenantID string              `json:"tenant_id"`
-	Hosts    []string            `json:"hosts"`
-	LRS      LRSConfigRequest    `json:"lrs"`
-	Auth     AuthConfigRequest   `json:"auth"`
+	TenantID     string               `json:"tenant_id"`
+	Hosts        []string             `json:"hosts"`
+	LRS          LRSConfigRequest     `json:"lrs"`
+	Auth         AuthConfigRequest    `json:"auth"`
+	LTIPlatforms []LTIPlatformRequest `json:"lti_platforms,omitempty"`
+	RateLimits   RateLimits           `json:"rate_limits,omitempty"`
+	Quotas       Quotas               `json:"quotas,omitempty"`
 }
 
 type LRSConfigRequest struct {
@@ -312,10 +723,41 @@ type LRSConfigRequest struct {
 }
 
 type AuthConfigRequest struct {
-	JWTSecret        string   `json:"jwt_secret"`
-	JWTTTLSeconds    int      `json:"jwt_ttl_seconds"`
-	LMSAPIKeys       []string `json:"lms_api_keys"`
-	PermissionPolicy string   `json:"permission_policy"`
+	JWTSecret            string                       `json:"jwt_secret"`
+	JWTTTLSeconds        int                          `json:"jwt_ttl_seconds"`
+	LMSAPIKeys           []LMSAPIKeyRequest           `json:"lms_api_keys"`
+	PermissionPolicy     string                       `json:"permission_policy"`
+	OAuthTokenTTLSeconds int                          `json:"oauth_token_ttl_seconds,omitempty"`
+	OAuthClients         []OAuthClientRequest         `json:"oauth_clients,omitempty"`
+	TokenExchangeIssuers []TokenExchangeIssuerRequest `json:"token_exchange_issuers,omitempty"`
+}
+
+type OAuthClientRequest struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	PublicKeyPEM string   `json:"public_key_pem,omitempty"`
+	Scopes       []string `json:"scopes"`
+}
+
+type LTIPlatformRequest struct {
+	Issuer             string   `json:"issuer"`
+	ClientID           string   `json:"client_id"`
+	DeploymentIDs      []string `json:"deployment_ids,omitempty"`
+	AuthLoginURL       string   `json:"auth_login_url"`
+	JWKSFile           string   `json:"jwks_file"`
+	ContentURLPrefixes []string `json:"content_url_prefixes"`
+	WritePermission    string   `json:"write_permission,omitempty"`
+	ReadPermission     string   `json:"read_permission,omitempty"`
+}
+
+type TokenExchangeIssuerRequest struct {
+	Issuer             string            `json:"issuer"`
+	Audience           string            `json:"audience"`
+	JWKSFile           string            `json:"jwks_file"`
+	ClaimMappings      map[string]string `json:"claim_mappings,omitempty"`
+	AccountHomePage    string            `json:"account_home_page,omitempty"`
+	MaxReadPermission  string            `json:"max_read_permission,omitempty"`
+	MaxWritePermission string            `json:"max_write_permission,omitempty"`
 }
 
 // ListTenants returns all tenants
@@ -354,35 +796,51 @@ func (s *DatabaseTenantStore) DeleteTenant(ctx context.Context, tenantID string)
 		return err
 	}
 	if rows == 0 {
-		return fmt.Errorf("tenant not found: %s", tenantID)
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
 	}
 
-	// Invalidate cache
+	s.invalidateTenant(tenantID)
+
+	log.WithField("tenant_id", tenantID).Info("Tenant deleted")
+
+	return nil
+}
+
+// invalidateTenant evicts a tenant and every cached host of it
+func (s *DatabaseTenantStore) invalidateTenant(tenantID string) {
 	s.mu.Lock()
-	for host := range s.cache {
-		if s.cache[host].TenantID == tenantID {
+	delete(s.byID, tenantID)
+	for host, cached := range s.cache {
+		if cached.config.TenantID == tenantID {
 			delete(s.cache, host)
 		}
 	}
+	hooks := s.onInvalidate
 	s.mu.Unlock()
 
-	log.WithField("tenant_id", tenantID).Info("Tenant deleted")
-
-	return nil
+	for _, hook := range hooks {
+		hook(tenantID)
+	}
 }
 
 // MarshalJSON implements json.Marshaler for TenantConfig
 func (t *TenantConfig) MarshalJSON() ([]byte, error) {
 	// Don't include secrets in JSON output
 	return json.Marshal(struct {
-		TenantID         string   `json:"tenant_id"`
-		Hosts            []string `json:"hosts"`
-		LRSEndpoint      string   `json:"lrs_endpoint"`
-		PermissionPolicy string   `json:"permission_policy"`
+		TenantID         string     `json:"tenant_id"`
+		Status           string     `json:"status"`
+		Hosts            []string   `json:"hosts"`
+		LRSEndpoint      string     `json:"lrs_endpoint"`
+		PermissionPolicy string     `json:"permission_policy"`
+		RateLimits       RateLimits `json:"rate_limits"`
+		Quotas           Quotas     `json:"quotas"`
 	}{
 		TenantID:         t.TenantID,
+		Status:           t.Status,
 		Hosts:            t.Hosts,
 		LRSEndpoint:      t.LRSEndpoint,
 		PermissionPolicy: t.PermissionPolicy,
+		RateLimits:       t.RateLimits,
+		Quotas:           t.Quotas,
 	})
 }
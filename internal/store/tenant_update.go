@@ -0,0 +1,236 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrTenantNotFound is returned when a tenant does not exist or is deleted
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// minJWTSecretLength is the shortest accepted tenant JWT secret in bytes
+const minJWTSecretLength = 32
+
+// UpdateTenantRequest changes a tenant's hosts, LRS, auth settings, rate
+// limits and quotas. Omitted (nil) fields are left unchanged; rate limits and
+// quotas are replaced as a whole.
+type UpdateTenantRequest struct {
+	Hosts      *[]string         `json:"hosts,omitempty"`
+	LRS        *LRSConfigUpdate  `json:"lrs,omitempty"`
+	Auth       *AuthConfigUpdate `json:"auth,omitempty"`
+	RateLimits *RateLimits       `json:"rate_limits,omitempty"`
+	Quotas     *Quotas           `json:"quotas,omitempty"`
+}
+
+// LRSConfigUpdate changes a tenant's LRS connection
+type LRSConfigUpdate struct {
+	Endpoint *string `json:"endpoint,omitempty"`
+	Username *string `json:"username,omitempty"`
+	Password *string `json:"password,omitempty"`
+}
+
+// AuthConfigUpdate changes a tenant's token settings
+type AuthConfigUpdate struct {
+	JWTSecret            *string `json:"jwt_secret,omitempty"`
+	JWTTTLSeconds        *int    `json:"jwt_ttl_seconds,omitempty"`
+	PermissionPolicy     *string `json:"permission_policy,omitempty"`
+	OAuthTokenTTLSeconds *int    `json:"oauth_token_ttl_seconds,omitempty"`
+}
+
+// ChangesRouting reports whether the request replaces the tenant's hosts or
+// LRS endpoint, which decide where other tenants' traffic can be sent
+func (r *UpdateTenantRequest) ChangesRouting() bool {
+	return r.Hosts != nil || (r.LRS != nil && r.LRS.Endpoint != nil)
+}
+
+// Validate checks the fields present in the request
+func (r *UpdateTenantRequest) Validate() error {
+	if r.Hosts != nil {
+		if len(*r.Hosts) == 0 {
+			return fmt.Errorf("hosts must not be empty")
+		}
+		if _, err := normalizeHosts(*r.Hosts); err != nil {
+			return err
+		}
+	}
+
+	if r.LRS != nil {
+		if r.LRS.Endpoint != nil {
+			if err := validateEndpoint(*r.LRS.Endpoint); err != nil {
+				return err
+			}
+		}
+		if r.LRS.Username != nil && *r.LRS.Username == "" {
+			return fmt.Errorf("lrs.username must not be empty")
+		}
+		if r.LRS.Password != nil && *r.LRS.Password == "" {
+			return fmt.Errorf("lrs.password must not be empty")
+		}
+	}
+
+	if r.Auth != nil {
+		if r.Auth.JWTSecret != nil && len(*r.Auth.JWTSecret) < minJWTSecretLength {
+			return fmt.Errorf("auth.jwt_secret must be at least %d bytes", minJWTSecretLength)
+		}
+		if r.Auth.JWTTTLSeconds != nil && *r.Auth.JWTTTLSeconds <= 0 {
+			return fmt.Errorf("auth.jwt_ttl_seconds must be positive")
+		}
+		if r.Auth.OAuthTokenTTLSeconds != nil && *r.Auth.OAuthTokenTTLSeconds <= 0 {
+			return fmt.Errorf("auth.oauth_token_ttl_seconds must be positive")
+		}
+		if r.Auth.PermissionPolicy != nil && *r.Auth.PermissionPolicy != "strict" && *r.Auth.PermissionPolicy != "permissive" {
+			return fmt.Errorf("auth.permission_policy must be \"strict\" or \"permissive\"")
+		}
+	}
+
+	if r.RateLimits != nil {
+		if err := r.RateLimits.Normalize(); err != nil {
+			return err
+		}
+	}
+
+	if r.Quotas != nil {
+		if err := r.Quotas.Normalize(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateComplete checks that a replacement (PUT) sets every field
+func (r *UpdateTenantRequest) ValidateComplete() error {
+	if r.Hosts == nil {
+		return fmt.Errorf("hosts is required")
+	}
+	if r.LRS == nil || r.LRS.Endpoint == nil || r.LRS.Username == nil || r.LRS.Password == nil {
+		return fmt.Errorf("lrs.endpoint, lrs.username and lrs.password are required")
+	}
+	if r.Auth == nil || r.Auth.JWTSecret == nil || r.Auth.JWTTTLSeconds == nil ||
+		r.Auth.PermissionPolicy == nil || r.Auth.OAuthTokenTTLSeconds == nil {
+		return fmt.Errorf("auth.jwt_secret, auth.jwt_ttl_seconds, auth.permission_policy and auth.oauth_token_ttl_seconds are required")
+	}
+	return r.Validate()
+}
+
+// validateEndpoint requires an absolute http(s) LRS endpoint URL
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("lrs.endpoint must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// UpdateTenant applies an update in one transaction and evicts every cached
+// host of the tenant
+func (s *DatabaseTenantStore) UpdateTenant(ctx context.Context, tenantID string, req *UpdateTenantRequest) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRowContext(ctx, `
+		SELECT status FROM tenants WHERE tenant_id = $1 FOR UPDATE
+	`, tenantID).Scan(&status)
+	if err == sql.ErrNoRows || status == TenantStatusDeleted {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if req.LRS != nil {
+		password, err := s.encryptSecretPtr(ctx, tx, tenantID, "password", req.LRS.Password)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE tenant_lrs_config
+			SET endpoint = COALESCE($2, endpoint),
+			    username = COALESCE($3, username),
+			    password = COALESCE($4, password)
+			WHERE tenant_id = $1
+		`, tenantID, req.LRS.Endpoint, req.LRS.Username, password)
+		if err != nil {
+			return fmt.Errorf("failed to update LRS config: %w", err)
+		}
+	}
+
+	if req.Auth != nil {
+		jwtSecret, err := s.encryptSecretPtr(ctx, tx, tenantID, "jwt_secret", req.Auth.JWTSecret)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE tenant_auth_config
+			SET jwt_secret = COALESCE($2, jwt_secret),
+			    jwt_ttl_seconds = COALESCE($3, jwt_ttl_seconds),
+			    permission_policy = COALESCE($4, permission_policy),
+			    oauth_token_ttl_seconds = COALESCE($5, oauth_token_ttl_seconds)
+			WHERE tenant_id = $1
+		`, tenantID, jwtSecret, req.Auth.JWTTTLSeconds, req.Auth.PermissionPolicy, req.Auth.OAuthTokenTTLSeconds)
+		if err != nil {
+			return fmt.Errorf("failed to update auth config: %w", err)
+		}
+	}
+
+	if req.RateLimits != nil {
+		if err := replaceRateLimits(ctx, tx, tenantID, *req.RateLimits); err != nil {
+			return err
+		}
+	}
+
+	if req.Quotas != nil {
+		if err := replaceQuotas(ctx, tx, tenantID, *req.Quotas); err != nil {
+			return err
+		}
+	}
+
+	if req.Hosts != nil {
+		hosts, err := normalizeHosts(*req.Hosts)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM tenant_hosts WHERE tenant_id = $1`, tenantID)
+		if err != nil {
+			return fmt.Errorf("failed to update host mappings: %w", err)
+		}
+		for _, host := range hosts {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO tenant_hosts (tenant_id, host)
+				VALUES ($1, $2)
+			`, tenantID, host)
+			if err != nil {
+				return fmt.Errorf("failed to create host mapping %s: %w", host, err)
+			}
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tenants SET updated_at = CURRENT_TIMESTAMP WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if req.Hosts != nil {
+		// Moved mappings can change which tenant other cached hosts resolve to
+		s.flushCache()
+	} else {
+		s.invalidateTenant(tenantID)
+	}
+
+	log.WithField("tenant_id", tenantID).Info("Tenant updated")
+
+	return nil
+}
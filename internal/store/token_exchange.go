@@ -0,0 +1,86 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/jwks"
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+)
+
+// TokenExchangeIssuer is an identity provider whose tokens may be exchanged
+// for proxy JWTs (RFC 8693)
+type TokenExchangeIssuer struct {
+	Issuer             string
+	Audience           string // Required aud of subject tokens
+	Keys               *jwks.KeySet
+	ClaimMappings      map[string]string // actor field -> claim name
+	AccountHomePage    string
+	MaxReadPermission  string
+	MaxWritePermission string
+}
+
+// Actor fields that may be populated from subject token claims
+var actorClaimFields = map[string]bool{
+	"name":              true,
+	"mbox":              true,
+	"mbox_sha1sum":      true,
+	"openid":            true,
+	"account_name":      true,
+	"account_home_page": true,
+}
+
+// NewTokenExchangeIssuer validates an issuer configuration and loads its JWKS file
+func NewTokenExchangeIssuer(issuer, audience, jwksFile string, mappings map[string]string, accountHomePage, maxRead, maxWrite string) (*TokenExchangeIssuer, error) {
+	if issuer == "" {
+		return nil, fmt.Errorf("token exchange issuer is required")
+	}
+	if audience == "" {
+		// Without it, a token the IdP issued to any other application
+		// could be exchanged
+		return nil, fmt.Errorf("issuer %s: audience is required", issuer)
+	}
+	if jwksFile == "" {
+		return nil, fmt.Errorf("issuer %s: jwks_file is required", issuer)
+	}
+
+	for field := range mappings {
+		if !actorClaimFields[field] {
+			return nil, fmt.Errorf("issuer %s: unknown claim mapping field: %s", issuer, field)
+		}
+	}
+	if len(mappings) == 0 {
+		// Default: identify learners by the IdP's subject as an xAPI account
+		mappings = map[string]string{"account_name": "sub"}
+	}
+	if accountHomePage == "" {
+		accountHomePage = issuer
+	}
+
+	if maxRead == "" {
+		maxRead = "actor-activity-registration-scoped"
+	}
+	if maxWrite == "" {
+		maxWrite = "actor-activity-registration-scoped"
+	}
+	if err := models.ValidatePermission(maxRead); err != nil {
+		return nil, fmt.Errorf("issuer %s: max_read_permission: %w", issuer, err)
+	}
+	if err := models.ValidatePermission(maxWrite); err != nil {
+		return nil, fmt.Errorf("issuer %s: max_write_permission: %w", issuer, err)
+	}
+
+	keys, err := jwks.LoadFile(jwksFile)
+	if err != nil {
+		return nil, fmt.Errorf("issuer %s: %w", issuer, err)
+	}
+
+	return &TokenExchangeIssuer{
+		Issuer:             issuer,
+		Audience:           audience,
+		Keys:               keys,
+		ClaimMappings:      mappings,
+		AccountHomePage:    accountHomePage,
+		MaxReadPermission:  maxRead,
+		MaxWritePermission: maxWrite,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/usage"
+)
+
+// AddUsage implements usage.Store, adding to each tenant's row for the hour
+// in one transaction
+func (s *DatabaseTenantStore) AddUsage(ctx context.Context, hour time.Time, counts map[string]usage.Counts) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for tenantID, c := range counts {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO tenant_usage (tenant_id, hour, statements_written, statements_read, tokens_issued, bytes_proxied)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (tenant_id, hour) DO UPDATE SET
+				statements_written = tenant_usage.statements_written + excluded.statements_written,
+				statements_read = tenant_usage.statements_read + excluded.statements_read,
+				tokens_issued = tenant_usage.tokens_issued + excluded.tokens_issued,
+				bytes_proxied = tenant_usage.bytes_proxied + excluded.bytes_proxied
+		`, tenantID, hour, c.StatementsWritten, c.StatementsRead, c.TokensIssued, c.BytesProxied)
+		if err != nil {
+			return fmt.Errorf("failed to record usage: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// MonthUsage implements usage.Store
+func (s *DatabaseTenantStore) MonthUsage(ctx context.Context, month time.Time) (map[string]usage.Counts, error) {
+	records, err := s.QueryUsage(ctx, "", month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[string]usage.Counts)
+	for _, rec := range records {
+		total := totals[rec.TenantID]
+		total.Add(rec.Counts)
+		totals[rec.TenantID] = total
+	}
+	return totals, nil
+}
+
+// QueryUsage returns hourly usage in [since, until), of one tenant or of all
+// tenants if tenantID is empty, ordered by tenant and hour
+func (s *DatabaseTenantStore) QueryUsage(ctx context.Context, tenantID string, since, until time.Time) ([]*usage.Record, error) {
+	query := `
+		SELECT tenant_id, hour, statements_written, statements_read, tokens_issued, bytes_proxied
+		FROM tenant_usage
+		WHERE hour >= $1 AND hour < $2`
+	args := []interface{}{since.UTC(), until.UTC()}
+	if tenantID != "" {
+		query += ` AND tenant_id = $3`
+		args = append(args, tenantID)
+	}
+	query += `
+		ORDER BY tenant_id, hour`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*usage.Record
+	for rows.Next() {
+		rec := &usage.Record{}
+		if err := rows.Scan(&rec.TenantID, &rec.Period, &rec.StatementsWritten, &rec.StatementsRead,
+			&rec.TokensIssued, &rec.BytesProxied); err != nil {
+			return nil, err
+		}
+		rec.Period = rec.Period.UTC()
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,272 @@
+// Package usage meters each tenant's use of the proxy for billing and
+// quotas. Counts are kept in memory and added to hourly totals in a Store
+// periodically.
+package usage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Metrics counted per tenant
+const (
+	StatementsWritten = "statements_written"
+	StatementsRead    = "statements_read"
+	TokensIssued      = "tokens_issued"
+	BytesProxied      = "bytes_proxied" // Request and response bodies exchanged with the LRS
+)
+
+// Metrics lists every metric
+var Metrics = []string{StatementsWritten, StatementsRead, TokensIssued, BytesProxied}
+
+// Counts are a tenant's usage over some period
+type Counts struct {
+	StatementsWritten int64 `json:"statements_written"`
+	StatementsRead    int64 `json:"statements_read"`
+	TokensIssued      int64 `json:"tokens_issued"`
+	BytesProxied      int64 `json:"bytes_proxied"`
+}
+
+// Get returns the count of a metric
+func (c *Counts) Get(metric string) int64 {
+	switch metric {
+	case StatementsWritten:
+		return c.StatementsWritten
+	case StatementsRead:
+		return c.StatementsRead
+	case TokensIssued:
+		return c.TokensIssued
+	case BytesProxied:
+		return c.BytesProxied
+	}
+	return 0
+}
+
+// Add adds other to c
+func (c *Counts) Add(other Counts) {
+	c.StatementsWritten += other.StatementsWritten
+	c.StatementsRead += other.StatementsRead
+	c.TokensIssued += other.TokensIssued
+	c.BytesProxied += other.BytesProxied
+}
+
+// Record is a tenant's usage in one period
+type Record struct {
+	TenantID string    `json:"tenant_id"`
+	Period   time.Time `json:"period"` // Start of the hour, day or month
+	Counts
+}
+
+// Store keeps hourly usage totals
+type Store interface {
+	// AddUsage adds counts to each tenant's total for the hour
+	AddUsage(ctx context.Context, hour time.Time, counts map[string]Counts) error
+	// MonthUsage returns each tenant's totals for the month starting at month
+	MonthUsage(ctx context.Context, month time.Time) (map[string]Counts, error)
+}
+
+// MonthStart returns the start of t's month in UTC
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Meter counts usage and knows each tenant's month-to-date totals. Totals
+// from the store include the flushes of every replica, so they lag other
+// replicas by up to the flush interval.
+type Meter struct {
+	store Store // nil keeps usage in memory only
+	now   func() time.Time
+
+	mu       sync.Mutex
+	pending  map[time.Time]map[string]*Counts // hour -> tenant -> counts not yet stored
+	inflight map[time.Time]map[string]*Counts // Being stored
+	month    time.Time                        // Month of totals
+	totals   map[string]Counts                // Stored month-to-date totals
+	warned   map[string]bool                  // Soft quota warnings logged this month
+}
+
+// NewMeter creates a meter that stores usage in store, or only in memory if
+// store is nil
+func NewMeter(store Store) *Meter {
+	return &Meter{
+		store:   store,
+		now:     time.Now,
+		pending: make(map[time.Time]map[string]*Counts),
+		month:   MonthStart(time.Now()),
+		totals:  make(map[string]Counts),
+		warned:  make(map[string]bool),
+	}
+}
+
+// Add counts a tenant's usage now
+func (m *Meter) Add(tenantID string, counts Counts) {
+	hour := m.now().UTC().Truncate(time.Hour)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tenants, ok := m.pending[hour]
+	if !ok {
+		tenants = make(map[string]*Counts)
+		m.pending[hour] = tenants
+	}
+	c, ok := tenants[tenantID]
+	if !ok {
+		c = &Counts{}
+		tenants[tenantID] = c
+	}
+	c.Add(counts)
+}
+
+// Usage returns a tenant's usage so far this month
+func (m *Meter) Usage(tenantID string) Counts {
+	month := MonthStart(m.now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var used Counts
+	if m.month.Equal(month) {
+		used = m.totals[tenantID]
+	}
+	for _, hours := range []map[time.Time]map[string]*Counts{m.pending, m.inflight} {
+		for hour, tenants := range hours {
+			if c, ok := tenants[tenantID]; ok && !hour.Before(month) {
+				used.Add(*c)
+			}
+		}
+	}
+	return used
+}
+
+// FirstWarning reports whether a soft quota warning for the metric has not
+// been given yet this month, and marks it given
+func (m *Meter) FirstWarning(tenantID, metric string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rollover(MonthStart(m.now()))
+	key := tenantID + "\x00" + metric
+	if m.warned[key] {
+		return false
+	}
+	m.warned[key] = true
+	return true
+}
+
+// rollover starts a new month. Callers hold mu.
+func (m *Meter) rollover(month time.Time) {
+	if m.month.Equal(month) {
+		return
+	}
+	m.month = month
+	m.totals = make(map[string]Counts)
+	m.warned = make(map[string]bool)
+}
+
+// Run flushes usage every interval until ctx is done. Callers flush once
+// more on shutdown.
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Flush(ctx)
+		}
+	}
+}
+
+// Flush stores pending usage and reloads the month-to-date totals. Usage
+// that fails to store is kept for the next flush.
+func (m *Meter) Flush(ctx context.Context) {
+	m.mu.Lock()
+	batch := m.pending
+	m.pending = make(map[time.Time]map[string]*Counts)
+	m.inflight = batch
+	m.mu.Unlock()
+
+	if m.store == nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.inflight = nil
+		m.addToTotals(batch)
+		return
+	}
+
+	stored := make(map[time.Time]map[string]*Counts)
+	for hour, tenants := range batch {
+		counts := make(map[string]Counts, len(tenants))
+		for tenantID, c := range tenants {
+			counts[tenantID] = *c
+		}
+		if err := m.store.AddUsage(ctx, hour, counts); err != nil {
+			log.WithError(err).Error("Failed to store usage")
+			for hour := range stored {
+				delete(batch, hour)
+			}
+			m.mu.Lock()
+			m.inflight = nil
+			m.requeue(batch)
+			m.addToTotals(stored)
+			m.mu.Unlock()
+			return
+		}
+		stored[hour] = tenants
+	}
+
+	month := MonthStart(m.now())
+	totals, err := m.store.MonthUsage(ctx, month)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inflight = nil
+	if err != nil {
+		log.WithError(err).Warn("Failed to load usage totals")
+		// Stored, but not yet in the totals: count it locally until the
+		// next successful load
+		m.addToTotals(stored)
+		return
+	}
+	m.rollover(month)
+	m.totals = totals
+}
+
+// addToTotals adds flushed usage for the current month to the totals.
+// Callers hold mu.
+func (m *Meter) addToTotals(hours map[time.Time]map[string]*Counts) {
+	month := MonthStart(m.now())
+	m.rollover(month)
+	for hour, tenants := range hours {
+		if hour.Before(month) {
+			continue
+		}
+		for tenantID, c := range tenants {
+			total := m.totals[tenantID]
+			total.Add(*c)
+			m.totals[tenantID] = total
+		}
+	}
+}
+
+// requeue returns usage that failed to store to pending. Callers hold mu.
+func (m *Meter) requeue(hours map[time.Time]map[string]*Counts) {
+	for hour, tenants := range hours {
+		pending, ok := m.pending[hour]
+		if !ok {
+			m.pending[hour] = tenants
+			continue
+		}
+		for tenantID, c := range tenants {
+			if p, ok := pending[tenantID]; ok {
+				p.Add(*c)
+			} else {
+				pending[tenantID] = c
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStore keeps hourly totals in memory. AddUsage fails for failHour, and
+// while gate is set it signals entered and waits for gate to be closed.
+type fakeStore struct {
+	mu       sync.Mutex
+	hours    map[time.Time]map[string]Counts
+	adds     int
+	failHour time.Time
+	entered  chan struct{}
+	gate     chan struct{}
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{hours: make(map[time.Time]map[string]Counts)}
+}
+
+func (s *fakeStore) AddUsage(ctx context.Context, hour time.Time, counts map[string]Counts) error {
+	if s.gate != nil {
+		s.entered <- struct{}{}
+		<-s.gate
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hour.Equal(s.failHour) {
+		return errors.New("database unavailable")
+	}
+	s.adds++
+	tenants, ok := s.hours[hour]
+	if !ok {
+		tenants = make(map[string]Counts)
+		s.hours[hour] = tenants
+	}
+	for tenantID, c := range counts {
+		total := tenants[tenantID]
+		total.Add(c)
+		tenants[tenantID] = total
+	}
+	return nil
+}
+
+func (s *fakeStore) MonthUsage(ctx context.Context, month time.Time) (map[string]Counts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	totals := make(map[string]Counts)
+	for hour, tenants := range s.hours {
+		if MonthStart(hour).Equal(month) {
+			for tenantID, c := range tenants {
+				total := totals[tenantID]
+				total.Add(c)
+				totals[tenantID] = total
+			}
+		}
+	}
+	return totals, nil
+}
+
+// stored returns a tenant's total in the store
+func (s *fakeStore) stored(tenantID string) Counts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total Counts
+	for _, tenants := range s.hours {
+		total.Add(tenants[tenantID])
+	}
+	return total
+}
+
+// newTestMeter creates a meter on a clock the test moves
+func newTestMeter(store Store, now time.Time) (*Meter, *time.Time) {
+	m := NewMeter(store)
+	m.now = func() time.Time { return now }
+	m.month = MonthStart(now)
+	return m, &now
+}
+
+func TestMeterFlush(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	m, now := newTestMeter(store, time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC))
+
+	m.Add("acme", Counts{StatementsWritten: 2})
+	*now = now.Add(time.Hour)
+	m.Add("acme", Counts{StatementsWritten: 3, BytesProxied: 100})
+	m.Add("globex", Counts{TokensIssued: 1})
+	if used := m.Usage("acme"); used.StatementsWritten != 5 || used.BytesProxied != 100 {
+		t.Errorf("usage before flushing = %+v", used)
+	}
+
+	m.Flush(ctx)
+	if got := store.stored("acme"); got.StatementsWritten != 5 || got.BytesProxied != 100 {
+		t.Errorf("stored = %+v", got)
+	}
+	if store.adds != 2 {
+		t.Errorf("%d AddUsage calls, want one per hour", store.adds)
+	}
+	// Usage now comes from the store's totals, and is not counted twice
+	if used := m.Usage("acme"); used.StatementsWritten != 5 {
+		t.Errorf("usage after flushing = %+v", used)
+	}
+	m.Flush(ctx)
+	if store.adds != 2 {
+		t.Error("flushing with nothing pending stored usage")
+	}
+}
+
+func TestMeterRequeuesFailedUsage(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	start := time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC)
+	m, now := newTestMeter(store, start)
+
+	m.Add("acme", Counts{StatementsRead: 1})
+	*now = now.Add(time.Hour)
+	m.Add("acme", Counts{StatementsRead: 10})
+
+	// The second hour fails to store. Hours are flushed in no particular
+	// order, so the first may be stored or pending again; either way
+	// nothing is lost or counted twice.
+	store.failHour = now.Truncate(time.Hour)
+	m.Flush(ctx)
+	if got := store.stored("acme"); got.StatementsRead != 0 && got.StatementsRead != 1 {
+		t.Errorf("stored = %+v, want at most the first hour", got)
+	}
+	if used := m.Usage("acme"); used.StatementsRead != 11 {
+		t.Errorf("usage after a failed flush = %+v, want 11 statements read", used)
+	}
+
+	// Usage counted meanwhile is merged with the requeued usage
+	m.Add("acme", Counts{StatementsRead: 100})
+	store.failHour = time.Time{}
+	m.Flush(ctx)
+	if got := store.stored("acme"); got.StatementsRead != 111 {
+		t.Errorf("stored after retrying = %+v, want 111 statements read", got)
+	}
+	if used := m.Usage("acme"); used.StatementsRead != 111 {
+		t.Errorf("usage after retrying = %+v", used)
+	}
+}
+
+func TestMeterCountsInflightUsage(t *testing.T) {
+	ctx := context.Background()
+	store := newFakeStore()
+	store.entered = make(chan struct{}, 1)
+	store.gate = make(chan struct{})
+	m, _ := newTestMeter(store, time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC))
+
+	m.Add("acme", Counts{TokensIssued: 3})
+	done := make(chan struct{})
+	go func() {
+		m.Flush(ctx)
+		close(done)
+	}()
+	<-store.entered
+
+	// Usage being stored still counts, and so does usage added meanwhile
+	m.Add("acme", Counts{TokensIssued: 1})
+	if used := m.Usage("acme"); used.TokensIssued != 4 {
+		t.Errorf("usage during a flush = %+v, want 4 tokens issued", used)
+	}
+
+	close(store.gate)
+	<-done
+	if used := m.Usage("acme"); used.TokensIssued != 4 {
+		t.Errorf("usage after the flush = %+v, want 4 tokens issued", used)
+	}
+}
+
+func TestMeterMonthRollover(t *testing.T) {
+	for name, store := range map[string]Store{"stored": newFakeStore(), "in memory": nil} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			m, now := newTestMeter(store, time.Date(2026, 10, 31, 23, 30, 0, 0, time.UTC))
+
+			m.Add("acme", Counts{StatementsWritten: 7})
+			m.Flush(ctx)
+			m.Add("acme", Counts{StatementsWritten: 1})
+			if used := m.Usage("acme"); used.StatementsWritten != 8 {
+				t.Errorf("October usage = %+v", used)
+			}
+			if !m.FirstWarning("acme", StatementsWritten) || m.FirstWarning("acme", StatementsWritten) {
+				t.Error("soft quota warning not given exactly once in October")
+			}
+			if !m.FirstWarning("acme", StatementsRead) || !m.FirstWarning("globex", StatementsWritten) {
+				t.Error("warnings are not per tenant and metric")
+			}
+
+			// October's usage, stored or pending, does not count in November
+			*now = now.Add(time.Hour)
+			if used := m.Usage("acme"); used.StatementsWritten != 0 {
+				t.Errorf("November usage = %+v, want none", used)
+			}
+			m.Add("acme", Counts{StatementsWritten: 2})
+			m.Flush(ctx)
+			if used := m.Usage("acme"); used.StatementsWritten != 2 {
+				t.Errorf("November usage after flushing = %+v, want 2 statements written", used)
+			}
+			if !m.FirstWarning("acme", StatementsWritten) || m.FirstWarning("acme", StatementsWritten) {
+				t.Error("soft quota warning not given exactly once in November")
+			}
+		})
+	}
+}
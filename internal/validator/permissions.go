@@ -1,12 +1,49 @@
 package validator
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
 )
 
+// Reasons a request is denied, for metrics
+const (
+	ReasonNoPermission         = "no_permission"
+	ReasonUnsupportedScope     = "unsupported_scope"
+	ReasonActorMismatch        = "actor_mismatch"
+	ReasonActivityMismatch     = "activity_mismatch"
+	ReasonRegistrationMismatch = "registration_mismatch"
+	ReasonGroupRequired        = "group_required"
+	ReasonGroupMismatch        = "group_mismatch"
+	ReasonNotGroupMember       = "not_group_member"
+)
+
+// Denial is a permission denial with its reason
+type Denial struct {
+	Reason  string
+	message string
+}
+
+func (d *Denial) Error() string {
+	return d.message
+}
+
+// denied creates a Denial
+func denied(reason, format string, args ...interface{}) error {
+	return &Denial{Reason: reason, message: fmt.Sprintf(format, args...)}
+}
+
+// Reason returns the reason of a denial, or "other"
+func Reason(err error) string {
+	var d *Denial
+	if errors.As(err, &d) {
+		return d.Reason
+	}
+	return "other"
+}
+
 // PermissionValidator validates statements against JWT permissions
 type PermissionValidator struct {
 	policy string // "strict" or "permissive"
@@ -25,7 +62,7 @@ func (v *PermissionValidator) ValidateWrite(claims *models.Claims, stmt *models.
 
 	// No write permission
 	if scope == "false" {
-		return fmt.Errorf("write permission denied")
+		return denied(ReasonNoPermission, "write permission denied")
 	}
 
 	switch scope {
@@ -36,7 +73,7 @@ func (v *PermissionValidator) ValidateWrite(claims *models.Claims, stmt *models.
 		return v.validateGroupActivityRegistration(claims, stmt)
 
 	default:
-		return fmt.Errorf("unsupported write permission scope: %s", scope)
+		return denied(ReasonUnsupportedScope, "unsupported write permission scope: %s", scope)
 	}
 }
 
@@ -46,7 +83,7 @@ func (v *PermissionValidator) ValidateRead(claims *models.Claims, query map[stri
 
 	// No read permission
 	if scope == "false" {
-		return fmt.Errorf("read permission denied")
+		return denied(ReasonNoPermission, "read permission denied")
 	}
 
 	switch scope {
@@ -67,7 +104,7 @@ func (v *PermissionValidator) ValidateRead(claims *models.Claims, query map[stri
 			// In permissive mode, allow unknown scopes but log warning
 			return nil
 		}
-		return fmt.Errorf("unsupported read permission scope: %s", scope)
+		return denied(ReasonUnsupportedScope, "unsupported read permission scope: %s", scope)
 	}
 }
 
@@ -75,19 +112,19 @@ func (v *PermissionValidator) ValidateRead(claims *models.Claims, query map[stri
 func (v *PermissionValidator) validateActorActivityRegistration(claims *models.Claims, stmt *models.Statement, op string) error {
 	// Actor must match
 	if !claims.Actor.Equals(stmt.Actor) {
-		return fmt.Errorf("%s denied: actor mismatch (expected %v, got %v)",
+		return denied(ReasonActorMismatch, "%s denied: actor mismatch (expected %v, got %v)",
 			op, claims.Actor, stmt.Actor)
 	}
 
 	// Activity must match
 	if stmt.Object.ID != claims.ActivityID {
-		return fmt.Errorf("%s denied: activity mismatch (expected %s, got %s)",
+		return denied(ReasonActivityMismatch, "%s denied: activity mismatch (expected %s, got %s)",
 			op, claims.ActivityID, stmt.Object.ID)
 	}
 
 	// Registration must match
 	if stmt.Context == nil || stmt.Context.Registration != claims.Registration {
-		return fmt.Errorf("%s denied: registration mismatch (expected %s, got %v)",
+		return denied(ReasonRegistrationMismatch, "%s denied: registration mismatch (expected %s, got %v)",
 			op, claims.Registration, stmt.Context)
 	}
 
@@ -98,27 +135,27 @@ func (v *PermissionValidator) validateActorActivityRegistration(claims *models.C
 func (v *PermissionValidator) validateGroupActivityRegistration(claims *models.Claims, stmt *models.Statement) error {
 	// Statement must use Group actor
 	if stmt.Actor.ObjectType != "Group" {
-		return fmt.Errorf("write denied: group actor required")
+		return denied(ReasonGroupRequired, "write denied: group actor required")
 	}
 
 	// Group must match authorized group
 	if claims.Group == nil || stmt.Actor.Name != claims.Group.Name {
-		return fmt.Errorf("write denied: group mismatch")
+		return denied(ReasonGroupMismatch, "write denied: group mismatch")
 	}
 
 	// Requesting actor must be a group member
 	if !claims.Group.IsMember(claims.Actor) {
-		return fmt.Errorf("write denied: actor not a member of group")
+		return denied(ReasonNotGroupMember, "write denied: actor not a member of group")
 	}
 
 	// Activity must match
 	if stmt.Object.ID != claims.ActivityID {
-		return fmt.Errorf("write denied: activity mismatch")
+		return denied(ReasonActivityMismatch, "write denied: activity mismatch")
 	}
 
 	// Registration must match
 	if stmt.Context == nil || stmt.Context.Registration != claims.Registration {
-		return fmt.Errorf("write denied: registration mismatch")
+		return denied(ReasonRegistrationMismatch, "write denied: registration mismatch")
 	}
 
 	return nil
@@ -128,24 +165,22 @@ func (v *PermissionValidator) validateGroupActivityRegistration(claims *models.C
 func (v *PermissionValidator) validateActorActivityRegistrationRead(claims *models.Claims, query map[string]string) error {
 	// If agent specified in query, must match
 	if agent := query["agent"]; agent != "" {
-		// Simplified check - in production, parse full agent JSON
-		if !strings.Contains(agent, claims.Actor.Mbox) &&
-			!strings.Contains(agent, claims.Actor.OpenID) {
-			return fmt.Errorf("read denied: agent mismatch")
+		if !agentMatches(claims, agent) {
+			return denied(ReasonActorMismatch, "read denied: agent mismatch")
 		}
 	}
 
 	// If activity specified, must match
 	if activity := query["activity"]; activity != "" {
 		if activity != claims.ActivityID {
-			return fmt.Errorf("read denied: activity mismatch")
+			return denied(ReasonActivityMismatch, "read denied: activity mismatch")
 		}
 	}
 
 	// If registration specified, must match
 	if reg := query["registration"]; reg != "" {
 		if reg != claims.Registration {
-			return fmt.Errorf("read denied: registration mismatch")
+			return denied(ReasonRegistrationMismatch, "read denied: registration mismatch")
 		}
 	}
 
@@ -156,16 +191,15 @@ func (v *PermissionValidator) validateActorActivityRegistrationRead(claims *mode
 func (v *PermissionValidator) validateActorCourseRegistrationRead(claims *models.Claims, query map[string]string) error {
 	// Actor must match (if specified)
 	if agent := query["agent"]; agent != "" {
-		if !strings.Contains(agent, claims.Actor.Mbox) &&
-			!strings.Contains(agent, claims.Actor.OpenID) {
-			return fmt.Errorf("read denied: agent mismatch")
+		if !agentMatches(claims, agent) {
+			return denied(ReasonActorMismatch, "read denied: agent mismatch")
 		}
 	}
 
 	// Registration must match (if specified)
 	if reg := query["registration"]; reg != "" {
 		if reg != claims.Registration {
-			return fmt.Errorf("read denied: registration mismatch")
+			return denied(ReasonRegistrationMismatch, "read denied: registration mismatch")
 		}
 	}
 
@@ -179,16 +213,15 @@ func (v *PermissionValidator) validateActorCourseRegistrationRead(claims *models
 func (v *PermissionValidator) validateActorActivityAllRegistrationsRead(claims *models.Claims, query map[string]string) error {
 	// Actor must match
 	if agent := query["agent"]; agent != "" {
-		if !strings.Contains(agent, claims.Actor.Mbox) &&
-			!strings.Contains(agent, claims.Actor.OpenID) {
-			return fmt.Errorf("read denied: agent mismatch")
+		if !agentMatches(claims, agent) {
+			return denied(ReasonActorMismatch, "read denied: agent mismatch")
 		}
 	}
 
 	// Activity must match (if specified)
 	if activity := query["activity"]; activity != "" {
 		if activity != claims.ActivityID {
-			return fmt.Errorf("read denied: activity mismatch")
+			return denied(ReasonActivityMismatch, "read denied: activity mismatch")
 		}
 	}
 
@@ -205,14 +238,14 @@ func (v *PermissionValidator) validateGroupActivityRegistrationRead(claims *mode
 	// Activity must match (if specified)
 	if activity := query["activity"]; activity != "" {
 		if activity != claims.ActivityID {
-			return fmt.Errorf("read denied: activity mismatch")
+			return denied(ReasonActivityMismatch, "read denied: activity mismatch")
 		}
 	}
 
 	// Registration must match (if specified)
 	if reg := query["registration"]; reg != "" {
 		if reg != claims.Registration {
-			return fmt.Errorf("read denied: registration mismatch")
+			return denied(ReasonRegistrationMismatch, "read denied: registration mismatch")
 		}
 	}
 
@@ -222,24 +255,32 @@ func (v *PermissionValidator) validateGroupActivityRegistrationRead(claims *mode
 // ValidateStateAccess validates access to state API
 func (v *PermissionValidator) ValidateStateAccess(claims *models.Claims, activityID, agent, registration string) error {
 	// State API uses same scoping as statements
-	// Simplified validation - in production, parse full agent JSON
 
 	// Actor must match
-	if !strings.Contains(agent, claims.Actor.Mbox) &&
-		!strings.Contains(agent, claims.Actor.OpenID) {
-		return fmt.Errorf("state access denied: agent mismatch")
+	if !agentMatches(claims, agent) {
+		return denied(ReasonActorMismatch, "state access denied: agent mismatch")
 	}
 
 	// Activity must match (for default scope)
 	scope := claims.Permissions.Read
 	if scope == "actor-activity-registration-scoped" {
 		if activityID != claims.ActivityID {
-			return fmt.Errorf("state access denied: activity mismatch")
+			return denied(ReasonActivityMismatch, "state access denied: activity mismatch")
 		}
 		if registration != claims.Registration {
-			return fmt.Errorf("state access denied: registration mismatch")
+			return denied(ReasonRegistrationMismatch, "state access denied: registration mismatch")
 		}
 	}
 
 	return nil
 }
+
+// agentMatches parses an xAPI agent parameter (JSON) and reports whether it
+// identifies the token's actor, by mbox, mbox_sha1sum, openid or account
+func agentMatches(claims *models.Claims, agent string) bool {
+	var actor models.Actor
+	if err := json.Unmarshal([]byte(agent), &actor); err != nil {
+		return false
+	}
+	return claims.Actor.Equals(actor)
+}
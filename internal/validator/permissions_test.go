@@ -0,0 +1,78 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/inxsol/xapi-lrs-auth-proxy/internal/models"
+)
+
+func TestAgentMustMatchActor(t *testing.T) {
+	const (
+		activity     = "https://example.com/activity"
+		registration = "reg-123"
+	)
+	mboxActor := models.Actor{Mbox: "mailto:learner@example.com"}
+	accountActor := models.Actor{Account: &models.Account{HomePage: "https://lms.example.com", Name: "user-1"}}
+
+	tests := []struct {
+		name  string
+		actor models.Actor
+		agent string
+		want  bool
+	}{
+		{"same mbox", mboxActor, `{"mbox":"mailto:learner@example.com"}`, true},
+		{"other mbox", mboxActor, `{"mbox":"mailto:other@example.com"}`, false},
+		{"mbox as substring", mboxActor, `{"mbox":"mailto:learner@example.com.evil"}`, false},
+		{"same account", accountActor, `{"account":{"homePage":"https://lms.example.com","name":"user-1"}}`, true},
+		{"other account name", accountActor, `{"account":{"homePage":"https://lms.example.com","name":"user-2"}}`, false},
+		{"other account home page", accountActor, `{"account":{"homePage":"https://other.example.com","name":"user-1"}}`, false},
+		{"account actor, mbox agent", accountActor, `{"mbox":"mailto:learner@example.com"}`, false},
+		{"account actor, empty agent object", accountActor, `{}`, false},
+		{"not JSON", accountActor, `mailto:learner@example.com`, false},
+	}
+	v := NewPermissionValidator("strict")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, scope := range []string{
+				"actor-activity-registration-scoped",
+				"actor-course-registration-scoped",
+				"actor-activity-all-registrations",
+			} {
+				claims := &models.Claims{
+					Actor:        tt.actor,
+					ActivityID:   activity,
+					Registration: registration,
+					Permissions:  models.Permissions{Read: scope},
+				}
+				err := v.ValidateRead(claims, map[string]string{"agent": tt.agent})
+				if (err == nil) != tt.want {
+					t.Errorf("ValidateRead(%s) error = %v, want allowed %v", scope, err, tt.want)
+				}
+				if !tt.want && Reason(err) != ReasonActorMismatch {
+					t.Errorf("ValidateRead(%s) reason = %s, want %s", scope, Reason(err), ReasonActorMismatch)
+				}
+			}
+
+			claims := &models.Claims{
+				Actor:        tt.actor,
+				ActivityID:   activity,
+				Registration: registration,
+				Permissions:  models.Permissions{Read: "actor-activity-registration-scoped"},
+			}
+			err := v.ValidateStateAccess(claims, activity, tt.agent, registration)
+			if (err == nil) != tt.want {
+				t.Errorf("ValidateStateAccess error = %v, want allowed %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStateAccessRequiresAgent(t *testing.T) {
+	claims := &models.Claims{
+		Actor:       models.Actor{Account: &models.Account{HomePage: "https://lms.example.com", Name: "user-1"}},
+		Permissions: models.Permissions{Read: "actor-activity-all-registrations"},
+	}
+	if err := NewPermissionValidator("strict").ValidateStateAccess(claims, "", "", ""); err == nil {
+		t.Error("state access without an agent was allowed")
+	}
+}